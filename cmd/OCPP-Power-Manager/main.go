@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -78,12 +81,12 @@ func main() {
 	ocppServer.Mount(r)
 
 	// Create API instance with OCPP server
-	api := httpapi.New(database, logger, ocppServer)
+	api := httpapi.New(database, logger, ocppServer, cfg)
 
-	// Logs scheduler temporarily disabled
-	// logsScheduler := httpapi.NewLogsScheduler(database, logger)
-	// logsScheduler.Start()
-	// defer logsScheduler.Stop()
+	// Run the scheduled export jobs
+	exportScheduler := httpapi.NewExportScheduler(database, logger)
+	exportScheduler.Start()
+	defer exportScheduler.Stop()
 
 	// API routes
 	r.Route("/api", func(r chi.Router) {
@@ -107,10 +110,31 @@ func main() {
 		}
 	}()
 
+	// Start the TLS server for chargers on security profiles 2 and 3
+	var tlsServer *http.Server
+	if cfg.TLSCertFile != "" {
+		tlsConfig, err := newTLSConfig(cfg)
+		if err != nil {
+			logger.Fatal("Failed to set up TLS", zap.Error(err))
+		}
+		tlsServer = &http.Server{
+			Addr:      cfg.TLSAddr,
+			Handler:   r,
+			TLSConfig: tlsConfig,
+		}
+
+		go func() {
+			logger.Info("🔒 Starting TLS server", zap.String("addr", cfg.TLSAddr), zap.Bool("client_certificates", cfg.TLSClientCAFile != ""))
+			if err := tlsServer.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("TLS server failed", zap.Error(err))
+			}
+		}()
+	}
+
 	// Wait for interrupt signal to gracefully shutdown the server
 	logger.Info("✅ OCPP Power Manager is running! Open http://" + cfg.HTTPAddr + " in your browser")
 	logger.Info("📱 Web interface ready - Manage your EV charging stations")
-	logger.Info("🔌 OCPP server ready - Stations can connect to ws://" + cfg.HTTPAddr + "/ocpp16/{station_id}")
+	logger.Info("🔌 OCPP server ready - Stations can connect to ws://" + cfg.HTTPAddr + "/ocpp16/{station_id}, /ocpp201/{station_id} or /ocpp/{station_id}")
 	logger.Info("⏹️ Press Ctrl+C to stop the server")
 
 	quit := make(chan os.Signal, 1)
@@ -126,6 +150,11 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		logger.Error("Server forced to shutdown", zap.Error(err))
 	}
+	if tlsServer != nil {
+		if err := tlsServer.Shutdown(ctx); err != nil {
+			logger.Error("TLS server forced to shutdown", zap.Error(err))
+		}
+	}
 
 	logger.Info("Server exited")
 }
@@ -138,3 +167,25 @@ func maskDSN(dsn string) string {
 	}
 	return "***"
 }
+
+// newTLSConfig builds the TLS settings of the charger listener
+// OCPP requires TLS 1.2 or newer; client certificates are verified when offered, and profile 3
+// stations are refused without one when they connect
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(cfg.TLSClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", cfg.TLSClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
@@ -3,13 +3,23 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 )
 
 // Config holds the application configuration
 type Config struct {
-	HTTPAddr string
-	DBDriver string
-	DBDSN    string
+	HTTPAddr       string
+	DBDriver       string
+	DBDSN          string
+	PublicURL      string // Base URL chargers reach this server at, used in the download and upload links sent to them
+	FirmwareDir    string // Where uploaded firmware images are stored
+	DiagnosticsDir string // Where diagnostics files uploaded by chargers are stored
+
+	// TLS listener for security profiles 2 and 3; off unless TLSCertFile is set
+	TLSAddr         string
+	TLSCertFile     string // Server certificate chain (PEM)
+	TLSKeyFile      string // Server private key (PEM)
+	TLSClientCAFile string // CAs client certificates must chain to (PEM); needed for profile 3
 }
 
 // Load loads configuration from environment variables with defaults
@@ -19,12 +29,27 @@ func Load() (*Config, error) {
 		DBDriver: getEnv("DB_DRIVER", "sqlite"),
 		DBDSN:    getEnv("DB_DSN", "file:ocpppm.db?_foreign_keys=on"),
 	}
+	cfg.PublicURL = strings.TrimSuffix(getEnv("PUBLIC_URL", "http://"+cfg.HTTPAddr), "/")
+	cfg.FirmwareDir = getEnv("FIRMWARE_DIR", "firmware")
+	cfg.DiagnosticsDir = getEnv("DIAGNOSTICS_DIR", "diagnostics")
+	cfg.TLSAddr = getEnv("TLS_ADDR", ":8443")
+	cfg.TLSCertFile = os.Getenv("TLS_CERT_FILE")
+	cfg.TLSKeyFile = os.Getenv("TLS_KEY_FILE")
+	cfg.TLSClientCAFile = os.Getenv("TLS_CLIENT_CA_FILE")
 
 	// Validate DB driver
 	if cfg.DBDriver != "sqlite" && cfg.DBDriver != "postgres" {
 		return nil, fmt.Errorf("invalid DB_DRIVER: %s, must be 'sqlite' or 'postgres'", cfg.DBDriver)
 	}
 
+	// Validate TLS files
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.TLSClientCAFile != "" && cfg.TLSCertFile == "" {
+		return nil, fmt.Errorf("TLS_CLIENT_CA_FILE needs TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+
 	return cfg, nil
 }
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib" // postgres driver
@@ -44,7 +45,7 @@ func Open(ctx context.Context, driver, dsn string) (*sql.DB, error) {
 
 // openSQLite opens a SQLite database with optimized settings
 func openSQLite(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite", dsn)
+	db, err := sql.Open("sqlite", withSQLitePragmas(dsn))
 	if err != nil {
 		return nil, err
 	}
@@ -68,6 +69,24 @@ func openSQLite(dsn string) (*sql.DB, error) {
 	return db, nil
 }
 
+// withSQLitePragmas adds the busy timeout and foreign keys to the DSN so every pooled connection gets them
+// A PRAGMA run with db.Exec only reaches one connection; writes on the others failed with SQLITE_BUSY
+// instead of waiting whenever the background writers overlapped
+func withSQLitePragmas(dsn string) string {
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	for _, pragma := range []string{"busy_timeout(5000)", "foreign_keys(1)"} {
+		name := pragma[:strings.Index(pragma, "(")]
+		if !strings.Contains(dsn, "_pragma="+name) {
+			dsn += separator + "_pragma=" + pragma
+			separator = "&"
+		}
+	}
+	return dsn
+}
+
 // openPostgres opens a PostgreSQL database using pgx stdlib driver
 func openPostgres(dsn string) (*sql.DB, error) {
 	return sql.Open("pgx", dsn)
@@ -1,17 +1,48 @@
 package httpapi
 
 import (
+	"context"
 	"database/sql"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
 	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/config"
+	"OCPP-Power-Manager/internal/ocpp"
 )
 
-// OCPPServer interface for controlling OCPP server
+// OCPPServer interface for controlling OCPP server and sending commands to chargers
 type OCPPServer interface {
 	Start()
 	Stop()
 	IsRunning() bool
+	IsConnected(chargePointId string) bool
+	Events() *ocpp.EventBus
+	RemoteStartTransaction(ctx context.Context, chargePointId string, request *core.RemoteStartTransactionRequest) (*core.RemoteStartTransactionConfirmation, error)
+	RemoteStopTransaction(ctx context.Context, chargePointId string, request *core.RemoteStopTransactionRequest) (*core.RemoteStopTransactionConfirmation, error)
+	Reset(ctx context.Context, chargePointId string, resetType core.ResetType) (*core.ResetConfirmation, error)
+	UnlockConnector(ctx context.Context, chargePointId string, connectorId int) (*core.UnlockConnectorConfirmation, error)
+	ChangeAvailability(ctx context.Context, chargePointId string, connectorId int, availabilityType core.AvailabilityType) (*core.ChangeAvailabilityConfirmation, error)
+	GetConfiguration(ctx context.Context, chargePointId string, keys []string) (*core.GetConfigurationConfirmation, error)
+	ChangeConfiguration(ctx context.Context, chargePointId, key, value string) (*core.ChangeConfigurationConfirmation, error)
+	SyncLocalList(ctx context.Context, chargePointId string, full bool) (*ocpp.LocalListSyncResult, error)
+	GetLocalListState(ctx context.Context, chargePointId string) (*ocpp.LocalListState, error)
+	SyncAllLocalLists()
+	RebalanceSite(ctx context.Context, siteID int64) ([]ocpp.LoadAllocation, error)
+	ReleaseLoadLimit(ctx context.Context, chargePointId string) error
+	SetChargingProfile(ctx context.Context, chargePointId string, connectorId int, profile *types.ChargingProfile) (*ocpp.SetChargingProfileConfirmation, error)
+	ClearChargingProfile(ctx context.Context, chargePointId string, request *ocpp.ClearChargingProfileRequest) (*ocpp.ClearChargingProfileConfirmation, error)
+	GetCompositeSchedule(ctx context.Context, chargePointId string, request *ocpp.GetCompositeScheduleRequest) (*ocpp.GetCompositeScheduleConfirmation, error)
+	PushTOUSchedule(ctx context.Context, scheduleID int64) ([]ocpp.TOUPushResult, error)
+	ReleaseTOUSchedule(ctx context.Context, chargePointId string) error
+	PriceTransaction(ctx context.Context, transactionRowID int64) (*ocpp.TransactionCost, error)
+	SetValidationMode(chargePointId, mode string)
+	ReserveNow(ctx context.Context, chargePointId string, request *ocpp.ReserveNowRequest) (*ocpp.ReserveNowConfirmation, error)
+	CancelReservation(ctx context.Context, chargePointId string, reservationId int) (*ocpp.CancelReservationConfirmation, error)
+	UpdateFirmware(ctx context.Context, chargePointId string, request *ocpp.UpdateFirmwareRequest) (*ocpp.UpdateFirmwareConfirmation, error)
+	GetDiagnostics(ctx context.Context, chargePointId string, request *ocpp.GetDiagnosticsRequest) (*ocpp.GetDiagnosticsConfirmation, error)
 }
 
 // API holds the API dependencies
@@ -19,14 +50,16 @@ type API struct {
 	db         *sql.DB
 	logger     *zap.Logger
 	ocppServer OCPPServer
+	cfg        *config.Config
 }
 
 // New creates a new API instance
-func New(db *sql.DB, logger *zap.Logger, ocppServer OCPPServer) *API {
+func New(db *sql.DB, logger *zap.Logger, ocppServer OCPPServer, cfg *config.Config) *API {
 	return &API{
 		db:         db,
 		logger:     logger,
 		ocppServer: ocppServer,
+		cfg:        cfg,
 	}
 }
 
@@ -35,12 +68,23 @@ func (a *API) Routes() chi.Router {
 	r := chi.NewRouter()
 
 	// Mount sub-APIs
-	r.Mount("/stations", NewStationsAPI(a.db, a.logger).Routes())
+	r.Mount("/stations", NewStationsAPI(a.db, a.logger, a.ocppServer, a.cfg.DiagnosticsDir, a.cfg.PublicURL).Routes())
 	r.Mount("/seed", NewSeedAPI(a.db, a.logger).Routes())
 	r.Mount("/dev", NewDevAPI(a.db, a.logger).Routes())
 	r.Mount("/settings", NewSettingsAPI(a.db, a.logger, a.ocppServer).Routes())
 	r.Mount("/network", NewNetworkAPI(a.logger).Routes())
 	r.Mount("/logs", NewLogsAPI(a.db, a.logger).Routes())
+	r.Mount("/events", NewEventsAPI(a.logger, a.ocppServer).Routes())
+	r.Mount("/idtags", NewIdTagsAPI(a.db, a.logger, a.ocppServer).Routes())
+	r.Mount("/transactions", NewTransactionsAPI(a.db, a.logger, a.ocppServer).Routes())
+	r.Mount("/sites", NewSitesAPI(a.db, a.logger, a.ocppServer).Routes())
+	r.Mount("/tou-schedules", NewTOUSchedulesAPI(a.db, a.logger, a.ocppServer).Routes())
+	r.Mount("/tariffs", NewTariffsAPI(a.db, a.logger).Routes())
+	r.Mount("/statements", NewStatementsAPI(a.db, a.logger).Routes())
+	r.Mount("/ocpp-log", NewOCPPLogAPI(a.db, a.logger).Routes())
+	r.Mount("/auth-failures", NewAuthFailuresAPI(a.db, a.logger).Routes())
+	r.Mount("/firmware", NewFirmwareAPI(a.db, a.logger, a.ocppServer, a.cfg.FirmwareDir, a.cfg.PublicURL).Routes())
+	r.Mount("/diagnostics", NewDiagnosticsUploadAPI(a.db, a.logger, a.cfg.DiagnosticsDir).Routes())
 
 	return r
 }
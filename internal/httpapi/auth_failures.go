@@ -0,0 +1,153 @@
+package httpapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// AuthFailure is a refused OCPP connection attempt
+type AuthFailure struct {
+	ID              int64     `json:"id"`
+	Station         string    `json:"station"`          // Identity in the URL the charger connected to
+	RemoteAddr      string    `json:"remote_addr"`      // TCP peer address
+	SecurityProfile int       `json:"security_profile"` // Profile the attempt was checked against
+	Reason          string    `json:"reason"`
+	LockedOut       bool      `json:"locked_out"` // This attempt locked the address out
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// AuthFailuresPage is a page of failed connection attempts, newest first
+type AuthFailuresPage struct {
+	Failures   []AuthFailure `json:"failures"`
+	NextCursor *string       `json:"next_cursor"` // Pass as ?cursor= to get older attempts; null on the last page
+}
+
+// AuthFailuresAPI handles the failed connection attempt endpoints
+type AuthFailuresAPI struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewAuthFailuresAPI creates a new failed connection attempts API
+func NewAuthFailuresAPI(db *sql.DB, logger *zap.Logger) *AuthFailuresAPI {
+	return &AuthFailuresAPI{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Routes returns the routes for the failed connection attempts API
+func (api *AuthFailuresAPI) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", api.ListFailures)
+	return r
+}
+
+// ListFailures handles GET /api/auth-failures
+// Filters: station (identity), remote_addr, from/to (RFC3339); paging: limit (default 100, max 1000) and cursor
+func (api *AuthFailuresAPI) ListFailures(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	query := `
+		SELECT id, identity, remote_addr, security_profile, reason, locked_out, ts
+		FROM auth_failures
+		WHERE 1 = 1
+	`
+	var args []interface{}
+
+	if station := params.Get("station"); station != "" {
+		query += " AND identity = ?"
+		args = append(args, station)
+	}
+	if addr := params.Get("remote_addr"); addr != "" {
+		query += " AND remote_addr = ?"
+		args = append(args, addr)
+	}
+
+	for _, bound := range []struct{ param, condition string }{{"from", " AND ts >= ?"}, {"to", " AND ts < ?"}} {
+		value := params.Get(bound.param)
+		if value == "" {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid "+bound.param+" (use RFC3339)", http.StatusBadRequest)
+			return
+		}
+		query += bound.condition
+		args = append(args, ts.UTC())
+	}
+
+	if cursor := params.Get("cursor"); cursor != "" {
+		id, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		query += " AND id < ?"
+		args = append(args, id)
+	}
+
+	limit := 100
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 1000 {
+			http.Error(w, "limit must be 1-1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	// One extra row tells whether there is another page
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := api.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		api.logger.Error("Failed to query authentication failures", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	page := AuthFailuresPage{Failures: []AuthFailure{}}
+	for rows.Next() {
+		var failure AuthFailure
+		err := rows.Scan(
+			&failure.ID,
+			&failure.Station,
+			&failure.RemoteAddr,
+			&failure.SecurityProfile,
+			&failure.Reason,
+			&failure.LockedOut,
+			&failure.Timestamp,
+		)
+		if err != nil {
+			api.logger.Error("Failed to scan authentication failure", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		page.Failures = append(page.Failures, failure)
+	}
+
+	if err = rows.Err(); err != nil {
+		api.logger.Error("Row iteration error", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if len(page.Failures) > limit {
+		page.Failures = page.Failures[:limit]
+		cursor := strconv.FormatInt(page.Failures[limit-1].ID, 10)
+		page.NextCursor = &cursor
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
@@ -0,0 +1,79 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ConnectionSession represents one WebSocket connection of a station
+type ConnectionSession struct {
+	ID              int64      `json:"id"`
+	RemoteIP        *string    `json:"remote_ip"`
+	ConnectedAt     time.Time  `json:"connected_at"`
+	DisconnectedAt  *time.Time `json:"disconnected_at"` // nil while the connection is open
+	CloseCode       *int       `json:"close_code"`
+	CloseReason     *string    `json:"close_reason"`
+	DurationSeconds float64    `json:"duration_seconds"`
+}
+
+// ListConnections handles GET /api/stations/{id}/connections
+func (api *StationsAPI) ListConnections(w http.ResponseWriter, r *http.Request) {
+	_, identity, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	query := `
+		SELECT id, remote_ip, connected_at, disconnected_at, close_code, close_reason
+		FROM charger_connections
+		WHERE identity = ?
+		ORDER BY connected_at DESC
+		LIMIT 200
+	`
+
+	rows, err := api.db.QueryContext(r.Context(), query, identity)
+	if err != nil {
+		api.logger.Error("Failed to query connection sessions", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	sessions := []ConnectionSession{}
+	for rows.Next() {
+		var session ConnectionSession
+		if err := rows.Scan(
+			&session.ID,
+			&session.RemoteIP,
+			&session.ConnectedAt,
+			&session.DisconnectedAt,
+			&session.CloseCode,
+			&session.CloseReason,
+		); err != nil {
+			api.logger.Error("Failed to scan connection session", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// Open sessions last until now
+		end := time.Now()
+		if session.DisconnectedAt != nil {
+			end = *session.DisconnectedAt
+		}
+		session.DurationSeconds = end.Sub(session.ConnectedAt).Seconds()
+
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		api.logger.Error("Row iteration error", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
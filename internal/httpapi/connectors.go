@@ -0,0 +1,155 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Connector represents the last reported status of a station connector
+type Connector struct {
+	ConnectorId     int        `json:"connector_id"`
+	Status          string     `json:"status"` // Available, Preparing, Charging, Faulted, ...
+	ErrorCode       string     `json:"error_code"`
+	Info            *string    `json:"info"`
+	VendorId        *string    `json:"vendor_id"`
+	VendorErrorCode *string    `json:"vendor_error_code"`
+	Timestamp       *time.Time `json:"timestamp"` // When the charger says the status changed
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// ConnectorStatusChange represents one entry of a connector's status history
+type ConnectorStatusChange struct {
+	Status          string     `json:"status"`
+	ErrorCode       string     `json:"error_code"`
+	Info            *string    `json:"info"`
+	VendorId        *string    `json:"vendor_id"`
+	VendorErrorCode *string    `json:"vendor_error_code"`
+	Timestamp       *time.Time `json:"timestamp"`
+	ReceivedAt      time.Time  `json:"received_at"`
+}
+
+// ListConnectors handles GET /api/stations/{id}/connectors
+func (api *StationsAPI) ListConnectors(w http.ResponseWriter, r *http.Request) {
+	id, _, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	connectors, err := api.getConnectors(r.Context(), &id)
+	if err != nil {
+		api.logger.Error("Failed to query connectors", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	result := connectors[id]
+	if result == nil {
+		result = []Connector{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// ConnectorHistory handles GET /api/stations/{id}/connectors/{connectorId}/history
+func (api *StationsAPI) ConnectorHistory(w http.ResponseWriter, r *http.Request) {
+	id, _, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	connectorId, err := strconv.Atoi(chi.URLParam(r, "connectorId"))
+	if err != nil || connectorId < 0 {
+		http.Error(w, "Invalid connector ID", http.StatusBadRequest)
+		return
+	}
+
+	query := `
+		SELECT status, error_code, info, vendor_id, vendor_error_code, status_ts, received_at
+		FROM connector_status_history
+		WHERE charger_id = ? AND connector_id = ?
+		ORDER BY received_at DESC
+		LIMIT 200
+	`
+
+	rows, err := api.db.QueryContext(r.Context(), query, id, connectorId)
+	if err != nil {
+		api.logger.Error("Failed to query connector status history", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	history := []ConnectorStatusChange{}
+	for rows.Next() {
+		var change ConnectorStatusChange
+		if err := rows.Scan(
+			&change.Status,
+			&change.ErrorCode,
+			&change.Info,
+			&change.VendorId,
+			&change.VendorErrorCode,
+			&change.Timestamp,
+			&change.ReceivedAt,
+		); err != nil {
+			api.logger.Error("Failed to scan connector status history", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		history = append(history, change)
+	}
+
+	if err = rows.Err(); err != nil {
+		api.logger.Error("Row iteration error", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// getConnectors fetches connectors grouped by station ID
+// A nil chargerID returns the connectors of every station
+func (api *StationsAPI) getConnectors(ctx context.Context, chargerID *int64) (map[int64][]Connector, error) {
+	query := `
+		SELECT charger_id, connector_id, status, error_code, info, vendor_id, vendor_error_code, status_ts, updated_at
+		FROM connectors
+		WHERE (? IS NULL OR charger_id = ?)
+		ORDER BY charger_id ASC, connector_id ASC
+	`
+
+	rows, err := api.db.QueryContext(ctx, query, chargerID, chargerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	connectors := make(map[int64][]Connector)
+	for rows.Next() {
+		var stationID int64
+		var connector Connector
+		if err := rows.Scan(
+			&stationID,
+			&connector.ConnectorId,
+			&connector.Status,
+			&connector.ErrorCode,
+			&connector.Info,
+			&connector.VendorId,
+			&connector.VendorErrorCode,
+			&connector.Timestamp,
+			&connector.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		connectors[stationID] = append(connectors[stationID], connector)
+	}
+
+	return connectors, rows.Err()
+}
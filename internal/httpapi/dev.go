@@ -3,6 +3,7 @@ package httpapi
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -83,7 +84,8 @@ func (api *DevAPI) SimulateMeterValues(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create a fake transaction for this meter value
-	txID := int(time.Now().Unix())
+	// tx_id is unique, so use a dev-only ID that cannot clash with charger transactions
+	txID := fmt.Sprintf("dev-%d", time.Now().UnixNano())
 	insertTxQuery := `
 		INSERT INTO transactions (charger_id, tx_id, start_ts, start_meter_wh)
 		VALUES (?, ?, ?, ?)
@@ -111,11 +113,12 @@ func (api *DevAPI) SimulateMeterValues(w http.ResponseWriter, r *http.Request) {
 
 	// Insert meter value
 	insertMeterQuery := `
-		INSERT INTO meter_values (transaction_id, ts, measurand, value)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO meter_values (charger_id, transaction_id, ts, measurand, unit, value)
+		VALUES (?, ?, ?, ?, 'Wh', ?)
 	`
 
 	_, err = api.db.ExecContext(r.Context(), insertMeterQuery,
+		chargerID,
 		transactionID,
 		timestamp,
 		"Energy.Active.Import.Register",
@@ -0,0 +1,265 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/pdf"
+)
+
+// Kinds of billing documents; each kind has its own number sequence per year
+const (
+	documentKindReceipt   = "receipt"
+	documentKindStatement = "statement"
+)
+
+// documentNumberPrefixes start the numbers of each kind, e.g. R2026-000042
+var documentNumberPrefixes = map[string]string{
+	documentKindReceipt:   "R",
+	documentKindStatement: "S",
+}
+
+// issueDocumentNumber returns the number of the document for a reference, giving it the next number of
+// its kind and year the first time. Numbers have no gaps and never change once issued
+func issueDocumentNumber(ctx context.Context, db *sql.DB, kind, reference string, now time.Time) (string, time.Time, error) {
+	// A single statement, so concurrent requests cannot take the same number
+	query := `
+		INSERT INTO billing_documents (kind, reference, year, seq, issued_at)
+		SELECT ?, ?, ?, COALESCE(MAX(seq), 0) + 1, ?
+		FROM billing_documents WHERE kind = ? AND year = ?
+		ON CONFLICT(kind, reference) DO NOTHING
+	`
+	_, err := db.ExecContext(ctx, query, kind, reference, now.Year(), now, kind, now.Year())
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to issue document number: %w", err)
+	}
+
+	var year, seq int
+	var issuedAt time.Time
+	err = db.QueryRowContext(ctx,
+		`SELECT year, seq, issued_at FROM billing_documents WHERE kind = ? AND reference = ?`,
+		kind, reference).Scan(&year, &seq, &issuedAt)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to read document number: %w", err)
+	}
+
+	return fmt.Sprintf("%s%d-%06d", documentNumberPrefixes[kind], year, seq), issuedAt, nil
+}
+
+// documentView is a receipt or statement laid out for printing
+// The first RightFrom columns are text, the rest are numbers aligned to the right
+type documentView struct {
+	Title     string
+	Number    string
+	Date      string
+	Seller    []string    // Name first, then the other details
+	Details   [][2]string // Label and value
+	Columns   []string
+	Widths    []float64 // Relative column widths
+	RightFrom int
+	Rows      [][]string
+	Totals    [][2]string // Label and value; the last one is the grand total
+	Note      string
+}
+
+// sellerLines returns the seller details as printed lines
+func sellerLines(seller *Seller) []string {
+	var lines []string
+	if seller.Name != "" {
+		lines = append(lines, seller.Name)
+	}
+	for _, line := range strings.Split(seller.Address, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if seller.VATNumber != "" {
+		lines = append(lines, "VAT "+seller.VATNumber)
+	}
+	if seller.Email != "" {
+		lines = append(lines, seller.Email)
+	}
+	return lines
+}
+
+// formatAmount formats an amount of money with its currency
+func formatAmount(amount float64, currency string) string {
+	return fmt.Sprintf("%s %.2f", currency, amount)
+}
+
+// formatUnitPrice formats a price per unit with at least two decimals, keeping finer prices such as 0.345 per kWh
+func formatUnitPrice(price float64) string {
+	formatted := strconv.FormatFloat(price, 'f', -1, 64)
+	if dot := strings.IndexByte(formatted, '.'); dot < 0 || len(formatted)-dot-1 < 2 {
+		return fmt.Sprintf("%.2f", price)
+	}
+	return formatted
+}
+
+// writeDocument sends a document as pdf (the default), html or json
+// body is what the json format returns
+func writeDocument(w http.ResponseWriter, r *http.Request, logger *zap.Logger, view *documentView, filename string, body interface{}) {
+	switch r.URL.Query().Get("format") {
+	case "", "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, filename))
+		if _, err := view.pdf().WriteTo(w); err != nil {
+			logger.Error("Failed to write PDF document", zap.Error(err))
+		}
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := documentTemplate.Execute(w, view); err != nil {
+			logger.Error("Failed to render HTML document", zap.Error(err))
+		}
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	default:
+		http.Error(w, "format must be pdf, html or json", http.StatusBadRequest)
+	}
+}
+
+// Layout of the PDF documents in points
+const (
+	pdfMargin      = 50.0
+	pdfRowHeight   = 15.0
+	pdfFontSize    = 9.0
+	pdfBottomLimit = pdf.PageHeight - 70
+)
+
+// pdf lays out the document on A4 pages, repeating the table header on every page
+func (view *documentView) pdf() *pdf.Document {
+	doc := pdf.New()
+	doc.AddPage()
+	right := pdf.PageWidth - pdfMargin
+
+	doc.Text(pdfMargin, 70, 20, true, view.Title)
+	if view.Number != "" {
+		doc.TextRight(right, 60, pdfFontSize, true, "No. "+view.Number)
+	}
+	doc.TextRight(right, 75, pdfFontSize, false, view.Date)
+
+	y := 105.0
+	for i, line := range view.Seller {
+		if i == 0 {
+			doc.Text(pdfMargin, y, 11, true, line)
+		} else {
+			doc.Text(pdfMargin, y, pdfFontSize, false, line)
+		}
+		y += 13
+	}
+
+	y += 15
+	for _, detail := range view.Details {
+		doc.Text(pdfMargin, y, pdfFontSize, true, detail[0])
+		doc.Text(pdfMargin+100, y, pdfFontSize, false, pdf.Truncate(detail[1], right-pdfMargin-100, pdfFontSize, false))
+		y += 13
+	}
+
+	// Column edges across the width between the margins
+	var total float64
+	for _, width := range view.Widths {
+		total += width
+	}
+	edges := []float64{pdfMargin}
+	for _, width := range view.Widths {
+		edges = append(edges, edges[len(edges)-1]+width/total*(right-pdfMargin))
+	}
+
+	row := func(cells []string, bold bool) {
+		for i, cell := range cells {
+			if i < view.RightFrom {
+				doc.Text(edges[i], y, pdfFontSize, bold, pdf.Truncate(cell, edges[i+1]-edges[i]-6, pdfFontSize, bold))
+			} else {
+				doc.TextRight(edges[i+1], y, pdfFontSize, bold, cell)
+			}
+		}
+	}
+	header := func() {
+		row(view.Columns, true)
+		doc.Line(pdfMargin, y+4, right, y+4)
+		y += pdfRowHeight + 2
+	}
+
+	y += 20
+	header()
+	for _, cells := range view.Rows {
+		if y > pdfBottomLimit {
+			doc.AddPage()
+			y = 60
+			header()
+		}
+		row(cells, false)
+		y += pdfRowHeight
+	}
+
+	if y+float64(len(view.Totals))*pdfRowHeight > pdfBottomLimit {
+		doc.AddPage()
+		y = 60
+	}
+	doc.Line(pdfMargin, y-10, right, y-10)
+	y += 5
+	for i, line := range view.Totals {
+		bold := i == len(view.Totals)-1
+		doc.TextRight(edges[len(edges)-2]-10, y, pdfFontSize, bold, line[0])
+		doc.TextRight(right, y, pdfFontSize, bold, line[1])
+		y += pdfRowHeight
+	}
+
+	if view.Note != "" {
+		doc.Text(pdfMargin, y+20, 8, false, view.Note)
+	}
+
+	return doc
+}
+
+// documentTemplate renders a documentView as a printable HTML page
+var documentTemplate = template.Must(template.New("document").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}{{if .Number}} {{.Number}}{{end}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; font-size: 13px; color: #222; max-width: 800px; margin: 40px auto; }
+header { display: flex; justify-content: space-between; align-items: flex-start; }
+h1 { margin: 0; font-size: 28px; }
+.meta { text-align: right; }
+.seller { margin: 24px 0; line-height: 1.5; }
+.seller div:first-child { font-weight: bold; font-size: 15px; }
+.details th { text-align: left; padding-right: 24px; }
+table.lines { width: 100%; border-collapse: collapse; margin-top: 24px; }
+table.lines th { border-bottom: 1px solid #222; text-align: left; }
+table.lines th, table.lines td { padding: 4px 6px; }
+table.lines .num { text-align: right; white-space: nowrap; }
+table.lines tfoot tr:first-child td { border-top: 1px solid #222; }
+table.lines tfoot tr:last-child td { font-weight: bold; }
+.note { margin-top: 24px; font-size: 11px; color: #555; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Title}}</h1>
+<div class="meta">{{if .Number}}<div><strong>No. {{.Number}}</strong></div>{{end}}<div>{{.Date}}</div></div>
+</header>
+<div class="seller">{{range .Seller}}<div>{{.}}</div>{{end}}</div>
+<table class="details">{{range .Details}}<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>{{end}}</table>
+<table class="lines">
+<thead><tr>{{range $i, $column := .Columns}}<th{{if ge $i $.RightFrom}} class="num"{{end}}>{{$column}}</th>{{end}}</tr></thead>
+<tbody>{{range .Rows}}<tr>{{range $i, $cell := .}}<td{{if ge $i $.RightFrom}} class="num"{{end}}>{{$cell}}</td>{{end}}</tr>
+{{end}}</tbody>
+<tfoot>{{$span := len .Columns}}{{range .Totals}}<tr><td colspan="{{$span}}" class="num">{{index . 0}}&nbsp;&nbsp;&nbsp;{{index . 1}}</td></tr>
+{{end}}</tfoot>
+</table>
+{{if .Note}}<p class="note">{{.Note}}</p>{{end}}
+</body>
+</html>
+`))
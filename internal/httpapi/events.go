@@ -0,0 +1,136 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/ocpp"
+)
+
+// sseKeepAliveInterval is how often a comment is sent to keep idle connections open
+const sseKeepAliveInterval = 15 * time.Second
+
+// EventsAPI streams live charger events to the dashboard using Server-Sent Events
+type EventsAPI struct {
+	logger     *zap.Logger
+	ocppServer OCPPServer
+}
+
+// NewEventsAPI creates a new events API
+func NewEventsAPI(logger *zap.Logger, ocppServer OCPPServer) *EventsAPI {
+	return &EventsAPI{
+		logger:     logger,
+		ocppServer: ocppServer,
+	}
+}
+
+// Routes returns the routes for the events API
+func (api *EventsAPI) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", api.StreamEvents)
+	return r
+}
+
+// StreamEvents handles GET /api/events
+// Optional ?station=CP-001,CP-002 limits the stream to the given OCPP identities
+// A Last-Event-ID header (or ?last_event_id=) replays buffered events missed since that ID
+func (api *EventsAPI) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Build the station filter
+	stations := make(map[string]bool)
+	if param := r.URL.Query().Get("station"); param != "" {
+		for _, identity := range strings.Split(param, ",") {
+			if identity = strings.TrimSpace(identity); identity != "" {
+				stations[identity] = true
+			}
+		}
+	}
+
+	// EventSource sends Last-Event-ID automatically when it reconnects
+	lastEventIDStr := r.Header.Get("Last-Event-ID")
+	if lastEventIDStr == "" {
+		lastEventIDStr = r.URL.Query().Get("last_event_id")
+	}
+	var lastEventID uint64
+	if lastEventIDStr != "" {
+		var err error
+		lastEventID, err = strconv.ParseUint(lastEventIDStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	replay, events, cancel := api.ocppServer.Events().Subscribe(lastEventID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	api.logger.Info("Event stream opened",
+		zap.Int("station_filter", len(stations)),
+		zap.Uint64("last_event_id", lastEventID),
+		zap.Int("replayed", len(replay)))
+
+	// send writes one event in SSE format, skipping events for other stations
+	send := func(event ocpp.Event) error {
+		if len(stations) > 0 && !stations[event.ChargePointId] {
+			return nil
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	for _, event := range replay {
+		if err := send(event); err != nil {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			api.logger.Info("Event stream closed by client")
+			return
+		case event, ok := <-events:
+			if !ok {
+				// We fell too far behind; the client reconnects and resumes with Last-Event-ID
+				api.logger.Warn("Event stream dropped slow subscriber")
+				return
+			}
+			if err := send(event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// exportSchedulerInterval is how often the scheduler looks for due export jobs
+const exportSchedulerInterval = 15 * time.Second
+
+// ExportScheduler runs the enabled export jobs when they are due
+type ExportScheduler struct {
+	db     *sql.DB
+	logger *zap.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewExportScheduler creates a new export scheduler
+func NewExportScheduler(db *sql.DB, logger *zap.Logger) *ExportScheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &ExportScheduler{
+		db:     db,
+		logger: logger,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start begins the background scheduler
+func (s *ExportScheduler) Start() {
+	s.logger.Info("Starting export scheduler")
+
+	// Runs still marked running were cut off by a restart; without this the job could never run again
+	result, err := s.db.Exec(
+		`UPDATE export_runs SET status = ?, error = ?, finished_at = ? WHERE status = ?`,
+		exportRunFailed, "interrupted by a restart", time.Now().UTC(), exportRunRunning,
+	)
+	if err != nil {
+		s.logger.Error("Failed to close interrupted export runs", zap.Error(err))
+	} else if n, _ := result.RowsAffected(); n > 0 {
+		s.logger.Warn("Marked interrupted export runs as failed", zap.Int64("runs", n))
+	}
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				s.logger.Error("Scheduler panic recovered", zap.Any("panic", r))
+			}
+		}()
+		s.run()
+	}()
+}
+
+// Stop stops the background scheduler
+func (s *ExportScheduler) Stop() {
+	s.logger.Info("Stopping export scheduler")
+	s.cancel()
+}
+
+// run is the main scheduler loop
+func (s *ExportScheduler) run() {
+	ticker := time.NewTicker(exportSchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			s.logger.Info("Export scheduler stopped")
+			return
+		case <-ticker.C:
+			s.runDueJobs()
+		}
+	}
+}
+
+// runDueJobs runs each enabled job whose interval has passed since its last run, one after the other
+func (s *ExportScheduler) runDueJobs() {
+	rows, err := s.db.QueryContext(s.ctx, `SELECT id, frequency, frequency_value, last_run_at FROM export_jobs WHERE enabled = 1`)
+	if err != nil {
+		s.logger.Error("Failed to query export jobs", zap.Error(err))
+		return
+	}
+
+	var due []int64
+	now := time.Now().UTC()
+	for rows.Next() {
+		var job ExportJob
+		if err := rows.Scan(&job.ID, &job.Frequency, &job.FrequencyValue, &job.LastRunAt); err != nil {
+			s.logger.Error("Failed to scan export job", zap.Error(err))
+			continue
+		}
+		if job.LastRunAt == nil || !now.Before(job.LastRunAt.Add(job.interval())) {
+			due = append(due, job.ID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error("Row iteration error", zap.Error(err))
+	}
+	rows.Close()
+
+	for _, id := range due {
+		if s.ctx.Err() != nil {
+			return
+		}
+		if _, err := runExportJob(s.ctx, s.db, s.logger, id, "schedule"); err != nil && err != errExportRunning {
+			s.logger.Error("Failed to run export job", zap.Int64("job_id", id), zap.Error(err))
+		}
+	}
+}
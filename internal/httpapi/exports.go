@@ -0,0 +1,542 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/xlsx"
+)
+
+// Windows of an export job
+const (
+	exportWindowSinceLastRun = "since_last_run"
+	exportWindowFull         = "full"
+)
+
+// Statuses of an export run
+const (
+	exportRunRunning = "running"
+	exportRunSuccess = "success"
+	exportRunFailed  = "failed"
+)
+
+// errExportRunning is returned when a job is started while it is still running
+var errExportRunning = errors.New("the export job is already running")
+
+// exportDataset is a table export jobs can write out
+type exportDataset struct {
+	query      string // Without WHERE and ORDER BY
+	timeColumn string // Column the window applies to; empty for a snapshot of the current state
+	orderBy    string
+}
+
+// exportDatasets are the datasets by name
+var exportDatasets = map[string]exportDataset{
+	"stations": {
+		query: `
+			SELECT c.id, c.identity, c.name, c.vendor, c.model, c.firmware, c.max_output_kw,
+				c.total_energy_wh, c.site_id, c.last_seen
+			FROM chargers c`,
+		orderBy: "c.id",
+	},
+	// Completed sessions, in the window they stopped in, with their cost once priced
+	"sessions": {
+		query: `
+			SELECT t.id, t.tx_id AS transaction_id, c.id AS station_id, c.identity AS station_identity,
+				t.connector_id, t.id_tag, t.start_ts, t.stop_ts, t.start_meter_wh, t.stop_meter_wh, t.energy_wh,
+				tc.currency, tc.subtotal, tc.vat_amount, tc.total
+			FROM transactions t
+			JOIN chargers c ON c.id = t.charger_id
+			LEFT JOIN transaction_costs tc ON tc.transaction_id = t.id`,
+		timeColumn: "t.stop_ts",
+		orderBy:    "t.stop_ts, t.id",
+	},
+	"meter_values": {
+		query: `
+			SELECT mv.id, c.identity AS station_identity, mv.connector_id, t.tx_id AS transaction_id, mv.ts,
+				mv.measurand, mv.phase, mv.unit, mv.context, mv.location, mv.format, mv.value
+			FROM meter_values mv
+			JOIN chargers c ON c.id = mv.charger_id
+			LEFT JOIN transactions t ON t.id = mv.transaction_id`,
+		timeColumn: "mv.ts",
+		orderBy:    "mv.ts, mv.id",
+	},
+	"status_history": {
+		query: `
+			SELECT h.id, c.identity AS station_identity, h.connector_id, h.status, h.error_code, h.info,
+				h.vendor_id, h.vendor_error_code, h.status_ts, h.received_at
+			FROM connector_status_history h
+			JOIN chargers c ON c.id = h.charger_id`,
+		timeColumn: "h.received_at",
+		orderBy:    "h.received_at, h.id",
+	},
+	// Every frame exchanged with the chargers, from the OCPP message journal
+	"ocpp_messages": {
+		query: `
+			SELECT om.id, om.identity AS station_identity, om.direction, om.message_type, om.message_id,
+				om.action, om.error_code, om.latency_ms, om.ts, om.payload
+			FROM ocpp_messages om`,
+		timeColumn: "om.ts",
+		orderBy:    "om.ts, om.id",
+	},
+}
+
+// exportFormats maps the formats to their file extension and content type
+var exportFormats = map[string][2]string{
+	"csv":   {"csv", "text/csv"},
+	"jsonl": {"jsonl", "application/x-ndjson"},
+	"xlsx":  {"xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+}
+
+// exportWriter writes the rows of a dataset in one format
+type exportWriter interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// csvExportWriter writes a header row and then the values as text
+type csvExportWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvExportWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+		case time.Time:
+			record[i] = v.UTC().Format(time.RFC3339)
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return w.writer.Write(record)
+}
+
+func (w *csvExportWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// jsonlExportWriter writes one JSON object per row keyed by column
+type jsonlExportWriter struct {
+	encoder *json.Encoder
+	columns []string
+}
+
+func (w *jsonlExportWriter) WriteRow(values []interface{}) error {
+	row := make(map[string]interface{}, len(values))
+	for i, value := range values {
+		row[w.columns[i]] = value
+	}
+	return w.encoder.Encode(row)
+}
+
+func (w *jsonlExportWriter) Close() error {
+	return nil
+}
+
+// newExportWriter starts writing a dataset; CSV and XLSX get a header row
+func newExportWriter(w io.Writer, format, dataset string, columns []string) (exportWriter, error) {
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column
+	}
+
+	switch format {
+	case "csv":
+		writer := &csvExportWriter{writer: csv.NewWriter(w)}
+		return writer, writer.WriteRow(header)
+	case "jsonl":
+		return &jsonlExportWriter{encoder: json.NewEncoder(w), columns: columns}, nil
+	case "xlsx":
+		writer, err := xlsx.NewWriter(w, dataset)
+		if err != nil {
+			return nil, err
+		}
+		return writer, writer.WriteRow(header)
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// writeExport writes the rows of a dataset between from and to (from nil for everything before to)
+// Snapshot datasets ignore the window. It returns the number of rows written
+func writeExport(ctx context.Context, db *sql.DB, w io.Writer, datasetName, format string, from *time.Time, to time.Time) (int, error) {
+	dataset, ok := exportDatasets[datasetName]
+	if !ok {
+		return 0, fmt.Errorf("unknown dataset %q", datasetName)
+	}
+
+	query := dataset.query
+	var args []interface{}
+	if dataset.timeColumn != "" {
+		query += fmt.Sprintf(" WHERE %s < ?", dataset.timeColumn)
+		args = append(args, to.UTC())
+		if from != nil {
+			query += fmt.Sprintf(" AND %s >= ?", dataset.timeColumn)
+			args = append(args, from.UTC())
+		}
+	}
+	query += " ORDER BY " + dataset.orderBy
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query %s: %w", datasetName, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	writer, err := newExportWriter(w, format, datasetName, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return count, fmt.Errorf("failed to scan %s row: %w", datasetName, err)
+		}
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		if err := writer.WriteRow(values); err != nil {
+			return count, fmt.Errorf("failed to write %s row: %w", datasetName, err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+
+	return count, writer.Close()
+}
+
+// ExportJob is a named, scheduled export of a dataset to files
+type ExportJob struct {
+	ID             int64      `json:"id"`
+	Name           string     `json:"name"`
+	Dataset        string     `json:"dataset"` // stations, sessions, meter_values, status_history or ocpp_messages
+	Format         string     `json:"format"`  // csv, jsonl or xlsx
+	Directory      string     `json:"directory"`
+	Frequency      string     `json:"frequency"` // minutes, hours or days
+	FrequencyValue int        `json:"frequency_value"`
+	Window         string     `json:"window"`     // since_last_run or full
+	KeepFiles      int        `json:"keep_files"` // Newest files kept, 0 for all
+	KeepDays       int        `json:"keep_days"`  // Days files are kept, 0 for ever
+	Enabled        bool       `json:"enabled"`
+	LastRunAt      *time.Time `json:"last_run_at"`
+	NextRunAt      *time.Time `json:"next_run_at"` // Null while disabled
+	LastRun        *ExportRun `json:"last_run"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// ExportRun is one run of an export job
+type ExportRun struct {
+	ID            int64      `json:"id"`
+	JobID         int64      `json:"job_id"`
+	JobName       string     `json:"job_name"`
+	TriggeredBy   string     `json:"triggered_by"` // schedule or manual
+	Status        string     `json:"status"`       // running, success or failed
+	WindowStart   *time.Time `json:"window_start"` // Null when the run exported everything before window_end
+	WindowEnd     time.Time  `json:"window_end"`
+	Rows          *int       `json:"rows"`
+	File          *string    `json:"file"`
+	Bytes         *int64     `json:"bytes"`
+	Error         *string    `json:"error"`
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+	FileDeletedAt *time.Time `json:"file_deleted_at"` // Set when retention removed the file
+}
+
+// interval returns the time between the job's runs
+func (job *ExportJob) interval() time.Duration {
+	unit := time.Hour
+	switch job.Frequency {
+	case "minutes":
+		unit = time.Minute
+	case "days":
+		unit = 24 * time.Hour
+	}
+	return time.Duration(job.FrequencyValue) * unit
+}
+
+// exportJobSelect selects a job with its latest run
+const exportJobSelect = `
+	SELECT j.id, j.name, j.dataset, j.format, j.directory, j.frequency, j.frequency_value, j.window_mode,
+		j.keep_files, j.keep_days, j.enabled, j.last_run_at, j.created_at, j.updated_at,
+		(SELECT MAX(id) FROM export_runs WHERE job_id = j.id)
+	FROM export_jobs j
+`
+
+// exportRunSelect selects a run with its job's name
+const exportRunSelect = `
+	SELECT r.id, r.job_id, j.name, r.triggered_by, r.status, r.window_start, r.window_end, r.row_count,
+		r.file_path, r.bytes, r.error, r.started_at, r.finished_at, r.file_deleted_at
+	FROM export_runs r
+	JOIN export_jobs j ON j.id = r.job_id
+`
+
+// scanExportRun reads an exportRunSelect row
+func scanExportRun(row interface{ Scan(...interface{}) error }) (*ExportRun, error) {
+	var run ExportRun
+	err := row.Scan(
+		&run.ID,
+		&run.JobID,
+		&run.JobName,
+		&run.TriggeredBy,
+		&run.Status,
+		&run.WindowStart,
+		&run.WindowEnd,
+		&run.Rows,
+		&run.File,
+		&run.Bytes,
+		&run.Error,
+		&run.StartedAt,
+		&run.FinishedAt,
+		&run.FileDeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// getExportJob fetches a job with its latest run and next run time
+func getExportJob(ctx context.Context, db *sql.DB, id int64) (*ExportJob, error) {
+	var job ExportJob
+	var lastRunID sql.NullInt64
+	err := db.QueryRowContext(ctx, exportJobSelect+" WHERE j.id = ?", id).Scan(
+		&job.ID,
+		&job.Name,
+		&job.Dataset,
+		&job.Format,
+		&job.Directory,
+		&job.Frequency,
+		&job.FrequencyValue,
+		&job.Window,
+		&job.KeepFiles,
+		&job.KeepDays,
+		&job.Enabled,
+		&job.LastRunAt,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&lastRunID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.Enabled {
+		next := time.Now().UTC()
+		if job.LastRunAt != nil {
+			next = job.LastRunAt.Add(job.interval())
+		}
+		job.NextRunAt = &next
+	}
+
+	if lastRunID.Valid {
+		job.LastRun, err = scanExportRun(db.QueryRowContext(ctx, exportRunSelect+" WHERE r.id = ?", lastRunID.Int64))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &job, nil
+}
+
+// exportFileSlug turns a job name into a file name prefix
+var exportFileSlug = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// runExportJob runs a job now and records the run; a failed run is recorded too and returned without error.
+// The window starts where the last successful run ended, so a failed run's rows go out with the next run
+func runExportJob(ctx context.Context, db *sql.DB, logger *zap.Logger, jobID int64, triggeredBy string) (*ExportRun, error) {
+	job, err := getExportJob(ctx, db, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var windowStart *time.Time
+	if job.Window == exportWindowSinceLastRun {
+		// Not MAX(window_end): SQLite returns aggregates as text, which does not scan into a time
+		var lastEnd time.Time
+		query := `SELECT window_end FROM export_runs WHERE job_id = ? AND status = ? ORDER BY window_end DESC LIMIT 1`
+		err := db.QueryRowContext(ctx, query, jobID, exportRunSuccess).Scan(&lastEnd)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to find the previous run: %w", err)
+		}
+		if err == nil {
+			windowStart = &lastEnd
+		}
+	}
+
+	// Claiming the run in one statement keeps the scheduler and a manual run from running a job twice at once
+	claim := `
+		INSERT INTO export_runs (job_id, triggered_by, status, window_start, window_end, started_at)
+		SELECT ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM export_runs WHERE job_id = ? AND status = ?)
+	`
+	result, err := db.ExecContext(ctx, claim, jobID, triggeredBy, exportRunRunning, windowStart, now, now, jobID, exportRunRunning)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start export run: %w", err)
+	}
+	if claimed, _ := result.RowsAffected(); claimed == 0 {
+		return nil, errExportRunning
+	}
+	runID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.ExecContext(ctx, `UPDATE export_jobs SET last_run_at = ? WHERE id = ?`, now, jobID); err != nil {
+		logger.Error("Failed to update export job last run", zap.Int64("job_id", jobID), zap.Error(err))
+	}
+
+	// The run finishes even if the request that started it goes away
+	runCtx := context.Background()
+
+	extension := exportFormats[job.Format][0]
+	filename := fmt.Sprintf("%s_%s_%d.%s",
+		strings.Trim(strings.ToLower(exportFileSlug.ReplaceAllString(job.Name, "-")), "-"),
+		now.Format("2006-01-02_15-04-05"), runID, extension)
+	path := filepath.Join(job.Directory, filename)
+
+	count, size, runErr := writeExportFile(runCtx, db, path, job.Dataset, job.Format, windowStart, now)
+
+	status, errorText := exportRunSuccess, sql.NullString{}
+	var filePath sql.NullString
+	if runErr != nil {
+		status = exportRunFailed
+		errorText = sql.NullString{String: runErr.Error(), Valid: true}
+		logger.Error("Export run failed", zap.String("job", job.Name), zap.Int64("run_id", runID), zap.Error(runErr))
+	} else {
+		filePath = sql.NullString{String: path, Valid: true}
+		logger.Info("Export run completed", zap.String("job", job.Name), zap.String("file", path), zap.Int("rows", count))
+	}
+
+	update := `
+		UPDATE export_runs SET status = ?, row_count = ?, file_path = ?, bytes = ?, error = ?, finished_at = ?
+		WHERE id = ?
+	`
+	if _, err := db.ExecContext(runCtx, update, status, count, filePath, size, errorText, time.Now().UTC(), runID); err != nil {
+		return nil, fmt.Errorf("failed to record export run: %w", err)
+	}
+
+	if runErr == nil {
+		applyExportRetention(runCtx, db, logger, job)
+	}
+
+	return scanExportRun(db.QueryRowContext(runCtx, exportRunSelect+" WHERE r.id = ?", runID))
+}
+
+// writeExportFile writes an export next to its final path and moves it there once complete,
+// so other programs picking up files from the directory never see a partial file
+func writeExportFile(ctx context.Context, db *sql.DB, path, dataset, format string, from *time.Time, to time.Time) (int, int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, 0, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	partial := path + ".partial"
+	file, err := os.Create(partial)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create file: %w", err)
+	}
+
+	count, err := writeExport(ctx, db, file, dataset, format, from, to)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partial)
+		return count, 0, err
+	}
+
+	if err := os.Rename(partial, path); err != nil {
+		os.Remove(partial)
+		return count, 0, fmt.Errorf("failed to move file into place: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return count, 0, err
+	}
+	return count, info.Size(), nil
+}
+
+// applyExportRetention deletes the job's files beyond its newest keep_files and older than keep_days
+// Only files the job's own runs wrote are touched, never anything else in the directory
+func applyExportRetention(ctx context.Context, db *sql.DB, logger *zap.Logger, job *ExportJob) {
+	if job.KeepFiles <= 0 && job.KeepDays <= 0 {
+		return
+	}
+
+	query := `
+		SELECT id, file_path, started_at FROM export_runs
+		WHERE job_id = ? AND status = ? AND file_path IS NOT NULL AND file_deleted_at IS NULL
+		ORDER BY started_at DESC, id DESC
+	`
+	rows, err := db.QueryContext(ctx, query, job.ID, exportRunSuccess)
+	if err != nil {
+		logger.Error("Failed to query export files", zap.Int64("job_id", job.ID), zap.Error(err))
+		return
+	}
+
+	type exportFile struct {
+		runID     int64
+		path      string
+		startedAt time.Time
+	}
+	var expired []exportFile
+	cutoff := time.Now().UTC().AddDate(0, 0, -job.KeepDays)
+	for kept := 0; rows.Next(); {
+		var file exportFile
+		if err := rows.Scan(&file.runID, &file.path, &file.startedAt); err != nil {
+			logger.Error("Failed to scan export file", zap.Error(err))
+			break
+		}
+		if (job.KeepFiles > 0 && kept >= job.KeepFiles) || (job.KeepDays > 0 && file.startedAt.Before(cutoff)) {
+			expired = append(expired, file)
+			continue
+		}
+		kept++
+	}
+	rows.Close()
+
+	for _, file := range expired {
+		if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+			logger.Warn("Failed to delete old export file", zap.String("file", file.path), zap.Error(err))
+			continue
+		}
+		if _, err := db.ExecContext(ctx, `UPDATE export_runs SET file_deleted_at = ? WHERE id = ?`, time.Now().UTC(), file.runID); err != nil {
+			logger.Error("Failed to record deleted export file", zap.Int64("run_id", file.runID), zap.Error(err))
+		}
+		logger.Info("Deleted old export file", zap.String("job", job.Name), zap.String("file", file.path))
+	}
+}
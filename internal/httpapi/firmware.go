@@ -0,0 +1,751 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/ocpp"
+)
+
+// maxFirmwareSize is the largest firmware image that can be uploaded
+const maxFirmwareSize = 1 << 30
+
+// unsafeFilenameChars are replaced in uploaded file names, which end up in the download URL
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// FirmwareFile is a firmware image in the repository
+type FirmwareFile struct {
+	ID          int64     `json:"id"`
+	Filename    string    `json:"filename"`
+	Version     string    `json:"version"` // Compared with the firmwareVersion of BootNotification
+	Vendor      *string   `json:"vendor"`
+	Model       *string   `json:"model"`
+	Notes       *string   `json:"notes"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	MD5         string    `json:"md5"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+	DownloadURL string    `json:"download_url"` // The location sent to chargers
+
+	storedName string
+}
+
+// FirmwareUpdate is the rollout of a firmware image to one charger
+type FirmwareUpdate struct {
+	ID               int64      `json:"id"`
+	FirmwareID       int64      `json:"firmware_id"`
+	FirmwareVersion  string     `json:"firmware_version"`
+	StationID        int64      `json:"station_id"`
+	Station          string     `json:"station"` // Identity of the charger
+	Location         string     `json:"location"`
+	RetrieveDate     time.Time  `json:"retrieve_date"`
+	Retries          *int       `json:"retries"`
+	RetryInterval    *int       `json:"retry_interval"`
+	Status           string     `json:"status"` // requested, failed, or the last FirmwareStatusNotification
+	Error            *string    `json:"error"`
+	PreviousFirmware *string    `json:"previous_firmware"` // What the charger ran when the update was sent
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	CompletedAt      *time.Time `json:"completed_at"`
+}
+
+// FirmwareRolloutRequest represents the request to send a firmware image to chargers
+type FirmwareRolloutRequest struct {
+	StationIDs    []int64    `json:"station_ids"`
+	RetrieveDate  *time.Time `json:"retrieve_date"`  // Not before this time; defaults to now
+	Retries       *int       `json:"retries"`        // How often the charger retries a failed download
+	RetryInterval *int       `json:"retry_interval"` // Seconds between retries
+}
+
+// firmwareFileSelect selects firmware images
+const firmwareFileSelect = `
+	SELECT id, filename, stored_name, version, vendor, model, notes, size, sha256, md5, uploaded_at
+	FROM firmware_files
+`
+
+// firmwareUpdateSelect selects firmware updates with their firmware version and charger
+const firmwareUpdateSelect = `
+	SELECT u.id, u.firmware_id, f.version, u.charger_id, c.identity, u.location, u.retrieve_date, u.retries,
+		u.retry_interval, u.status, u.error, u.previous_firmware, u.created_at, u.updated_at, u.completed_at
+	FROM firmware_updates u
+	JOIN firmware_files f ON f.id = u.firmware_id
+	JOIN chargers c ON c.id = u.charger_id
+`
+
+// FirmwareAPI handles the firmware repository and firmware rollouts
+type FirmwareAPI struct {
+	db         *sql.DB
+	logger     *zap.Logger
+	ocppServer OCPPServer
+	dir        string // Where the images are stored
+	publicURL  string // Base URL chargers download from
+}
+
+// NewFirmwareAPI creates a new firmware API
+func NewFirmwareAPI(db *sql.DB, logger *zap.Logger, ocppServer OCPPServer, dir, publicURL string) *FirmwareAPI {
+	return &FirmwareAPI{
+		db:         db,
+		logger:     logger,
+		ocppServer: ocppServer,
+		dir:        dir,
+		publicURL:  publicURL,
+	}
+}
+
+// Routes returns the routes for the firmware API
+func (api *FirmwareAPI) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", api.ListFirmware)
+	r.Post("/", api.UploadFirmware)
+	r.Get("/updates", api.ListUpdates)
+	r.Get("/{id}", api.GetFirmware)
+	r.Delete("/{id}", api.DeleteFirmware)
+	r.Post("/{id}/rollout", api.Rollout)
+
+	// Chargers fetch the image from here; the file name is part of the URL because some chargers need it
+	r.Get("/{id}/download/{name}", api.Download)
+	r.Head("/{id}/download/{name}", api.Download)
+	return r
+}
+
+// ListFirmware handles GET /api/firmware
+func (api *FirmwareAPI) ListFirmware(w http.ResponseWriter, r *http.Request) {
+	rows, err := api.db.QueryContext(r.Context(), firmwareFileSelect+" ORDER BY id DESC")
+	if err != nil {
+		api.logger.Error("Failed to query firmware", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	files := []FirmwareFile{}
+	for rows.Next() {
+		file, err := api.scanFirmwareFile(rows)
+		if err != nil {
+			api.logger.Error("Failed to scan firmware", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		files = append(files, *file)
+	}
+
+	if err = rows.Err(); err != nil {
+		api.logger.Error("Row iteration error", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+// UploadFirmware handles POST /api/firmware
+// multipart/form-data with the image in "file" and the fields version (required), vendor, model and notes
+// The image is streamed to disk while its checksums are computed
+func (api *FirmwareAPI) UploadFirmware(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxFirmwareSize+1<<20)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expected multipart/form-data", http.StatusBadRequest)
+		return
+	}
+
+	if err := os.MkdirAll(api.dir, 0o755); err != nil {
+		api.logger.Error("Failed to create firmware directory", zap.String("dir", api.dir), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	fields := map[string]string{}
+	var upload *firmwareUpload
+	defer func() {
+		// Still set unless the upload was stored
+		if upload != nil {
+			os.Remove(upload.tempPath)
+		}
+	}()
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, "Invalid multipart body", http.StatusBadRequest)
+			return
+		}
+
+		switch part.FormName() {
+		case "file":
+			if upload != nil {
+				http.Error(w, "Only one file can be uploaded at a time", http.StatusBadRequest)
+				return
+			}
+			upload, err = api.receiveFirmware(part)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					http.Error(w, "Firmware image is larger than 1 GiB", http.StatusRequestEntityTooLarge)
+					return
+				}
+				api.logger.Error("Failed to receive firmware", zap.Error(err))
+				http.Error(w, "Failed to receive the file", http.StatusBadRequest)
+				return
+			}
+		case "version", "vendor", "model", "notes":
+			value, err := io.ReadAll(io.LimitReader(part, 4096))
+			if err != nil {
+				http.Error(w, "Invalid multipart body", http.StatusBadRequest)
+				return
+			}
+			fields[part.FormName()] = strings.TrimSpace(string(value))
+		}
+	}
+
+	if upload == nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	if upload.size == 0 {
+		http.Error(w, "file is empty", http.StatusBadRequest)
+		return
+	}
+	if fields["version"] == "" {
+		http.Error(w, "version is required", http.StatusBadRequest)
+		return
+	}
+	if len(fields["version"]) > 50 {
+		http.Error(w, "version must be <= 50 characters (the BootNotification limit)", http.StatusBadRequest)
+		return
+	}
+
+	var existingID int64
+	err = api.db.QueryRowContext(r.Context(), `SELECT id FROM firmware_files WHERE sha256 = ?`, upload.sha256).Scan(&existingID)
+	if err == nil {
+		http.Error(w, fmt.Sprintf("The same image is already uploaded as firmware %d", existingID), http.StatusConflict)
+		return
+	}
+	if err != sql.ErrNoRows {
+		api.logger.Error("Failed to check for duplicate firmware", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The checksum names the file on disk, so the stored image can be checked against it
+	storedName := upload.sha256
+	if err := os.Rename(upload.tempPath, filepath.Join(api.dir, storedName)); err != nil {
+		api.logger.Error("Failed to store firmware", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// From here on the deferred cleanup removes the stored file if it cannot be recorded
+	upload.tempPath = filepath.Join(api.dir, storedName)
+
+	query := `
+		INSERT INTO firmware_files (filename, stored_name, version, vendor, model, notes, size, sha256, md5, uploaded_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := api.db.ExecContext(r.Context(), query,
+		upload.filename,
+		storedName,
+		fields["version"],
+		nullIfEmpty(fields["vendor"]),
+		nullIfEmpty(fields["model"]),
+		nullIfEmpty(fields["notes"]),
+		upload.size,
+		upload.sha256,
+		upload.md5,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		api.logger.Error("Failed to record firmware", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	upload = nil
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		api.logger.Error("Failed to get last insert ID", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	file, err := api.getFirmwareFile(r.Context(), id)
+	if err != nil {
+		api.logger.Error("Failed to fetch uploaded firmware", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	api.logger.Info("Firmware uploaded",
+		zap.Int64("firmware_id", id),
+		zap.String("version", file.Version),
+		zap.Int64("size", file.Size),
+		zap.String("sha256", file.SHA256))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(file)
+}
+
+// GetFirmware handles GET /api/firmware/{id}
+func (api *FirmwareAPI) GetFirmware(w http.ResponseWriter, r *http.Request) {
+	file, ok := api.firmwareFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(file)
+}
+
+// DeleteFirmware handles DELETE /api/firmware/{id}
+// An image cannot be deleted while a charger may still be downloading it
+func (api *FirmwareAPI) DeleteFirmware(w http.ResponseWriter, r *http.Request) {
+	file, ok := api.firmwareFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var open int
+	err := api.db.QueryRowContext(r.Context(),
+		`SELECT COUNT(*) FROM firmware_updates WHERE firmware_id = ? AND completed_at IS NULL`, file.ID).Scan(&open)
+	if err != nil {
+		api.logger.Error("Failed to count open firmware updates", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if open > 0 {
+		http.Error(w, fmt.Sprintf("%d firmware update(s) with this image are still running", open), http.StatusConflict)
+		return
+	}
+
+	if _, err := api.db.ExecContext(r.Context(), `DELETE FROM firmware_files WHERE id = ?`, file.ID); err != nil {
+		api.logger.Error("Failed to delete firmware", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := os.Remove(filepath.Join(api.dir, file.storedName)); err != nil && !os.IsNotExist(err) {
+		api.logger.Warn("Failed to remove firmware file", zap.String("file", file.storedName), zap.Error(err))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Download handles GET and HEAD /api/firmware/{id}/download/{name}
+// Range requests are supported so chargers can resume interrupted downloads
+func (api *FirmwareAPI) Download(w http.ResponseWriter, r *http.Request) {
+	file, ok := api.firmwareFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	f, err := os.Open(filepath.Join(api.dir, file.storedName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "The firmware image is missing on disk", http.StatusNotFound)
+			return
+		}
+		api.logger.Error("Failed to open firmware file", zap.String("file", file.storedName), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	api.logger.Info("Firmware download",
+		zap.Int64("firmware_id", file.ID),
+		zap.String("remote_addr", r.RemoteAddr),
+		zap.String("range", r.Header.Get("Range")))
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Filename))
+	w.Header().Set("ETag", `"`+file.SHA256+`"`)
+	http.ServeContent(w, r, file.Filename, file.UploadedAt, f)
+}
+
+// Rollout handles POST /api/firmware/{id}/rollout
+// It sends UpdateFirmware to every station and answers with the update started for each one;
+// an update still open on a station is superseded by the new one
+func (api *FirmwareAPI) Rollout(w http.ResponseWriter, r *http.Request) {
+	file, ok := api.firmwareFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req FirmwareRolloutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := validateFirmwareRolloutRequest(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The location must be an absolute URL the chargers can reach
+	if u, err := url.Parse(api.publicURL); err != nil || u.Scheme == "" || u.Hostname() == "" {
+		http.Error(w, "PUBLIC_URL must be set to the URL chargers reach this server at", http.StatusConflict)
+		return
+	}
+
+	stations := make([]rolloutStation, len(req.StationIDs))
+	for i, stationID := range req.StationIDs {
+		stations[i].id = stationID
+		err := api.db.QueryRowContext(r.Context(), `SELECT identity, firmware FROM chargers WHERE id = ?`, stationID).
+			Scan(&stations[i].identity, &stations[i].firmware)
+		if err == sql.ErrNoRows {
+			http.Error(w, fmt.Sprintf("Station %d not found", stationID), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			api.logger.Error("Failed to fetch station", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// The chargers answer independently, so one slow charger does not hold up the others
+	ids := make([]int64, len(stations))
+	var wg sync.WaitGroup
+	for i := range stations {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i] = api.sendFirmwareUpdate(r.Context(), file, stations[i], &req)
+		}(i)
+	}
+	wg.Wait()
+
+	updates := []FirmwareUpdate{}
+	for _, id := range ids {
+		if id == 0 {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		update, err := scanFirmwareUpdate(api.db.QueryRowContext(r.Context(), firmwareUpdateSelect+" WHERE u.id = ?", id))
+		if err != nil {
+			api.logger.Error("Failed to fetch firmware update", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		updates = append(updates, *update)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updates)
+}
+
+// ListUpdates handles GET /api/firmware/updates
+// Filters: station_id, firmware_id, status (a status, or open/completed); newest first, at most 500
+func (api *FirmwareAPI) ListUpdates(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := firmwareUpdateSelect + " WHERE 1 = 1"
+	var args []interface{}
+
+	for _, filter := range []struct{ param, column string }{{"station_id", "u.charger_id"}, {"firmware_id", "u.firmware_id"}} {
+		value := params.Get(filter.param)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid "+filter.param, http.StatusBadRequest)
+			return
+		}
+		query += " AND " + filter.column + " = ?"
+		args = append(args, id)
+	}
+
+	switch status := params.Get("status"); status {
+	case "":
+	case "open":
+		query += " AND u.completed_at IS NULL"
+	case "completed":
+		query += " AND u.completed_at IS NOT NULL"
+	default:
+		query += " AND u.status = ?"
+		args = append(args, status)
+	}
+
+	query += " ORDER BY u.id DESC LIMIT 500"
+
+	rows, err := api.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		api.logger.Error("Failed to query firmware updates", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	updates := []FirmwareUpdate{}
+	for rows.Next() {
+		update, err := scanFirmwareUpdate(rows)
+		if err != nil {
+			api.logger.Error("Failed to scan firmware update", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		updates = append(updates, *update)
+	}
+
+	if err = rows.Err(); err != nil {
+		api.logger.Error("Row iteration error", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updates)
+}
+
+// rolloutStation is a charger a firmware image is sent to
+type rolloutStation struct {
+	id       int64
+	identity string
+	firmware *string
+}
+
+// sendFirmwareUpdate records the update for one charger and sends UpdateFirmware
+// The row exists before the CALL so a FirmwareStatusNotification right after the answer finds it
+// It returns the update's ID, or 0 if it could not be recorded
+func (api *FirmwareAPI) sendFirmwareUpdate(ctx context.Context, file *FirmwareFile, station rolloutStation, req *FirmwareRolloutRequest) int64 {
+	now := time.Now().UTC()
+
+	tx, err := api.db.BeginTx(ctx, nil)
+	if err != nil {
+		api.logger.Error("Failed to begin firmware update", zap.Error(err))
+		return 0
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO firmware_updates (firmware_id, charger_id, location, retrieve_date, retries, retry_interval,
+			status, previous_firmware, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, file.ID, station.id, file.DownloadURL, *req.RetrieveDate, req.Retries, req.RetryInterval,
+		ocpp.FirmwareUpdateRequested, station.firmware, now, now)
+	if err != nil {
+		api.logger.Error("Failed to record firmware update", zap.Error(err))
+		return 0
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		api.logger.Error("Failed to get last insert ID", zap.Error(err))
+		return 0
+	}
+
+	// The charger runs one update at a time; the new one replaces whatever it was doing
+	_, err = tx.ExecContext(ctx, `
+		UPDATE firmware_updates SET status = ?, error = ?, updated_at = ?, completed_at = ?
+		WHERE charger_id = ? AND id <> ? AND completed_at IS NULL
+	`, ocpp.FirmwareUpdateFailed, fmt.Sprintf("Superseded by firmware update %d", id), now, now, station.id, id)
+	if err != nil {
+		api.logger.Error("Failed to supersede firmware updates", zap.Error(err))
+		return 0
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.logger.Error("Failed to commit firmware update", zap.Error(err))
+		return 0
+	}
+
+	_, callErr := api.ocppServer.UpdateFirmware(ctx, station.identity, &ocpp.UpdateFirmwareRequest{
+		Location:      file.DownloadURL,
+		Retries:       req.Retries,
+		RetrieveDate:  types.NewDateTime(*req.RetrieveDate),
+		RetryInterval: req.RetryInterval,
+	})
+	if callErr != nil {
+		api.logger.Warn("UpdateFirmware failed",
+			zap.String("charge_point_id", station.identity),
+			zap.Int64("update_id", id),
+			zap.Error(callErr))
+
+		// Use a fresh context so the failure is kept even if the HTTP caller went away
+		failedAt := time.Now().UTC()
+		_, err := api.db.ExecContext(context.Background(), `
+			UPDATE firmware_updates SET status = ?, error = ?, updated_at = ?, completed_at = ?
+			WHERE id = ? AND completed_at IS NULL
+		`, ocpp.FirmwareUpdateFailed, callErr.Error(), failedAt, failedAt, id)
+		if err != nil {
+			api.logger.Error("Failed to record firmware update failure", zap.Error(err))
+		}
+	}
+
+	return id
+}
+
+// firmwareFromURL resolves the {id} URL parameter to a firmware image
+// It writes the error response itself and returns false if the image cannot be found
+func (api *FirmwareAPI) firmwareFromURL(w http.ResponseWriter, r *http.Request) (*FirmwareFile, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid firmware ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	file, err := api.getFirmwareFile(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Firmware not found", http.StatusNotFound)
+			return nil, false
+		}
+		api.logger.Error("Failed to fetch firmware", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return file, true
+}
+
+// getFirmwareFile fetches a firmware image by ID
+func (api *FirmwareAPI) getFirmwareFile(ctx context.Context, id int64) (*FirmwareFile, error) {
+	return api.scanFirmwareFile(api.db.QueryRowContext(ctx, firmwareFileSelect+" WHERE id = ?", id))
+}
+
+// scanFirmwareFile reads a firmwareFileSelect row and fills in the download URL
+func (api *FirmwareAPI) scanFirmwareFile(row interface{ Scan(...interface{}) error }) (*FirmwareFile, error) {
+	var file FirmwareFile
+	err := row.Scan(
+		&file.ID,
+		&file.Filename,
+		&file.storedName,
+		&file.Version,
+		&file.Vendor,
+		&file.Model,
+		&file.Notes,
+		&file.Size,
+		&file.SHA256,
+		&file.MD5,
+		&file.UploadedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	file.DownloadURL = fmt.Sprintf("%s/api/firmware/%d/download/%s", api.publicURL, file.ID, url.PathEscape(file.Filename))
+	return &file, nil
+}
+
+// scanFirmwareUpdate reads a firmwareUpdateSelect row
+func scanFirmwareUpdate(row interface{ Scan(...interface{}) error }) (*FirmwareUpdate, error) {
+	var update FirmwareUpdate
+	err := row.Scan(
+		&update.ID,
+		&update.FirmwareID,
+		&update.FirmwareVersion,
+		&update.StationID,
+		&update.Station,
+		&update.Location,
+		&update.RetrieveDate,
+		&update.Retries,
+		&update.RetryInterval,
+		&update.Status,
+		&update.Error,
+		&update.PreviousFirmware,
+		&update.CreatedAt,
+		&update.UpdatedAt,
+		&update.CompletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+// firmwareUpload is an image received into a temporary file
+type firmwareUpload struct {
+	tempPath string
+	filename string
+	size     int64
+	sha256   string
+	md5      string
+}
+
+// receiveFirmware streams an uploaded image into a temporary file in the firmware directory
+func (api *FirmwareAPI) receiveFirmware(part io.Reader) (*firmwareUpload, error) {
+	filename := "firmware.bin"
+	if named, ok := part.(interface{ FileName() string }); ok && named.FileName() != "" {
+		filename = unsafeFilenameChars.ReplaceAllString(filepath.Base(named.FileName()), "_")
+	}
+
+	temp, err := os.CreateTemp(api.dir, ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer temp.Close()
+
+	sha := sha256.New()
+	sum := md5.New()
+	size, err := io.Copy(io.MultiWriter(temp, sha, sum), part)
+	if err == nil {
+		err = temp.Close()
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return nil, err
+	}
+
+	return &firmwareUpload{
+		tempPath: temp.Name(),
+		filename: filename,
+		size:     size,
+		sha256:   hex.EncodeToString(sha.Sum(nil)),
+		md5:      hex.EncodeToString(sum.Sum(nil)),
+	}, nil
+}
+
+// validateFirmwareRolloutRequest validates a rollout request and fills in the defaults
+func validateFirmwareRolloutRequest(req *FirmwareRolloutRequest) error {
+	if len(req.StationIDs) == 0 {
+		return fmt.Errorf("station_ids needs at least one station")
+	}
+	seen := make(map[int64]bool, len(req.StationIDs))
+	for _, id := range req.StationIDs {
+		if seen[id] {
+			return fmt.Errorf("station %d is listed twice", id)
+		}
+		seen[id] = true
+	}
+
+	if req.RetrieveDate == nil {
+		now := time.Now().UTC().Truncate(time.Second)
+		req.RetrieveDate = &now
+	}
+	if req.Retries != nil && *req.Retries < 0 {
+		return fmt.Errorf("retries must be >= 0")
+	}
+	if req.RetryInterval != nil && *req.RetryInterval < 0 {
+		return fmt.Errorf("retry_interval must be >= 0")
+	}
+	return nil
+}
+
+// nullIfEmpty stores an empty form field as NULL
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
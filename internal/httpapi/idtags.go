@@ -0,0 +1,355 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// maxIdTagLength is the OCPP 1.6 limit for an idTag (CiString20Type)
+const maxIdTagLength = 20
+
+// IdTag represents an RFID card or other token allowed to charge
+type IdTag struct {
+	ID          int64      `json:"id"`
+	Tag         string     `json:"tag"`
+	Status      string     `json:"status"` // Accepted, Blocked or Expired
+	ExpiryDate  *time.Time `json:"expiry_date"`
+	ParentIdTag *string    `json:"parent_id_tag"`
+	OwnerName   *string    `json:"owner_name"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// CreateIdTagRequest represents the request to create an idTag
+type CreateIdTagRequest struct {
+	Tag         string     `json:"tag"`
+	Status      string     `json:"status"` // Defaults to Accepted
+	ExpiryDate  *time.Time `json:"expiry_date"`
+	ParentIdTag *string    `json:"parent_id_tag"`
+	OwnerName   *string    `json:"owner_name"`
+}
+
+// UpdateIdTagRequest represents the request to update an idTag
+type UpdateIdTagRequest struct {
+	Status      string     `json:"status"`
+	ExpiryDate  *time.Time `json:"expiry_date"`
+	ParentIdTag *string    `json:"parent_id_tag"`
+	OwnerName   *string    `json:"owner_name"`
+}
+
+// IdTagsAPI handles the authorization list
+type IdTagsAPI struct {
+	db         *sql.DB
+	logger     *zap.Logger
+	ocppServer OCPPServer
+}
+
+// NewIdTagsAPI creates a new idTags API
+func NewIdTagsAPI(db *sql.DB, logger *zap.Logger, ocppServer OCPPServer) *IdTagsAPI {
+	return &IdTagsAPI{
+		db:         db,
+		logger:     logger,
+		ocppServer: ocppServer,
+	}
+}
+
+// Routes returns the routes for the idTags API
+func (api *IdTagsAPI) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/", api.ListIdTags)
+	r.Post("/", api.CreateIdTag)
+	r.Get("/{id}", api.GetIdTag)
+	r.Put("/{id}", api.UpdateIdTag)
+	r.Delete("/{id}", api.DeleteIdTag)
+
+	return r
+}
+
+// ListIdTags handles GET /api/idtags
+func (api *IdTagsAPI) ListIdTags(w http.ResponseWriter, r *http.Request) {
+	query := `
+		SELECT id, tag, status, expiry_date, parent_id_tag, owner_name, created_at, updated_at
+		FROM id_tags
+		ORDER BY tag
+	`
+
+	rows, err := api.db.QueryContext(r.Context(), query)
+	if err != nil {
+		api.logger.Error("Failed to query idTags", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	idTags := []IdTag{}
+	for rows.Next() {
+		var idTag IdTag
+		err := rows.Scan(
+			&idTag.ID,
+			&idTag.Tag,
+			&idTag.Status,
+			&idTag.ExpiryDate,
+			&idTag.ParentIdTag,
+			&idTag.OwnerName,
+			&idTag.CreatedAt,
+			&idTag.UpdatedAt,
+		)
+		if err != nil {
+			api.logger.Error("Failed to scan idTag", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		idTags = append(idTags, idTag)
+	}
+	if err := rows.Err(); err != nil {
+		api.logger.Error("Failed to read idTags", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(idTags)
+}
+
+// GetIdTag handles GET /api/idtags/{id}
+func (api *IdTagsAPI) GetIdTag(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid idTag ID", http.StatusBadRequest)
+		return
+	}
+
+	idTag, err := api.getIdTagByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "idTag not found", http.StatusNotFound)
+			return
+		}
+		api.logger.Error("Failed to fetch idTag", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(idTag)
+}
+
+// CreateIdTag handles POST /api/idtags
+func (api *IdTagsAPI) CreateIdTag(w http.ResponseWriter, r *http.Request) {
+	var req CreateIdTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Tag == "" {
+		http.Error(w, "tag is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Tag) > maxIdTagLength {
+		http.Error(w, fmt.Sprintf("tag must be <= %d characters", maxIdTagLength), http.StatusBadRequest)
+		return
+	}
+	if req.Status == "" {
+		req.Status = "Accepted"
+	}
+	if err := validateIdTagFields(req.Status, req.ParentIdTag); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := `
+		INSERT INTO id_tags (tag, status, expiry_date, parent_id_tag, owner_name, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	result, err := api.db.ExecContext(r.Context(), query,
+		req.Tag,
+		req.Status,
+		req.ExpiryDate,
+		req.ParentIdTag,
+		req.OwnerName,
+		now,
+		now,
+	)
+	if err != nil {
+		api.logger.Error("Failed to create idTag", zap.Error(err))
+		if isUniqueConstraintError(err) {
+			http.Error(w, "idTag already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		api.logger.Error("Failed to get last insert ID", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	idTag, err := api.getIdTagByID(r.Context(), id)
+	if err != nil {
+		api.logger.Error("Failed to fetch created idTag", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Push the change to the local lists of connected chargers
+	api.ocppServer.SyncAllLocalLists()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(idTag)
+}
+
+// UpdateIdTag handles PUT /api/idtags/{id}
+// The tag itself cannot change; delete it and create a new one instead
+func (api *IdTagsAPI) UpdateIdTag(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid idTag ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateIdTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateIdTagFields(req.Status, req.ParentIdTag); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := `
+		UPDATE id_tags
+		SET status = ?, expiry_date = ?, parent_id_tag = ?, owner_name = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	result, err := api.db.ExecContext(r.Context(), query,
+		req.Status,
+		req.ExpiryDate,
+		req.ParentIdTag,
+		req.OwnerName,
+		time.Now(),
+		id,
+	)
+	if err != nil {
+		api.logger.Error("Failed to update idTag", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		api.logger.Error("Failed to get rows affected", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "idTag not found", http.StatusNotFound)
+		return
+	}
+
+	idTag, err := api.getIdTagByID(r.Context(), id)
+	if err != nil {
+		api.logger.Error("Failed to fetch updated idTag", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Push the change to the local lists of connected chargers
+	api.ocppServer.SyncAllLocalLists()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(idTag)
+}
+
+// DeleteIdTag handles DELETE /api/idtags/{id}
+func (api *IdTagsAPI) DeleteIdTag(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid idTag ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := api.db.ExecContext(r.Context(), `DELETE FROM id_tags WHERE id = ?`, id)
+	if err != nil {
+		api.logger.Error("Failed to delete idTag", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		api.logger.Error("Failed to get rows affected", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "idTag not found", http.StatusNotFound)
+		return
+	}
+
+	// Push the change to the local lists of connected chargers
+	api.ocppServer.SyncAllLocalLists()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getIdTagByID fetches an idTag by ID
+func (api *IdTagsAPI) getIdTagByID(ctx context.Context, id int64) (*IdTag, error) {
+	query := `
+		SELECT id, tag, status, expiry_date, parent_id_tag, owner_name, created_at, updated_at
+		FROM id_tags
+		WHERE id = ?
+	`
+
+	var idTag IdTag
+	err := api.db.QueryRowContext(ctx, query, id).Scan(
+		&idTag.ID,
+		&idTag.Tag,
+		&idTag.Status,
+		&idTag.ExpiryDate,
+		&idTag.ParentIdTag,
+		&idTag.OwnerName,
+		&idTag.CreatedAt,
+		&idTag.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &idTag, nil
+}
+
+// validateIdTagFields validates the status and parent of an idTag
+func validateIdTagFields(status string, parentIdTag *string) error {
+	switch status {
+	case "Accepted", "Blocked", "Expired":
+	default:
+		return fmt.Errorf("status must be Accepted, Blocked or Expired")
+	}
+
+	if parentIdTag != nil && len(*parentIdTag) > maxIdTagLength {
+		return fmt.Errorf("parent_id_tag must be <= %d characters", maxIdTagLength)
+	}
+
+	return nil
+}
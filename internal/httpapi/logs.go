@@ -1,20 +1,22 @@
 package httpapi
 
 import (
+	"context"
 	"database/sql"
-	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 )
 
-// LogsAPI handles CSV log export endpoints
+// LogsAPI handles the export job and download endpoints
 type LogsAPI struct {
 	db     *sql.DB
 	logger *zap.Logger
@@ -32,368 +34,460 @@ func NewLogsAPI(db *sql.DB, logger *zap.Logger) *LogsAPI {
 func (api *LogsAPI) Routes() chi.Router {
 	r := chi.NewRouter()
 
-	r.Get("/config", api.getLogsConfig)
-	r.Put("/config", api.updateLogsConfig)
-	r.Post("/download", api.downloadCSV)
+	r.Get("/exports", api.listExportJobs)
+	r.Post("/exports", api.createExportJob)
+	r.Get("/exports/{id}", api.getExportJob)
+	r.Put("/exports/{id}", api.updateExportJob)
+	r.Delete("/exports/{id}", api.deleteExportJob)
+	r.Post("/exports/{id}/run", api.runExportJobNow)
+	r.Get("/exports/{id}/runs", api.listExportJobRuns)
+
+	// Run history across jobs and the files the runs wrote
+	r.Get("/runs", api.listExportRuns)
+	r.Get("/runs/{id}/file", api.downloadExportRunFile)
+
+	// Ad-hoc export streamed to the browser instead of written to a directory
+	r.Get("/download", api.download)
+	r.Post("/download", api.download)
 	r.Post("/browse", api.browseDirectory)
 
 	return r
 }
 
-// LogsConfig represents the logs configuration
-type LogsConfig struct {
-	Enabled        bool      `json:"enabled"`
-	Directory      string    `json:"directory"`
-	Frequency      string    `json:"frequency"`       // minutes, hours, days
-	FrequencyValue int       `json:"frequency_value"` // the numeric value for the frequency
-	LastExport     time.Time `json:"last_export"`
+// ExportJobRequest represents the request to create or update an export job
+type ExportJobRequest struct {
+	Name           string `json:"name"`
+	Dataset        string `json:"dataset"`
+	Format         string `json:"format"` // Defaults to csv
+	Directory      string `json:"directory"`
+	Frequency      string `json:"frequency"`       // minutes, hours or days
+	FrequencyValue int    `json:"frequency_value"` // Defaults to 1
+	Window         string `json:"window"`          // Defaults to since_last_run, or full for stations
+	KeepFiles      int    `json:"keep_files"`
+	KeepDays       int    `json:"keep_days"`
+	Enabled        bool   `json:"enabled"`
 }
 
-// getLogsConfig returns the current logs configuration
-func (api *LogsAPI) getLogsConfig(w http.ResponseWriter, r *http.Request) {
-	api.logger.Info("Logs configuration requested")
-
-	// Get configuration from database
-	config, err := api.getLogsConfigFromDB()
+// listExportJobs handles GET /api/logs/exports
+func (api *LogsAPI) listExportJobs(w http.ResponseWriter, r *http.Request) {
+	rows, err := api.db.QueryContext(r.Context(), `SELECT id FROM export_jobs ORDER BY name, id`)
 	if err != nil {
-		api.logger.Error("Failed to get logs config from database", zap.Error(err))
-		http.Error(w, "Failed to get configuration", http.StatusInternalServerError)
+		api.logger.Error("Failed to query export jobs", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			api.logger.Error("Failed to scan export job", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	jobs := []*ExportJob{}
+	for _, id := range ids {
+		job, err := getExportJob(r.Context(), api.db, id)
+		if err != nil {
+			api.logger.Error("Failed to fetch export job", zap.Int64("job_id", id), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		jobs = append(jobs, job)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(config); err != nil {
-		api.logger.Error("Failed to encode logs config", zap.Error(err))
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// getExportJob handles GET /api/logs/exports/{id}
+func (api *LogsAPI) getExportJob(w http.ResponseWriter, r *http.Request) {
+	id, ok := exportIDFromURL(w, r, "export job")
+	if !ok {
 		return
 	}
 
-	api.logger.Info("Logs configuration returned")
-}
+	job, err := getExportJob(r.Context(), api.db, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Export job not found", http.StatusNotFound)
+			return
+		}
+		api.logger.Error("Failed to fetch export job", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-// updateLogsConfig updates the logs configuration
-func (api *LogsAPI) updateLogsConfig(w http.ResponseWriter, r *http.Request) {
-	api.logger.Info("Logs configuration update requested")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
 
-	var config LogsConfig
-	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
-		api.logger.Error("Failed to decode logs config", zap.Error(err))
+// createExportJob handles POST /api/logs/exports
+func (api *LogsAPI) createExportJob(w http.ResponseWriter, r *http.Request) {
+	var req ExportJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	// Validate configuration
-	if config.Enabled && config.Directory == "" {
-		http.Error(w, "Directory is required when logging is enabled", http.StatusBadRequest)
+	if err := validateExportJobRequest(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if config.Frequency != "seconds" && config.Frequency != "minutes" && config.Frequency != "hours" {
-		http.Error(w, "Invalid frequency. Must be seconds, minutes, or hours", http.StatusBadRequest)
+	query := `
+		INSERT INTO export_jobs (name, dataset, format, directory, frequency, frequency_value, window_mode,
+			keep_files, keep_days, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	result, err := api.db.ExecContext(r.Context(), query,
+		req.Name,
+		req.Dataset,
+		req.Format,
+		req.Directory,
+		req.Frequency,
+		req.FrequencyValue,
+		req.Window,
+		req.KeepFiles,
+		req.KeepDays,
+		req.Enabled,
+		now,
+		now,
+	)
+	if err != nil {
+		api.logger.Error("Failed to create export job", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	if config.FrequencyValue < 1 {
-		http.Error(w, "Frequency value must be at least 1", http.StatusBadRequest)
+	id, err := result.LastInsertId()
+	if err != nil {
+		api.logger.Error("Failed to get last insert ID", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// No limits - user can set any frequency they want
-
-	// Save configuration to database
-	if err := api.saveLogsConfigToDB(&config); err != nil {
-		api.logger.Error("Failed to save logs config to database", zap.Error(err))
-		http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
+	job, err := getExportJob(r.Context(), api.db, id)
+	if err != nil {
+		api.logger.Error("Failed to fetch created export job", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	api.logger.Info("Logs configuration updated",
-		zap.Bool("enabled", config.Enabled),
-		zap.String("directory", config.Directory),
-		zap.String("frequency", config.Frequency),
-		zap.Int("frequency_value", config.FrequencyValue))
+	api.logger.Info("Export job created", zap.Int64("job_id", id), zap.String("name", req.Name), zap.String("dataset", req.Dataset))
 
 	w.Header().Set("Content-Type", "application/json")
-	response := map[string]string{"message": "Configuration updated successfully"}
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		api.logger.Error("Failed to encode response", zap.Error(err))
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(job)
+}
+
+// updateExportJob handles PUT /api/logs/exports/{id}
+// A changed dataset or window applies from the next run; earlier files are left as they are
+func (api *LogsAPI) updateExportJob(w http.ResponseWriter, r *http.Request) {
+	id, ok := exportIDFromURL(w, r, "export job")
+	if !ok {
+		return
+	}
+
+	var req ExportJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-}
 
-// downloadCSV generates and downloads a CSV file with station data
-func (api *LogsAPI) downloadCSV(w http.ResponseWriter, r *http.Request) {
-	api.logger.Info("CSV download requested")
+	if err := validateExportJobRequest(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Get all stations from the database
-	rows, err := api.db.Query(`
-		SELECT id, identity, model, total_energy_wh
-		FROM chargers 
-		ORDER BY id
-	`)
+	query := `
+		UPDATE export_jobs
+		SET name = ?, dataset = ?, format = ?, directory = ?, frequency = ?, frequency_value = ?, window_mode = ?,
+			keep_files = ?, keep_days = ?, enabled = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	result, err := api.db.ExecContext(r.Context(), query,
+		req.Name,
+		req.Dataset,
+		req.Format,
+		req.Directory,
+		req.Frequency,
+		req.FrequencyValue,
+		req.Window,
+		req.KeepFiles,
+		req.KeepDays,
+		req.Enabled,
+		time.Now(),
+		id,
+	)
 	if err != nil {
-		api.logger.Error("Failed to query chargers", zap.Error(err))
-		http.Error(w, "Failed to query chargers", http.StatusInternalServerError)
+		api.logger.Error("Failed to update export job", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	// Create CSV content
-	var csvData [][]string
-	csvData = append(csvData, []string{"ID", "OCPP Identity", "Model", "Total Energy (kWh)", "Timestamp"})
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		api.logger.Error("Failed to get rows affected", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-	// Get current timestamp for all records
-	currentTime := time.Now().Format("2006-01-02 15:04:05")
+	if rowsAffected == 0 {
+		http.Error(w, "Export job not found", http.StatusNotFound)
+		return
+	}
 
-	for rows.Next() {
-		var id int
-		var identity, model string
-		var totalEnergyWh sql.NullInt64
+	job, err := getExportJob(r.Context(), api.db, id)
+	if err != nil {
+		api.logger.Error("Failed to fetch updated export job", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-		err := rows.Scan(&id, &identity, &model, &totalEnergyWh)
-		if err != nil {
-			api.logger.Error("Failed to scan charger row", zap.Error(err))
-			continue
-		}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
 
-		// Convert Wh to kWh and format
-		totalEnergy := "0.000"
-		if totalEnergyWh.Valid {
-			kwh := float64(totalEnergyWh.Int64) / 1000.0
-			totalEnergy = fmt.Sprintf("%.3f", kwh)
-		}
+// deleteExportJob handles DELETE /api/logs/exports/{id}
+// The run history goes with the job; files it wrote stay on disk
+func (api *LogsAPI) deleteExportJob(w http.ResponseWriter, r *http.Request) {
+	id, ok := exportIDFromURL(w, r, "export job")
+	if !ok {
+		return
+	}
 
-		csvData = append(csvData, []string{
-			fmt.Sprintf("%d", id),
-			identity,
-			model,
-			totalEnergy,
-			currentTime,
-		})
+	result, err := api.db.ExecContext(r.Context(), `DELETE FROM export_jobs WHERE id = ?`, id)
+	if err != nil {
+		api.logger.Error("Failed to delete export job", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
-	if err := rows.Err(); err != nil {
-		api.logger.Error("Error iterating charger rows", zap.Error(err))
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		api.logger.Error("Failed to get rows affected", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Generate filename with timestamp
-	timestamp := time.Now().Format("2006-01-02_15-04-05")
-	filename := fmt.Sprintf("stations_log_%s.csv", timestamp)
+	if rowsAffected == 0 {
+		http.Error(w, "Export job not found", http.StatusNotFound)
+		return
+	}
 
-	// Set response headers for file download
-	w.Header().Set("Content-Type", "text/csv")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	// Write CSV data
-	writer := csv.NewWriter(w)
-	defer writer.Flush()
+// runExportJobNow handles POST /api/logs/exports/{id}/run
+// The job runs whether or not it is enabled; the response is the finished run, which may have failed
+func (api *LogsAPI) runExportJobNow(w http.ResponseWriter, r *http.Request) {
+	id, ok := exportIDFromURL(w, r, "export job")
+	if !ok {
+		return
+	}
 
-	for _, row := range csvData {
-		if err := writer.Write(row); err != nil {
-			api.logger.Error("Failed to write CSV row", zap.Error(err))
-			return
+	run, err := runExportJob(r.Context(), api.db, api.logger, id, "manual")
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			http.Error(w, "Export job not found", http.StatusNotFound)
+		case errExportRunning:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			api.logger.Error("Failed to run export job", zap.Int64("job_id", id), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
 		}
+		return
 	}
 
-	api.logger.Info("CSV download completed", zap.String("filename", filename), zap.Int("rows", len(csvData)-1))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
 }
 
-// saveCSVToFile saves CSV data to a file (for scheduled exports)
-func (api *LogsAPI) saveCSVToFile(directory, filename string) error {
-	// Get all stations from the database
-	rows, err := api.db.Query(`
-		SELECT id, identity, model, total_energy_wh
-		FROM chargers 
-		ORDER BY id
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to query chargers: %w", err)
-	}
-	defer rows.Close()
-
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(directory, 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+// listExportJobRuns handles GET /api/logs/exports/{id}/runs
+func (api *LogsAPI) listExportJobRuns(w http.ResponseWriter, r *http.Request) {
+	id, ok := exportIDFromURL(w, r, "export job")
+	if !ok {
+		return
 	}
 
-	// Create file
-	filePath := filepath.Join(directory, filename)
-	api.logger.Info("Creating CSV file",
-		zap.String("directory", directory),
-		zap.String("filename", filename),
-		zap.String("full_path", filePath),
-		zap.Bool("is_absolute", filepath.IsAbs(directory)))
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+	var exists bool
+	if err := api.db.QueryRowContext(r.Context(), `SELECT EXISTS(SELECT 1 FROM export_jobs WHERE id = ?)`, id).Scan(&exists); err != nil {
+		api.logger.Error("Failed to check export job", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
-	defer file.Close()
-
-	// Write CSV data
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	// Write header
-	if err := writer.Write([]string{"ID", "OCPP Identity", "Model", "Total Energy (kWh)", "Timestamp"}); err != nil {
-		return fmt.Errorf("failed to write CSV header: %w", err)
+	if !exists {
+		http.Error(w, "Export job not found", http.StatusNotFound)
+		return
 	}
 
-	// Get current timestamp for all records
-	currentTime := time.Now().Format("2006-01-02 15:04:05")
+	api.writeExportRuns(w, r, " WHERE r.job_id = ?", id)
+}
 
-	// Write data rows
-	for rows.Next() {
-		var id int
-		var identity, model string
-		var totalEnergyWh sql.NullInt64
+// listExportRuns handles GET /api/logs/runs
+func (api *LogsAPI) listExportRuns(w http.ResponseWriter, r *http.Request) {
+	api.writeExportRuns(w, r, "")
+}
 
-		err := rows.Scan(&id, &identity, &model, &totalEnergyWh)
-		if err != nil {
-			api.logger.Error("Failed to scan charger row", zap.Error(err))
-			continue
+// writeExportRuns writes the newest runs matching the condition
+// Query parameters: status and limit (default 50, max 500)
+func (api *LogsAPI) writeExportRuns(w http.ResponseWriter, r *http.Request, where string, args ...interface{}) {
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			http.Error(w, "limit must be 1-500", http.StatusBadRequest)
+			return
 		}
+		limit = parsed
+	}
 
-		// Convert Wh to kWh and format
-		totalEnergy := "0.000"
-		if totalEnergyWh.Valid {
-			kwh := float64(totalEnergyWh.Int64) / 1000.0
-			totalEnergy = fmt.Sprintf("%.3f", kwh)
+	if status := r.URL.Query().Get("status"); status != "" {
+		if where == "" {
+			where = " WHERE r.status = ?"
+		} else {
+			where += " AND r.status = ?"
 		}
+		args = append(args, status)
+	}
 
-		row := []string{
-			fmt.Sprintf("%d", id),
-			identity,
-			model,
-			totalEnergy,
-			currentTime,
-		}
+	rows, err := api.db.QueryContext(r.Context(), exportRunSelect+where+" ORDER BY r.started_at DESC, r.id DESC LIMIT ?", append(args, limit)...)
+	if err != nil {
+		api.logger.Error("Failed to query export runs", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
 
-		if err := writer.Write(row); err != nil {
-			return fmt.Errorf("failed to write CSV row: %w", err)
+	runs := []*ExportRun{}
+	for rows.Next() {
+		run, err := scanExportRun(rows)
+		if err != nil {
+			api.logger.Error("Failed to scan export run", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
 		}
+		runs = append(runs, run)
 	}
 
-	if err := rows.Err(); err != nil {
-		return fmt.Errorf("error iterating charger rows: %w", err)
+	if err = rows.Err(); err != nil {
+		api.logger.Error("Row iteration error", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
-	api.logger.Info("CSV file saved", zap.String("filepath", filePath))
-	return nil
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
 }
 
-// getLogsConfigFromDB retrieves the logs configuration from the database
-func (api *LogsAPI) getLogsConfigFromDB() (*LogsConfig, error) {
-	query := `
-		SELECT enabled, directory, frequency, frequency_value, last_export
-		FROM logs_config
-		ORDER BY id DESC
-		LIMIT 1
-	`
-
-	var config LogsConfig
-	var lastExport sql.NullTime
-
-	err := api.db.QueryRow(query).Scan(
-		&config.Enabled,
-		&config.Directory,
-		&config.Frequency,
-		&config.FrequencyValue,
-		&lastExport,
-	)
+// downloadExportRunFile handles GET /api/logs/runs/{id}/file
+func (api *LogsAPI) downloadExportRunFile(w http.ResponseWriter, r *http.Request) {
+	id, ok := exportIDFromURL(w, r, "export run")
+	if !ok {
+		return
+	}
 
+	run, err := scanExportRun(api.db.QueryRowContext(r.Context(), exportRunSelect+" WHERE r.id = ?", id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			// Return default configuration if no config exists
-			return &LogsConfig{
-				Enabled:        false,
-				Directory:      "",
-				Frequency:      "hours",
-				FrequencyValue: 1,
-				LastExport:     time.Time{},
-			}, nil
+			http.Error(w, "Export run not found", http.StatusNotFound)
+			return
 		}
-		return nil, fmt.Errorf("failed to query logs config: %w", err)
+		api.logger.Error("Failed to fetch export run", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
-	if lastExport.Valid {
-		config.LastExport = lastExport.Time
+	if run.File == nil || run.FileDeletedAt != nil {
+		http.Error(w, "The run has no file", http.StatusNotFound)
+		return
 	}
 
-	return &config, nil
-}
+	file, err := os.Open(*run.File)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "The file no longer exists", http.StatusNotFound)
+			return
+		}
+		api.logger.Error("Failed to open export file", zap.String("file", *run.File), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
 
-// saveLogsConfigToDB saves the logs configuration to the database
-func (api *LogsAPI) saveLogsConfigToDB(config *LogsConfig) error {
-	// First, try to update existing record
-	updateQuery := `
-		UPDATE logs_config 
-		SET enabled = ?, directory = ?, frequency = ?, frequency_value = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE id = (SELECT id FROM logs_config ORDER BY id DESC LIMIT 1)
-	`
+	name := filepath.Base(*run.File)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(w, r, name, run.StartedAt, file)
+}
 
-	result, err := api.db.Exec(updateQuery,
-		config.Enabled,
-		config.Directory,
-		config.Frequency,
-		config.FrequencyValue,
-	)
+// download handles GET and POST /api/logs/download
+// Query parameters: dataset (default stations), format (csv, jsonl or xlsx, default csv)
+// and from/to (RFC3339, to defaults to now) for datasets with a time
+func (api *LogsAPI) download(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
 
-	if err != nil {
-		return fmt.Errorf("failed to update logs config: %w", err)
+	dataset := params.Get("dataset")
+	if dataset == "" {
+		dataset = "stations"
+	}
+	if _, ok := exportDatasets[dataset]; !ok {
+		http.Error(w, fmt.Sprintf("unknown dataset %q", dataset), http.StatusBadRequest)
+		return
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+	format := params.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	formatInfo, ok := exportFormats[format]
+	if !ok {
+		http.Error(w, "format must be csv, jsonl or xlsx", http.StatusBadRequest)
+		return
 	}
 
-	// If no rows were updated, insert a new record
-	if rowsAffected == 0 {
-		insertQuery := `
-			INSERT INTO logs_config (enabled, directory, frequency, frequency_value, last_export)
-			VALUES (?, ?, ?, ?, ?)
-		`
-
-		var lastExport interface{}
-		if config.LastExport.IsZero() {
-			lastExport = nil
-		} else {
-			lastExport = config.LastExport
+	var from *time.Time
+	if value := params.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid from (use RFC3339)", http.StatusBadRequest)
+			return
 		}
-
-		_, err = api.db.Exec(insertQuery,
-			config.Enabled,
-			config.Directory,
-			config.Frequency,
-			config.FrequencyValue,
-			lastExport,
-		)
-
+		from = &parsed
+	}
+	to := time.Now().UTC()
+	if value := params.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
 		if err != nil {
-			return fmt.Errorf("failed to insert logs config: %w", err)
+			http.Error(w, "Invalid to (use RFC3339)", http.StatusBadRequest)
+			return
 		}
+		to = parsed
 	}
 
-	return nil
-}
-
-// updateLastExportTime updates the last export time in the database
-func (api *LogsAPI) updateLastExportTime() error {
-	query := `
-		UPDATE logs_config 
-		SET last_export = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
-		WHERE id = (SELECT id FROM logs_config ORDER BY id DESC LIMIT 1)
-	`
+	filename := fmt.Sprintf("%s_%s.%s", dataset, time.Now().Format("2006-01-02_15-04-05"), formatInfo[0])
+	w.Header().Set("Content-Type", formatInfo[1])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
 
-	_, err := api.db.Exec(query)
+	// Once rows are streaming the status is sent, so a late error can only end the response early
+	count, err := writeExport(r.Context(), api.db, w, dataset, format, from, to)
 	if err != nil {
-		return fmt.Errorf("failed to update last export time: %w", err)
+		if !errors.Is(err, context.Canceled) {
+			api.logger.Error("Export download failed", zap.String("dataset", dataset), zap.Error(err))
+		}
+		return
 	}
 
-	return nil
+	api.logger.Info("Export download completed", zap.String("filename", filename), zap.Int("rows", count))
 }
 
 // browseDirectory handles directory browsing requests
@@ -410,3 +504,65 @@ func (api *LogsAPI) browseDirectory(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// exportIDFromURL parses the {id} URL parameter of an export job or run
+// It writes the error response itself and returns false if the ID is invalid
+func exportIDFromURL(w http.ResponseWriter, r *http.Request, what string) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid "+what+" ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// validateExportJobRequest validates an export job request and fills in the defaults
+func validateExportJobRequest(req *ExportJobRequest) error {
+	if req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if req.Directory == "" {
+		return fmt.Errorf("directory is required")
+	}
+
+	dataset, ok := exportDatasets[req.Dataset]
+	if !ok {
+		return fmt.Errorf("dataset must be stations, sessions, meter_values, status_history or ocpp_messages")
+	}
+
+	if req.Format == "" {
+		req.Format = "csv"
+	}
+	if _, ok := exportFormats[req.Format]; !ok {
+		return fmt.Errorf("format must be csv, jsonl or xlsx")
+	}
+
+	if req.Frequency != "minutes" && req.Frequency != "hours" && req.Frequency != "days" {
+		return fmt.Errorf("frequency must be minutes, hours or days")
+	}
+	if req.FrequencyValue == 0 {
+		req.FrequencyValue = 1
+	}
+	if req.FrequencyValue < 1 {
+		return fmt.Errorf("frequency_value must be at least 1")
+	}
+
+	if req.Window == "" {
+		req.Window = exportWindowSinceLastRun
+		if dataset.timeColumn == "" {
+			req.Window = exportWindowFull
+		}
+	}
+	if req.Window != exportWindowSinceLastRun && req.Window != exportWindowFull {
+		return fmt.Errorf("window must be since_last_run or full")
+	}
+	if req.Window == exportWindowSinceLastRun && dataset.timeColumn == "" {
+		return fmt.Errorf("%s is a snapshot of the current state; use window full", req.Dataset)
+	}
+
+	if req.KeepFiles < 0 || req.KeepDays < 0 {
+		return fmt.Errorf("keep_files and keep_days must be >= 0")
+	}
+
+	return nil
+}
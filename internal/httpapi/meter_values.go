@@ -0,0 +1,137 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maxMeterValues caps how many readings one meter-values request returns
+const maxMeterValues = 10000
+
+// MeterValue represents one sampled value reported by a charger
+type MeterValue struct {
+	ConnectorId   int       `json:"connector_id"`
+	TransactionId *string   `json:"transaction_id"` // OCPP transaction ID, if the reading belongs to a transaction
+	Timestamp     time.Time `json:"timestamp"`      // When the charger took the reading
+	Measurand     string    `json:"measurand"`
+	Phase         *string   `json:"phase"`
+	Unit          *string   `json:"unit"` // Base unit (Wh, W, A, V, Percent, Celsius, ...)
+	Context       *string   `json:"context"`
+	Location      *string   `json:"location"`
+	Format        *string   `json:"format"`
+	Value         *float64  `json:"value"` // nil for SignedData
+	RawValue      *string   `json:"raw_value"`
+}
+
+// ListMeterValues handles GET /api/stations/{id}/meter-values
+// Optional query parameters: from and to (RFC3339, default the last 24 hours),
+// measurand (comma-separated, e.g. Power.Active.Import,SoC) and connector_id
+func (api *StationsAPI) ListMeterValues(w http.ResponseWriter, r *http.Request) {
+	id, _, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	to := time.Now().UTC()
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		parsed, err := time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			http.Error(w, "to must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		to = parsed.UTC()
+	}
+
+	from := to.Add(-24 * time.Hour)
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		parsed, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			http.Error(w, "from must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		from = parsed.UTC()
+	}
+
+	if from.After(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	query := `
+		SELECT mv.connector_id, t.tx_id, mv.ts, mv.measurand, mv.phase, mv.unit, mv.context, mv.location, mv.format, mv.value, mv.raw_value
+		FROM meter_values mv
+		LEFT JOIN transactions t ON t.id = mv.transaction_id
+		WHERE mv.charger_id = ? AND mv.ts >= ? AND mv.ts <= ?
+	`
+	args := []interface{}{id, from, to}
+
+	if measurandParam := r.URL.Query().Get("measurand"); measurandParam != "" {
+		var placeholders []string
+		for _, measurand := range strings.Split(measurandParam, ",") {
+			if measurand = strings.TrimSpace(measurand); measurand != "" {
+				placeholders = append(placeholders, "?")
+				args = append(args, measurand)
+			}
+		}
+		if len(placeholders) > 0 {
+			query += " AND mv.measurand IN (" + strings.Join(placeholders, ", ") + ")"
+		}
+	}
+
+	if connectorIdStr := r.URL.Query().Get("connector_id"); connectorIdStr != "" {
+		connectorId, err := strconv.Atoi(connectorIdStr)
+		if err != nil || connectorId < 0 {
+			http.Error(w, "Invalid connector ID", http.StatusBadRequest)
+			return
+		}
+		query += " AND mv.connector_id = ?"
+		args = append(args, connectorId)
+	}
+
+	query += " ORDER BY mv.ts ASC, mv.id ASC LIMIT " + strconv.Itoa(maxMeterValues)
+
+	rows, err := api.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		api.logger.Error("Failed to query meter values", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	values := []MeterValue{}
+	for rows.Next() {
+		var value MeterValue
+		if err := rows.Scan(
+			&value.ConnectorId,
+			&value.TransactionId,
+			&value.Timestamp,
+			&value.Measurand,
+			&value.Phase,
+			&value.Unit,
+			&value.Context,
+			&value.Location,
+			&value.Format,
+			&value.Value,
+			&value.RawValue,
+		); err != nil {
+			api.logger.Error("Failed to scan meter value", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		values = append(values, value)
+	}
+
+	if err = rows.Err(); err != nil {
+		api.logger.Error("Row iteration error", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(values)
+}
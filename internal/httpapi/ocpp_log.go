@@ -0,0 +1,278 @@
+package httpapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/ocpp"
+)
+
+// OCPPMessage is one frame of the OCPP message journal
+type OCPPMessage struct {
+	ID              int64           `json:"id"`
+	Station         string          `json:"station"`      // Identity the charger connected with
+	Direction       string          `json:"direction"`    // in (from the charger) or out (to the charger)
+	MessageType     *int            `json:"message_type"` // 2 CALL, 3 CALLRESULT, 4 CALLERROR; null if unparseable
+	MessageTypeName string          `json:"message_type_name"`
+	MessageID       *string         `json:"message_id"`
+	Action          *string         `json:"action"` // For results, the action of the CALL they answer
+	ErrorCode       *string         `json:"error_code"`
+	LatencyMs       *int64          `json:"latency_ms"` // For results, the time since the CALL
+	Payload         json.RawMessage `json:"payload"`    // The frame as sent, or a JSON string if it was not valid JSON
+	Timestamp       time.Time       `json:"timestamp"`
+}
+
+// OCPPMessageDetail is a frame with the CALL or answer it pairs with
+type OCPPMessageDetail struct {
+	OCPPMessage
+	Related *OCPPMessage `json:"related"` // The answer to a CALL, or the CALL a result answers
+}
+
+// OCPPMessagesPage is a page of the journal, newest first
+type OCPPMessagesPage struct {
+	Messages   []OCPPMessage `json:"messages"`
+	NextCursor *string       `json:"next_cursor"` // Pass as ?cursor= to get older messages; null on the last page
+}
+
+// ocppMessageSelect selects journal frames
+const ocppMessageSelect = `
+	SELECT id, identity, direction, message_type, message_id, action, error_code, latency_ms, payload, ts
+	FROM ocpp_messages
+`
+
+// OCPPLogAPI handles the OCPP message journal endpoints
+type OCPPLogAPI struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewOCPPLogAPI creates a new OCPP log API
+func NewOCPPLogAPI(db *sql.DB, logger *zap.Logger) *OCPPLogAPI {
+	return &OCPPLogAPI{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Routes returns the routes for the OCPP log API
+func (api *OCPPLogAPI) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", api.ListMessages)
+	r.Get("/{id}", api.GetMessage)
+	return r
+}
+
+// ListMessages handles GET /api/ocpp-log
+// Filters: station (identity) or station_id, action, direction (in or out), message_type (2, 3 or 4),
+// message_id, q (text in the frame), from/to (RFC3339); paging: limit (default 100, max 1000) and cursor
+func (api *OCPPLogAPI) ListMessages(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	query := ocppMessageSelect + " WHERE 1 = 1"
+	var args []interface{}
+
+	if station := params.Get("station"); station != "" {
+		query += " AND identity = ?"
+		args = append(args, station)
+	}
+	if stationID := params.Get("station_id"); stationID != "" {
+		id, err := strconv.ParseInt(stationID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid station_id", http.StatusBadRequest)
+			return
+		}
+		query += " AND identity = (SELECT identity FROM chargers WHERE id = ?)"
+		args = append(args, id)
+	}
+	if action := params.Get("action"); action != "" {
+		query += " AND action = ?"
+		args = append(args, action)
+	}
+	if direction := params.Get("direction"); direction != "" {
+		if direction != ocpp.JournalDirectionIn && direction != ocpp.JournalDirectionOut {
+			http.Error(w, "direction must be in or out", http.StatusBadRequest)
+			return
+		}
+		query += " AND direction = ?"
+		args = append(args, direction)
+	}
+	if messageType := params.Get("message_type"); messageType != "" {
+		n, err := strconv.Atoi(messageType)
+		if err != nil || n < 2 || n > 4 {
+			http.Error(w, "message_type must be 2, 3 or 4", http.StatusBadRequest)
+			return
+		}
+		query += " AND message_type = ?"
+		args = append(args, n)
+	}
+	if messageID := params.Get("message_id"); messageID != "" {
+		query += " AND message_id = ?"
+		args = append(args, messageID)
+	}
+	if text := params.Get("q"); text != "" {
+		query += " AND instr(payload, ?) > 0"
+		args = append(args, text)
+	}
+
+	for _, bound := range []struct{ param, condition string }{{"from", " AND ts >= ?"}, {"to", " AND ts < ?"}} {
+		value := params.Get(bound.param)
+		if value == "" {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid "+bound.param+" (use RFC3339)", http.StatusBadRequest)
+			return
+		}
+		query += bound.condition
+		args = append(args, ts.UTC())
+	}
+
+	// IDs grow with time, so the cursor is simply the last ID of the page
+	if cursor := params.Get("cursor"); cursor != "" {
+		id, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		query += " AND id < ?"
+		args = append(args, id)
+	}
+
+	limit := 100
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 1000 {
+			http.Error(w, "limit must be 1-1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	// One extra row tells whether there is another page
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := api.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		api.logger.Error("Failed to query OCPP journal", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	page := OCPPMessagesPage{Messages: []OCPPMessage{}}
+	for rows.Next() {
+		message, err := scanOCPPMessage(rows)
+		if err != nil {
+			api.logger.Error("Failed to scan OCPP journal row", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		page.Messages = append(page.Messages, *message)
+	}
+
+	if err = rows.Err(); err != nil {
+		api.logger.Error("Row iteration error", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if len(page.Messages) > limit {
+		page.Messages = page.Messages[:limit]
+		cursor := strconv.FormatInt(page.Messages[limit-1].ID, 10)
+		page.NextCursor = &cursor
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// GetMessage handles GET /api/ocpp-log/{id}
+// A CALL comes with the first answer to it and an answer with the last CALL before it with the same message ID
+func (api *OCPPLogAPI) GetMessage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+
+	message, err := scanOCPPMessage(api.db.QueryRowContext(r.Context(), ocppMessageSelect+" WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return
+		}
+		api.logger.Error("Failed to fetch OCPP journal message", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	detail := OCPPMessageDetail{OCPPMessage: *message}
+	if message.MessageType != nil && message.MessageID != nil {
+		// The other side answers a CALL, so the pair travels in opposite directions
+		query := ocppMessageSelect + " WHERE identity = ? AND message_id = ? AND direction <> ?"
+		if *message.MessageType == 2 {
+			query += " AND message_type IN (3, 4) AND id > ? ORDER BY id ASC LIMIT 1"
+		} else {
+			query += " AND message_type = 2 AND id < ? ORDER BY id DESC LIMIT 1"
+		}
+		related, err := scanOCPPMessage(api.db.QueryRowContext(r.Context(), query,
+			message.Station, *message.MessageID, message.Direction, message.ID))
+		if err != nil && err != sql.ErrNoRows {
+			api.logger.Error("Failed to fetch related OCPP journal message", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		detail.Related = related
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+// scanOCPPMessage reads an ocppMessageSelect row
+func scanOCPPMessage(row interface{ Scan(...interface{}) error }) (*OCPPMessage, error) {
+	var message OCPPMessage
+	var payload string
+	err := row.Scan(
+		&message.ID,
+		&message.Station,
+		&message.Direction,
+		&message.MessageType,
+		&message.MessageID,
+		&message.Action,
+		&message.ErrorCode,
+		&message.LatencyMs,
+		&payload,
+		&message.Timestamp,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if json.Valid([]byte(payload)) {
+		message.Payload = json.RawMessage(payload)
+	} else {
+		message.Payload, _ = json.Marshal(payload)
+	}
+
+	if message.MessageType != nil {
+		switch *message.MessageType {
+		case 2:
+			message.MessageTypeName = "CALL"
+		case 3:
+			message.MessageTypeName = "CALLRESULT"
+		case 4:
+			message.MessageTypeName = "CALLERROR"
+		}
+	}
+
+	return &message, nil
+}
@@ -0,0 +1,203 @@
+package httpapi
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/ocpp"
+)
+
+// Receipt is the document a driver gets for one completed charging session
+type Receipt struct {
+	Number      string        `json:"number"`
+	IssuedAt    time.Time     `json:"issued_at"`
+	Seller      Seller        `json:"seller"`
+	Transaction Transaction   `json:"transaction"`
+	Lines       []ReceiptLine `json:"lines"`
+}
+
+// ReceiptLine is one priced item of a receipt; amounts exclude VAT
+type ReceiptLine struct {
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	Unit        string  `json:"unit"`
+	UnitPrice   float64 `json:"unit_price"`
+	Amount      float64 `json:"amount"`
+}
+
+// GetReceipt handles GET /api/transactions/{id}/receipt
+// Query parameter format: pdf (default), html or json. The receipt is numbered the first time it is requested
+func (api *TransactionsAPI) GetReceipt(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	row := api.db.QueryRowContext(r.Context(), transactionSelect+" WHERE t.id = ?", id)
+	transaction, err := scanTransaction(row, time.Now())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+		api.logger.Error("Failed to fetch transaction", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if transaction.Cost == nil {
+		http.Error(w, "The transaction has no cost yet; it is still open or no tariff applies to it", http.StatusConflict)
+		return
+	}
+
+	seller, err := loadSeller(r.Context(), api.db)
+	if err != nil {
+		api.logger.Error("Failed to load seller details", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	number, issuedAt, err := issueDocumentNumber(r.Context(), api.db, documentKindReceipt, fmt.Sprintf("transaction:%d", transaction.ID), time.Now())
+	if err != nil {
+		api.logger.Error("Failed to number receipt", zap.Int64("transaction_id", transaction.ID), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	location, err := time.LoadLocation(transaction.Cost.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	receipt := Receipt{
+		Number:      number,
+		IssuedAt:    issuedAt,
+		Seller:      *seller,
+		Transaction: *transaction,
+		Lines:       receiptLines(transaction.Cost, location),
+	}
+
+	writeDocument(w, r, api.logger, receipt.view(location), "receipt-"+number, receipt)
+}
+
+// receiptLines itemizes a session's cost: energy and charging time per price, then idle time and the session fee
+func receiptLines(cost *ocpp.TransactionCost, location *time.Location) []ReceiptLine {
+	lines := []ReceiptLine{}
+
+	timeUnit, minutesPerUnit := "h", 60.0
+	if cost.TimeUnit == ocpp.TariffTimeUnitMinute {
+		timeUnit, minutesPerUnit = "min", 1
+	}
+
+	for _, line := range cost.Lines {
+		period := fmt.Sprintf("%s-%s", line.From.In(location).Format("15:04"), line.To.In(location).Format("15:04"))
+		if line.EnergyCost > 0 || line.EnergyPrice > 0 {
+			lines = append(lines, ReceiptLine{
+				Description: "Energy " + period,
+				Quantity:    line.EnergyKwh,
+				Unit:        "kWh",
+				UnitPrice:   line.EnergyPrice,
+				Amount:      line.EnergyCost,
+			})
+		}
+		if line.TimeCost > 0 || line.TimePrice > 0 {
+			lines = append(lines, ReceiptLine{
+				Description: "Charging time " + period,
+				Quantity:    line.Minutes / minutesPerUnit,
+				Unit:        timeUnit,
+				UnitPrice:   line.TimePrice,
+				Amount:      line.TimeCost,
+			})
+		}
+	}
+
+	if cost.IdleCost > 0 {
+		lines = append(lines, ReceiptLine{
+			Description: "Idle fee after charging completed",
+			Quantity:    cost.IdleMinutes,
+			Unit:        "min",
+			UnitPrice:   cost.IdlePrice,
+			Amount:      cost.IdleCost,
+		})
+	}
+
+	if cost.SessionFee > 0 {
+		lines = append(lines, ReceiptLine{
+			Description: "Session fee",
+			Quantity:    1,
+			UnitPrice:   cost.SessionFee,
+			Amount:      cost.SessionFee,
+		})
+	}
+
+	return lines
+}
+
+// view lays out the receipt for printing, with times in the tariff's timezone
+func (receipt *Receipt) view(location *time.Location) *documentView {
+	transaction := receipt.Transaction
+	cost := transaction.Cost
+
+	station := transaction.StationIdentity
+	if transaction.StationName != nil && *transaction.StationName != "" && *transaction.StationName != transaction.StationIdentity {
+		station = fmt.Sprintf("%s (%s)", *transaction.StationName, transaction.StationIdentity)
+	}
+
+	details := [][2]string{
+		{"Session", transaction.TransactionId},
+		{"Station", station},
+	}
+	if transaction.ConnectorId != nil {
+		details = append(details, [2]string{"Connector", strconv.Itoa(*transaction.ConnectorId)})
+	}
+	if transaction.IdTag != nil {
+		details = append(details, [2]string{"idTag", *transaction.IdTag})
+	}
+	details = append(details,
+		[2]string{"Started", transaction.StartTs.In(location).Format("2006-01-02 15:04")},
+		[2]string{"Stopped", transaction.StopTs.In(location).Format("2006-01-02 15:04")},
+		[2]string{"Energy", fmt.Sprintf("%.3f kWh", cost.EnergyKwh)},
+		[2]string{"Tariff", cost.TariffName},
+	)
+
+	view := &documentView{
+		Title:     "Receipt",
+		Number:    receipt.Number,
+		Date:      receipt.IssuedAt.In(location).Format("2006-01-02"),
+		Seller:    sellerLines(&receipt.Seller),
+		Details:   details,
+		Columns:   []string{"Description", "Quantity", "Unit price", "Amount (" + cost.Currency + ")"},
+		Widths:    []float64{4, 2, 2, 2},
+		RightFrom: 1,
+		Totals: [][2]string{
+			{"Subtotal", formatAmount(cost.Subtotal, cost.Currency)},
+			{fmt.Sprintf("VAT %g%%", cost.VATPercent), formatAmount(cost.VATAmount, cost.Currency)},
+			{"Total", formatAmount(cost.Total, cost.Currency)},
+		},
+		Note: "Times are in " + location.String() + ". Amounts exclude VAT unless stated otherwise.",
+	}
+
+	for _, line := range receipt.Lines {
+		quantity := "1"
+		unitPrice := formatUnitPrice(line.UnitPrice)
+		switch line.Unit {
+		case "":
+		case "kWh":
+			quantity = fmt.Sprintf("%.3f kWh", line.Quantity)
+			unitPrice += " /kWh"
+		default:
+			quantity = fmt.Sprintf("%.2f %s", line.Quantity, line.Unit)
+			unitPrice += " /" + line.Unit
+		}
+		view.Rows = append(view.Rows, []string{line.Description, quantity, unitPrice, fmt.Sprintf("%.2f", line.Amount)})
+	}
+
+	return view
+}
@@ -1,12 +1,15 @@
 package httpapi
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/ocpp"
 )
 
 // SettingsAPI handles settings-related HTTP endpoints
@@ -30,6 +33,12 @@ func (api *SettingsAPI) Routes() chi.Router {
 	r := chi.NewRouter()
 	r.Get("/", api.GetSettings)
 	r.Put("/", api.UpdateSettings)
+	r.Get("/seller", api.GetSeller)
+	r.Put("/seller", api.UpdateSeller)
+	r.Get("/ocpp-log", api.GetOCPPLogRetention)
+	r.Put("/ocpp-log", api.UpdateOCPPLogRetention)
+	r.Get("/security", api.GetSecuritySettings)
+	r.Put("/security", api.UpdateSecuritySettings)
 	r.Get("/status", api.GetServerStatus)
 	r.Post("/server/start", api.StartOCPPServer)
 	r.Post("/server/stop", api.StopOCPPServer)
@@ -135,6 +144,198 @@ func (api *SettingsAPI) UpdateSettings(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(settings)
 }
 
+// Seller holds the details of the charging operator printed on receipts and statements
+type Seller struct {
+	Name      string `json:"name"`
+	Address   string `json:"address"` // May span several lines
+	VATNumber string `json:"vat_number"`
+	Email     string `json:"email"`
+}
+
+// sellerSettingKeys maps the seller fields to their app_settings keys
+func sellerSettingKeys(seller *Seller) map[string]*string {
+	return map[string]*string{
+		"seller_name":       &seller.Name,
+		"seller_address":    &seller.Address,
+		"seller_vat_number": &seller.VATNumber,
+		"seller_email":      &seller.Email,
+	}
+}
+
+// loadSeller reads the seller details; fields that were never set are empty
+func loadSeller(ctx context.Context, db *sql.DB) (*Seller, error) {
+	rows, err := db.QueryContext(ctx, `SELECT key, value FROM app_settings WHERE key LIKE 'seller_%'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var seller Seller
+	fields := sellerSettingKeys(&seller)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		if field, ok := fields[key]; ok {
+			*field = value
+		}
+	}
+	return &seller, rows.Err()
+}
+
+// GetSeller handles GET /api/settings/seller
+func (api *SettingsAPI) GetSeller(w http.ResponseWriter, r *http.Request) {
+	seller, err := loadSeller(r.Context(), api.db)
+	if err != nil {
+		api.logger.Error("Failed to query seller details", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(seller)
+}
+
+// UpdateSeller handles PUT /api/settings/seller
+// Documents issued before keep their number but show the new details when downloaded again
+func (api *SettingsAPI) UpdateSeller(w http.ResponseWriter, r *http.Request) {
+	var seller Seller
+	if err := json.NewDecoder(r.Body).Decode(&seller); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if seller.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := api.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.logger.Error("Failed to begin transaction", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	updateQuery := `
+		INSERT INTO app_settings (key, value)
+		VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`
+	for key, value := range sellerSettingKeys(&seller) {
+		if _, err := tx.ExecContext(r.Context(), updateQuery, key, *value); err != nil {
+			api.logger.Error("Failed to update seller details", zap.String("key", key), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.logger.Error("Failed to commit seller details", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	api.logger.Info("Seller details updated", zap.String("name", seller.Name))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(seller)
+}
+
+// GetOCPPLogRetention handles GET /api/settings/ocpp-log
+func (api *SettingsAPI) GetOCPPLogRetention(w http.ResponseWriter, r *http.Request) {
+	retention, err := ocpp.LoadJournalRetention(r.Context(), api.db)
+	if err != nil {
+		api.logger.Error("Failed to query OCPP log retention", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(retention)
+}
+
+// UpdateOCPPLogRetention handles PUT /api/settings/ocpp-log
+// The limits apply from the next hourly prune
+func (api *SettingsAPI) UpdateOCPPLogRetention(w http.ResponseWriter, r *http.Request) {
+	var retention ocpp.JournalRetention
+	if err := json.NewDecoder(r.Body).Decode(&retention); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if retention.Days < 0 || retention.MaxMessages < 0 {
+		http.Error(w, "retention_days and max_messages must be >= 0", http.StatusBadRequest)
+		return
+	}
+
+	if err := ocpp.SaveJournalRetention(r.Context(), api.db, &retention); err != nil {
+		api.logger.Error("Failed to update OCPP log retention", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	api.logger.Info("OCPP log retention updated",
+		zap.Int("retention_days", retention.Days),
+		zap.Int("max_messages", retention.MaxMessages))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(retention)
+}
+
+// GetSecuritySettings handles GET /api/settings/security
+func (api *SettingsAPI) GetSecuritySettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := ocpp.LoadSecuritySettings(r.Context(), api.db)
+	if err != nil {
+		api.logger.Error("Failed to query security settings", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateSecuritySettings handles PUT /api/settings/security
+// Omitted fields keep their value; the settings apply to the next connection attempt
+func (api *SettingsAPI) UpdateSecuritySettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := ocpp.LoadSecuritySettings(r.Context(), api.db)
+	if err != nil {
+		api.logger.Error("Failed to query security settings", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(settings); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if settings.MaxFailedAttempts < 0 {
+		http.Error(w, "max_failed_attempts must be >= 0", http.StatusBadRequest)
+		return
+	}
+	if settings.LockoutMinutes < 1 {
+		http.Error(w, "lockout_minutes must be >= 1", http.StatusBadRequest)
+		return
+	}
+
+	if err := ocpp.SaveSecuritySettings(r.Context(), api.db, settings); err != nil {
+		api.logger.Error("Failed to update security settings", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	api.logger.Info("Security settings updated",
+		zap.Bool("allow_unknown_chargers", settings.AllowUnknownChargers),
+		zap.Int("max_failed_attempts", settings.MaxFailedAttempts),
+		zap.Int("lockout_minutes", settings.LockoutMinutes))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
 // ServerStatus represents the server status
 type ServerStatus struct {
 	OCPPServerRunning bool   `json:"ocppServerRunning"`
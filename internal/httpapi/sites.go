@@ -0,0 +1,645 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/ocpp"
+)
+
+// Site represents a grid connection whose capacity is shared by a group of chargers
+type Site struct {
+	ID          int64            `json:"id"`
+	Name        string           `json:"name"`
+	GridLimit   float64          `json:"grid_limit"`
+	LimitUnit   string           `json:"limit_unit"` // "A" per phase or "kW" in total
+	Phases      int              `json:"phases"`
+	Voltage     float64          `json:"voltage"` // Phase voltage used to convert between kW and A
+	Strategy    string           `json:"strategy"`
+	MinCurrentA float64          `json:"min_current_a"` // Below this a session is paused instead of throttled
+	Chargers    []SiteCharger    `json:"chargers"`
+	Allocations []SiteAllocation `json:"allocations"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// SiteCharger is a charger that belongs to a site
+type SiteCharger struct {
+	StationID   int64    `json:"station_id"`
+	Identity    string   `json:"identity"`
+	Name        *string  `json:"name"`
+	Priority    int      `json:"priority"` // Higher is served first with the priority strategy
+	MaxOutputKW *float64 `json:"max_output_kw"`
+}
+
+// SiteAllocation is the last current limit sent to a charging connector of a site
+type SiteAllocation struct {
+	StationID     int64     `json:"station_id"`
+	Identity      string    `json:"identity"`
+	ConnectorId   int       `json:"connector_id"`
+	TransactionId string    `json:"transaction_id"`
+	LimitA        float64   `json:"limit_a"`
+	Status        *string   `json:"status"`
+	Error         *string   `json:"error"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// SiteRequest represents the request to create or update a site
+type SiteRequest struct {
+	Name        string   `json:"name"`
+	GridLimit   float64  `json:"grid_limit"`
+	LimitUnit   string   `json:"limit_unit"`    // Defaults to A
+	Phases      int      `json:"phases"`        // Defaults to 3
+	Voltage     float64  `json:"voltage"`       // Defaults to 230
+	Strategy    string   `json:"strategy"`      // Defaults to equal
+	MinCurrentA *float64 `json:"min_current_a"` // Defaults to 6
+}
+
+// SetSiteChargersRequest represents the request to set which chargers belong to a site
+type SetSiteChargersRequest struct {
+	Chargers []struct {
+		StationID int64 `json:"station_id"`
+		Priority  int   `json:"priority"`
+	} `json:"chargers"`
+}
+
+// SitesAPI handles site and load management endpoints
+type SitesAPI struct {
+	db         *sql.DB
+	logger     *zap.Logger
+	ocppServer OCPPServer
+}
+
+// NewSitesAPI creates a new sites API
+func NewSitesAPI(db *sql.DB, logger *zap.Logger, ocppServer OCPPServer) *SitesAPI {
+	return &SitesAPI{
+		db:         db,
+		logger:     logger,
+		ocppServer: ocppServer,
+	}
+}
+
+// Routes returns the routes for the sites API
+func (api *SitesAPI) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", api.ListSites)
+	r.Post("/", api.CreateSite)
+	r.Get("/{id}", api.GetSite)
+	r.Put("/{id}", api.UpdateSite)
+	r.Delete("/{id}", api.DeleteSite)
+
+	// Chargers sharing the site's grid connection
+	r.Put("/{id}/chargers", api.SetSiteChargers)
+
+	// Recalculate and push the connector limits now
+	r.Post("/{id}/rebalance", api.RebalanceSite)
+	return r
+}
+
+// ListSites handles GET /api/sites
+func (api *SitesAPI) ListSites(w http.ResponseWriter, r *http.Request) {
+	rows, err := api.db.QueryContext(r.Context(), `SELECT id FROM sites ORDER BY id ASC`)
+	if err != nil {
+		api.logger.Error("Failed to query sites", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			api.logger.Error("Failed to scan site", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	sites := []Site{}
+	for _, id := range ids {
+		site, err := api.getSiteByID(r.Context(), id)
+		if err != nil {
+			api.logger.Error("Failed to fetch site", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		sites = append(sites, *site)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sites)
+}
+
+// GetSite handles GET /api/sites/{id}
+func (api *SitesAPI) GetSite(w http.ResponseWriter, r *http.Request) {
+	id, ok := siteIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	site, err := api.getSiteByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Site not found", http.StatusNotFound)
+			return
+		}
+		api.logger.Error("Failed to fetch site", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(site)
+}
+
+// CreateSite handles POST /api/sites
+func (api *SitesAPI) CreateSite(w http.ResponseWriter, r *http.Request) {
+	var req SiteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateSiteRequest(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := `
+		INSERT INTO sites (name, grid_limit, limit_unit, phases, voltage, strategy, min_current_a, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	result, err := api.db.ExecContext(r.Context(), query,
+		req.Name,
+		req.GridLimit,
+		req.LimitUnit,
+		req.Phases,
+		req.Voltage,
+		req.Strategy,
+		*req.MinCurrentA,
+		now,
+		now,
+	)
+	if err != nil {
+		api.logger.Error("Failed to create site", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		api.logger.Error("Failed to get last insert ID", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	site, err := api.getSiteByID(r.Context(), id)
+	if err != nil {
+		api.logger.Error("Failed to fetch created site", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(site)
+}
+
+// UpdateSite handles PUT /api/sites/{id}
+// A changed limit or strategy is applied to the running sessions right away
+func (api *SitesAPI) UpdateSite(w http.ResponseWriter, r *http.Request) {
+	id, ok := siteIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req SiteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateSiteRequest(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := `
+		UPDATE sites
+		SET name = ?, grid_limit = ?, limit_unit = ?, phases = ?, voltage = ?, strategy = ?, min_current_a = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	result, err := api.db.ExecContext(r.Context(), query,
+		req.Name,
+		req.GridLimit,
+		req.LimitUnit,
+		req.Phases,
+		req.Voltage,
+		req.Strategy,
+		*req.MinCurrentA,
+		time.Now(),
+		id,
+	)
+	if err != nil {
+		api.logger.Error("Failed to update site", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		api.logger.Error("Failed to get rows affected", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "Site not found", http.StatusNotFound)
+		return
+	}
+
+	go api.rebalanceInBackground(id)
+
+	site, err := api.getSiteByID(r.Context(), id)
+	if err != nil {
+		api.logger.Error("Failed to fetch updated site", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(site)
+}
+
+// DeleteSite handles DELETE /api/sites/{id}
+// Its chargers are released and the load limits sent to them are cleared
+func (api *SitesAPI) DeleteSite(w http.ResponseWriter, r *http.Request) {
+	id, ok := siteIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := api.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.logger.Error("Failed to begin transaction", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	released, err := siteChargerIdentities(r.Context(), tx, id)
+	if err != nil {
+		api.logger.Error("Failed to look up site chargers", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), `UPDATE chargers SET site_id = NULL WHERE site_id = ?`, id); err != nil {
+		api.logger.Error("Failed to release site chargers", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := tx.ExecContext(r.Context(), `DELETE FROM sites WHERE id = ?`, id)
+	if err != nil {
+		api.logger.Error("Failed to delete site", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		api.logger.Error("Failed to get rows affected", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "Site not found", http.StatusNotFound)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.logger.Error("Failed to commit site deletion", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	go api.releaseChargersInBackground(released)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetSiteChargers handles PUT /api/sites/{id}/chargers
+// The list replaces the site's chargers; a charger can only belong to one site
+// Chargers that are no longer in the list have their load limits cleared
+func (api *SitesAPI) SetSiteChargers(w http.ResponseWriter, r *http.Request) {
+	id, ok := siteIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req SetSiteChargersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := api.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.logger.Error("Failed to begin transaction", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM sites WHERE id = ?`, id).Scan(&exists); err != nil {
+		api.logger.Error("Failed to look up site", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if exists == 0 {
+		http.Error(w, "Site not found", http.StatusNotFound)
+		return
+	}
+
+	previous, err := siteChargerIdentities(r.Context(), tx, id)
+	if err != nil {
+		api.logger.Error("Failed to look up site chargers", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), `UPDATE chargers SET site_id = NULL, priority = 0 WHERE site_id = ?`, id); err != nil {
+		api.logger.Error("Failed to release site chargers", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Sites that lose a charger to this one have capacity to hand out to their other sessions
+	otherSites := map[int64]bool{}
+	for _, charger := range req.Chargers {
+		var currentSite sql.NullInt64
+		err := tx.QueryRowContext(r.Context(), `SELECT site_id FROM chargers WHERE id = ?`, charger.StationID).Scan(&currentSite)
+		if err != nil && err != sql.ErrNoRows {
+			api.logger.Error("Failed to look up charger site", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if currentSite.Valid && currentSite.Int64 != id {
+			otherSites[currentSite.Int64] = true
+		}
+
+		result, err := tx.ExecContext(r.Context(),
+			`UPDATE chargers SET site_id = ?, priority = ? WHERE id = ?`,
+			id, charger.Priority, charger.StationID)
+		if err != nil {
+			api.logger.Error("Failed to assign charger to site", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, fmt.Sprintf("Station %d not found", charger.StationID), http.StatusBadRequest)
+			return
+		}
+		delete(previous, charger.StationID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.logger.Error("Failed to commit site chargers", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	go api.releaseChargersInBackground(previous)
+	go api.rebalanceInBackground(id)
+	for otherSite := range otherSites {
+		go api.rebalanceInBackground(otherSite)
+	}
+
+	site, err := api.getSiteByID(r.Context(), id)
+	if err != nil {
+		api.logger.Error("Failed to fetch site", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(site)
+}
+
+// RebalanceSite handles POST /api/sites/{id}/rebalance
+// It recalculates the connector limits and returns what was sent to each charger
+func (api *SitesAPI) RebalanceSite(w http.ResponseWriter, r *http.Request) {
+	id, ok := siteIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	allocations, err := api.ocppServer.RebalanceSite(r.Context(), id)
+	if err != nil {
+		if _, lookupErr := api.getSiteByID(r.Context(), id); lookupErr == sql.ErrNoRows {
+			http.Error(w, "Site not found", http.StatusNotFound)
+			return
+		}
+		api.logger.Error("Failed to rebalance site", zap.Int64("site_id", id), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(allocations)
+}
+
+// rebalanceInBackground applies site changes to running sessions without holding up the HTTP response
+func (api *SitesAPI) rebalanceInBackground(id int64) {
+	if _, err := api.ocppServer.RebalanceSite(context.Background(), id); err != nil {
+		api.logger.Error("Failed to rebalance site", zap.Int64("site_id", id), zap.Error(err))
+	}
+}
+
+// releaseChargersInBackground clears the load limits of chargers that left a site
+// A charger that is offline keeps its limit until its session ends
+func (api *SitesAPI) releaseChargersInBackground(chargers map[int64]string) {
+	for _, identity := range chargers {
+		if err := api.ocppServer.ReleaseLoadLimit(context.Background(), identity); err != nil {
+			api.logger.Error("Failed to clear load limit", zap.String("charge_point_id", identity), zap.Error(err))
+		}
+	}
+}
+
+// siteChargerIdentities returns the OCPP identities of a site's chargers keyed by station ID
+func siteChargerIdentities(ctx context.Context, tx *sql.Tx, siteID int64) (map[int64]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id, identity FROM chargers WHERE site_id = ?`, siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chargers := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var identity string
+		if err := rows.Scan(&id, &identity); err != nil {
+			return nil, err
+		}
+		chargers[id] = identity
+	}
+	return chargers, rows.Err()
+}
+
+// getSiteByID fetches a site with its chargers and current allocations
+func (api *SitesAPI) getSiteByID(ctx context.Context, id int64) (*Site, error) {
+	query := `
+		SELECT id, name, grid_limit, limit_unit, phases, voltage, strategy, min_current_a, created_at, updated_at
+		FROM sites
+		WHERE id = ?
+	`
+
+	var site Site
+	err := api.db.QueryRowContext(ctx, query, id).Scan(
+		&site.ID,
+		&site.Name,
+		&site.GridLimit,
+		&site.LimitUnit,
+		&site.Phases,
+		&site.Voltage,
+		&site.Strategy,
+		&site.MinCurrentA,
+		&site.CreatedAt,
+		&site.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	chargerRows, err := api.db.QueryContext(ctx,
+		`SELECT id, identity, name, priority, max_output_kw FROM chargers WHERE site_id = ? ORDER BY priority DESC, id ASC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer chargerRows.Close()
+
+	site.Chargers = []SiteCharger{}
+	for chargerRows.Next() {
+		var charger SiteCharger
+		if err := chargerRows.Scan(&charger.StationID, &charger.Identity, &charger.Name, &charger.Priority, &charger.MaxOutputKW); err != nil {
+			return nil, err
+		}
+		site.Chargers = append(site.Chargers, charger)
+	}
+	if err := chargerRows.Err(); err != nil {
+		return nil, err
+	}
+
+	allocationQuery := `
+		SELECT c.id, c.identity, la.connector_id, t.tx_id, la.limit_a, la.status, la.error, la.updated_at
+		FROM load_allocations la
+		JOIN chargers c ON c.id = la.charger_id
+		JOIN transactions t ON t.id = la.transaction_id
+		WHERE c.site_id = ? AND t.stop_ts IS NULL
+		ORDER BY c.id ASC, la.connector_id ASC
+	`
+
+	allocationRows, err := api.db.QueryContext(ctx, allocationQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer allocationRows.Close()
+
+	site.Allocations = []SiteAllocation{}
+	for allocationRows.Next() {
+		var allocation SiteAllocation
+		if err := allocationRows.Scan(
+			&allocation.StationID,
+			&allocation.Identity,
+			&allocation.ConnectorId,
+			&allocation.TransactionId,
+			&allocation.LimitA,
+			&allocation.Status,
+			&allocation.Error,
+			&allocation.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		site.Allocations = append(site.Allocations, allocation)
+	}
+
+	return &site, allocationRows.Err()
+}
+
+// siteIDFromURL parses the {id} URL parameter of a site
+// It writes the error response itself and returns false if the ID is invalid
+func siteIDFromURL(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid site ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// validateSiteRequest validates a site request and fills in the defaults
+func validateSiteRequest(req *SiteRequest) error {
+	if req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if req.GridLimit <= 0 {
+		return fmt.Errorf("grid_limit must be > 0")
+	}
+
+	if req.LimitUnit == "" {
+		req.LimitUnit = "A"
+	}
+	if req.LimitUnit != "A" && req.LimitUnit != "kW" {
+		return fmt.Errorf("limit_unit must be A or kW")
+	}
+
+	if req.Phases == 0 {
+		req.Phases = 3
+	}
+	if req.Phases != 1 && req.Phases != 3 {
+		return fmt.Errorf("phases must be 1 or 3")
+	}
+
+	if req.Voltage == 0 {
+		req.Voltage = 230
+	}
+	if req.Voltage < 0 {
+		return fmt.Errorf("voltage must be > 0")
+	}
+
+	if req.Strategy == "" {
+		req.Strategy = ocpp.LoadStrategyEqual
+	}
+	switch req.Strategy {
+	case ocpp.LoadStrategyEqual, ocpp.LoadStrategyFirstCome, ocpp.LoadStrategyPriority:
+	default:
+		return fmt.Errorf("strategy must be equal, first_come or priority")
+	}
+
+	if req.MinCurrentA == nil {
+		minCurrentA := 6.0
+		req.MinCurrentA = &minCurrentA
+	}
+	if *req.MinCurrentA < 0 {
+		return fmt.Errorf("min_current_a must be >= 0")
+	}
+
+	return nil
+}
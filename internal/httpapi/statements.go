@@ -0,0 +1,295 @@
+package httpapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/ocpp"
+)
+
+// Statement lists a month of priced charging sessions of an idTag or an idTag group, e.g. for a fleet owner
+type Statement struct {
+	Number     *string            `json:"number"` // Null for a draft of a month that has not ended yet
+	IssuedAt   time.Time          `json:"issued_at"`
+	Seller     Seller             `json:"seller"`
+	IdTag      *string            `json:"id_tag"`
+	IdTagGroup *string            `json:"id_tag_group"`
+	Month      string             `json:"month"` // YYYY-MM
+	Timezone   string             `json:"timezone"`
+	Sessions   []StatementSession `json:"sessions"`
+	Totals     []StatementTotal   `json:"totals"` // One per currency
+}
+
+// StatementSession is one completed session on a statement
+type StatementSession struct {
+	TransactionID   int64     `json:"transaction_id"`
+	StationIdentity string    `json:"station_identity"`
+	StationName     *string   `json:"station_name"`
+	IdTag           *string   `json:"id_tag"`
+	StartTs         time.Time `json:"start_ts"`
+	StopTs          time.Time `json:"stop_ts"`
+	EnergyKwh       float64   `json:"energy_kwh"`
+	Currency        string    `json:"currency"`
+	Subtotal        float64   `json:"subtotal"`
+	VATAmount       float64   `json:"vat_amount"`
+	Total           float64   `json:"total"`
+}
+
+// StatementTotal sums the sessions of a statement in one currency
+type StatementTotal struct {
+	Currency  string  `json:"currency"`
+	EnergyKwh float64 `json:"energy_kwh"`
+	Subtotal  float64 `json:"subtotal"`
+	VATAmount float64 `json:"vat_amount"`
+	Total     float64 `json:"total"`
+}
+
+// StatementsAPI handles monthly statement endpoints
+type StatementsAPI struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewStatementsAPI creates a new statements API
+func NewStatementsAPI(db *sql.DB, logger *zap.Logger) *StatementsAPI {
+	return &StatementsAPI{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Routes returns the routes for the statements API
+func (api *StatementsAPI) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", api.GetStatement)
+	return r
+}
+
+// GetStatement handles GET /api/statements
+// Query parameters: id_tag or id_tag_group (sessions of the tag itself and of tags with it as parent),
+// month (YYYY-MM, defaults to last month), timezone (of the month, defaults to UTC) and format (pdf, html or json).
+// Sessions count in the month they stopped in. A statement is numbered once its month has ended
+func (api *StatementsAPI) GetStatement(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	statement := Statement{Sessions: []StatementSession{}, Totals: []StatementTotal{}}
+	idTag, group := params.Get("id_tag"), params.Get("id_tag_group")
+	switch {
+	case idTag != "" && group == "":
+		statement.IdTag = &idTag
+	case group != "" && idTag == "":
+		statement.IdTagGroup = &group
+	default:
+		http.Error(w, "Set either id_tag or id_tag_group", http.StatusBadRequest)
+		return
+	}
+
+	statement.Timezone = params.Get("timezone")
+	if statement.Timezone == "" {
+		statement.Timezone = "UTC"
+	}
+	location, err := time.LoadLocation(statement.Timezone)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unknown timezone %q", statement.Timezone), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	from := time.Date(now.In(location).Year(), now.In(location).Month(), 1, 0, 0, 0, 0, location).AddDate(0, -1, 0)
+	if month := params.Get("month"); month != "" {
+		from, err = time.ParseInLocation("2006-01", month, location)
+		if err != nil {
+			http.Error(w, "Invalid month (use YYYY-MM)", http.StatusBadRequest)
+			return
+		}
+	}
+	to := from.AddDate(0, 1, 0)
+	statement.Month = from.Format("2006-01")
+
+	query := `
+		SELECT t.id, c.identity, c.name, t.id_tag, t.start_ts, t.stop_ts, tc.breakdown
+		FROM transactions t
+		JOIN chargers c ON c.id = t.charger_id
+		JOIN transaction_costs tc ON tc.transaction_id = t.id
+		LEFT JOIN id_tags it ON it.tag = t.id_tag
+		WHERE t.stop_ts >= ? AND t.stop_ts < ?
+	`
+	args := []interface{}{from.UTC(), to.UTC()}
+	if statement.IdTag != nil {
+		query += " AND t.id_tag = ?"
+		args = append(args, idTag)
+	} else {
+		query += " AND (t.id_tag = ? OR it.parent_id_tag = ?)"
+		args = append(args, group, group)
+	}
+	query += " ORDER BY t.stop_ts ASC, t.id ASC"
+
+	rows, err := api.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		api.logger.Error("Failed to query statement sessions", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	totals := make(map[string]*StatementTotal)
+	for rows.Next() {
+		var session StatementSession
+		var breakdown string
+		if err := rows.Scan(
+			&session.TransactionID,
+			&session.StationIdentity,
+			&session.StationName,
+			&session.IdTag,
+			&session.StartTs,
+			&session.StopTs,
+			&breakdown,
+		); err != nil {
+			api.logger.Error("Failed to scan statement session", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		var cost ocpp.TransactionCost
+		if err := json.Unmarshal([]byte(breakdown), &cost); err != nil {
+			api.logger.Error("Invalid cost breakdown", zap.Int64("transaction_id", session.TransactionID), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		session.EnergyKwh = cost.EnergyKwh
+		session.Currency = cost.Currency
+		session.Subtotal = cost.Subtotal
+		session.VATAmount = cost.VATAmount
+		session.Total = cost.Total
+		statement.Sessions = append(statement.Sessions, session)
+
+		total, ok := totals[cost.Currency]
+		if !ok {
+			total = &StatementTotal{Currency: cost.Currency}
+			totals[cost.Currency] = total
+		}
+		total.EnergyKwh += cost.EnergyKwh
+		total.Subtotal += cost.Subtotal
+		total.VATAmount += cost.VATAmount
+		total.Total += cost.Total
+	}
+
+	if err = rows.Err(); err != nil {
+		api.logger.Error("Row iteration error", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if len(statement.Sessions) == 0 {
+		http.Error(w, "No priced sessions in "+statement.Month, http.StatusNotFound)
+		return
+	}
+
+	for _, total := range totals {
+		// Sums of floats drift, e.g. 0.1 + 0.2; amounts are whole cents
+		total.EnergyKwh = math.Round(total.EnergyKwh*1000) / 1000
+		total.Subtotal = math.Round(total.Subtotal*100) / 100
+		total.VATAmount = math.Round(total.VATAmount*100) / 100
+		total.Total = math.Round(total.Total*100) / 100
+		statement.Totals = append(statement.Totals, *total)
+	}
+	sort.Slice(statement.Totals, func(i, j int) bool { return statement.Totals[i].Currency < statement.Totals[j].Currency })
+
+	seller, err := loadSeller(r.Context(), api.db)
+	if err != nil {
+		api.logger.Error("Failed to load seller details", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	statement.Seller = *seller
+
+	statement.IssuedAt = now
+	filename := "statement-draft-" + statement.Month
+	if !to.After(now) {
+		subject := "id_tag:" + idTag
+		if statement.IdTagGroup != nil {
+			subject = "id_tag_group:" + group
+		}
+		reference := fmt.Sprintf("%s:%s:%s", subject, statement.Month, statement.Timezone)
+
+		number, issuedAt, err := issueDocumentNumber(r.Context(), api.db, documentKindStatement, reference, now)
+		if err != nil {
+			api.logger.Error("Failed to number statement", zap.String("reference", reference), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		statement.Number = &number
+		statement.IssuedAt = issuedAt
+		filename = "statement-" + number
+	}
+
+	writeDocument(w, r, api.logger, statement.view(location), filename, statement)
+}
+
+// view lays out the statement for printing, with times in the statement's timezone
+func (statement *Statement) view(location *time.Location) *documentView {
+	view := &documentView{
+		Title:     "Statement",
+		Date:      statement.IssuedAt.In(location).Format("2006-01-02"),
+		Seller:    sellerLines(&statement.Seller),
+		Columns:   []string{"Stopped", "Station", "idTag", "kWh", "Excl. VAT", "VAT", "Total"},
+		Widths:    []float64{2.4, 2.6, 2, 1.3, 1.6, 1.3, 1.6},
+		RightFrom: 3,
+		Note:      "Times are in " + statement.Timezone + ". Sessions count in the month they stopped in.",
+	}
+	if statement.Number != nil {
+		view.Number = *statement.Number
+	} else {
+		view.Title = "Statement (draft)"
+		view.Note += " This draft is not numbered until the month has ended."
+	}
+
+	if statement.IdTag != nil {
+		view.Details = append(view.Details, [2]string{"idTag", *statement.IdTag})
+	} else {
+		view.Details = append(view.Details, [2]string{"idTag group", *statement.IdTagGroup})
+	}
+	view.Details = append(view.Details,
+		[2]string{"Period", statement.Month},
+		[2]string{"Sessions", fmt.Sprint(len(statement.Sessions))},
+	)
+
+	for _, session := range statement.Sessions {
+		station := session.StationIdentity
+		if session.StationName != nil && *session.StationName != "" {
+			station = *session.StationName
+		}
+		idTag := ""
+		if session.IdTag != nil {
+			idTag = *session.IdTag
+		}
+		view.Rows = append(view.Rows, []string{
+			session.StopTs.In(location).Format("2006-01-02 15:04"),
+			station,
+			idTag,
+			fmt.Sprintf("%.3f", session.EnergyKwh),
+			formatAmount(session.Subtotal, session.Currency),
+			formatAmount(session.VATAmount, session.Currency),
+			formatAmount(session.Total, session.Currency),
+		})
+	}
+
+	for _, total := range statement.Totals {
+		view.Totals = append(view.Totals,
+			[2]string{fmt.Sprintf("Energy (%s sessions)", total.Currency), fmt.Sprintf("%.3f kWh", total.EnergyKwh)},
+			[2]string{"Total excl. VAT", formatAmount(total.Subtotal, total.Currency)},
+			[2]string{"VAT", formatAmount(total.VATAmount, total.Currency)},
+			[2]string{"Total", formatAmount(total.Total, total.Currency)},
+		)
+	}
+
+	return view
+}
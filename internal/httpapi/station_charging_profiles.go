@@ -0,0 +1,647 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/ocpp"
+)
+
+// ChargingProfile represents a charging profile defined for a station
+// A TxProfile is dropped by the charger when its transaction ends, so Installed can be stale for those
+type ChargingProfile struct {
+	ID             int64                   `json:"id"` // Also the chargingProfileId sent to the charger
+	ConnectorId    int                     `json:"connector_id"`
+	Purpose        string                  `json:"purpose"` // ChargePointMaxProfile, TxDefaultProfile or TxProfile
+	StackLevel     int                     `json:"stack_level"`
+	Kind           string                  `json:"kind"` // Absolute, Recurring or Relative
+	RecurrencyKind *string                 `json:"recurrency_kind"`
+	TransactionId  *int                    `json:"transaction_id"`
+	ValidFrom      *time.Time              `json:"valid_from"`
+	ValidTo        *time.Time              `json:"valid_to"`
+	Schedule       *types.ChargingSchedule `json:"schedule"`
+	Installed      bool                    `json:"installed"`
+	Status         *string                 `json:"status"` // Charger's answer to the last install or clear
+	Error          *string                 `json:"error"`
+	InstalledAt    *time.Time              `json:"installed_at"`
+	CreatedAt      time.Time               `json:"created_at"`
+	UpdatedAt      time.Time               `json:"updated_at"`
+}
+
+// ChargingProfileRequest represents the request to define a charging profile
+type ChargingProfileRequest struct {
+	ConnectorId    *int                    `json:"connector_id"` // 0 means the whole station
+	Purpose        string                  `json:"purpose"`
+	StackLevel     int                     `json:"stack_level"`
+	Kind           string                  `json:"kind"`
+	RecurrencyKind *string                 `json:"recurrency_kind"` // Daily or Weekly, Recurring only
+	TransactionId  *int                    `json:"transaction_id"`  // TxProfile only
+	ValidFrom      *time.Time              `json:"valid_from"`
+	ValidTo        *time.Time              `json:"valid_to"`
+	Schedule       *types.ChargingSchedule `json:"schedule"` // OCPP ChargingSchedule (chargingRateUnit, chargingSchedulePeriod, ...)
+}
+
+// ClearChargingProfilesRequest represents the request to clear profiles on the charger by criteria
+type ClearChargingProfilesRequest struct {
+	ConnectorId *int    `json:"connector_id"`
+	Purpose     *string `json:"purpose"`
+	StackLevel  *int    `json:"stack_level"`
+}
+
+// CompositeScheduleResponse is the schedule the charger will apply on a connector
+type CompositeScheduleResponse struct {
+	Status           string                  `json:"status"`
+	ConnectorId      *int                    `json:"connector_id"`
+	ScheduleStart    *time.Time              `json:"schedule_start"`
+	ChargingSchedule *types.ChargingSchedule `json:"charging_schedule"`
+}
+
+// ListChargingProfiles handles GET /api/stations/{id}/charging-profiles
+func (api *StationsAPI) ListChargingProfiles(w http.ResponseWriter, r *http.Request) {
+	id, _, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	query := chargingProfileSelect + ` WHERE charger_id = ? ORDER BY connector_id ASC, purpose ASC, stack_level DESC, id ASC`
+
+	rows, err := api.db.QueryContext(r.Context(), query, id)
+	if err != nil {
+		api.logger.Error("Failed to query charging profiles", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	profiles := []ChargingProfile{}
+	for rows.Next() {
+		profile, err := scanChargingProfile(rows)
+		if err != nil {
+			api.logger.Error("Failed to scan charging profile", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		profiles = append(profiles, *profile)
+	}
+
+	if err = rows.Err(); err != nil {
+		api.logger.Error("Row iteration error", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profiles)
+}
+
+// CreateChargingProfile handles POST /api/stations/{id}/charging-profiles
+// The profile is only stored; it is sent to the charger with the install endpoint
+func (api *StationsAPI) CreateChargingProfile(w http.ResponseWriter, r *http.Request) {
+	id, _, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req ChargingProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateChargingProfileRequest(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	schedule, err := json.Marshal(req.Schedule)
+	if err != nil {
+		http.Error(w, "Invalid schedule", http.StatusBadRequest)
+		return
+	}
+
+	query := `
+		INSERT INTO charging_profiles (charger_id, connector_id, purpose, stack_level, kind, recurrency_kind, transaction_id, valid_from, valid_to, schedule, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	result, err := api.db.ExecContext(r.Context(), query,
+		id,
+		*req.ConnectorId,
+		req.Purpose,
+		req.StackLevel,
+		req.Kind,
+		req.RecurrencyKind,
+		req.TransactionId,
+		req.ValidFrom,
+		req.ValidTo,
+		string(schedule),
+		now,
+		now,
+	)
+	if err != nil {
+		api.logger.Error("Failed to create charging profile", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	profileID, err := result.LastInsertId()
+	if err != nil {
+		api.logger.Error("Failed to get last insert ID", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	profile, err := api.getChargingProfile(r.Context(), id, profileID)
+	if err != nil {
+		api.logger.Error("Failed to fetch created charging profile", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(profile)
+}
+
+// DeleteChargingProfile handles DELETE /api/stations/{id}/charging-profiles/{profileId}
+// A profile that is installed on the charger has to be cleared first
+func (api *StationsAPI) DeleteChargingProfile(w http.ResponseWriter, r *http.Request) {
+	profile, _, ok := api.chargingProfileFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if profile.Installed {
+		http.Error(w, "Charging profile is installed on the station, clear it first", http.StatusConflict)
+		return
+	}
+
+	if _, err := api.db.ExecContext(r.Context(), `DELETE FROM charging_profiles WHERE id = ?`, profile.ID); err != nil {
+		api.logger.Error("Failed to delete charging profile", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// InstallChargingProfile handles POST /api/stations/{id}/charging-profiles/{profileId}/install
+// It sends the profile with SetChargingProfile and records the charger's answer
+func (api *StationsAPI) InstallChargingProfile(w http.ResponseWriter, r *http.Request) {
+	profile, identity, ok := api.chargingProfileFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	confirmation, err := api.ocppServer.SetChargingProfile(r.Context(), identity, profile.ConnectorId, profile.ocppProfile())
+	if err != nil {
+		api.recordChargingProfileError(profile.ID, err)
+		api.writeCommandError(w, identity, "SetChargingProfile", err)
+		return
+	}
+
+	if err := api.recordChargingProfileInstall(r.Context(), profile, string(confirmation.Status)); err != nil {
+		api.logger.Error("Failed to record charging profile install", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	api.writeChargingProfile(w, r, profile.ID)
+}
+
+// ClearChargingProfile handles POST /api/stations/{id}/charging-profiles/{profileId}/clear
+// It removes the profile from the charger by its ID; the stored definition is kept
+func (api *StationsAPI) ClearChargingProfile(w http.ResponseWriter, r *http.Request) {
+	profile, identity, ok := api.chargingProfileFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	profileID := int(profile.ID)
+	confirmation, err := api.ocppServer.ClearChargingProfile(r.Context(), identity, &ocpp.ClearChargingProfileRequest{Id: &profileID})
+	if err != nil {
+		api.recordChargingProfileError(profile.ID, err)
+		api.writeCommandError(w, identity, "ClearChargingProfile", err)
+		return
+	}
+
+	// Unknown means the charger does not have the profile (any more), which is cleared as well
+	query := `UPDATE charging_profiles SET installed = 0, status = ?, error = NULL, updated_at = ? WHERE id = ?`
+	if _, err := api.db.ExecContext(r.Context(), query, string(confirmation.Status), time.Now(), profile.ID); err != nil {
+		api.logger.Error("Failed to record charging profile clear", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	api.writeChargingProfile(w, r, profile.ID)
+}
+
+// ClearChargingProfiles handles POST /api/stations/{id}/charging-profiles/clear
+// It removes every profile matching the given criteria from the charger; no criteria clears all of them
+func (api *StationsAPI) ClearChargingProfiles(w http.ResponseWriter, r *http.Request) {
+	id, identity, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional - no body means every profile
+	var req ClearChargingProfilesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.ConnectorId != nil && *req.ConnectorId < 0 {
+		http.Error(w, "connector_id must be >= 0", http.StatusBadRequest)
+		return
+	}
+	if req.Purpose != nil && !validChargingProfilePurpose(*req.Purpose) {
+		http.Error(w, "purpose must be ChargePointMaxProfile, TxDefaultProfile or TxProfile", http.StatusBadRequest)
+		return
+	}
+	if req.StackLevel != nil && *req.StackLevel < 0 {
+		http.Error(w, "stack_level must be >= 0", http.StatusBadRequest)
+		return
+	}
+
+	request := &ocpp.ClearChargingProfileRequest{
+		ConnectorId: req.ConnectorId,
+		StackLevel:  req.StackLevel,
+	}
+	if req.Purpose != nil {
+		request.ChargingProfilePurpose = types.ChargingProfilePurposeType(*req.Purpose)
+	}
+
+	confirmation, err := api.ocppServer.ClearChargingProfile(r.Context(), identity, request)
+	if err != nil {
+		api.writeCommandError(w, identity, "ClearChargingProfile", err)
+		return
+	}
+
+	if confirmation.Status == ocpp.ClearChargingProfileStatusAccepted {
+		if err := api.markChargingProfilesCleared(r.Context(), id, &req, string(confirmation.Status)); err != nil {
+			api.logger.Error("Failed to record charging profile clear", zap.Error(err))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CommandResponse{Status: string(confirmation.Status)})
+}
+
+// GetCompositeSchedule handles GET /api/stations/{id}/composite-schedule
+// Query parameters: connector_id (default 0), duration in seconds (default 3600) and charging_rate_unit (A or W)
+func (api *StationsAPI) GetCompositeSchedule(w http.ResponseWriter, r *http.Request) {
+	_, identity, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	request := &ocpp.GetCompositeScheduleRequest{Duration: 3600}
+
+	if connectorStr := r.URL.Query().Get("connector_id"); connectorStr != "" {
+		connectorId, err := strconv.Atoi(connectorStr)
+		if err != nil || connectorId < 0 {
+			http.Error(w, "connector_id must be >= 0", http.StatusBadRequest)
+			return
+		}
+		request.ConnectorId = connectorId
+	}
+
+	if durationStr := r.URL.Query().Get("duration"); durationStr != "" {
+		duration, err := strconv.Atoi(durationStr)
+		if err != nil || duration <= 0 {
+			http.Error(w, "duration must be > 0", http.StatusBadRequest)
+			return
+		}
+		request.Duration = duration
+	}
+
+	if unit := r.URL.Query().Get("charging_rate_unit"); unit != "" {
+		if !validChargingRateUnit(unit) {
+			http.Error(w, "charging_rate_unit must be A or W", http.StatusBadRequest)
+			return
+		}
+		request.ChargingRateUnit = types.ChargingRateUnitType(unit)
+	}
+
+	confirmation, err := api.ocppServer.GetCompositeSchedule(r.Context(), identity, request)
+	if err != nil {
+		api.writeCommandError(w, identity, "GetCompositeSchedule", err)
+		return
+	}
+
+	response := CompositeScheduleResponse{
+		Status:           string(confirmation.Status),
+		ConnectorId:      confirmation.ConnectorId,
+		ChargingSchedule: confirmation.ChargingSchedule,
+	}
+	if confirmation.ScheduleStart != nil {
+		response.ScheduleStart = &confirmation.ScheduleStart.Time
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ocppProfile converts a stored profile into the OCPP ChargingProfile sent to the charger
+func (p *ChargingProfile) ocppProfile() *types.ChargingProfile {
+	profile := &types.ChargingProfile{
+		ChargingProfileId:      int(p.ID),
+		StackLevel:             p.StackLevel,
+		ChargingProfilePurpose: types.ChargingProfilePurposeType(p.Purpose),
+		ChargingProfileKind:    types.ChargingProfileKindType(p.Kind),
+		ChargingSchedule:       p.Schedule,
+	}
+	if p.TransactionId != nil {
+		profile.TransactionId = *p.TransactionId
+	}
+	if p.RecurrencyKind != nil {
+		profile.RecurrencyKind = types.RecurrencyKindType(*p.RecurrencyKind)
+	}
+	if p.ValidFrom != nil {
+		profile.ValidFrom = types.NewDateTime(*p.ValidFrom)
+	}
+	if p.ValidTo != nil {
+		profile.ValidTo = types.NewDateTime(*p.ValidTo)
+	}
+	return profile
+}
+
+// recordChargingProfileInstall stores the charger's answer to SetChargingProfile
+// An accepted profile replaces the installed profile with the same stack level and purpose on the connector
+func (api *StationsAPI) recordChargingProfileInstall(ctx context.Context, profile *ChargingProfile, status string) error {
+	now := time.Now()
+
+	tx, err := api.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if status != string(ocpp.ChargingProfileStatusAccepted) {
+		_, err := tx.ExecContext(ctx, `UPDATE charging_profiles SET status = ?, error = NULL, updated_at = ? WHERE id = ?`, status, now, profile.ID)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	replaced := `
+		UPDATE charging_profiles SET installed = 0, updated_at = ?
+		WHERE charger_id = (SELECT charger_id FROM charging_profiles WHERE id = ?)
+			AND connector_id = ? AND purpose = ? AND stack_level = ? AND id <> ? AND installed = 1
+	`
+	if _, err := tx.ExecContext(ctx, replaced, now, profile.ID, profile.ConnectorId, profile.Purpose, profile.StackLevel, profile.ID); err != nil {
+		return err
+	}
+
+	installed := `UPDATE charging_profiles SET installed = 1, status = ?, error = NULL, installed_at = ?, updated_at = ? WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, installed, status, now, now, profile.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// recordChargingProfileError stores a failed install or clear (timeout, CALLERROR, disconnect)
+func (api *StationsAPI) recordChargingProfileError(profileID int64, callErr error) {
+	// Use a fresh context so the failure is kept even if the HTTP caller went away
+	query := `UPDATE charging_profiles SET status = 'Error', error = ?, updated_at = ? WHERE id = ?`
+	if _, err := api.db.ExecContext(context.Background(), query, callErr.Error(), time.Now(), profileID); err != nil {
+		api.logger.Error("Failed to record charging profile error", zap.Int64("profile_id", profileID), zap.Error(err))
+	}
+}
+
+// markChargingProfilesCleared marks the installed profiles matching a ClearChargingProfile as removed
+func (api *StationsAPI) markChargingProfilesCleared(ctx context.Context, chargerID int64, req *ClearChargingProfilesRequest, status string) error {
+	query := `UPDATE charging_profiles SET installed = 0, status = ?, updated_at = ? WHERE charger_id = ? AND installed = 1`
+	args := []interface{}{status, time.Now(), chargerID}
+
+	if req.ConnectorId != nil {
+		query += ` AND connector_id = ?`
+		args = append(args, *req.ConnectorId)
+	}
+	if req.Purpose != nil {
+		query += ` AND purpose = ?`
+		args = append(args, *req.Purpose)
+	}
+	if req.StackLevel != nil {
+		query += ` AND stack_level = ?`
+		args = append(args, *req.StackLevel)
+	}
+
+	_, err := api.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// chargingProfileFromURL resolves the {id} and {profileId} URL parameters to a station's profile
+// It writes the error response itself and returns false if the profile cannot be found
+func (api *StationsAPI) chargingProfileFromURL(w http.ResponseWriter, r *http.Request) (*ChargingProfile, string, bool) {
+	id, identity, ok := api.stationFromURL(w, r)
+	if !ok {
+		return nil, "", false
+	}
+
+	profileID, err := strconv.ParseInt(chi.URLParam(r, "profileId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid charging profile ID", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	profile, err := api.getChargingProfile(r.Context(), id, profileID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Charging profile not found", http.StatusNotFound)
+			return nil, "", false
+		}
+		api.logger.Error("Failed to fetch charging profile", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, "", false
+	}
+
+	return profile, identity, true
+}
+
+// writeChargingProfile responds with the current state of a profile
+func (api *StationsAPI) writeChargingProfile(w http.ResponseWriter, r *http.Request, profileID int64) {
+	var chargerID int64
+	if err := api.db.QueryRowContext(r.Context(), `SELECT charger_id FROM charging_profiles WHERE id = ?`, profileID).Scan(&chargerID); err != nil {
+		api.logger.Error("Failed to fetch charging profile", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	profile, err := api.getChargingProfile(r.Context(), chargerID, profileID)
+	if err != nil {
+		api.logger.Error("Failed to fetch charging profile", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// chargingProfileSelect reads the columns scanChargingProfile expects
+const chargingProfileSelect = `
+	SELECT id, connector_id, purpose, stack_level, kind, recurrency_kind, transaction_id, valid_from, valid_to,
+		schedule, installed, status, error, installed_at, created_at, updated_at
+	FROM charging_profiles
+`
+
+// getChargingProfile fetches a profile of a station by ID
+func (api *StationsAPI) getChargingProfile(ctx context.Context, chargerID, profileID int64) (*ChargingProfile, error) {
+	row := api.db.QueryRowContext(ctx, chargingProfileSelect+` WHERE id = ? AND charger_id = ?`, profileID, chargerID)
+	return scanChargingProfile(row)
+}
+
+// scanChargingProfile reads a chargingProfileSelect row
+func scanChargingProfile(row interface{ Scan(...interface{}) error }) (*ChargingProfile, error) {
+	var profile ChargingProfile
+	var schedule string
+	err := row.Scan(
+		&profile.ID,
+		&profile.ConnectorId,
+		&profile.Purpose,
+		&profile.StackLevel,
+		&profile.Kind,
+		&profile.RecurrencyKind,
+		&profile.TransactionId,
+		&profile.ValidFrom,
+		&profile.ValidTo,
+		&schedule,
+		&profile.Installed,
+		&profile.Status,
+		&profile.Error,
+		&profile.InstalledAt,
+		&profile.CreatedAt,
+		&profile.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(schedule), &profile.Schedule); err != nil {
+		return nil, fmt.Errorf("invalid stored schedule of charging profile %d: %w", profile.ID, err)
+	}
+	return &profile, nil
+}
+
+// validateChargingProfileRequest checks a charging profile against the OCPP 1.6 rules and fills in the defaults
+func validateChargingProfileRequest(req *ChargingProfileRequest) error {
+	if req.ConnectorId == nil {
+		connectorId := 0
+		req.ConnectorId = &connectorId
+	}
+	if *req.ConnectorId < 0 {
+		return fmt.Errorf("connector_id must be >= 0")
+	}
+
+	if !validChargingProfilePurpose(req.Purpose) {
+		return fmt.Errorf("purpose must be ChargePointMaxProfile, TxDefaultProfile or TxProfile")
+	}
+	switch types.ChargingProfilePurposeType(req.Purpose) {
+	case types.ChargingProfilePurposeChargePointMaxProfile:
+		if *req.ConnectorId != 0 {
+			return fmt.Errorf("a ChargePointMaxProfile applies to the whole station and needs connector_id 0")
+		}
+	case types.ChargingProfilePurposeTxProfile:
+		if *req.ConnectorId == 0 {
+			return fmt.Errorf("a TxProfile needs a connector_id > 0")
+		}
+	}
+	if req.TransactionId != nil && types.ChargingProfilePurposeType(req.Purpose) != types.ChargingProfilePurposeTxProfile {
+		return fmt.Errorf("transaction_id is only allowed for a TxProfile")
+	}
+
+	if req.StackLevel < 0 {
+		return fmt.Errorf("stack_level must be >= 0")
+	}
+
+	if req.Kind == "" {
+		req.Kind = string(types.ChargingProfileKindAbsolute)
+	}
+	switch types.ChargingProfileKindType(req.Kind) {
+	case types.ChargingProfileKindAbsolute, types.ChargingProfileKindRelative:
+		if req.RecurrencyKind != nil {
+			return fmt.Errorf("recurrency_kind is only allowed for a Recurring profile")
+		}
+	case types.ChargingProfileKindRecurring:
+		if req.RecurrencyKind == nil || (*req.RecurrencyKind != string(types.RecurrencyKindDaily) && *req.RecurrencyKind != string(types.RecurrencyKindWeekly)) {
+			return fmt.Errorf("a Recurring profile needs recurrency_kind Daily or Weekly")
+		}
+	default:
+		return fmt.Errorf("kind must be Absolute, Recurring or Relative")
+	}
+
+	if req.ValidFrom != nil && req.ValidTo != nil && !req.ValidTo.After(*req.ValidFrom) {
+		return fmt.Errorf("valid_to must be after valid_from")
+	}
+
+	if req.Schedule == nil {
+		return fmt.Errorf("schedule is required")
+	}
+	if !validChargingRateUnit(string(req.Schedule.ChargingRateUnit)) {
+		return fmt.Errorf("schedule.chargingRateUnit must be A or W")
+	}
+	if req.Kind == string(types.ChargingProfileKindRecurring) && req.Schedule.StartSchedule == nil {
+		return fmt.Errorf("a Recurring profile needs schedule.startSchedule")
+	}
+	if req.Schedule.Duration != nil && *req.Schedule.Duration < 0 {
+		return fmt.Errorf("schedule.duration must be >= 0")
+	}
+	if req.Schedule.MinChargingRate != nil && *req.Schedule.MinChargingRate < 0 {
+		return fmt.Errorf("schedule.minChargingRate must be >= 0")
+	}
+
+	periods := req.Schedule.ChargingSchedulePeriod
+	if len(periods) == 0 {
+		return fmt.Errorf("schedule.chargingSchedulePeriod needs at least one period")
+	}
+	if periods[0].StartPeriod != 0 {
+		return fmt.Errorf("the first schedule period must start at 0")
+	}
+	for i, period := range periods {
+		if i > 0 && period.StartPeriod <= periods[i-1].StartPeriod {
+			return fmt.Errorf("schedule periods must be in increasing startPeriod order")
+		}
+		if period.Limit < 0 {
+			return fmt.Errorf("schedule period limits must be >= 0")
+		}
+		// OCPP 1.6 allows one decimal place
+		if math.Abs(period.Limit*10-math.Round(period.Limit*10)) > 1e-9 {
+			return fmt.Errorf("schedule period limits must be multiples of 0.1")
+		}
+		if period.NumberPhases != nil && (*period.NumberPhases < 1 || *period.NumberPhases > 3) {
+			return fmt.Errorf("schedule period numberPhases must be 1, 2 or 3")
+		}
+	}
+
+	return nil
+}
+
+// validChargingProfilePurpose reports whether purpose is an OCPP 1.6 charging profile purpose
+func validChargingProfilePurpose(purpose string) bool {
+	switch types.ChargingProfilePurposeType(purpose) {
+	case types.ChargingProfilePurposeChargePointMaxProfile, types.ChargingProfilePurposeTxDefaultProfile, types.ChargingProfilePurposeTxProfile:
+		return true
+	}
+	return false
+}
+
+// validChargingRateUnit reports whether unit is an OCPP 1.6 charging rate unit
+func validChargingRateUnit(unit string) bool {
+	return unit == string(types.ChargingRateUnitAmperes) || unit == string(types.ChargingRateUnitWatts)
+}
@@ -0,0 +1,342 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/ocpp"
+)
+
+// RemoteStartRequest represents the request to remotely start a charging session
+type RemoteStartRequest struct {
+	IdTag           string                 `json:"id_tag"`
+	ConnectorId     *int                   `json:"connector_id"`
+	ChargingProfile *types.ChargingProfile `json:"charging_profile"`
+}
+
+// RemoteStopRequest represents the request to remotely stop a charging session
+type RemoteStopRequest struct {
+	TransactionId *int `json:"transaction_id"`
+}
+
+// ResetRequest represents the request to reset a station
+type ResetRequest struct {
+	Type string `json:"type"` // Soft or Hard
+}
+
+// UnlockConnectorRequest represents the request to unlock a connector
+type UnlockConnectorRequest struct {
+	ConnectorId int `json:"connector_id"`
+}
+
+// ChangeAvailabilityRequest represents the request to change connector availability
+type ChangeAvailabilityRequest struct {
+	ConnectorId *int   `json:"connector_id"` // 0 means the whole station
+	Type        string `json:"type"`         // Operative or Inoperative
+}
+
+// CommandResponse is the charger's answer to a remote command
+type CommandResponse struct {
+	Status string `json:"status"`
+}
+
+// CommandHistoryEntry represents a command sent to a station and its outcome
+type CommandHistoryEntry struct {
+	ID          int64           `json:"id"`
+	Action      string          `json:"action"`
+	Request     json.RawMessage `json:"request"`
+	Status      *string         `json:"status"`
+	Error       *string         `json:"error"`
+	CreatedAt   time.Time       `json:"created_at"`
+	CompletedAt *time.Time      `json:"completed_at"`
+}
+
+// RemoteStart handles POST /api/stations/{id}/remote-start
+func (api *StationsAPI) RemoteStart(w http.ResponseWriter, r *http.Request) {
+	_, identity, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req RemoteStartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Validate request against the OCPP 1.6 RemoteStartTransaction constraints
+	if req.IdTag == "" {
+		http.Error(w, "id_tag is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.IdTag) > 20 {
+		http.Error(w, "id_tag must be <= 20 characters", http.StatusBadRequest)
+		return
+	}
+	if req.ConnectorId != nil && *req.ConnectorId <= 0 {
+		http.Error(w, "connector_id must be > 0", http.StatusBadRequest)
+		return
+	}
+	if req.ChargingProfile != nil && req.ChargingProfile.ChargingProfilePurpose != types.ChargingProfilePurposeTxProfile {
+		http.Error(w, "charging_profile must have chargingProfilePurpose TxProfile", http.StatusBadRequest)
+		return
+	}
+
+	confirmation, err := api.ocppServer.RemoteStartTransaction(r.Context(), identity, &core.RemoteStartTransactionRequest{
+		ConnectorId:     req.ConnectorId,
+		IdTag:           req.IdTag,
+		ChargingProfile: req.ChargingProfile,
+	})
+	if err != nil {
+		api.writeCommandError(w, identity, "RemoteStartTransaction", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CommandResponse{Status: string(confirmation.Status)})
+}
+
+// RemoteStop handles POST /api/stations/{id}/remote-stop
+func (api *StationsAPI) RemoteStop(w http.ResponseWriter, r *http.Request) {
+	_, identity, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req RemoteStopRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.TransactionId == nil {
+		http.Error(w, "transaction_id is required", http.StatusBadRequest)
+		return
+	}
+
+	confirmation, err := api.ocppServer.RemoteStopTransaction(r.Context(), identity, &core.RemoteStopTransactionRequest{
+		TransactionId: *req.TransactionId,
+	})
+	if err != nil {
+		api.writeCommandError(w, identity, "RemoteStopTransaction", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CommandResponse{Status: string(confirmation.Status)})
+}
+
+// Reset handles POST /api/stations/{id}/reset
+func (api *StationsAPI) Reset(w http.ResponseWriter, r *http.Request) {
+	_, identity, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req ResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	resetType := core.ResetType(req.Type)
+	if resetType != core.ResetTypeSoft && resetType != core.ResetTypeHard {
+		http.Error(w, "type must be Soft or Hard", http.StatusBadRequest)
+		return
+	}
+
+	confirmation, err := api.ocppServer.Reset(r.Context(), identity, resetType)
+	if err != nil {
+		api.writeCommandError(w, identity, "Reset", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CommandResponse{Status: string(confirmation.Status)})
+}
+
+// UnlockConnector handles POST /api/stations/{id}/unlock-connector
+func (api *StationsAPI) UnlockConnector(w http.ResponseWriter, r *http.Request) {
+	_, identity, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req UnlockConnectorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.ConnectorId <= 0 {
+		http.Error(w, "connector_id must be > 0", http.StatusBadRequest)
+		return
+	}
+
+	confirmation, err := api.ocppServer.UnlockConnector(r.Context(), identity, req.ConnectorId)
+	if err != nil {
+		api.writeCommandError(w, identity, "UnlockConnector", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CommandResponse{Status: string(confirmation.Status)})
+}
+
+// ChangeAvailability handles POST /api/stations/{id}/availability
+func (api *StationsAPI) ChangeAvailability(w http.ResponseWriter, r *http.Request) {
+	_, identity, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req ChangeAvailabilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.ConnectorId == nil || *req.ConnectorId < 0 {
+		http.Error(w, "connector_id is required and must be >= 0", http.StatusBadRequest)
+		return
+	}
+
+	availabilityType := core.AvailabilityType(req.Type)
+	if availabilityType != core.AvailabilityTypeOperative && availabilityType != core.AvailabilityTypeInoperative {
+		http.Error(w, "type must be Operative or Inoperative", http.StatusBadRequest)
+		return
+	}
+
+	confirmation, err := api.ocppServer.ChangeAvailability(r.Context(), identity, *req.ConnectorId, availabilityType)
+	if err != nil {
+		api.writeCommandError(w, identity, "ChangeAvailability", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CommandResponse{Status: string(confirmation.Status)})
+}
+
+// ListCommands handles GET /api/stations/{id}/commands
+func (api *StationsAPI) ListCommands(w http.ResponseWriter, r *http.Request) {
+	id, _, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	query := `
+		SELECT id, action, request, status, error, created_at, completed_at
+		FROM command_history
+		WHERE charger_id = ?
+		ORDER BY created_at DESC
+		LIMIT 100
+	`
+
+	rows, err := api.db.QueryContext(r.Context(), query, id)
+	if err != nil {
+		api.logger.Error("Failed to query command history", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	commands := []CommandHistoryEntry{}
+	for rows.Next() {
+		var entry CommandHistoryEntry
+		var request string
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.Action,
+			&request,
+			&entry.Status,
+			&entry.Error,
+			&entry.CreatedAt,
+			&entry.CompletedAt,
+		); err != nil {
+			api.logger.Error("Failed to scan command history", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		entry.Request = json.RawMessage(request)
+		commands = append(commands, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		api.logger.Error("Row iteration error", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(commands)
+}
+
+// stationFromURL resolves the {id} URL parameter to the station ID and its OCPP identity
+// It writes the error response itself and returns false if the station cannot be found
+func (api *StationsAPI) stationFromURL(w http.ResponseWriter, r *http.Request) (int64, string, bool) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid station ID", http.StatusBadRequest)
+		return 0, "", false
+	}
+
+	identity, err := api.getStationIdentity(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Station not found", http.StatusNotFound)
+			return 0, "", false
+		}
+		api.logger.Error("Failed to fetch station identity", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return 0, "", false
+	}
+
+	return id, identity, true
+}
+
+// getStationIdentity fetches the OCPP identity of a station by ID
+func (api *StationsAPI) getStationIdentity(ctx context.Context, id int64) (string, error) {
+	var identity string
+	err := api.db.QueryRowContext(ctx, "SELECT identity FROM chargers WHERE id = ?", id).Scan(&identity)
+	return identity, err
+}
+
+// writeCommandError maps a failed OCPP command to an HTTP error response
+func (api *StationsAPI) writeCommandError(w http.ResponseWriter, identity, action string, err error) {
+	api.logger.Error("OCPP command failed",
+		zap.String("charge_point_id", identity),
+		zap.String("action", action),
+		zap.Error(err))
+
+	var callErr *ocpp.CallError
+	var schemaErr *ocpp.SchemaError
+	switch {
+	case errors.Is(err, ocpp.ErrNotConnected):
+		http.Error(w, "Station is not connected", http.StatusConflict)
+	case errors.Is(err, ocpp.ErrCallTimeout):
+		http.Error(w, "Station did not respond in time", http.StatusGatewayTimeout)
+	case errors.Is(err, ocpp.ErrConnectionClosed):
+		http.Error(w, "Station disconnected before responding", http.StatusBadGateway)
+	case errors.Is(err, ocpp.ErrUnsupportedProtocol):
+		http.Error(w, action+" is not available for stations connected with OCPP 2.0.1", http.StatusConflict)
+	case errors.As(err, &callErr):
+		http.Error(w, "Station returned an error: "+callErr.ErrorCode, http.StatusBadGateway)
+	case errors.As(err, &schemaErr) && schemaErr.IsResponse():
+		http.Error(w, "Station returned an invalid response: "+schemaErr.Violations[0].String(), http.StatusBadGateway)
+	case errors.As(err, &schemaErr):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
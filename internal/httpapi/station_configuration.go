@@ -0,0 +1,258 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/ocpp"
+)
+
+// ConfigurationKey represents a cached charger configuration key
+type ConfigurationKey struct {
+	Key              string     `json:"key"`
+	Value            *string    `json:"value"`
+	Readonly         bool       `json:"readonly"`
+	LastChangeStatus *string    `json:"last_change_status"`
+	LastChangeAt     *time.Time `json:"last_change_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// FetchConfigurationRequest represents the request to read keys from the charger
+type FetchConfigurationRequest struct {
+	Keys []string `json:"keys"` // empty means all keys
+}
+
+// FetchConfigurationResponse is the live GetConfiguration result
+type FetchConfigurationResponse struct {
+	Keys        []ConfigurationKey `json:"keys"`
+	UnknownKeys []string           `json:"unknown_keys"`
+}
+
+// ConfigurationChange is a single key/value to set on the charger
+type ConfigurationChange struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ChangeConfigurationRequest represents the request to change configuration keys
+type ChangeConfigurationRequest struct {
+	Changes []ConfigurationChange `json:"changes"`
+}
+
+// ConfigurationChangeResult is the charger's answer for one key
+type ConfigurationChangeResult struct {
+	Key    string `json:"key"`
+	Status string `json:"status"` // Accepted, Rejected, RebootRequired, NotSupported
+	// Set instead of status: the CALLERROR code of the charger, NotConnected, Timeout, ConnectionClosed
+	// or Failed when the key could not be sent, and NotAttempted for the keys after that
+	Error string `json:"error,omitempty"`
+}
+
+// GetConfiguration handles GET /api/stations/{id}/configuration
+// It returns the last known configuration without contacting the charger
+func (api *StationsAPI) GetConfiguration(w http.ResponseWriter, r *http.Request) {
+	id, _, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := api.getCachedConfiguration(r.Context(), id)
+	if err != nil {
+		api.logger.Error("Failed to query charger configuration", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// FetchConfiguration handles POST /api/stations/{id}/configuration/fetch
+// It sends GetConfiguration to the charger and refreshes the cached keys
+func (api *StationsAPI) FetchConfiguration(w http.ResponseWriter, r *http.Request) {
+	id, identity, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional - no body means all keys
+	var req FetchConfigurationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	for _, key := range req.Keys {
+		if key == "" || len(key) > 50 {
+			http.Error(w, "keys must be 1-50 characters", http.StatusBadRequest)
+			return
+		}
+	}
+
+	confirmation, err := api.ocppServer.GetConfiguration(r.Context(), identity, req.Keys)
+	if err != nil {
+		api.writeCommandError(w, identity, "GetConfiguration", err)
+		return
+	}
+
+	// Return the refreshed cache entries for the keys the charger reported
+	cached, err := api.getCachedConfiguration(r.Context(), id)
+	if err != nil {
+		api.logger.Error("Failed to query charger configuration", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	reported := make(map[string]bool, len(confirmation.ConfigurationKey))
+	for _, key := range confirmation.ConfigurationKey {
+		reported[key.Key] = true
+	}
+
+	response := FetchConfigurationResponse{
+		Keys:        []ConfigurationKey{},
+		UnknownKeys: confirmation.UnknownKey,
+	}
+	for _, key := range cached {
+		if reported[key.Key] {
+			response.Keys = append(response.Keys, key)
+		}
+	}
+	if response.UnknownKeys == nil {
+		response.UnknownKeys = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ChangeConfiguration handles PUT /api/stations/{id}/configuration
+// Each key is sent as its own ChangeConfiguration and reported individually; if the charger becomes
+// unreachable part way, the keys already sent keep their answers and the rest are NotAttempted
+func (api *StationsAPI) ChangeConfiguration(w http.ResponseWriter, r *http.Request) {
+	_, identity, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req ChangeConfigurationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Validate against the OCPP 1.6 ChangeConfiguration field limits
+	if len(req.Changes) == 0 {
+		http.Error(w, "changes must contain at least one key", http.StatusBadRequest)
+		return
+	}
+	for _, change := range req.Changes {
+		if change.Key == "" || len(change.Key) > 50 {
+			http.Error(w, "key must be 1-50 characters", http.StatusBadRequest)
+			return
+		}
+		if len(change.Value) > 500 {
+			http.Error(w, "value must be <= 500 characters", http.StatusBadRequest)
+			return
+		}
+	}
+
+	results := make([]ConfigurationChangeResult, 0, len(req.Changes))
+	for i, change := range req.Changes {
+		confirmation, err := api.ocppServer.ChangeConfiguration(r.Context(), identity, change.Key, change.Value)
+		if err != nil {
+			// A CALLERROR only concerns this key; anything else means the charger is unreachable
+			var callErr *ocpp.CallError
+			if errors.As(err, &callErr) {
+				results = append(results, ConfigurationChangeResult{
+					Key:   change.Key,
+					Error: callErr.ErrorCode,
+				})
+				continue
+			}
+
+			// Nothing was applied, so the request failed as a whole
+			if i == 0 {
+				api.writeCommandError(w, identity, "ChangeConfiguration", err)
+				return
+			}
+
+			api.logger.Error("ChangeConfiguration stopped part way",
+				zap.String("charge_point_id", identity),
+				zap.String("key", change.Key),
+				zap.Error(err))
+			results = append(results, ConfigurationChangeResult{
+				Key:   change.Key,
+				Error: commandErrorCode(err),
+			})
+			for _, skipped := range req.Changes[i+1:] {
+				results = append(results, ConfigurationChangeResult{
+					Key:   skipped.Key,
+					Error: "NotAttempted",
+				})
+			}
+			break
+		}
+
+		results = append(results, ConfigurationChangeResult{
+			Key:    change.Key,
+			Status: string(confirmation.Status),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// commandErrorCode names why a command could not be delivered, for per-item results
+func commandErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ocpp.ErrNotConnected):
+		return "NotConnected"
+	case errors.Is(err, ocpp.ErrCallTimeout):
+		return "Timeout"
+	case errors.Is(err, ocpp.ErrConnectionClosed):
+		return "ConnectionClosed"
+	default:
+		return "Failed"
+	}
+}
+
+// getCachedConfiguration reads the cached configuration keys of a station
+func (api *StationsAPI) getCachedConfiguration(ctx context.Context, chargerID int64) ([]ConfigurationKey, error) {
+	query := `
+		SELECT key, value, readonly, last_change_status, last_change_at, updated_at
+		FROM charger_configuration
+		WHERE charger_id = ?
+		ORDER BY key ASC
+	`
+
+	rows, err := api.db.QueryContext(ctx, query, chargerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []ConfigurationKey{}
+	for rows.Next() {
+		var key ConfigurationKey
+		if err := rows.Scan(
+			&key.Key,
+			&key.Value,
+			&key.Readonly,
+			&key.LastChangeStatus,
+			&key.LastChangeAt,
+			&key.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
@@ -0,0 +1,550 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/ocpp"
+)
+
+// maxDiagnosticsSize is the largest diagnostics file a charger can upload
+const maxDiagnosticsSize = 512 << 20
+
+// Diagnostics is a diagnostics file requested from a charger with GetDiagnostics
+type Diagnostics struct {
+	ID            int64      `json:"id"`
+	Location      string     `json:"location"`   // Where the charger was told to upload to
+	StartTime     *time.Time `json:"start_time"` // Time window of the logging information asked for
+	StopTime      *time.Time `json:"stop_time"`
+	Retries       *int       `json:"retries"`
+	RetryInterval *int       `json:"retry_interval"`
+	Status        string     `json:"status"` // requested, failed, or the last DiagnosticsStatusNotification
+	Error         *string    `json:"error"`
+	FileName      *string    `json:"file_name"` // Named by the charger in its GetDiagnostics answer or the upload
+	Size          *int64     `json:"size"`      // Set once the file has been received
+	SHA256        *string    `json:"sha256"`
+	UploadedAt    *time.Time `json:"uploaded_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	CompletedAt   *time.Time `json:"completed_at"`
+
+	storedName *string
+}
+
+// RequestDiagnosticsRequest represents the request to fetch diagnostics from a charger
+type RequestDiagnosticsRequest struct {
+	StartTime     *time.Time `json:"start_time"`
+	StopTime      *time.Time `json:"stop_time"`
+	Retries       *int       `json:"retries"`
+	RetryInterval *int       `json:"retry_interval"` // Seconds between retries
+}
+
+// diagnosticsSelect selects diagnostics requests
+const diagnosticsSelect = `
+	SELECT id, location, start_time, stop_time, retries, retry_interval, status, error, file_name,
+		stored_name, size, sha256, uploaded_at, created_at, updated_at, completed_at
+	FROM diagnostics
+`
+
+// ListDiagnostics handles GET /api/stations/{id}/diagnostics
+// Optional status filters on a status, or open/completed; newest first, at most 100
+func (api *StationsAPI) ListDiagnostics(w http.ResponseWriter, r *http.Request) {
+	id, _, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	query := diagnosticsSelect + " WHERE charger_id = ?"
+	args := []interface{}{id}
+	switch status := r.URL.Query().Get("status"); status {
+	case "":
+	case "open":
+		query += " AND completed_at IS NULL"
+	case "completed":
+		query += " AND completed_at IS NOT NULL"
+	default:
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC LIMIT 100"
+
+	rows, err := api.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		api.logger.Error("Failed to query diagnostics", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	diagnostics := []Diagnostics{}
+	for rows.Next() {
+		d, err := scanDiagnostics(rows)
+		if err != nil {
+			api.logger.Error("Failed to scan diagnostics", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		diagnostics = append(diagnostics, *d)
+	}
+
+	if err = rows.Err(); err != nil {
+		api.logger.Error("Row iteration error", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diagnostics)
+}
+
+// RequestDiagnostics handles POST /api/stations/{id}/diagnostics
+// It sends GetDiagnostics with an upload location on this server; a request still open is superseded
+func (api *StationsAPI) RequestDiagnostics(w http.ResponseWriter, r *http.Request) {
+	id, identity, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req RequestDiagnosticsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := validateDiagnosticsRequest(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The location must be an absolute URL the charger can reach
+	if u, err := url.Parse(api.publicURL); err != nil || u.Scheme == "" || u.Hostname() == "" {
+		http.Error(w, "PUBLIC_URL must be set to the URL chargers reach this server at", http.StatusConflict)
+		return
+	}
+
+	// The token in the upload URL is all that identifies the request, so it must not be guessable
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		api.logger.Error("Failed to generate upload token", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(b)
+	location := api.publicURL + "/api/diagnostics/upload/" + token + "/"
+
+	now := time.Now().UTC()
+	tx, err := api.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.logger.Error("Failed to begin diagnostics request", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(r.Context(), `
+		INSERT INTO diagnostics (charger_id, upload_token, location, start_time, stop_time, retries, retry_interval,
+			status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, token, location, req.StartTime, req.StopTime, req.Retries, req.RetryInterval, ocpp.DiagnosticsRequested, now, now)
+	if err != nil {
+		api.logger.Error("Failed to create diagnostics request", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	diagnosticsID, err := result.LastInsertId()
+	if err != nil {
+		api.logger.Error("Failed to get last insert ID", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The charger runs one upload at a time; the new request replaces whatever it was doing
+	_, err = tx.ExecContext(r.Context(), `
+		UPDATE diagnostics SET status = ?, error = ?, updated_at = ?, completed_at = ?
+		WHERE charger_id = ? AND id <> ? AND completed_at IS NULL
+	`, ocpp.DiagnosticsFailed, fmt.Sprintf("Superseded by diagnostics request %d", diagnosticsID), now, now, id, diagnosticsID)
+	if err != nil {
+		api.logger.Error("Failed to supersede diagnostics requests", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.logger.Error("Failed to commit diagnostics request", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	request := &ocpp.GetDiagnosticsRequest{
+		Location:      location,
+		Retries:       req.Retries,
+		RetryInterval: req.RetryInterval,
+	}
+	if req.StartTime != nil {
+		request.StartTime = types.NewDateTime(*req.StartTime)
+	}
+	if req.StopTime != nil {
+		request.StopTime = types.NewDateTime(*req.StopTime)
+	}
+
+	confirmation, err := api.ocppServer.GetDiagnostics(r.Context(), identity, request)
+	if err != nil {
+		api.failDiagnostics(diagnosticsID, err.Error())
+		api.writeCommandError(w, identity, "GetDiagnostics", err)
+		return
+	}
+
+	if confirmation.FileName == "" {
+		api.failDiagnostics(diagnosticsID, "The charger has no diagnostics information to upload")
+	} else {
+		// An upload may already have named the file; the charger's answer does not override it
+		query := `UPDATE diagnostics SET file_name = COALESCE(file_name, ?), updated_at = ? WHERE id = ?`
+		if _, err := api.db.ExecContext(r.Context(), query, confirmation.FileName, time.Now().UTC(), diagnosticsID); err != nil {
+			api.logger.Error("Failed to record GetDiagnostics answer", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	d, err := api.getDiagnostics(r.Context(), id, diagnosticsID)
+	if err != nil {
+		api.logger.Error("Failed to fetch diagnostics request", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(d)
+}
+
+// GetDiagnostics handles GET /api/stations/{id}/diagnostics/{diagnosticsId}
+func (api *StationsAPI) GetDiagnostics(w http.ResponseWriter, r *http.Request) {
+	d, ok := api.diagnosticsFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
+
+// DownloadDiagnostics handles GET /api/stations/{id}/diagnostics/{diagnosticsId}/file
+func (api *StationsAPI) DownloadDiagnostics(w http.ResponseWriter, r *http.Request) {
+	d, ok := api.diagnosticsFromURL(w, r)
+	if !ok {
+		return
+	}
+	if d.storedName == nil {
+		http.Error(w, "The charger has not uploaded the file yet", http.StatusNotFound)
+		return
+	}
+
+	file, err := os.Open(filepath.Join(api.diagnosticsDir, *d.storedName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "The diagnostics file is missing on disk", http.StatusNotFound)
+			return
+		}
+		api.logger.Error("Failed to open diagnostics file", zap.String("file", *d.storedName), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	name := fmt.Sprintf("diagnostics-%d", d.ID)
+	if d.FileName != nil {
+		name = *d.FileName
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(w, r, name, *d.UploadedAt, file)
+}
+
+// DeleteDiagnostics handles DELETE /api/stations/{id}/diagnostics/{diagnosticsId}
+// A later upload for a deleted request is refused
+func (api *StationsAPI) DeleteDiagnostics(w http.ResponseWriter, r *http.Request) {
+	d, ok := api.diagnosticsFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := api.db.ExecContext(r.Context(), `DELETE FROM diagnostics WHERE id = ?`, d.ID); err != nil {
+		api.logger.Error("Failed to delete diagnostics", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if d.storedName != nil {
+		if err := os.Remove(filepath.Join(api.diagnosticsDir, *d.storedName)); err != nil && !os.IsNotExist(err) {
+			api.logger.Warn("Failed to remove diagnostics file", zap.String("file", *d.storedName), zap.Error(err))
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// failDiagnostics ends a diagnostics request that did not produce an upload
+// It uses a fresh context so the outcome is kept even if the HTTP caller went away
+func (api *StationsAPI) failDiagnostics(diagnosticsID int64, reason string) {
+	now := time.Now().UTC()
+	_, err := api.db.ExecContext(context.Background(), `
+		UPDATE diagnostics SET status = ?, error = ?, updated_at = ?, completed_at = ?
+		WHERE id = ? AND completed_at IS NULL
+	`, ocpp.DiagnosticsFailed, reason, now, now, diagnosticsID)
+	if err != nil {
+		api.logger.Error("Failed to update diagnostics request", zap.Int64("diagnostics_id", diagnosticsID), zap.Error(err))
+	}
+}
+
+// diagnosticsFromURL resolves the {id} and {diagnosticsId} URL parameters to a diagnostics request
+// It writes the error response itself and returns false if the request cannot be found
+func (api *StationsAPI) diagnosticsFromURL(w http.ResponseWriter, r *http.Request) (*Diagnostics, bool) {
+	id, _, ok := api.stationFromURL(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	diagnosticsID, err := strconv.ParseInt(chi.URLParam(r, "diagnosticsId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid diagnostics ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	d, err := api.getDiagnostics(r.Context(), id, diagnosticsID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Diagnostics not found", http.StatusNotFound)
+			return nil, false
+		}
+		api.logger.Error("Failed to fetch diagnostics", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return d, true
+}
+
+// getDiagnostics fetches a diagnostics request of a station
+func (api *StationsAPI) getDiagnostics(ctx context.Context, chargerID, diagnosticsID int64) (*Diagnostics, error) {
+	return scanDiagnostics(api.db.QueryRowContext(ctx, diagnosticsSelect+" WHERE charger_id = ? AND id = ?", chargerID, diagnosticsID))
+}
+
+// scanDiagnostics reads a diagnosticsSelect row
+func scanDiagnostics(row interface{ Scan(...interface{}) error }) (*Diagnostics, error) {
+	var d Diagnostics
+	err := row.Scan(
+		&d.ID,
+		&d.Location,
+		&d.StartTime,
+		&d.StopTime,
+		&d.Retries,
+		&d.RetryInterval,
+		&d.Status,
+		&d.Error,
+		&d.FileName,
+		&d.storedName,
+		&d.Size,
+		&d.SHA256,
+		&d.UploadedAt,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+		&d.CompletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// validateDiagnosticsRequest validates a diagnostics request
+func validateDiagnosticsRequest(req *RequestDiagnosticsRequest) error {
+	if req.StartTime != nil && req.StopTime != nil && !req.StopTime.After(*req.StartTime) {
+		return fmt.Errorf("stop_time must be after start_time")
+	}
+	if req.Retries != nil && *req.Retries < 0 {
+		return fmt.Errorf("retries must be >= 0")
+	}
+	if req.RetryInterval != nil && *req.RetryInterval < 0 {
+		return fmt.Errorf("retry_interval must be >= 0")
+	}
+	return nil
+}
+
+// DiagnosticsUploadAPI receives the diagnostics files chargers upload
+// Chargers are not API users, so the upload is authorised by the token in the location they were sent
+type DiagnosticsUploadAPI struct {
+	db     *sql.DB
+	logger *zap.Logger
+	dir    string // Where the files are stored
+}
+
+// NewDiagnosticsUploadAPI creates a new diagnostics upload API
+func NewDiagnosticsUploadAPI(db *sql.DB, logger *zap.Logger, dir string) *DiagnosticsUploadAPI {
+	return &DiagnosticsUploadAPI{
+		db:     db,
+		logger: logger,
+		dir:    dir,
+	}
+}
+
+// Routes returns the routes for the diagnostics upload API
+// Chargers append the file name to the location, or send it to the location itself
+func (api *DiagnosticsUploadAPI) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Put("/upload/{token}", api.Upload)
+	r.Post("/upload/{token}", api.Upload)
+	r.Put("/upload/{token}/", api.Upload)
+	r.Post("/upload/{token}/", api.Upload)
+	r.Put("/upload/{token}/{name}", api.Upload)
+	r.Post("/upload/{token}/{name}", api.Upload)
+	return r
+}
+
+// Upload handles PUT and POST /api/diagnostics/upload/{token}[/{name}]
+// The file is the request body, or the first file of a multipart/form-data body
+func (api *DiagnosticsUploadAPI) Upload(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	var diagnosticsID int64
+	var storedName *string
+	err := api.db.QueryRowContext(r.Context(), `SELECT id, stored_name FROM diagnostics WHERE upload_token = ?`, token).
+		Scan(&diagnosticsID, &storedName)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Unknown upload location", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		api.logger.Error("Failed to look up diagnostics upload", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if storedName != nil {
+		http.Error(w, "A file has already been uploaded to this location", http.StatusConflict)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxDiagnosticsSize+1<<20)
+	body, name, err := diagnosticsUploadBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if name == "" {
+		name = chi.URLParam(r, "name")
+	}
+
+	if err := os.MkdirAll(api.dir, 0o755); err != nil {
+		api.logger.Error("Failed to create diagnostics directory", zap.String("dir", api.dir), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	temp, err := os.CreateTemp(api.dir, ".upload-*")
+	if err != nil {
+		api.logger.Error("Failed to create diagnostics file", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(temp.Name()) // Fails harmlessly once the file has been renamed
+	defer temp.Close()
+
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(temp, sum), body)
+	if err == nil {
+		err = temp.Close()
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Diagnostics file is larger than 512 MiB", http.StatusRequestEntityTooLarge)
+			return
+		}
+		api.logger.Warn("Failed to receive diagnostics upload", zap.Int64("diagnostics_id", diagnosticsID), zap.Error(err))
+		http.Error(w, "Failed to receive the file", http.StatusBadRequest)
+		return
+	}
+
+	stored := fmt.Sprintf("%d-%s", diagnosticsID, token)
+	if err := os.Rename(temp.Name(), filepath.Join(api.dir, stored)); err != nil {
+		api.logger.Error("Failed to store diagnostics file", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var fileName *string
+	if name != "" {
+		safe := unsafeFilenameChars.ReplaceAllString(filepath.Base(name), "_")
+		fileName = &safe
+	}
+
+	// The status is left to the charger's DiagnosticsStatusNotification
+	now := time.Now().UTC()
+	result, err := api.db.ExecContext(r.Context(), `
+		UPDATE diagnostics
+		SET stored_name = ?, file_name = COALESCE(?, file_name), size = ?, sha256 = ?, uploaded_at = ?, updated_at = ?
+		WHERE id = ? AND stored_name IS NULL
+	`, stored, fileName, size, hex.EncodeToString(sum.Sum(nil)), now, now, diagnosticsID)
+	if err == nil {
+		if n, _ := result.RowsAffected(); n == 0 {
+			err = fmt.Errorf("diagnostics request %d was deleted or already has a file", diagnosticsID)
+		}
+	}
+	if err != nil {
+		os.Remove(filepath.Join(api.dir, stored))
+		api.logger.Error("Failed to record diagnostics upload", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	api.logger.Info("Diagnostics uploaded",
+		zap.Int64("diagnostics_id", diagnosticsID),
+		zap.String("file_name", name),
+		zap.Int64("size", size),
+		zap.String("remote_addr", r.RemoteAddr))
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// diagnosticsUploadBody returns the uploaded file and the name it was sent with, if any
+func diagnosticsUploadBody(r *http.Request) (io.Reader, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return r.Body, "", nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid multipart body")
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, "", fmt.Errorf("no file in the multipart body")
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid multipart body")
+		}
+		if part.FileName() != "" {
+			return part, part.FileName(), nil
+		}
+	}
+}
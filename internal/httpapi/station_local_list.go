@@ -0,0 +1,58 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// SyncLocalListRequest represents the request to push the authorization list to a station
+type SyncLocalListRequest struct {
+	Full bool `json:"full"` // Replace the whole list instead of sending only the changes
+}
+
+// GetLocalList handles GET /api/stations/{id}/local-list
+// It returns the local authorization list version and sync state of the station
+func (api *StationsAPI) GetLocalList(w http.ResponseWriter, r *http.Request) {
+	_, identity, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	state, err := api.ocppServer.GetLocalListState(r.Context(), identity)
+	if err != nil {
+		api.logger.Error("Failed to query local list state", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// SyncLocalList handles POST /api/stations/{id}/local-list/sync
+// It sends a Full or Differential SendLocalList and verifies it with GetLocalListVersion
+func (api *StationsAPI) SyncLocalList(w http.ResponseWriter, r *http.Request) {
+	_, identity, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional - no body means a differential update when possible
+	var req SyncLocalListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	result, err := api.ocppServer.SyncLocalList(r.Context(), identity, req.Full)
+	if err != nil {
+		api.writeCommandError(w, identity, "SendLocalList", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,354 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/ocpp"
+)
+
+// Reservation is a connector held for an idTag until it arrives
+type Reservation struct {
+	ID            int64      `json:"id"`           // Sent to the charger as reservationId
+	ConnectorID   int        `json:"connector_id"` // 0 reserves the whole station
+	IdTag         string     `json:"id_tag"`
+	ParentIdTag   *string    `json:"parent_id_tag"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	Status        string     `json:"status"`         // pending, active, rejected, failed, cancelled, expired or used
+	ChargerStatus *string    `json:"charger_status"` // The charger's answer to ReserveNow or CancelReservation
+	Error         *string    `json:"error"`
+	TransactionID *int64     `json:"transaction_id"` // The transaction that used the reservation
+	CreatedAt     time.Time  `json:"created_at"`
+	EndedAt       *time.Time `json:"ended_at"`
+}
+
+// CreateReservationRequest represents the request to reserve a connector
+type CreateReservationRequest struct {
+	ConnectorId     *int       `json:"connector_id"`
+	IdTag           string     `json:"id_tag"`
+	ExpiresAt       *time.Time `json:"expires_at"`       // Either an expiry date
+	DurationMinutes *int       `json:"duration_minutes"` // or how long from now
+}
+
+// reservationSelect selects reservations
+const reservationSelect = `
+	SELECT id, connector_id, id_tag, parent_id_tag, expires_at, status, charger_status, error,
+		transaction_id, created_at, ended_at
+	FROM reservations
+`
+
+// maxReservationDuration is how far ahead a connector can be reserved
+const maxReservationDuration = 7 * 24 * time.Hour
+
+// ListReservations handles GET /api/stations/{id}/reservations
+// Optional status filters on the reservation state; newest first, at most 100
+func (api *StationsAPI) ListReservations(w http.ResponseWriter, r *http.Request) {
+	id, _, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	query := reservationSelect + " WHERE charger_id = ?"
+	args := []interface{}{id}
+	if status := r.URL.Query().Get("status"); status != "" {
+		switch status {
+		case ocpp.ReservationPending, ocpp.ReservationActive, ocpp.ReservationRejected, ocpp.ReservationFailed,
+			ocpp.ReservationCancelled, ocpp.ReservationExpired, ocpp.ReservationUsed:
+		default:
+			http.Error(w, "status must be pending, active, rejected, failed, cancelled, expired or used", http.StatusBadRequest)
+			return
+		}
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC LIMIT 100"
+
+	rows, err := api.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		api.logger.Error("Failed to query reservations", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	reservations := []Reservation{}
+	for rows.Next() {
+		reservation, err := scanReservation(rows)
+		if err != nil {
+			api.logger.Error("Failed to scan reservation", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		reservations = append(reservations, *reservation)
+	}
+
+	if err = rows.Err(); err != nil {
+		api.logger.Error("Row iteration error", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reservations)
+}
+
+// CreateReservation handles POST /api/stations/{id}/reservations
+// The reservation is stored first so its ID can be sent with ReserveNow, then updated with the charger's answer
+func (api *StationsAPI) CreateReservation(w http.ResponseWriter, r *http.Request) {
+	id, identity, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	expiresAt, err := validateReservationRequest(&req, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The charger would answer Occupied; say so before sending anything
+	var reservedUntil time.Time
+	err = api.db.QueryRowContext(r.Context(), `
+		SELECT expires_at FROM reservations
+		WHERE charger_id = ? AND connector_id = ? AND status IN (?, ?) AND expires_at > ?
+		LIMIT 1
+	`, id, *req.ConnectorId, ocpp.ReservationPending, ocpp.ReservationActive, now).Scan(&reservedUntil)
+	if err == nil {
+		http.Error(w, fmt.Sprintf("Connector is already reserved until %s", reservedUntil.Format(time.RFC3339)), http.StatusConflict)
+		return
+	}
+	if err != sql.ErrNoRows {
+		api.logger.Error("Failed to check existing reservations", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Members of an idTag group reserve on behalf of the group
+	var parentIdTag *string
+	err = api.db.QueryRowContext(r.Context(), `SELECT parent_id_tag FROM id_tags WHERE tag = ?`, req.IdTag).Scan(&parentIdTag)
+	if err != nil && err != sql.ErrNoRows {
+		api.logger.Error("Failed to fetch idTag", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := api.db.ExecContext(r.Context(), `
+		INSERT INTO reservations (charger_id, connector_id, id_tag, parent_id_tag, expires_at, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, id, *req.ConnectorId, req.IdTag, parentIdTag, expiresAt, ocpp.ReservationPending, now)
+	if err != nil {
+		api.logger.Error("Failed to create reservation", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	reservationID, err := result.LastInsertId()
+	if err != nil {
+		api.logger.Error("Failed to get last insert ID", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	request := &ocpp.ReserveNowRequest{
+		ConnectorId:   *req.ConnectorId,
+		ExpiryDate:    types.NewDateTime(expiresAt),
+		IdTag:         req.IdTag,
+		ReservationId: int(reservationID),
+	}
+	if parentIdTag != nil {
+		request.ParentIdTag = *parentIdTag
+	}
+
+	confirmation, err := api.ocppServer.ReserveNow(r.Context(), identity, request)
+	if err != nil {
+		api.endReservation(reservationID, ocpp.ReservationFailed, nil, err)
+		api.writeCommandError(w, identity, "ReserveNow", err)
+		return
+	}
+
+	chargerStatus := string(confirmation.Status)
+	if confirmation.Status == ocpp.ReservationStatusAccepted {
+		// Only a pending reservation becomes active; the expiry check may have ended it meanwhile
+		query := `UPDATE reservations SET status = ?, charger_status = ? WHERE id = ? AND status = ?`
+		if _, err := api.db.ExecContext(r.Context(), query, ocpp.ReservationActive, chargerStatus, reservationID, ocpp.ReservationPending); err != nil {
+			api.logger.Error("Failed to record ReserveNow answer", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		api.endReservation(reservationID, ocpp.ReservationRejected, &chargerStatus, nil)
+	}
+
+	reservation, err := api.getReservation(r.Context(), id, reservationID)
+	if err != nil {
+		api.logger.Error("Failed to fetch created reservation", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(reservation)
+}
+
+// CancelReservation handles POST /api/stations/{id}/reservations/{reservationId}/cancel
+// A Rejected answer means the charger no longer holds the reservation, so it is cancelled either way
+func (api *StationsAPI) CancelReservation(w http.ResponseWriter, r *http.Request) {
+	id, identity, ok := api.stationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	reservationID, err := strconv.ParseInt(chi.URLParam(r, "reservationId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+
+	reservation, err := api.getReservation(r.Context(), id, reservationID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Reservation not found", http.StatusNotFound)
+			return
+		}
+		api.logger.Error("Failed to fetch reservation", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if reservation.Status != ocpp.ReservationPending && reservation.Status != ocpp.ReservationActive {
+		http.Error(w, "Reservation is already "+reservation.Status, http.StatusConflict)
+		return
+	}
+
+	confirmation, err := api.ocppServer.CancelReservation(r.Context(), identity, int(reservationID))
+	if err != nil {
+		api.writeCommandError(w, identity, "CancelReservation", err)
+		return
+	}
+
+	chargerStatus := string(confirmation.Status)
+	api.endReservation(reservationID, ocpp.ReservationCancelled, &chargerStatus, nil)
+
+	reservation, err = api.getReservation(r.Context(), id, reservationID)
+	if err != nil {
+		api.logger.Error("Failed to fetch cancelled reservation", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reservation)
+}
+
+// endReservation moves a pending or active reservation to a final state
+// It uses a fresh context so the outcome is kept even if the HTTP caller went away
+func (api *StationsAPI) endReservation(reservationID int64, status string, chargerStatus *string, callErr error) {
+	var errorText *string
+	if callErr != nil {
+		msg := callErr.Error()
+		errorText = &msg
+	}
+
+	query := `
+		UPDATE reservations
+		SET status = ?, charger_status = COALESCE(?, charger_status), error = ?, ended_at = ?
+		WHERE id = ? AND status IN (?, ?)
+	`
+	_, err := api.db.ExecContext(context.Background(), query,
+		status,
+		chargerStatus,
+		errorText,
+		time.Now().UTC(),
+		reservationID,
+		ocpp.ReservationPending,
+		ocpp.ReservationActive,
+	)
+	if err != nil {
+		api.logger.Error("Failed to update reservation", zap.Int64("reservation_id", reservationID), zap.Error(err))
+	}
+}
+
+// getReservation fetches a reservation of a station
+func (api *StationsAPI) getReservation(ctx context.Context, chargerID, reservationID int64) (*Reservation, error) {
+	return scanReservation(api.db.QueryRowContext(ctx, reservationSelect+" WHERE charger_id = ? AND id = ?", chargerID, reservationID))
+}
+
+// scanReservation reads a reservationSelect row
+func scanReservation(row interface{ Scan(...interface{}) error }) (*Reservation, error) {
+	var reservation Reservation
+	err := row.Scan(
+		&reservation.ID,
+		&reservation.ConnectorID,
+		&reservation.IdTag,
+		&reservation.ParentIdTag,
+		&reservation.ExpiresAt,
+		&reservation.Status,
+		&reservation.ChargerStatus,
+		&reservation.Error,
+		&reservation.TransactionID,
+		&reservation.CreatedAt,
+		&reservation.EndedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// validateReservationRequest checks a reservation against the OCPP 1.6 ReserveNow constraints
+// It returns the expiry date, truncated to whole seconds in UTC
+func validateReservationRequest(req *CreateReservationRequest, now time.Time) (time.Time, error) {
+	if req.ConnectorId == nil {
+		return time.Time{}, fmt.Errorf("connector_id is required (0 reserves the whole station)")
+	}
+	if *req.ConnectorId < 0 {
+		return time.Time{}, fmt.Errorf("connector_id must be >= 0")
+	}
+	if req.IdTag == "" {
+		return time.Time{}, fmt.Errorf("id_tag is required")
+	}
+	if len(req.IdTag) > 20 {
+		return time.Time{}, fmt.Errorf("id_tag must be <= 20 characters")
+	}
+
+	var expiresAt time.Time
+	switch {
+	case req.ExpiresAt != nil && req.DurationMinutes != nil:
+		return time.Time{}, fmt.Errorf("give either expires_at or duration_minutes, not both")
+	case req.ExpiresAt != nil:
+		expiresAt = *req.ExpiresAt
+	case req.DurationMinutes != nil:
+		if *req.DurationMinutes <= 0 {
+			return time.Time{}, fmt.Errorf("duration_minutes must be > 0")
+		}
+		expiresAt = now.Add(time.Duration(*req.DurationMinutes) * time.Minute)
+	default:
+		return time.Time{}, fmt.Errorf("expires_at or duration_minutes is required")
+	}
+
+	expiresAt = expiresAt.UTC().Truncate(time.Second)
+	if !expiresAt.After(now) {
+		return time.Time{}, fmt.Errorf("expires_at must be in the future")
+	}
+	if expiresAt.Sub(now) > maxReservationDuration {
+		return time.Time{}, fmt.Errorf("reservations can be made at most 7 days ahead")
+	}
+
+	return expiresAt, nil
+}
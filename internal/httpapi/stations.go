@@ -13,51 +13,70 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/ocpp"
 )
 
 // Station represents a charging station
 type Station struct {
-	ID             int64      `json:"id"`
-	Identity       string     `json:"identity"`
-	Name           *string    `json:"name"`
-	Model          *string    `json:"model"`
-	Vendor         *string    `json:"vendor"`
-	MaxOutputKW    *float64   `json:"max_output_kw"`
-	TotalEnergyWh  *int64     `json:"total_energy_wh"`
-	TotalEnergyKwh *float64   `json:"total_energy_kwh"`
-	Firmware       *string    `json:"firmware"`
-	LastSeen       *time.Time `json:"last_seen"`
-	Status         string     `json:"status"` // "online" if last_seen within 60s, "offline" otherwise
+	ID                  int64       `json:"id"`
+	Identity            string      `json:"identity"`
+	Name                *string     `json:"name"`
+	Model               *string     `json:"model"`
+	Vendor              *string     `json:"vendor"`
+	MaxOutputKW         *float64    `json:"max_output_kw"`
+	TotalEnergyWh       *int64      `json:"total_energy_wh"`
+	TotalEnergyKwh      *float64    `json:"total_energy_kwh"`
+	Firmware            *string     `json:"firmware"`
+	OCPPVersion         *string     `json:"ocpp_version"` // Protocol of the last connection: ocpp1.6 or ocpp2.0.1
+	LastSeen            *time.Time  `json:"last_seen"`
+	ValidationMode      string      `json:"validation_mode"`       // OCPP schema validation: strict or lenient
+	SecurityProfile     int         `json:"security_profile"`      // 0 none, 1 basic auth, 2 basic auth over TLS, 3 client certificate
+	AuthorizationKeySet bool        `json:"authorization_key_set"` // The key itself is only stored hashed
+	Status              string      `json:"status"`                // "online" while the WebSocket is open, "offline" otherwise
+	Connectors          []Connector `json:"connectors"`
 }
 
 // CreateStationRequest represents the request to create a station
 type CreateStationRequest struct {
-	Identity    string   `json:"identity"`
-	Name        *string  `json:"name"`
-	Model       *string  `json:"model"`
-	Vendor      *string  `json:"vendor"`
-	MaxOutputKW *float64 `json:"max_output_kw"`
+	Identity         string   `json:"identity"`
+	Name             *string  `json:"name"`
+	Model            *string  `json:"model"`
+	Vendor           *string  `json:"vendor"`
+	MaxOutputKW      *float64 `json:"max_output_kw"`
+	ValidationMode   *string  `json:"validation_mode"`   // Defaults to strict
+	SecurityProfile  *int     `json:"security_profile"`  // Defaults to 0; profiles 1 and 2 need an authorization_key
+	AuthorizationKey *string  `json:"authorization_key"` // Basic auth password, 16 to 40 characters
 }
 
 // UpdateStationRequest represents the request to update a station
 type UpdateStationRequest struct {
-	Name        *string  `json:"name"`
-	Model       *string  `json:"model"`
-	Vendor      *string  `json:"vendor"`
-	MaxOutputKW *float64 `json:"max_output_kw"`
+	Name             *string  `json:"name"`
+	Model            *string  `json:"model"`
+	Vendor           *string  `json:"vendor"`
+	MaxOutputKW      *float64 `json:"max_output_kw"`
+	ValidationMode   *string  `json:"validation_mode"`   // Left unchanged when omitted
+	SecurityProfile  *int     `json:"security_profile"`  // Left unchanged when omitted
+	AuthorizationKey *string  `json:"authorization_key"` // Left unchanged when omitted; an empty key removes the stored one
 }
 
 // StationsAPI handles station-related HTTP endpoints
 type StationsAPI struct {
-	db     *sql.DB
-	logger *zap.Logger
+	db             *sql.DB
+	logger         *zap.Logger
+	ocppServer     OCPPServer
+	diagnosticsDir string // Where uploaded diagnostics files are stored
+	publicURL      string // Base URL chargers upload diagnostics to
 }
 
 // NewStationsAPI creates a new stations API
-func NewStationsAPI(db *sql.DB, logger *zap.Logger) *StationsAPI {
+func NewStationsAPI(db *sql.DB, logger *zap.Logger, ocppServer OCPPServer, diagnosticsDir, publicURL string) *StationsAPI {
 	return &StationsAPI{
-		db:     db,
-		logger: logger,
+		db:             db,
+		logger:         logger,
+		ocppServer:     ocppServer,
+		diagnosticsDir: diagnosticsDir,
+		publicURL:      publicURL,
 	}
 }
 
@@ -68,13 +87,62 @@ func (api *StationsAPI) Routes() chi.Router {
 	r.Post("/", api.CreateStation)
 	r.Put("/{id}", api.UpdateStation)
 	r.Delete("/{id}", api.DeleteStation)
+
+	// Remote commands sent to the connected charger
+	r.Post("/{id}/remote-start", api.RemoteStart)
+	r.Post("/{id}/remote-stop", api.RemoteStop)
+	r.Post("/{id}/reset", api.Reset)
+	r.Post("/{id}/unlock-connector", api.UnlockConnector)
+	r.Post("/{id}/availability", api.ChangeAvailability)
+	r.Get("/{id}/commands", api.ListCommands)
+
+	// Per-connector status reported by StatusNotification
+	r.Get("/{id}/connectors", api.ListConnectors)
+	r.Get("/{id}/connectors/{connectorId}/history", api.ConnectorHistory)
+
+	// Sampled values from MeterValues (energy, power, current, voltage, SoC, ...)
+	r.Get("/{id}/meter-values", api.ListMeterValues)
+
+	// WebSocket connection sessions
+	r.Get("/{id}/connections", api.ListConnections)
+
+	// Charger configuration keys (cached copy and live read/write)
+	r.Get("/{id}/configuration", api.GetConfiguration)
+	r.Post("/{id}/configuration/fetch", api.FetchConfiguration)
+	r.Put("/{id}/configuration", api.ChangeConfiguration)
+
+	// Local authorization list for offline authorization
+	r.Get("/{id}/local-list", api.GetLocalList)
+	r.Post("/{id}/local-list/sync", api.SyncLocalList)
+
+	// Smart charging profiles
+	r.Get("/{id}/charging-profiles", api.ListChargingProfiles)
+	r.Post("/{id}/charging-profiles", api.CreateChargingProfile)
+	r.Post("/{id}/charging-profiles/clear", api.ClearChargingProfiles)
+	r.Delete("/{id}/charging-profiles/{profileId}", api.DeleteChargingProfile)
+	r.Post("/{id}/charging-profiles/{profileId}/install", api.InstallChargingProfile)
+	r.Post("/{id}/charging-profiles/{profileId}/clear", api.ClearChargingProfile)
+	r.Get("/{id}/composite-schedule", api.GetCompositeSchedule)
+
+	// Connector reservations (ReserveNow / CancelReservation)
+	r.Get("/{id}/reservations", api.ListReservations)
+	r.Post("/{id}/reservations", api.CreateReservation)
+	r.Post("/{id}/reservations/{reservationId}/cancel", api.CancelReservation)
+
+	// Diagnostics files (GetDiagnostics); chargers upload them to /api/diagnostics/upload
+	r.Get("/{id}/diagnostics", api.ListDiagnostics)
+	r.Post("/{id}/diagnostics", api.RequestDiagnostics)
+	r.Get("/{id}/diagnostics/{diagnosticsId}", api.GetDiagnostics)
+	r.Delete("/{id}/diagnostics/{diagnosticsId}", api.DeleteDiagnostics)
+	r.Get("/{id}/diagnostics/{diagnosticsId}/file", api.DownloadDiagnostics)
 	return r
 }
 
 // ListStations handles GET /api/stations
 func (api *StationsAPI) ListStations(w http.ResponseWriter, r *http.Request) {
 	query := `
-		SELECT id, identity, name, model, vendor, max_output_kw, total_energy_wh, firmware, last_seen
+		SELECT id, identity, name, model, vendor, max_output_kw, total_energy_wh, firmware, ocpp_version, last_seen, validation_mode,
+			security_profile, auth_key_hash IS NOT NULL
 		FROM chargers
 		ORDER BY id ASC
 	`
@@ -99,7 +167,11 @@ func (api *StationsAPI) ListStations(w http.ResponseWriter, r *http.Request) {
 			&station.MaxOutputKW,
 			&station.TotalEnergyWh,
 			&station.Firmware,
+			&station.OCPPVersion,
 			&station.LastSeen,
+			&station.ValidationMode,
+			&station.SecurityProfile,
+			&station.AuthorizationKeySet,
 		)
 		if err != nil {
 			api.logger.Error("Failed to scan station", zap.Error(err))
@@ -114,15 +186,8 @@ func (api *StationsAPI) ListStations(w http.ResponseWriter, r *http.Request) {
 			station.TotalEnergyKwh = &kwh
 		}
 
-		// Calculate online status: online if last_seen within 5 minutes (300 seconds)
-		// OCPP chargers typically send heartbeats every 1-5 minutes
-		station.Status = "offline"
-		if station.LastSeen != nil {
-			timeSinceLastSeen := time.Since(*station.LastSeen)
-			if timeSinceLastSeen <= 300*time.Second {
-				station.Status = "online"
-			}
-		}
+		// A station is online while its WebSocket is open
+		station.Status = api.stationStatus(station.Identity)
 
 		stations = append(stations, station)
 	}
@@ -138,6 +203,20 @@ func (api *StationsAPI) ListStations(w http.ResponseWriter, r *http.Request) {
 		stations = []Station{}
 	}
 
+	// Attach the per-connector status of every station
+	connectors, err := api.getConnectors(r.Context(), nil)
+	if err != nil {
+		api.logger.Error("Failed to query connectors", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	for i := range stations {
+		stations[i].Connectors = connectors[stations[i].ID]
+		if stations[i].Connectors == nil {
+			stations[i].Connectors = []Connector{}
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stations)
 }
@@ -162,9 +241,43 @@ func (api *StationsAPI) CreateStation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Validate validation_mode
+	validationMode := ocpp.DefaultValidationMode
+	if req.ValidationMode != nil {
+		if !ocpp.IsValidValidationMode(*req.ValidationMode) {
+			http.Error(w, "validation_mode must be strict or lenient", http.StatusBadRequest)
+			return
+		}
+		validationMode = *req.ValidationMode
+	}
+
+	// Validate security_profile and authorization_key
+	securityProfile := ocpp.SecurityProfileNone
+	if req.SecurityProfile != nil {
+		if !ocpp.IsValidSecurityProfile(*req.SecurityProfile) {
+			http.Error(w, "security_profile must be 0, 1, 2 or 3", http.StatusBadRequest)
+			return
+		}
+		securityProfile = *req.SecurityProfile
+	}
+	if err := validateAuthorizationKey(req.AuthorizationKey); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if ocpp.SecurityProfileNeedsKey(securityProfile) && (req.AuthorizationKey == nil || *req.AuthorizationKey == "") {
+		http.Error(w, "security_profile 1 and 2 need an authorization_key", http.StatusBadRequest)
+		return
+	}
+	keyHash, err := hashAuthorizationKey(req.AuthorizationKey)
+	if err != nil {
+		api.logger.Error("Failed to hash authorization key", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	query := `
-		INSERT INTO chargers (identity, name, model, vendor, max_output_kw)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO chargers (identity, name, model, vendor, max_output_kw, validation_mode, security_profile, auth_key_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	result, err := api.db.ExecContext(r.Context(), query,
@@ -173,6 +286,9 @@ func (api *StationsAPI) CreateStation(w http.ResponseWriter, r *http.Request) {
 		req.Model,
 		req.Vendor,
 		req.MaxOutputKW,
+		validationMode,
+		securityProfile,
+		keyHash,
 	)
 
 	if err != nil {
@@ -227,9 +343,56 @@ func (api *StationsAPI) UpdateStation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Validate validation_mode
+	if req.ValidationMode != nil && !ocpp.IsValidValidationMode(*req.ValidationMode) {
+		http.Error(w, "validation_mode must be strict or lenient", http.StatusBadRequest)
+		return
+	}
+
+	// Validate security_profile and authorization_key against what is stored
+	if req.SecurityProfile != nil && !ocpp.IsValidSecurityProfile(*req.SecurityProfile) {
+		http.Error(w, "security_profile must be 0, 1, 2 or 3", http.StatusBadRequest)
+		return
+	}
+	if err := validateAuthorizationKey(req.AuthorizationKey); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var securityProfile int
+	var keySet bool
+	err = api.db.QueryRowContext(r.Context(),
+		`SELECT security_profile, auth_key_hash IS NOT NULL FROM chargers WHERE id = ?`, id).Scan(&securityProfile, &keySet)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Station not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		api.logger.Error("Failed to query station security profile", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if req.SecurityProfile != nil {
+		securityProfile = *req.SecurityProfile
+	}
+	if req.AuthorizationKey != nil {
+		keySet = *req.AuthorizationKey != ""
+	}
+	if ocpp.SecurityProfileNeedsKey(securityProfile) && !keySet {
+		http.Error(w, "security_profile 1 and 2 need an authorization_key", http.StatusBadRequest)
+		return
+	}
+	keyHash, err := hashAuthorizationKey(req.AuthorizationKey)
+	if err != nil {
+		api.logger.Error("Failed to hash authorization key", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The new profile and key apply from the charger's next connection
 	query := `
 		UPDATE chargers 
-		SET name = ?, model = ?, vendor = ?, max_output_kw = ?
+		SET name = ?, model = ?, vendor = ?, max_output_kw = ?, validation_mode = COALESCE(?, validation_mode),
+			security_profile = ?, auth_key_hash = CASE WHEN ? THEN ? ELSE auth_key_hash END
 		WHERE id = ?
 	`
 
@@ -238,6 +401,10 @@ func (api *StationsAPI) UpdateStation(w http.ResponseWriter, r *http.Request) {
 		req.Model,
 		req.Vendor,
 		req.MaxOutputKW,
+		req.ValidationMode,
+		securityProfile,
+		req.AuthorizationKey != nil,
+		keyHash,
 		id,
 	)
 
@@ -267,6 +434,9 @@ func (api *StationsAPI) UpdateStation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A connected charger switches mode without reconnecting
+	api.ocppServer.SetValidationMode(station.Identity, station.ValidationMode)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(station)
 }
@@ -306,7 +476,8 @@ func (api *StationsAPI) DeleteStation(w http.ResponseWriter, r *http.Request) {
 // getStationByID fetches a station by ID
 func (api *StationsAPI) getStationByID(ctx context.Context, id int64) (*Station, error) {
 	query := `
-		SELECT id, identity, name, model, vendor, max_output_kw, total_energy_wh, firmware, last_seen
+		SELECT id, identity, name, model, vendor, max_output_kw, total_energy_wh, firmware, ocpp_version, last_seen, validation_mode,
+			security_profile, auth_key_hash IS NOT NULL
 		FROM chargers
 		WHERE id = ?
 	`
@@ -321,7 +492,11 @@ func (api *StationsAPI) getStationByID(ctx context.Context, id int64) (*Station,
 		&station.MaxOutputKW,
 		&station.TotalEnergyWh,
 		&station.Firmware,
+		&station.OCPPVersion,
 		&station.LastSeen,
+		&station.ValidationMode,
+		&station.SecurityProfile,
+		&station.AuthorizationKeySet,
 	)
 
 	if err != nil {
@@ -335,19 +510,30 @@ func (api *StationsAPI) getStationByID(ctx context.Context, id int64) (*Station,
 		station.TotalEnergyKwh = &kwh
 	}
 
-	// Calculate online status: online if last_seen within 5 minutes (300 seconds)
-	// OCPP chargers typically send heartbeats every 1-5 minutes
-	station.Status = "offline"
-	if station.LastSeen != nil {
-		timeSinceLastSeen := time.Since(*station.LastSeen)
-		if timeSinceLastSeen <= 300*time.Second {
-			station.Status = "online"
-		}
+	// A station is online while its WebSocket is open
+	station.Status = api.stationStatus(station.Identity)
+
+	// Attach the per-connector status
+	connectors, err := api.getConnectors(ctx, &id)
+	if err != nil {
+		return nil, err
+	}
+	station.Connectors = connectors[id]
+	if station.Connectors == nil {
+		station.Connectors = []Connector{}
 	}
 
 	return &station, nil
 }
 
+// stationStatus derives the online/offline status from the live connection registry
+func (api *StationsAPI) stationStatus(identity string) string {
+	if api.ocppServer.IsConnected(identity) {
+		return "online"
+	}
+	return "offline"
+}
+
 // validateIdentity validates the station identity
 func validateIdentity(identity string) error {
 	if identity == "" {
@@ -371,6 +557,29 @@ func validateIdentity(identity string) error {
 	return nil
 }
 
+// validateAuthorizationKey checks the length of an AuthorizationKey; an empty key means none
+func validateAuthorizationKey(key *string) error {
+	if key == nil || *key == "" {
+		return nil
+	}
+	if len(*key) < ocpp.MinAuthorizationKeyLength || len(*key) > ocpp.MaxAuthorizationKeyLength {
+		return fmt.Errorf("authorization_key must be %d to %d characters", ocpp.MinAuthorizationKeyLength, ocpp.MaxAuthorizationKeyLength)
+	}
+	return nil
+}
+
+// hashAuthorizationKey hashes an AuthorizationKey for storage, or returns nil if there is none
+func hashAuthorizationKey(key *string) (*string, error) {
+	if key == nil || *key == "" {
+		return nil, nil
+	}
+	hash, err := ocpp.HashAuthorizationKey(*key)
+	if err != nil {
+		return nil, err
+	}
+	return &hash, nil
+}
+
 // isUniqueConstraintError checks if the error is a unique constraint violation
 func isUniqueConstraintError(err error) bool {
 	// SQLite returns "UNIQUE constraint failed" for unique violations
@@ -0,0 +1,636 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/ocpp"
+)
+
+// Tariff represents how charging sessions are priced; every price excludes VAT
+type Tariff struct {
+	ID               int64             `json:"id"`
+	Name             string            `json:"name"`
+	Currency         string            `json:"currency"`
+	Timezone         string            `json:"timezone"`     // IANA zone the periods are in
+	EnergyPrice      float64           `json:"energy_price"` // Per kWh
+	TimePrice        float64           `json:"time_price"`   // Per time_unit of charging
+	TimeUnit         string            `json:"time_unit"`    // "minute" or "hour"
+	SessionFee       float64           `json:"session_fee"`
+	IdlePrice        float64           `json:"idle_price"` // Per minute connected after charging completed
+	IdleGraceMinutes int               `json:"idle_grace_minutes"`
+	VATPercent       float64           `json:"vat_percent"`
+	IsDefault        bool              `json:"is_default"` // Applies to sessions no assignment covers
+	Periods          []TariffPeriod    `json:"periods"`
+	Assignments      TariffAssignments `json:"assignments"`
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+}
+
+// TariffPeriod overrides the tariff's prices during a recurring local time window
+// An end that is not after the start runs past midnight; where periods overlap the first one wins
+type TariffPeriod struct {
+	Days        []string `json:"days"`         // Mon..Sun, empty for every day
+	Start       string   `json:"start"`        // HH:MM
+	End         string   `json:"end"`          // HH:MM, 24:00 for midnight
+	EnergyPrice *float64 `json:"energy_price"` // Null keeps the tariff's price
+	TimePrice   *float64 `json:"time_price"`
+}
+
+// TariffAssignments are the stations and idTag groups a tariff applies to
+// A group is a parent idTag; sessions of the tag itself or of tags with it as parent use the tariff
+type TariffAssignments struct {
+	StationIDs  []int64  `json:"station_ids"`
+	IdTagGroups []string `json:"id_tag_groups"`
+}
+
+// TariffRequest represents the request to create or update a tariff
+type TariffRequest struct {
+	Name             string         `json:"name"`
+	Currency         string         `json:"currency"` // Defaults to EUR
+	Timezone         string         `json:"timezone"` // Defaults to UTC
+	EnergyPrice      float64        `json:"energy_price"`
+	TimePrice        float64        `json:"time_price"`
+	TimeUnit         string         `json:"time_unit"` // Defaults to hour
+	SessionFee       float64        `json:"session_fee"`
+	IdlePrice        float64        `json:"idle_price"`
+	IdleGraceMinutes int            `json:"idle_grace_minutes"`
+	VATPercent       float64        `json:"vat_percent"`
+	IsDefault        bool           `json:"is_default"`
+	Periods          []TariffPeriod `json:"periods"`
+}
+
+// TariffsAPI handles tariff endpoints
+type TariffsAPI struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewTariffsAPI creates a new tariffs API
+func NewTariffsAPI(db *sql.DB, logger *zap.Logger) *TariffsAPI {
+	return &TariffsAPI{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Routes returns the routes for the tariffs API
+func (api *TariffsAPI) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", api.ListTariffs)
+	r.Post("/", api.CreateTariff)
+	r.Get("/{id}", api.GetTariff)
+	r.Put("/{id}", api.UpdateTariff)
+	r.Delete("/{id}", api.DeleteTariff)
+
+	// Stations and idTag groups the tariff applies to
+	r.Put("/{id}/assignments", api.SetTariffAssignments)
+	return r
+}
+
+// ListTariffs handles GET /api/tariffs
+func (api *TariffsAPI) ListTariffs(w http.ResponseWriter, r *http.Request) {
+	rows, err := api.db.QueryContext(r.Context(), `SELECT id FROM tariffs ORDER BY id ASC`)
+	if err != nil {
+		api.logger.Error("Failed to query tariffs", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			api.logger.Error("Failed to scan tariff", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	tariffs := []Tariff{}
+	for _, id := range ids {
+		tariff, err := api.getTariffByID(r.Context(), id)
+		if err != nil {
+			api.logger.Error("Failed to fetch tariff", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		tariffs = append(tariffs, *tariff)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tariffs)
+}
+
+// GetTariff handles GET /api/tariffs/{id}
+func (api *TariffsAPI) GetTariff(w http.ResponseWriter, r *http.Request) {
+	id, ok := tariffIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	tariff, err := api.getTariffByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Tariff not found", http.StatusNotFound)
+			return
+		}
+		api.logger.Error("Failed to fetch tariff", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tariff)
+}
+
+// CreateTariff handles POST /api/tariffs
+func (api *TariffsAPI) CreateTariff(w http.ResponseWriter, r *http.Request) {
+	var req TariffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	periods, err := validateTariffRequest(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := api.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.logger.Error("Failed to begin transaction", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if req.IsDefault {
+		if _, err := tx.ExecContext(r.Context(), `UPDATE tariffs SET is_default = 0 WHERE is_default = 1`); err != nil {
+			api.logger.Error("Failed to unset default tariff", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	query := `
+		INSERT INTO tariffs (name, currency, timezone, energy_price, time_price, time_unit, session_fee,
+			idle_price, idle_grace_minutes, vat_percent, is_default, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	result, err := tx.ExecContext(r.Context(), query,
+		req.Name,
+		req.Currency,
+		req.Timezone,
+		req.EnergyPrice,
+		req.TimePrice,
+		req.TimeUnit,
+		req.SessionFee,
+		req.IdlePrice,
+		req.IdleGraceMinutes,
+		req.VATPercent,
+		req.IsDefault,
+		now,
+		now,
+	)
+	if err != nil {
+		api.logger.Error("Failed to create tariff", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		api.logger.Error("Failed to get last insert ID", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := insertTariffPeriods(r.Context(), tx, id, req.Periods, periods); err != nil {
+		api.logger.Error("Failed to store tariff periods", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.logger.Error("Failed to commit tariff", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	tariff, err := api.getTariffByID(r.Context(), id)
+	if err != nil {
+		api.logger.Error("Failed to fetch created tariff", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tariff)
+}
+
+// UpdateTariff handles PUT /api/tariffs/{id}
+// The periods are replaced; sessions priced before keep their stored cost until recalculated
+func (api *TariffsAPI) UpdateTariff(w http.ResponseWriter, r *http.Request) {
+	id, ok := tariffIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req TariffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	periods, err := validateTariffRequest(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := api.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.logger.Error("Failed to begin transaction", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if req.IsDefault {
+		if _, err := tx.ExecContext(r.Context(), `UPDATE tariffs SET is_default = 0 WHERE is_default = 1 AND id <> ?`, id); err != nil {
+			api.logger.Error("Failed to unset default tariff", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	query := `
+		UPDATE tariffs
+		SET name = ?, currency = ?, timezone = ?, energy_price = ?, time_price = ?, time_unit = ?, session_fee = ?,
+			idle_price = ?, idle_grace_minutes = ?, vat_percent = ?, is_default = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	result, err := tx.ExecContext(r.Context(), query,
+		req.Name,
+		req.Currency,
+		req.Timezone,
+		req.EnergyPrice,
+		req.TimePrice,
+		req.TimeUnit,
+		req.SessionFee,
+		req.IdlePrice,
+		req.IdleGraceMinutes,
+		req.VATPercent,
+		req.IsDefault,
+		time.Now(),
+		id,
+	)
+	if err != nil {
+		api.logger.Error("Failed to update tariff", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		api.logger.Error("Failed to get rows affected", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "Tariff not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM tariff_periods WHERE tariff_id = ?`, id); err != nil {
+		api.logger.Error("Failed to replace tariff periods", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := insertTariffPeriods(r.Context(), tx, id, req.Periods, periods); err != nil {
+		api.logger.Error("Failed to store tariff periods", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.logger.Error("Failed to commit tariff", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	tariff, err := api.getTariffByID(r.Context(), id)
+	if err != nil {
+		api.logger.Error("Failed to fetch updated tariff", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tariff)
+}
+
+// DeleteTariff handles DELETE /api/tariffs/{id}
+// Costs already calculated with the tariff are kept
+func (api *TariffsAPI) DeleteTariff(w http.ResponseWriter, r *http.Request) {
+	id, ok := tariffIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := api.db.ExecContext(r.Context(), `DELETE FROM tariffs WHERE id = ?`, id)
+	if err != nil {
+		api.logger.Error("Failed to delete tariff", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		api.logger.Error("Failed to get rows affected", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "Tariff not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetTariffAssignments handles PUT /api/tariffs/{id}/assignments
+// The lists replace the tariff's assignments; a station or group has at most one tariff, so
+// listing one here moves it from its previous tariff
+func (api *TariffsAPI) SetTariffAssignments(w http.ResponseWriter, r *http.Request) {
+	id, ok := tariffIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req TariffAssignments
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := api.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.logger.Error("Failed to begin transaction", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM tariffs WHERE id = ?`, id).Scan(&exists); err != nil {
+		api.logger.Error("Failed to look up tariff", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if exists == 0 {
+		http.Error(w, "Tariff not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM tariff_assignments WHERE tariff_id = ?`, id); err != nil {
+		api.logger.Error("Failed to clear tariff assignments", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, stationID := range req.StationIDs {
+		var found int
+		if err := tx.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM chargers WHERE id = ?`, stationID).Scan(&found); err != nil {
+			api.logger.Error("Failed to look up station", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if found == 0 {
+			http.Error(w, fmt.Sprintf("Station %d not found", stationID), http.StatusBadRequest)
+			return
+		}
+
+		query := `
+			INSERT INTO tariff_assignments (tariff_id, charger_id) VALUES (?, ?)
+			ON CONFLICT(charger_id) DO UPDATE SET tariff_id = excluded.tariff_id
+		`
+		if _, err := tx.ExecContext(r.Context(), query, id, stationID); err != nil {
+			api.logger.Error("Failed to assign tariff to station", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	for _, group := range req.IdTagGroups {
+		if group == "" || len(group) > maxIdTagLength {
+			http.Error(w, fmt.Sprintf("id_tag_groups must be idTags of 1-%d characters", maxIdTagLength), http.StatusBadRequest)
+			return
+		}
+
+		query := `
+			INSERT INTO tariff_assignments (tariff_id, id_tag_group) VALUES (?, ?)
+			ON CONFLICT(id_tag_group) DO UPDATE SET tariff_id = excluded.tariff_id
+		`
+		if _, err := tx.ExecContext(r.Context(), query, id, group); err != nil {
+			api.logger.Error("Failed to assign tariff to idTag group", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.logger.Error("Failed to commit tariff assignments", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	tariff, err := api.getTariffByID(r.Context(), id)
+	if err != nil {
+		api.logger.Error("Failed to fetch tariff", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tariff)
+}
+
+// insertTariffPeriods stores the validated periods of a tariff
+func insertTariffPeriods(ctx context.Context, tx *sql.Tx, tariffID int64, requested []TariffPeriod, windows []ocpp.TOUWindow) error {
+	query := `
+		INSERT INTO tariff_periods (tariff_id, days_mask, start_time, end_time, energy_price, time_price)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	for i, window := range windows {
+		period := requested[i]
+		if _, err := tx.ExecContext(ctx, query, tariffID, window.Days, period.Start, period.End, period.EnergyPrice, period.TimePrice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getTariffByID fetches a tariff with its periods and assignments
+func (api *TariffsAPI) getTariffByID(ctx context.Context, id int64) (*Tariff, error) {
+	query := `
+		SELECT id, name, currency, timezone, energy_price, time_price, time_unit, session_fee,
+			idle_price, idle_grace_minutes, vat_percent, is_default, created_at, updated_at
+		FROM tariffs
+		WHERE id = ?
+	`
+
+	var tariff Tariff
+	err := api.db.QueryRowContext(ctx, query, id).Scan(
+		&tariff.ID,
+		&tariff.Name,
+		&tariff.Currency,
+		&tariff.Timezone,
+		&tariff.EnergyPrice,
+		&tariff.TimePrice,
+		&tariff.TimeUnit,
+		&tariff.SessionFee,
+		&tariff.IdlePrice,
+		&tariff.IdleGraceMinutes,
+		&tariff.VATPercent,
+		&tariff.IsDefault,
+		&tariff.CreatedAt,
+		&tariff.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	periodRows, err := api.db.QueryContext(ctx,
+		`SELECT days_mask, start_time, end_time, energy_price, time_price FROM tariff_periods WHERE tariff_id = ? ORDER BY id ASC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer periodRows.Close()
+
+	tariff.Periods = []TariffPeriod{}
+	for periodRows.Next() {
+		var period TariffPeriod
+		var days uint8
+		if err := periodRows.Scan(&days, &period.Start, &period.End, &period.EnergyPrice, &period.TimePrice); err != nil {
+			return nil, err
+		}
+		period.Days = ocpp.TOUDayNames(days)
+		if period.Days == nil {
+			period.Days = []string{}
+		}
+		tariff.Periods = append(tariff.Periods, period)
+	}
+	if err := periodRows.Err(); err != nil {
+		return nil, err
+	}
+
+	assignmentRows, err := api.db.QueryContext(ctx,
+		`SELECT charger_id, id_tag_group FROM tariff_assignments WHERE tariff_id = ? ORDER BY id ASC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer assignmentRows.Close()
+
+	tariff.Assignments = TariffAssignments{StationIDs: []int64{}, IdTagGroups: []string{}}
+	for assignmentRows.Next() {
+		var stationID sql.NullInt64
+		var group sql.NullString
+		if err := assignmentRows.Scan(&stationID, &group); err != nil {
+			return nil, err
+		}
+		if stationID.Valid {
+			tariff.Assignments.StationIDs = append(tariff.Assignments.StationIDs, stationID.Int64)
+		} else {
+			tariff.Assignments.IdTagGroups = append(tariff.Assignments.IdTagGroups, group.String)
+		}
+	}
+
+	return &tariff, assignmentRows.Err()
+}
+
+// tariffIDFromURL parses the {id} URL parameter of a tariff
+// It writes the error response itself and returns false if the ID is invalid
+func tariffIDFromURL(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid tariff ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// validateTariffRequest validates a tariff request, fills in the defaults and parses its periods
+func validateTariffRequest(req *TariffRequest) ([]ocpp.TOUWindow, error) {
+	if req.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	if req.Currency == "" {
+		req.Currency = "EUR"
+	}
+	if len(req.Currency) != 3 {
+		return nil, fmt.Errorf("currency must be an ISO 4217 code, e.g. EUR")
+	}
+
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", req.Timezone)
+	}
+
+	if req.TimeUnit == "" {
+		req.TimeUnit = ocpp.TariffTimeUnitHour
+	}
+	if req.TimeUnit != ocpp.TariffTimeUnitMinute && req.TimeUnit != ocpp.TariffTimeUnitHour {
+		return nil, fmt.Errorf("time_unit must be minute or hour")
+	}
+
+	if req.EnergyPrice < 0 || req.TimePrice < 0 || req.SessionFee < 0 || req.IdlePrice < 0 {
+		return nil, fmt.Errorf("prices must be >= 0")
+	}
+	if req.IdleGraceMinutes < 0 {
+		return nil, fmt.Errorf("idle_grace_minutes must be >= 0")
+	}
+	if req.VATPercent < 0 || req.VATPercent > 100 {
+		return nil, fmt.Errorf("vat_percent must be 0-100")
+	}
+
+	windows := make([]ocpp.TOUWindow, len(req.Periods))
+	for i, period := range req.Periods {
+		if period.EnergyPrice == nil && period.TimePrice == nil {
+			return nil, fmt.Errorf("period %d: set energy_price, time_price or both", i+1)
+		}
+		if (period.EnergyPrice != nil && *period.EnergyPrice < 0) || (period.TimePrice != nil && *period.TimePrice < 0) {
+			return nil, fmt.Errorf("period %d: prices must be >= 0", i+1)
+		}
+		parsed, err := ocpp.ParseTOUWindow(period.Days, period.Start, period.End, 0)
+		if err != nil {
+			return nil, fmt.Errorf("period %d: %w", i+1, err)
+		}
+		windows[i] = parsed
+	}
+
+	return windows, nil
+}
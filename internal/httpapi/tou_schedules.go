@@ -0,0 +1,780 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/ocpp"
+)
+
+// TOUSchedule represents a time-of-use charging schedule, e.g. throttling during peak tariff hours
+type TOUSchedule struct {
+	ID           int64                `json:"id"`
+	Name         string               `json:"name"`
+	Timezone     string               `json:"timezone"`   // IANA zone the windows are in, e.g. Europe/Amsterdam
+	LimitUnit    string               `json:"limit_unit"` // "kW" in total or "A" per phase
+	DefaultLimit float64              `json:"default_limit"`
+	Windows      []TOUScheduleWindow  `json:"windows"`
+	Chargers     []TOUScheduleCharger `json:"chargers"`
+	CreatedAt    time.Time            `json:"created_at"`
+	UpdatedAt    time.Time            `json:"updated_at"`
+}
+
+// TOUScheduleWindow is a recurring local time window with its own limit
+// An end that is not after the start runs past midnight
+type TOUScheduleWindow struct {
+	Days  []string `json:"days"`  // Mon..Sun, empty for every day
+	Start string   `json:"start"` // HH:MM
+	End   string   `json:"end"`   // HH:MM, 24:00 for midnight
+	Limit float64  `json:"limit"`
+}
+
+// TOUScheduleCharger is a charger following a schedule with the outcome of the last push
+type TOUScheduleCharger struct {
+	StationID int64      `json:"station_id"`
+	Identity  string     `json:"identity"`
+	Name      *string    `json:"name"`
+	Status    *string    `json:"status"` // Charger's answer to SetChargingProfile, null until pushed
+	Error     *string    `json:"error"`
+	PushedAt  *time.Time `json:"pushed_at"`
+}
+
+// TOUScheduleRequest represents the request to create or update a schedule
+type TOUScheduleRequest struct {
+	Name         string              `json:"name"`
+	Timezone     string              `json:"timezone"`   // Defaults to UTC
+	LimitUnit    string              `json:"limit_unit"` // Defaults to kW
+	DefaultLimit float64             `json:"default_limit"`
+	Windows      []TOUScheduleWindow `json:"windows"`
+}
+
+// SetTOUScheduleChargersRequest represents the request to set which chargers follow a schedule
+type SetTOUScheduleChargersRequest struct {
+	StationIDs []int64 `json:"station_ids"`
+}
+
+// TOUSchedulePreview is the limit curve of a schedule over one local day
+type TOUSchedulePreview struct {
+	Date      string                      `json:"date"`
+	Timezone  string                      `json:"timezone"`
+	LimitUnit string                      `json:"limit_unit"`
+	Periods   []ocpp.TOUPeriod            `json:"periods"`
+	Chargers  []TOUScheduleChargerPreview `json:"chargers"`
+}
+
+// TOUScheduleChargerPreview is the limit curve one charger will follow
+// In kW, limits above the charger's rated output are capped, since it cannot charge faster anyway
+type TOUScheduleChargerPreview struct {
+	StationID int64            `json:"station_id"`
+	Identity  string           `json:"identity"`
+	Periods   []ocpp.TOUPeriod `json:"periods"`
+}
+
+// TOUSchedulesAPI handles time-of-use schedule endpoints
+type TOUSchedulesAPI struct {
+	db         *sql.DB
+	logger     *zap.Logger
+	ocppServer OCPPServer
+}
+
+// NewTOUSchedulesAPI creates a new time-of-use schedules API
+func NewTOUSchedulesAPI(db *sql.DB, logger *zap.Logger, ocppServer OCPPServer) *TOUSchedulesAPI {
+	return &TOUSchedulesAPI{
+		db:         db,
+		logger:     logger,
+		ocppServer: ocppServer,
+	}
+}
+
+// Routes returns the routes for the time-of-use schedules API
+func (api *TOUSchedulesAPI) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", api.ListSchedules)
+	r.Post("/", api.CreateSchedule)
+	r.Get("/{id}", api.GetSchedule)
+	r.Put("/{id}", api.UpdateSchedule)
+	r.Delete("/{id}", api.DeleteSchedule)
+
+	// Chargers following the schedule
+	r.Put("/{id}/chargers", api.SetScheduleChargers)
+
+	// Send the schedule to its chargers now, and show what they will do on a given day
+	r.Post("/{id}/push", api.PushSchedule)
+	r.Get("/{id}/preview", api.PreviewSchedule)
+	return r
+}
+
+// ListSchedules handles GET /api/tou-schedules
+func (api *TOUSchedulesAPI) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	rows, err := api.db.QueryContext(r.Context(), `SELECT id FROM tou_schedules ORDER BY id ASC`)
+	if err != nil {
+		api.logger.Error("Failed to query time-of-use schedules", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			api.logger.Error("Failed to scan time-of-use schedule", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	schedules := []TOUSchedule{}
+	for _, id := range ids {
+		schedule, err := api.getScheduleByID(r.Context(), id)
+		if err != nil {
+			api.logger.Error("Failed to fetch time-of-use schedule", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		schedules = append(schedules, *schedule)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedules)
+}
+
+// GetSchedule handles GET /api/tou-schedules/{id}
+func (api *TOUSchedulesAPI) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := api.scheduleFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// CreateSchedule handles POST /api/tou-schedules
+func (api *TOUSchedulesAPI) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req TOUScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	windows, err := validateTOUScheduleRequest(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := api.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.logger.Error("Failed to begin transaction", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO tou_schedules (name, timezone, limit_unit, default_limit, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	result, err := tx.ExecContext(r.Context(), query, req.Name, req.Timezone, req.LimitUnit, req.DefaultLimit, now, now)
+	if err != nil {
+		api.logger.Error("Failed to create time-of-use schedule", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		api.logger.Error("Failed to get last insert ID", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := insertTOUScheduleWindows(r.Context(), tx, id, req.Windows, windows); err != nil {
+		api.logger.Error("Failed to store time-of-use schedule windows", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.logger.Error("Failed to commit time-of-use schedule", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	schedule, err := api.getScheduleByID(r.Context(), id)
+	if err != nil {
+		api.logger.Error("Failed to fetch created time-of-use schedule", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// UpdateSchedule handles PUT /api/tou-schedules/{id}
+// The windows are replaced and the new schedule is sent to its chargers right away
+func (api *TOUSchedulesAPI) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := touScheduleIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req TOUScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	windows, err := validateTOUScheduleRequest(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := api.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.logger.Error("Failed to begin transaction", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE tou_schedules
+		SET name = ?, timezone = ?, limit_unit = ?, default_limit = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	result, err := tx.ExecContext(r.Context(), query, req.Name, req.Timezone, req.LimitUnit, req.DefaultLimit, time.Now(), id)
+	if err != nil {
+		api.logger.Error("Failed to update time-of-use schedule", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		api.logger.Error("Failed to get rows affected", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "Time-of-use schedule not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM tou_schedule_windows WHERE schedule_id = ?`, id); err != nil {
+		api.logger.Error("Failed to replace time-of-use schedule windows", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := insertTOUScheduleWindows(r.Context(), tx, id, req.Windows, windows); err != nil {
+		api.logger.Error("Failed to store time-of-use schedule windows", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.logger.Error("Failed to commit time-of-use schedule", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	go api.pushInBackground(id)
+
+	schedule, err := api.getScheduleByID(r.Context(), id)
+	if err != nil {
+		api.logger.Error("Failed to fetch updated time-of-use schedule", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// DeleteSchedule handles DELETE /api/tou-schedules/{id}
+// The schedule's profile is cleared from its chargers
+func (api *TOUSchedulesAPI) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := touScheduleIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := api.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.logger.Error("Failed to begin transaction", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	released, err := touScheduleChargerIdentities(r.Context(), tx, id)
+	if err != nil {
+		api.logger.Error("Failed to look up time-of-use schedule chargers", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := tx.ExecContext(r.Context(), `DELETE FROM tou_schedules WHERE id = ?`, id)
+	if err != nil {
+		api.logger.Error("Failed to delete time-of-use schedule", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		api.logger.Error("Failed to get rows affected", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "Time-of-use schedule not found", http.StatusNotFound)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.logger.Error("Failed to commit time-of-use schedule deletion", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	go api.releaseChargersInBackground(released)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetScheduleChargers handles PUT /api/tou-schedules/{id}/chargers
+// The list replaces the schedule's chargers; a charger follows at most one schedule, so
+// listing a charger here moves it from its previous schedule. Chargers left out are cleared
+func (api *TOUSchedulesAPI) SetScheduleChargers(w http.ResponseWriter, r *http.Request) {
+	id, ok := touScheduleIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req SetTOUScheduleChargersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := api.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.logger.Error("Failed to begin transaction", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM tou_schedules WHERE id = ?`, id).Scan(&exists); err != nil {
+		api.logger.Error("Failed to look up time-of-use schedule", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if exists == 0 {
+		http.Error(w, "Time-of-use schedule not found", http.StatusNotFound)
+		return
+	}
+
+	previous, err := touScheduleChargerIdentities(r.Context(), tx, id)
+	if err != nil {
+		api.logger.Error("Failed to look up time-of-use schedule chargers", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM tou_schedule_chargers WHERE schedule_id = ?`, id); err != nil {
+		api.logger.Error("Failed to release time-of-use schedule chargers", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, stationID := range req.StationIDs {
+		var found int
+		if err := tx.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM chargers WHERE id = ?`, stationID).Scan(&found); err != nil {
+			api.logger.Error("Failed to look up station", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if found == 0 {
+			http.Error(w, fmt.Sprintf("Station %d not found", stationID), http.StatusBadRequest)
+			return
+		}
+
+		query := `
+			INSERT INTO tou_schedule_chargers (charger_id, schedule_id) VALUES (?, ?)
+			ON CONFLICT(charger_id) DO UPDATE SET
+				schedule_id = excluded.schedule_id,
+				status = NULL,
+				error = NULL,
+				utc_offset = NULL,
+				pushed_at = NULL
+		`
+		if _, err := tx.ExecContext(r.Context(), query, stationID, id); err != nil {
+			api.logger.Error("Failed to assign charger to time-of-use schedule", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		delete(previous, stationID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.logger.Error("Failed to commit time-of-use schedule chargers", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	go func() {
+		api.releaseChargersInBackground(previous)
+		api.pushInBackground(id)
+	}()
+
+	schedule, err := api.getScheduleByID(r.Context(), id)
+	if err != nil {
+		api.logger.Error("Failed to fetch time-of-use schedule", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// PushSchedule handles POST /api/tou-schedules/{id}/push
+// It sends the schedule to every connected charger following it and returns each charger's answer
+func (api *TOUSchedulesAPI) PushSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := api.scheduleFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	results, err := api.ocppServer.PushTOUSchedule(r.Context(), schedule.ID)
+	if err != nil {
+		api.logger.Error("Failed to push time-of-use schedule", zap.Int64("schedule_id", schedule.ID), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// PreviewSchedule handles GET /api/tou-schedules/{id}/preview
+// Query parameter date (YYYY-MM-DD, defaults to today in the schedule's timezone)
+func (api *TOUSchedulesAPI) PreviewSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := api.scheduleFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	sch, err := schedule.compile()
+	if err != nil {
+		api.logger.Error("Failed to compile time-of-use schedule", zap.Int64("schedule_id", schedule.ID), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	day := time.Now().In(sch.Location)
+	if dateStr := r.URL.Query().Get("date"); dateStr != "" {
+		day, err = time.ParseInLocation("2006-01-02", dateStr, sch.Location)
+		if err != nil {
+			http.Error(w, "Invalid date (use YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	preview := TOUSchedulePreview{
+		Date:      day.Format("2006-01-02"),
+		Timezone:  schedule.Timezone,
+		LimitUnit: schedule.LimitUnit,
+		Periods:   sch.Curve(day),
+		Chargers:  []TOUScheduleChargerPreview{},
+	}
+
+	for _, charger := range schedule.Chargers {
+		var maxOutputKW sql.NullFloat64
+		if err := api.db.QueryRowContext(r.Context(), `SELECT max_output_kw FROM chargers WHERE id = ?`, charger.StationID).Scan(&maxOutputKW); err != nil {
+			api.logger.Error("Failed to fetch station", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		periods := preview.Periods
+		if schedule.LimitUnit == "kW" && maxOutputKW.Valid && maxOutputKW.Float64 > 0 {
+			periods = capTOUPeriods(periods, maxOutputKW.Float64)
+		}
+
+		preview.Chargers = append(preview.Chargers, TOUScheduleChargerPreview{
+			StationID: charger.StationID,
+			Identity:  charger.Identity,
+			Periods:   periods,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
+
+// capTOUPeriods limits a curve to a maximum, merging periods that end up with the same limit
+func capTOUPeriods(periods []ocpp.TOUPeriod, max float64) []ocpp.TOUPeriod {
+	capped := []ocpp.TOUPeriod{}
+	for _, period := range periods {
+		period.Limit = math.Min(period.Limit, max)
+		if n := len(capped); n > 0 && capped[n-1].Limit == period.Limit {
+			capped[n-1].End = period.End
+			continue
+		}
+		capped = append(capped, period)
+	}
+	return capped
+}
+
+// compile turns the stored schedule into the form the OCPP server sends to chargers
+func (schedule *TOUSchedule) compile() (*ocpp.TOUSchedule, error) {
+	location, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	sch := &ocpp.TOUSchedule{
+		ID:           schedule.ID,
+		Location:     location,
+		LimitUnit:    schedule.LimitUnit,
+		DefaultLimit: schedule.DefaultLimit,
+	}
+	for _, window := range schedule.Windows {
+		parsed, err := ocpp.ParseTOUWindow(window.Days, window.Start, window.End, window.Limit)
+		if err != nil {
+			return nil, err
+		}
+		sch.Windows = append(sch.Windows, parsed)
+	}
+	return sch, nil
+}
+
+// pushInBackground sends a changed schedule to its chargers without holding up the HTTP response
+func (api *TOUSchedulesAPI) pushInBackground(id int64) {
+	if _, err := api.ocppServer.PushTOUSchedule(context.Background(), id); err != nil {
+		api.logger.Error("Failed to push time-of-use schedule", zap.Int64("schedule_id", id), zap.Error(err))
+	}
+}
+
+// releaseChargersInBackground clears the schedule profile of chargers that no longer follow a schedule
+// A charger that is offline keeps the profile until it is cleared by hand
+func (api *TOUSchedulesAPI) releaseChargersInBackground(chargers map[int64]string) {
+	for _, identity := range chargers {
+		if err := api.ocppServer.ReleaseTOUSchedule(context.Background(), identity); err != nil {
+			api.logger.Error("Failed to clear time-of-use schedule", zap.String("charge_point_id", identity), zap.Error(err))
+		}
+	}
+}
+
+// touScheduleChargerIdentities returns the OCPP identities of a schedule's chargers keyed by station ID
+func touScheduleChargerIdentities(ctx context.Context, tx *sql.Tx, scheduleID int64) (map[int64]string, error) {
+	query := `
+		SELECT c.id, c.identity
+		FROM tou_schedule_chargers tsc
+		JOIN chargers c ON c.id = tsc.charger_id
+		WHERE tsc.schedule_id = ?
+	`
+	rows, err := tx.QueryContext(ctx, query, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chargers := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var identity string
+		if err := rows.Scan(&id, &identity); err != nil {
+			return nil, err
+		}
+		chargers[id] = identity
+	}
+	return chargers, rows.Err()
+}
+
+// insertTOUScheduleWindows stores the validated windows of a schedule
+func insertTOUScheduleWindows(ctx context.Context, tx *sql.Tx, scheduleID int64, requested []TOUScheduleWindow, windows []ocpp.TOUWindow) error {
+	query := `
+		INSERT INTO tou_schedule_windows (schedule_id, days_mask, start_time, end_time, limit_value)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	for i, window := range windows {
+		if _, err := tx.ExecContext(ctx, query, scheduleID, window.Days, requested[i].Start, requested[i].End, window.Limit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scheduleFromURL resolves the {id} URL parameter to a schedule
+// It writes the error response itself and returns false if the schedule cannot be found
+func (api *TOUSchedulesAPI) scheduleFromURL(w http.ResponseWriter, r *http.Request) (*TOUSchedule, bool) {
+	id, ok := touScheduleIDFromURL(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	schedule, err := api.getScheduleByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Time-of-use schedule not found", http.StatusNotFound)
+			return nil, false
+		}
+		api.logger.Error("Failed to fetch time-of-use schedule", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return schedule, true
+}
+
+// getScheduleByID fetches a schedule with its windows and chargers
+func (api *TOUSchedulesAPI) getScheduleByID(ctx context.Context, id int64) (*TOUSchedule, error) {
+	query := `
+		SELECT id, name, timezone, limit_unit, default_limit, created_at, updated_at
+		FROM tou_schedules
+		WHERE id = ?
+	`
+
+	var schedule TOUSchedule
+	err := api.db.QueryRowContext(ctx, query, id).Scan(
+		&schedule.ID,
+		&schedule.Name,
+		&schedule.Timezone,
+		&schedule.LimitUnit,
+		&schedule.DefaultLimit,
+		&schedule.CreatedAt,
+		&schedule.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	windowRows, err := api.db.QueryContext(ctx,
+		`SELECT days_mask, start_time, end_time, limit_value FROM tou_schedule_windows WHERE schedule_id = ? ORDER BY id ASC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer windowRows.Close()
+
+	schedule.Windows = []TOUScheduleWindow{}
+	for windowRows.Next() {
+		var window TOUScheduleWindow
+		var days uint8
+		if err := windowRows.Scan(&days, &window.Start, &window.End, &window.Limit); err != nil {
+			return nil, err
+		}
+		window.Days = ocpp.TOUDayNames(days)
+		if window.Days == nil {
+			window.Days = []string{}
+		}
+		schedule.Windows = append(schedule.Windows, window)
+	}
+	if err := windowRows.Err(); err != nil {
+		return nil, err
+	}
+
+	chargerQuery := `
+		SELECT c.id, c.identity, c.name, tsc.status, tsc.error, tsc.pushed_at
+		FROM tou_schedule_chargers tsc
+		JOIN chargers c ON c.id = tsc.charger_id
+		WHERE tsc.schedule_id = ?
+		ORDER BY c.id ASC
+	`
+
+	chargerRows, err := api.db.QueryContext(ctx, chargerQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer chargerRows.Close()
+
+	schedule.Chargers = []TOUScheduleCharger{}
+	for chargerRows.Next() {
+		var charger TOUScheduleCharger
+		if err := chargerRows.Scan(
+			&charger.StationID,
+			&charger.Identity,
+			&charger.Name,
+			&charger.Status,
+			&charger.Error,
+			&charger.PushedAt,
+		); err != nil {
+			return nil, err
+		}
+		schedule.Chargers = append(schedule.Chargers, charger)
+	}
+
+	return &schedule, chargerRows.Err()
+}
+
+// touScheduleIDFromURL parses the {id} URL parameter of a schedule
+// It writes the error response itself and returns false if the ID is invalid
+func touScheduleIDFromURL(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid time-of-use schedule ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// validateTOUScheduleRequest validates a schedule request, fills in the defaults and parses its windows
+func validateTOUScheduleRequest(req *TOUScheduleRequest) ([]ocpp.TOUWindow, error) {
+	if req.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", req.Timezone)
+	}
+
+	if req.LimitUnit == "" {
+		req.LimitUnit = "kW"
+	}
+	if req.LimitUnit != "kW" && req.LimitUnit != "A" {
+		return nil, fmt.Errorf("limit_unit must be kW or A")
+	}
+
+	if req.DefaultLimit <= 0 {
+		return nil, fmt.Errorf("default_limit must be > 0 (e.g. the chargers' rated output)")
+	}
+
+	windows := make([]ocpp.TOUWindow, len(req.Windows))
+	for i, window := range req.Windows {
+		parsed, err := ocpp.ParseTOUWindow(window.Days, window.Start, window.End, window.Limit)
+		if err != nil {
+			return nil, fmt.Errorf("window %d: %w", i+1, err)
+		}
+		windows[i] = parsed
+	}
+
+	return windows, nil
+}
@@ -0,0 +1,480 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"OCPP-Power-Manager/internal/ocpp"
+)
+
+const (
+	// defaultTransactionsLimit is the page size when no limit is given
+	defaultTransactionsLimit = 50
+	// maxTransactionsLimit caps the page size of the transaction list
+	maxTransactionsLimit = 200
+)
+
+// Transaction represents a charging session
+type Transaction struct {
+	ID              int64                 `json:"id"`
+	TransactionId   string                `json:"transaction_id"` // OCPP transaction ID given to the charger
+	StationID       int64                 `json:"station_id"`
+	StationIdentity string                `json:"station_identity"`
+	StationName     *string               `json:"station_name"`
+	ConnectorId     *int                  `json:"connector_id"`
+	IdTag           *string               `json:"id_tag"`
+	ReservationId   *int                  `json:"reservation_id"`
+	Status          string                `json:"status"` // "open" while charging, "closed" after StopTransaction
+	StartTs         time.Time             `json:"start_ts"`
+	StopTs          *time.Time            `json:"stop_ts"`
+	StartMeterWh    int64                 `json:"start_meter_wh"`
+	StopMeterWh     *int64                `json:"stop_meter_wh"`
+	EnergyWh        *int64                `json:"energy_wh"` // Live from the latest meter reading while open
+	EnergyKwh       *float64              `json:"energy_kwh"`
+	DurationSeconds int64                 `json:"duration_seconds"` // Up to now while open
+	AverageKW       *float64              `json:"average_kw"`
+	PeakKW          *float64              `json:"peak_kw"` // Highest Power.Active.Import sample, if the charger sends power
+	Cost            *ocpp.TransactionCost `json:"cost"`    // Null while open or when no tariff applies
+}
+
+// TransactionDetail is a transaction with its meter value timeline
+type TransactionDetail struct {
+	Transaction
+	MeterValues []MeterValue `json:"meter_values"`
+}
+
+// TransactionsPage is one page of the transaction list
+type TransactionsPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   *string       `json:"next_cursor"` // Pass as ?cursor= to get the next page; null on the last page
+}
+
+// transactionsCursor is the position after the last transaction of a page
+type transactionsCursor struct {
+	Value string `json:"v"` // Sort key of the last row
+	ID    int64  `json:"id"`
+}
+
+// transactionSorts maps the sort parameter to the SQL expression it orders by
+var transactionSorts = map[string]string{
+	"start_ts":  "t.start_ts",
+	"energy_wh": "COALESCE(t.energy_wh, 0)",
+}
+
+// transactionSelect selects a transaction with its station and the meter data its aggregates are built from
+const transactionSelect = `
+	SELECT t.id, t.tx_id, c.id, c.identity, c.name, t.connector_id, t.id_tag, t.reservation_id,
+		t.start_ts, t.stop_ts, t.start_meter_wh, t.stop_meter_wh, t.energy_wh,
+		(SELECT value FROM meter_values
+			WHERE transaction_id = t.id AND measurand = 'Energy.Active.Import.Register' AND phase IS NULL AND value IS NOT NULL
+			ORDER BY ts DESC LIMIT 1),
+		(SELECT MAX(value) FROM meter_values
+			WHERE transaction_id = t.id AND measurand = 'Power.Active.Import' AND phase IS NULL),
+		tc.breakdown
+	FROM transactions t
+	JOIN chargers c ON c.id = t.charger_id
+	LEFT JOIN transaction_costs tc ON tc.transaction_id = t.id
+`
+
+// TransactionsAPI handles charging session endpoints
+type TransactionsAPI struct {
+	db         *sql.DB
+	logger     *zap.Logger
+	ocppServer OCPPServer
+}
+
+// NewTransactionsAPI creates a new transactions API
+func NewTransactionsAPI(db *sql.DB, logger *zap.Logger, ocppServer OCPPServer) *TransactionsAPI {
+	return &TransactionsAPI{
+		db:         db,
+		logger:     logger,
+		ocppServer: ocppServer,
+	}
+}
+
+// Routes returns the routes for the transactions API
+func (api *TransactionsAPI) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", api.ListTransactions)
+	r.Get("/{id}", api.GetTransaction)
+	r.Post("/{id}/cost", api.PriceTransaction)
+	r.Get("/{id}/receipt", api.GetReceipt)
+	return r
+}
+
+// ListTransactions handles GET /api/transactions
+// Filters: station_id, id_tag, from/to (RFC3339, on start time), status (open/closed), min_energy_wh
+// Sorting: sort (start_ts or energy_wh) and order (desc or asc); paging: limit and cursor
+func (api *TransactionsAPI) ListTransactions(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	var conditions []string
+	var args []interface{}
+
+	if stationIDStr := params.Get("station_id"); stationIDStr != "" {
+		stationID, err := strconv.ParseInt(stationIDStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid station_id", http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "t.charger_id = ?")
+		args = append(args, stationID)
+	}
+
+	if idTag := params.Get("id_tag"); idTag != "" {
+		conditions = append(conditions, "t.id_tag = ?")
+		args = append(args, idTag)
+	}
+
+	for _, bound := range []struct {
+		param string
+		op    string
+	}{{"from", ">="}, {"to", "<="}} {
+		value := params.Get(bound.param)
+		if value == "" {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, bound.param+" must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "t.start_ts "+bound.op+" ?")
+		args = append(args, ts.UTC())
+	}
+
+	switch params.Get("status") {
+	case "":
+	case "open":
+		conditions = append(conditions, "t.stop_ts IS NULL")
+	case "closed":
+		conditions = append(conditions, "t.stop_ts IS NOT NULL")
+	default:
+		http.Error(w, "status must be open or closed", http.StatusBadRequest)
+		return
+	}
+
+	if minEnergyStr := params.Get("min_energy_wh"); minEnergyStr != "" {
+		minEnergy, err := strconv.ParseInt(minEnergyStr, 10, 64)
+		if err != nil || minEnergy < 0 {
+			http.Error(w, "min_energy_wh must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "t.energy_wh >= ?")
+		args = append(args, minEnergy)
+	}
+
+	sortParam := params.Get("sort")
+	if sortParam == "" {
+		sortParam = "start_ts"
+	}
+	sortExpr, ok := transactionSorts[sortParam]
+	if !ok {
+		http.Error(w, "sort must be start_ts or energy_wh", http.StatusBadRequest)
+		return
+	}
+
+	order := strings.ToLower(params.Get("order"))
+	if order == "" {
+		order = "desc"
+	}
+	if order != "desc" && order != "asc" {
+		http.Error(w, "order must be desc or asc", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultTransactionsLimit
+	if limitStr := params.Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxTransactionsLimit {
+			http.Error(w, fmt.Sprintf("limit must be 1-%d", maxTransactionsLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Keyset pagination: continue after the sort key and row ID of the previous page's last row
+	if cursorStr := params.Get("cursor"); cursorStr != "" {
+		cursor, cursorValue, err := decodeTransactionsCursor(cursorStr, sortParam)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		op := "<"
+		if order == "asc" {
+			op = ">"
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s %s ? OR (%s = ? AND t.id %s ?))", sortExpr, op, sortExpr, op))
+		args = append(args, cursorValue, cursorValue, cursor.ID)
+	}
+
+	query := transactionSelect
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// Fetch one extra row to know whether there is a next page
+	query += fmt.Sprintf(" ORDER BY %s %s, t.id %s LIMIT %d", sortExpr, order, order, limit+1)
+
+	rows, err := api.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		api.logger.Error("Failed to query transactions", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	page := TransactionsPage{Transactions: []Transaction{}}
+	now := time.Now()
+	for rows.Next() {
+		transaction, err := scanTransaction(rows, now)
+		if err != nil {
+			api.logger.Error("Failed to scan transaction", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		page.Transactions = append(page.Transactions, *transaction)
+	}
+
+	if err = rows.Err(); err != nil {
+		api.logger.Error("Row iteration error", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if len(page.Transactions) > limit {
+		page.Transactions = page.Transactions[:limit]
+		next := encodeTransactionsCursor(page.Transactions[limit-1], sortParam)
+		page.NextCursor = &next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// GetTransaction handles GET /api/transactions/{id}
+// It returns the session with every meter value recorded during it
+func (api *TransactionsAPI) GetTransaction(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	row := api.db.QueryRowContext(r.Context(), transactionSelect+" WHERE t.id = ?", id)
+	transaction, err := scanTransaction(row, time.Now())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+		api.logger.Error("Failed to fetch transaction", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	meterValues, err := api.getTransactionMeterValues(r.Context(), transaction)
+	if err != nil {
+		api.logger.Error("Failed to query transaction meter values", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TransactionDetail{
+		Transaction: *transaction,
+		MeterValues: meterValues,
+	})
+}
+
+// PriceTransaction handles POST /api/transactions/{id}/cost
+// It recalculates the cost of a completed session with the tariff that applies now, e.g. after correcting a tariff
+func (api *TransactionsAPI) PriceTransaction(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	cost, err := api.ocppServer.PriceTransaction(r.Context(), id)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+		case ocpp.ErrTransactionOpen, ocpp.ErrNoTariff:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			api.logger.Error("Failed to price transaction", zap.Int64("transaction_id", id), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cost)
+}
+
+// getTransactionMeterValues fetches the meter value timeline of a transaction, oldest first
+func (api *TransactionsAPI) getTransactionMeterValues(ctx context.Context, transaction *Transaction) ([]MeterValue, error) {
+	query := `
+		SELECT connector_id, ts, measurand, phase, unit, context, location, format, value, raw_value
+		FROM meter_values
+		WHERE transaction_id = ?
+		ORDER BY ts ASC, id ASC
+		LIMIT ?
+	`
+
+	rows, err := api.db.QueryContext(ctx, query, transaction.ID, maxMeterValues)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []MeterValue{}
+	for rows.Next() {
+		value := MeterValue{TransactionId: &transaction.TransactionId}
+		if err := rows.Scan(
+			&value.ConnectorId,
+			&value.Timestamp,
+			&value.Measurand,
+			&value.Phase,
+			&value.Unit,
+			&value.Context,
+			&value.Location,
+			&value.Format,
+			&value.Value,
+			&value.RawValue,
+		); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+// scanTransaction reads a transactionSelect row and fills in the aggregate fields
+func scanTransaction(row interface{ Scan(...interface{}) error }, now time.Time) (*Transaction, error) {
+	var transaction Transaction
+	var lastRegisterWh, peakW *float64
+	var breakdown *string
+	err := row.Scan(
+		&transaction.ID,
+		&transaction.TransactionId,
+		&transaction.StationID,
+		&transaction.StationIdentity,
+		&transaction.StationName,
+		&transaction.ConnectorId,
+		&transaction.IdTag,
+		&transaction.ReservationId,
+		&transaction.StartTs,
+		&transaction.StopTs,
+		&transaction.StartMeterWh,
+		&transaction.StopMeterWh,
+		&transaction.EnergyWh,
+		&lastRegisterWh,
+		&peakW,
+		&breakdown,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if breakdown != nil {
+		transaction.Cost = &ocpp.TransactionCost{}
+		if err := json.Unmarshal([]byte(*breakdown), transaction.Cost); err != nil {
+			return nil, fmt.Errorf("invalid cost breakdown: %w", err)
+		}
+	}
+
+	end := now
+	transaction.Status = "open"
+	if transaction.StopTs != nil {
+		end = *transaction.StopTs
+		transaction.Status = "closed"
+	}
+
+	transaction.DurationSeconds = int64(end.Sub(transaction.StartTs).Seconds())
+	if transaction.DurationSeconds < 0 {
+		transaction.DurationSeconds = 0
+	}
+
+	// While charging, the energy so far comes from the latest meter register reading
+	if transaction.EnergyWh == nil && lastRegisterWh != nil && int64(*lastRegisterWh) >= transaction.StartMeterWh {
+		energyWh := int64(*lastRegisterWh) - transaction.StartMeterWh
+		transaction.EnergyWh = &energyWh
+	}
+
+	if transaction.EnergyWh != nil {
+		kwh := float64(*transaction.EnergyWh) / 1000.0
+		transaction.EnergyKwh = &kwh
+
+		if transaction.DurationSeconds > 0 {
+			averageKW := kwh / (float64(transaction.DurationSeconds) / 3600.0)
+			transaction.AverageKW = &averageKW
+		}
+	}
+
+	if peakW != nil {
+		peakKW := *peakW / 1000.0
+		transaction.PeakKW = &peakKW
+	}
+
+	return &transaction, nil
+}
+
+// encodeTransactionsCursor builds the cursor that continues after a transaction
+func encodeTransactionsCursor(transaction Transaction, sortParam string) string {
+	cursor := transactionsCursor{ID: transaction.ID}
+	switch sortParam {
+	case "energy_wh":
+		var energyWh int64
+		// Open transactions sort as 0 Wh, matching COALESCE(t.energy_wh, 0)
+		if transaction.Status == "closed" && transaction.EnergyWh != nil {
+			energyWh = *transaction.EnergyWh
+		}
+		cursor.Value = strconv.FormatInt(energyWh, 10)
+	default:
+		cursor.Value = transaction.StartTs.Format(time.RFC3339Nano)
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeTransactionsCursor parses a cursor and returns the sort key as a query argument
+func decodeTransactionsCursor(cursorStr, sortParam string) (*transactionsCursor, interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursorStr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cursor transactionsCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, nil, err
+	}
+
+	switch sortParam {
+	case "energy_wh":
+		energyWh, err := strconv.ParseInt(cursor.Value, 10, 64)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &cursor, energyWh, nil
+	default:
+		startTs, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &cursor, startTs, nil
+	}
+}
@@ -0,0 +1,75 @@
+package ocpp
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"go.uber.org/zap"
+)
+
+// concurrentTxWindow is how recently a session must have started to block its card elsewhere
+// Older open sessions most likely lost their StopTransaction and must not lock the card out
+const concurrentTxWindow = 24 * time.Hour
+
+// tagLocation is the charger and connector a card is presented at
+// ConnectorId is 0 when the charger does not say (Authorize), which covers the whole charger
+type tagLocation struct {
+	ChargePointId string
+	ConnectorId   int
+}
+
+// authorizeIdTag looks up an idTag in id_tags and returns the idTagInfo to send to the charger
+// Unknown tags are Invalid and tags past their expiry date are Expired. With a location, a tag
+// that started a session within concurrentTxWindow on another charger or connector is ConcurrentTx
+func (s *Server) authorizeIdTag(ctx context.Context, idTag string, location *tagLocation) *types.IdTagInfo {
+	var status string
+	var expiryDate sql.NullTime
+	var parentIdTag sql.NullString
+
+	query := `SELECT status, expiry_date, parent_id_tag FROM id_tags WHERE tag = ?`
+	err := s.db.QueryRowContext(ctx, query, idTag).Scan(&status, &expiryDate, &parentIdTag)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			s.logger.Error("Failed to look up idTag", zap.String("id_tag", idTag), zap.Error(err))
+		}
+		return &types.IdTagInfo{Status: types.AuthorizationStatusInvalid}
+	}
+
+	info := &types.IdTagInfo{
+		Status:      types.AuthorizationStatus(status),
+		ParentIdTag: parentIdTag.String,
+	}
+	if expiryDate.Valid {
+		info.ExpiryDate = types.NewDateTime(expiryDate.Time)
+		if info.Status == types.AuthorizationStatusAccepted && expiryDate.Time.Before(time.Now()) {
+			info.Status = types.AuthorizationStatusExpired
+		}
+	}
+
+	if location != nil && info.Status == types.AuthorizationStatusAccepted {
+		// A session on the same connector (or the same charger, for Authorize) is the card's own
+		query := `
+			SELECT COUNT(*) FROM transactions t
+			JOIN chargers c ON c.id = t.charger_id
+			WHERE t.id_tag = ? AND t.stop_ts IS NULL AND t.start_ts >= ?
+				AND (c.identity <> ? OR (? <> 0 AND COALESCE(t.connector_id, 1) <> ?))
+		`
+		var openTransactions int
+		err := s.db.QueryRowContext(ctx, query,
+			idTag,
+			time.Now().UTC().Add(-concurrentTxWindow),
+			location.ChargePointId,
+			location.ConnectorId,
+			location.ConnectorId,
+		).Scan(&openTransactions)
+		if err != nil {
+			s.logger.Error("Failed to check open transactions for idTag", zap.String("id_tag", idTag), zap.Error(err))
+		} else if openTransactions > 0 {
+			info.Status = types.AuthorizationStatusConcurrentTx
+		}
+	}
+
+	return info
+}
@@ -0,0 +1,236 @@
+package ocpp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"go.uber.org/zap"
+)
+
+// DefaultCallTimeout is how long we wait for a charger to answer a CALL
+const DefaultCallTimeout = 30 * time.Second
+
+var (
+	// ErrNotConnected is returned when the charger has no open WebSocket
+	ErrNotConnected = errors.New("charge point is not connected")
+	// ErrConnectionClosed is returned when the WebSocket closes before the charger replies
+	ErrConnectionClosed = errors.New("connection closed before charge point replied")
+	// ErrCallTimeout is returned when the charger does not reply in time
+	ErrCallTimeout = errors.New("charge point did not reply in time")
+	// ErrUnsupportedAction is returned for actions that are not part of a registered profile
+	ErrUnsupportedAction = errors.New("unsupported OCPP action")
+	// ErrUnsupportedProtocol is returned when the charger is connected with an OCPP version the command does not exist in
+	ErrUnsupportedProtocol = errors.New("command is not available over the charger's OCPP version")
+)
+
+// CallError is returned by Call when the charger answers with a CALLERROR
+type CallError struct {
+	MessageId        string
+	Action           string
+	ErrorCode        string
+	ErrorDescription string
+	ErrorDetails     json.RawMessage
+}
+
+func (e *CallError) Error() string {
+	if e.ErrorDescription == "" {
+		return fmt.Sprintf("%s rejected with %s", e.Action, e.ErrorCode)
+	}
+	return fmt.Sprintf("%s rejected with %s: %s", e.Action, e.ErrorCode, e.ErrorDescription)
+}
+
+// pendingCall is a CALL we sent to a charger and are waiting on
+type pendingCall struct {
+	action string
+	reply  chan callReply
+}
+
+// callReply carries either the CALLRESULT payload or the CALLERROR back to Call
+type callReply struct {
+	payload json.RawMessage
+	err     error
+}
+
+// Call sends a CALL to the charger and blocks until the matching CALLRESULT or CALLERROR arrives
+// The returned response is the confirmation type registered for the action (e.g. *core.ResetConfirmation)
+// Only one CALL is outstanding per connection at a time; concurrent callers wait for their turn
+func (s *Server) Call(ctx context.Context, chargePointId, action string, payload interface{}) (ocpp.Response, error) {
+	feature := s.findFeature(action)
+	if feature == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAction, action)
+	}
+
+	conn := s.getConnection(chargePointId)
+	if conn == nil {
+		return nil, ErrNotConnected
+	}
+
+	// The registered profiles are OCPP 1.6 messages
+	if conn.protocol != ProtocolOCPP16 {
+		return nil, fmt.Errorf("%w: %s over %s", ErrUnsupportedProtocol, action, conn.protocol)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.callTimeout)
+	defer cancel()
+
+	// Wait until no other CALL is outstanding on this connection
+	select {
+	case conn.callSlot <- struct{}{}:
+	case <-conn.closed:
+		return nil, ErrConnectionClosed
+	case <-ctx.Done():
+		return nil, callContextError(ctx)
+	}
+	defer func() { <-conn.callSlot }()
+
+	if payload == nil {
+		payload = struct{}{}
+	}
+
+	// Refuse to send a request the charger would reject as malformed
+	if err := checkOutgoingPayload(action, payload); err != nil {
+		return nil, err
+	}
+
+	messageId, err := newMessageId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate message ID: %w", err)
+	}
+
+	// OCPP CALL format: [2, messageId, action, payload]
+	message, err := json.Marshal([]interface{}{2, messageId, action, payload})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s request: %w", action, err)
+	}
+
+	call := conn.addPending(messageId, action)
+	defer conn.removePending(messageId)
+
+	s.logger.Info("Sending request to charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("action", action),
+		zap.String("message_id", messageId))
+
+	if err := s.writeFrame(conn, message); err != nil {
+		return nil, fmt.Errorf("failed to send %s request: %w", action, err)
+	}
+
+	select {
+	case reply := <-call.reply:
+		if reply.err != nil {
+			var callErr *CallError
+			if errors.As(reply.err, &callErr) {
+				callErr.Action = action
+			}
+			return nil, reply.err
+		}
+		payload, err := s.checkConfirmation(chargePointId, action, conn.validationMode(), reply.payload)
+		if err != nil {
+			return nil, err
+		}
+		return decodeConfirmation(feature, payload)
+	case <-conn.closed:
+		return nil, ErrConnectionClosed
+	case <-ctx.Done():
+		return nil, callContextError(ctx)
+	}
+}
+
+// handleCallResult matches a CALLRESULT from the charger with the CALL waiting on it
+func (s *Server) handleCallResult(chargePointId, messageId string, payload json.RawMessage) {
+	conn := s.getConnection(chargePointId)
+	if conn == nil || !conn.resolve(messageId, payload, nil) {
+		s.logger.Warn("Received response for unknown request",
+			zap.String("charge_point_id", chargePointId),
+			zap.String("message_id", messageId))
+	}
+}
+
+// handleCallError matches a CALLERROR from the charger with the CALL waiting on it
+func (s *Server) handleCallError(chargePointId, messageId, errorCode, errorDescription string, errorDetails json.RawMessage) {
+	callErr := &CallError{
+		MessageId:        messageId,
+		ErrorCode:        errorCode,
+		ErrorDescription: errorDescription,
+		ErrorDetails:     errorDetails,
+	}
+
+	conn := s.getConnection(chargePointId)
+	if conn == nil || !conn.resolve(messageId, nil, callErr) {
+		s.logger.Warn("Received error for unknown request",
+			zap.String("charge_point_id", chargePointId),
+			zap.String("message_id", messageId),
+			zap.String("error_code", errorCode))
+	}
+}
+
+// checkConfirmation validates a CALLRESULT payload against the response schema of the action
+// In lenient mode the payload comes back with tolerated values coerced to the schema types
+func (s *Server) checkConfirmation(chargePointId, action, mode string, payload json.RawMessage) (json.RawMessage, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode %s response: %w", action, err)
+	}
+
+	decoded, violations, err := validatePayload(action+"Response", decoded, mode)
+	if err != nil {
+		return nil, err
+	}
+	if len(violations) == 0 {
+		return payload, nil
+	}
+
+	s.logger.Warn("Accepted response with schema violations (lenient mode)",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("action", action),
+		zap.Strings("violations", violationStrings(violations)))
+	return json.Marshal(decoded)
+}
+
+// findFeature looks up the feature for an action in the profiles we support
+func (s *Server) findFeature(action string) ocpp.Feature {
+	for _, profile := range s.profiles {
+		if feature := profile.GetFeature(action); feature != nil {
+			return feature
+		}
+	}
+	return nil
+}
+
+// decodeConfirmation unmarshals a CALLRESULT payload into the feature's confirmation type
+func decodeConfirmation(feature ocpp.Feature, payload json.RawMessage) (ocpp.Response, error) {
+	confirmation := reflect.New(feature.GetResponseType()).Interface()
+	if err := json.Unmarshal(payload, confirmation); err != nil {
+		return nil, fmt.Errorf("failed to decode %s response: %w", feature.GetFeatureName(), err)
+	}
+
+	response, ok := confirmation.(ocpp.Response)
+	if !ok {
+		return nil, fmt.Errorf("%s response type does not implement ocpp.Response", feature.GetFeatureName())
+	}
+	return response, nil
+}
+
+// callContextError turns a finished context into the error Call reports
+func callContextError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrCallTimeout
+	}
+	return ctx.Err()
+}
+
+// newMessageId generates a unique ID for an outgoing CALL
+func newMessageId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,65 @@
+package ocpp
+
+import (
+	"context"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"go.uber.org/zap"
+)
+
+// SetChargingProfile installs a charging profile on a connector (0 for the whole charger)
+// A profile with the same ID, or the same stack level and purpose, replaces the one the charger had
+func (s *Server) SetChargingProfile(ctx context.Context, chargePointId string, connectorId int, profile *types.ChargingProfile) (*SetChargingProfileConfirmation, error) {
+	request := &SetChargingProfileRequest{
+		ConnectorId:     connectorId,
+		ChargingProfile: profile,
+	}
+
+	response, err := s.callCommand(ctx, chargePointId, SetChargingProfileFeatureName, request)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation := response.(*SetChargingProfileConfirmation)
+	s.logger.Info("SetChargingProfile answered by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.Int("connector_id", connectorId),
+		zap.Int("charging_profile_id", profile.ChargingProfileId),
+		zap.String("purpose", string(profile.ChargingProfilePurpose)),
+		zap.String("status", string(confirmation.Status)))
+
+	return confirmation, nil
+}
+
+// ClearChargingProfile removes the charging profiles matching the request from the charger
+func (s *Server) ClearChargingProfile(ctx context.Context, chargePointId string, request *ClearChargingProfileRequest) (*ClearChargingProfileConfirmation, error) {
+	response, err := s.callCommand(ctx, chargePointId, ClearChargingProfileFeatureName, request)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation := response.(*ClearChargingProfileConfirmation)
+	s.logger.Info("ClearChargingProfile answered by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("status", string(confirmation.Status)))
+
+	return confirmation, nil
+}
+
+// GetCompositeSchedule asks the charger which limits it will apply on a connector over the next seconds
+// The answer combines every installed profile, so it shows what the charger will actually do
+func (s *Server) GetCompositeSchedule(ctx context.Context, chargePointId string, request *GetCompositeScheduleRequest) (*GetCompositeScheduleConfirmation, error) {
+	response, err := s.callCommand(ctx, chargePointId, GetCompositeScheduleFeatureName, request)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation := response.(*GetCompositeScheduleConfirmation)
+	s.logger.Info("GetCompositeSchedule answered by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.Int("connector_id", request.ConnectorId),
+		zap.Int("duration", request.Duration),
+		zap.String("status", string(confirmation.Status)))
+
+	return confirmation, nil
+}
@@ -0,0 +1,241 @@
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"go.uber.org/zap"
+)
+
+// RemoteStartTransaction asks the charging station to start a transaction for an idTag
+func (s *Server) RemoteStartTransaction(ctx context.Context, chargePointId string, request *core.RemoteStartTransactionRequest) (*core.RemoteStartTransactionConfirmation, error) {
+	response, err := s.callCommand(ctx, chargePointId, core.RemoteStartTransactionFeatureName, request)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation := response.(*core.RemoteStartTransactionConfirmation)
+	s.logger.Info("RemoteStartTransaction answered by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("id_tag", request.IdTag),
+		zap.String("status", string(confirmation.Status)))
+
+	return confirmation, nil
+}
+
+// RemoteStopTransaction asks the charging station to stop a running transaction
+func (s *Server) RemoteStopTransaction(ctx context.Context, chargePointId string, request *core.RemoteStopTransactionRequest) (*core.RemoteStopTransactionConfirmation, error) {
+	response, err := s.callCommand(ctx, chargePointId, core.RemoteStopTransactionFeatureName, request)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation := response.(*core.RemoteStopTransactionConfirmation)
+	s.logger.Info("RemoteStopTransaction answered by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.Int("tx_id", request.TransactionId),
+		zap.String("status", string(confirmation.Status)))
+
+	return confirmation, nil
+}
+
+// Reset asks the charging station to perform a soft or hard reset
+func (s *Server) Reset(ctx context.Context, chargePointId string, resetType core.ResetType) (*core.ResetConfirmation, error) {
+	response, err := s.callCommand(ctx, chargePointId, core.ResetFeatureName, core.NewResetRequest(resetType))
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation := response.(*core.ResetConfirmation)
+	s.logger.Info("Reset answered by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("type", string(resetType)),
+		zap.String("status", string(confirmation.Status)))
+
+	return confirmation, nil
+}
+
+// UnlockConnector asks the charging station to release the cable on a connector
+func (s *Server) UnlockConnector(ctx context.Context, chargePointId string, connectorId int) (*core.UnlockConnectorConfirmation, error) {
+	response, err := s.callCommand(ctx, chargePointId, core.UnlockConnectorFeatureName, core.NewUnlockConnectorRequest(connectorId))
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation := response.(*core.UnlockConnectorConfirmation)
+	s.logger.Info("UnlockConnector answered by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.Int("connector_id", connectorId),
+		zap.String("status", string(confirmation.Status)))
+
+	return confirmation, nil
+}
+
+// ChangeAvailability sets a connector (or the whole charger for connector 0) Operative or Inoperative
+// A Scheduled answer means the charger is busy; the change is stored and re-sent after the transaction ends
+func (s *Server) ChangeAvailability(ctx context.Context, chargePointId string, connectorId int, availabilityType core.AvailabilityType) (*core.ChangeAvailabilityConfirmation, error) {
+	response, err := s.callCommand(ctx, chargePointId, core.ChangeAvailabilityFeatureName, core.NewChangeAvailabilityRequest(connectorId, availabilityType))
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation := response.(*core.ChangeAvailabilityConfirmation)
+	s.settleAvailability(ctx, chargePointId, connectorId, availabilityType, confirmation)
+	return confirmation, nil
+}
+
+// settleAvailability logs the charger's answer to a ChangeAvailability and keeps or forgets the scheduled change
+func (s *Server) settleAvailability(ctx context.Context, chargePointId string, connectorId int, availabilityType core.AvailabilityType, confirmation *core.ChangeAvailabilityConfirmation) {
+	s.logger.Info("ChangeAvailability answered by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.Int("connector_id", connectorId),
+		zap.String("type", string(availabilityType)),
+		zap.String("status", string(confirmation.Status)))
+
+	if err := s.storeScheduledAvailability(ctx, chargePointId, connectorId, availabilityType, confirmation.Status); err != nil {
+		s.logger.Error("Failed to store scheduled availability change",
+			zap.String("charge_point_id", chargePointId),
+			zap.Int("connector_id", connectorId),
+			zap.Error(err))
+	}
+}
+
+// storeScheduledAvailability remembers a Scheduled availability change and forgets it once it is settled
+func (s *Server) storeScheduledAvailability(ctx context.Context, chargePointId string, connectorId int, availabilityType core.AvailabilityType, status core.AvailabilityStatus) error {
+	chargerID, err := s.getChargerID(ctx, chargePointId)
+	if err != nil {
+		return err
+	}
+
+	if status == core.AvailabilityStatusScheduled {
+		query := `
+			INSERT INTO scheduled_availability (charger_id, connector_id, type, created_at)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT(charger_id, connector_id) DO UPDATE SET
+				type = excluded.type,
+				created_at = excluded.created_at
+		`
+		_, err = s.db.ExecContext(ctx, query, chargerID, connectorId, string(availabilityType), time.Now())
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `DELETE FROM scheduled_availability WHERE charger_id = ? AND connector_id = ?`, chargerID, connectorId)
+	return err
+}
+
+// reapplyScheduledAvailability re-sends availability changes the charger scheduled while a transaction was running
+// These are sent with Call rather than callCommand, so command_history only lists what operators sent
+func (s *Server) reapplyScheduledAvailability(chargePointId string) {
+	ctx := context.Background()
+
+	chargerID, err := s.getChargerID(ctx, chargePointId)
+	if err != nil {
+		s.logger.Error("Failed to look up charger for scheduled availability", zap.Error(err))
+		return
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT connector_id, type FROM scheduled_availability WHERE charger_id = ?`, chargerID)
+	if err != nil {
+		s.logger.Error("Failed to query scheduled availability", zap.Error(err))
+		return
+	}
+
+	type scheduledChange struct {
+		connectorId      int
+		availabilityType core.AvailabilityType
+	}
+	var changes []scheduledChange
+	for rows.Next() {
+		var change scheduledChange
+		if err := rows.Scan(&change.connectorId, &change.availabilityType); err != nil {
+			s.logger.Error("Failed to scan scheduled availability", zap.Error(err))
+			continue
+		}
+		changes = append(changes, change)
+	}
+	rows.Close()
+
+	for _, change := range changes {
+		s.logger.Info("Re-applying scheduled availability change",
+			zap.String("charge_point_id", chargePointId),
+			zap.Int("connector_id", change.connectorId),
+			zap.String("type", string(change.availabilityType)))
+
+		response, err := s.Call(ctx, chargePointId, core.ChangeAvailabilityFeatureName, core.NewChangeAvailabilityRequest(change.connectorId, change.availabilityType))
+		if err != nil {
+			s.logger.Error("Failed to re-apply scheduled availability change",
+				zap.String("charge_point_id", chargePointId),
+				zap.Int("connector_id", change.connectorId),
+				zap.Error(err))
+			continue
+		}
+		s.settleAvailability(ctx, chargePointId, change.connectorId, change.availabilityType, response.(*core.ChangeAvailabilityConfirmation))
+	}
+}
+
+// callCommand sends an operator command to the charger and records it in command_history
+func (s *Server) callCommand(ctx context.Context, chargePointId, action string, request interface{}) (ocpp.Response, error) {
+	startedAt := time.Now()
+	response, err := s.Call(ctx, chargePointId, action, request)
+	s.recordCommand(chargePointId, action, request, response, err, startedAt)
+	return response, err
+}
+
+// recordCommand stores a command and the charger's answer in command_history
+func (s *Server) recordCommand(chargePointId, action string, request interface{}, response ocpp.Response, callErr error, startedAt time.Time) {
+	// Use a fresh context so the history is kept even if the HTTP caller went away
+	ctx := context.Background()
+
+	chargerID, err := s.getChargerID(ctx, chargePointId)
+	if err != nil {
+		s.logger.Error("Failed to record command", zap.String("action", action), zap.Error(err))
+		return
+	}
+
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		s.logger.Error("Failed to marshal command request", zap.String("action", action), zap.Error(err))
+		return
+	}
+
+	var status, errorText *string
+	if callErr != nil {
+		msg := callErr.Error()
+		errorText = &msg
+	} else if response != nil {
+		// Every command confirmation carries a status field
+		var result struct {
+			Status string `json:"status"`
+		}
+		if raw, err := json.Marshal(response); err == nil && json.Unmarshal(raw, &result) == nil && result.Status != "" {
+			status = &result.Status
+		}
+	}
+
+	s.events.Publish(EventCommandResult, chargePointId, map[string]interface{}{
+		"action": action,
+		"status": status,
+		"error":  errorText,
+	})
+
+	query := `
+		INSERT INTO command_history (charger_id, action, request, status, error, created_at, completed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = s.db.ExecContext(ctx, query,
+		chargerID,
+		action,
+		string(requestJSON),
+		status,
+		errorText,
+		startedAt,
+		time.Now(),
+	)
+	if err != nil {
+		s.logger.Error("Failed to record command", zap.String("action", action), zap.Error(err))
+	}
+}
@@ -0,0 +1,167 @@
+package ocpp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"go.uber.org/zap"
+)
+
+// GetConfiguration reads configuration keys from the charging station and caches them
+// An empty keys list asks for every key and replaces the whole cached set
+func (s *Server) GetConfiguration(ctx context.Context, chargePointId string, keys []string) (*core.GetConfigurationConfirmation, error) {
+	response, err := s.callCommand(ctx, chargePointId, core.GetConfigurationFeatureName, &core.GetConfigurationRequest{Key: keys})
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation := response.(*core.GetConfigurationConfirmation)
+	s.logger.Info("GetConfiguration answered by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.Int("keys", len(confirmation.ConfigurationKey)),
+		zap.Int("unknown_keys", len(confirmation.UnknownKey)))
+
+	if err := s.cacheConfiguration(ctx, chargePointId, confirmation, len(keys) == 0); err != nil {
+		s.logger.Error("Failed to cache charger configuration",
+			zap.String("charge_point_id", chargePointId),
+			zap.Error(err))
+	}
+
+	return confirmation, nil
+}
+
+// ChangeConfiguration sets a configuration key on the charging station and records the outcome
+func (s *Server) ChangeConfiguration(ctx context.Context, chargePointId, key, value string) (*core.ChangeConfigurationConfirmation, error) {
+	response, err := s.callCommand(ctx, chargePointId, core.ChangeConfigurationFeatureName, &core.ChangeConfigurationRequest{
+		Key:   key,
+		Value: value,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation := response.(*core.ChangeConfigurationConfirmation)
+	s.logger.Info("ChangeConfiguration answered by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("key", key),
+		zap.String("status", string(confirmation.Status)))
+
+	if err := s.recordConfigurationChange(ctx, chargePointId, key, value, confirmation.Status); err != nil {
+		s.logger.Error("Failed to record configuration change",
+			zap.String("charge_point_id", chargePointId),
+			zap.String("key", key),
+			zap.Error(err))
+	}
+
+	return confirmation, nil
+}
+
+// cacheConfiguration stores the keys reported by GetConfiguration in charger_configuration
+func (s *Server) cacheConfiguration(ctx context.Context, chargePointId string, confirmation *core.GetConfigurationConfirmation, fullSet bool) error {
+	chargerID, err := s.getChargerID(ctx, chargePointId)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	// Upserting keeps the last_change_status of keys we have changed
+	query := `
+		INSERT INTO charger_configuration (charger_id, key, value, readonly, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(charger_id, key) DO UPDATE SET
+			value = excluded.value,
+			readonly = excluded.readonly,
+			updated_at = excluded.updated_at
+	`
+
+	for _, key := range confirmation.ConfigurationKey {
+		if _, err := tx.ExecContext(ctx, query, chargerID, key.Key, key.Value, key.Readonly, now); err != nil {
+			return fmt.Errorf("failed to cache configuration key %s: %w", key.Key, err)
+		}
+	}
+
+	// A full read is the charger's complete key set, so forget keys it no longer reports
+	// Keys with a recorded change are kept for their change status, without a stale value
+	if fullSet {
+		reported := make([]string, 0, len(confirmation.ConfigurationKey))
+		args := []interface{}{chargerID}
+		for _, key := range confirmation.ConfigurationKey {
+			reported = append(reported, "?")
+			args = append(args, key.Key)
+		}
+		notReported := ""
+		if len(reported) > 0 {
+			notReported = " AND key NOT IN (" + strings.Join(reported, ", ") + ")"
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM charger_configuration WHERE charger_id = ? AND last_change_status IS NULL`+notReported, args...); err != nil {
+			return fmt.Errorf("failed to clear keys the charger no longer reports: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE charger_configuration SET value = NULL WHERE charger_id = ?`+notReported, args...); err != nil {
+			return fmt.Errorf("failed to clear values the charger no longer reports: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// recordConfigurationChange stores the result of a ChangeConfiguration in charger_configuration
+// The cached value is only updated when the charger accepted the new value
+func (s *Server) recordConfigurationChange(ctx context.Context, chargePointId, key, value string, status core.ConfigurationStatus) error {
+	chargerID, err := s.getChargerID(ctx, chargePointId)
+	if err != nil {
+		return err
+	}
+
+	accepted := status == core.ConfigurationStatusAccepted || status == core.ConfigurationStatusRebootRequired
+	now := time.Now()
+
+	var query string
+	var args []interface{}
+	if accepted {
+		query = `
+			INSERT INTO charger_configuration (charger_id, key, value, last_change_status, last_change_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(charger_id, key) DO UPDATE SET
+				value = excluded.value,
+				last_change_status = excluded.last_change_status,
+				last_change_at = excluded.last_change_at,
+				updated_at = excluded.updated_at
+		`
+		args = []interface{}{chargerID, key, value, string(status), now, now}
+	} else {
+		query = `
+			INSERT INTO charger_configuration (charger_id, key, last_change_status, last_change_at, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(charger_id, key) DO UPDATE SET
+				last_change_status = excluded.last_change_status,
+				last_change_at = excluded.last_change_at
+		`
+		args = []interface{}{chargerID, key, string(status), now, now}
+	}
+
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to record configuration change: %w", err)
+	}
+	return nil
+}
+
+// getChargerID looks up the database ID of a charger by its OCPP identity
+func (s *Server) getChargerID(ctx context.Context, chargePointId string) (int64, error) {
+	var chargerID int64
+	err := s.db.QueryRowContext(ctx, "SELECT id FROM chargers WHERE identity = ?", chargePointId).Scan(&chargerID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get charger ID: %w", err)
+	}
+	return chargerID, nil
+}
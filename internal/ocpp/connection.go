@@ -0,0 +1,113 @@
+package ocpp
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// chargePointConn wraps the WebSocket of a connected charging station
+// It serialises writes and keeps track of the CALLs we are waiting on
+type chargePointConn struct {
+	id       string
+	ws       *websocket.Conn
+	protocol string        // Negotiated OCPP version, ProtocolOCPP16 or ProtocolOCPP201
+	writeMu  sync.Mutex    // gorilla/websocket supports only one concurrent writer
+	callSlot chan struct{} // OCPP allows only one outstanding CALL per connection
+	closed   chan struct{} // Closed when the read loop exits
+	replaced bool          // Set (under Server.mu) when the charger opened a newer connection
+
+	mu            sync.Mutex
+	pending       map[string]*pendingCall // Outstanding CALLs keyed by message ID
+	afterResponse []func()                // Run once the response to the current request has been written
+	validation    string                  // Schema validation mode, strict or lenient
+}
+
+// newChargePointConn creates the connection state for a freshly upgraded WebSocket
+func newChargePointConn(id string, ws *websocket.Conn, protocol string) *chargePointConn {
+	return &chargePointConn{
+		id:       id,
+		ws:       ws,
+		protocol: protocol,
+		callSlot: make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+		pending:  make(map[string]*pendingCall),
+
+		validation: DefaultValidationMode,
+	}
+}
+
+// write sends a text frame to the charger
+func (c *chargePointConn) write(message []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.ws.WriteMessage(websocket.TextMessage, message)
+}
+
+// addPending registers a CALL so its reply can be matched by message ID
+func (c *chargePointConn) addPending(messageId, action string) *pendingCall {
+	call := &pendingCall{
+		action: action,
+		reply:  make(chan callReply, 1),
+	}
+
+	c.mu.Lock()
+	c.pending[messageId] = call
+	c.mu.Unlock()
+
+	return call
+}
+
+// removePending forgets a CALL once it has been answered or abandoned
+func (c *chargePointConn) removePending(messageId string) {
+	c.mu.Lock()
+	delete(c.pending, messageId)
+	c.mu.Unlock()
+}
+
+// resolve hands a CALLRESULT or CALLERROR to the caller waiting on messageId
+// It returns false if no CALL with that ID is outstanding (e.g. it already timed out)
+func (c *chargePointConn) resolve(messageId string, payload json.RawMessage, err error) bool {
+	c.mu.Lock()
+	call, ok := c.pending[messageId]
+	delete(c.pending, messageId)
+	c.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	call.reply <- callReply{payload: payload, err: err}
+	return true
+}
+
+// addAfterResponse queues fn to run after the response to the request being handled is sent
+func (c *chargePointConn) addAfterResponse(fn func()) {
+	c.mu.Lock()
+	c.afterResponse = append(c.afterResponse, fn)
+	c.mu.Unlock()
+}
+
+// takeAfterResponse returns the queued functions and clears the queue
+func (c *chargePointConn) takeAfterResponse() []func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fns := c.afterResponse
+	c.afterResponse = nil
+	return fns
+}
+
+// validationMode returns how strictly the charger's payloads are checked against the schemas
+func (c *chargePointConn) validationMode() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.validation
+}
+
+// setValidationMode changes the validation mode for the rest of the connection
+func (c *chargePointConn) setValidationMode(mode string) {
+	c.mu.Lock()
+	c.validation = mode
+	c.mu.Unlock()
+}
@@ -0,0 +1,118 @@
+package ocpp
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// connectorStatus is the content of a StatusNotification for one connector
+type connectorStatus struct {
+	ConnectorId     int        `json:"connector_id"`
+	Status          string     `json:"status"`
+	ErrorCode       string     `json:"error_code"`
+	Info            *string    `json:"info,omitempty"`
+	VendorId        *string    `json:"vendor_id,omitempty"`
+	VendorErrorCode *string    `json:"vendor_error_code,omitempty"`
+	Timestamp       *time.Time `json:"timestamp,omitempty"` // When the charger says the status changed
+}
+
+// parseConnectorStatus reads a StatusNotification payload
+func parseConnectorStatus(payloadMap map[string]interface{}) connectorStatus {
+	status := connectorStatus{}
+
+	connectorId, _ := payloadMap["connectorId"].(float64)
+	status.ConnectorId = int(connectorId)
+	status.Status, _ = payloadMap["status"].(string)
+	status.ErrorCode, _ = payloadMap["errorCode"].(string)
+	if status.ErrorCode == "" {
+		status.ErrorCode = "NoError"
+	}
+
+	status.Info = optionalString(payloadMap, "info")
+	status.VendorId = optionalString(payloadMap, "vendorId")
+	status.VendorErrorCode = optionalString(payloadMap, "vendorErrorCode")
+
+	if timestampStr, ok := payloadMap["timestamp"].(string); ok {
+		if timestamp, err := time.Parse(time.RFC3339, timestampStr); err == nil {
+			status.Timestamp = &timestamp
+		}
+	}
+
+	return status
+}
+
+// recordConnectorStatus stores the latest connector status and appends it to the status history
+func (s *Server) recordConnectorStatus(ctx context.Context, chargePointId string, status connectorStatus) error {
+	chargerID, err := s.getChargerID(ctx, chargePointId)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	upsertQuery := `
+		INSERT INTO connectors (charger_id, connector_id, status, error_code, info, vendor_id, vendor_error_code, status_ts, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(charger_id, connector_id) DO UPDATE SET
+			status = excluded.status,
+			error_code = excluded.error_code,
+			info = excluded.info,
+			vendor_id = excluded.vendor_id,
+			vendor_error_code = excluded.vendor_error_code,
+			status_ts = excluded.status_ts,
+			updated_at = excluded.updated_at
+	`
+
+	_, err = tx.ExecContext(ctx, upsertQuery,
+		chargerID,
+		status.ConnectorId,
+		status.Status,
+		status.ErrorCode,
+		status.Info,
+		status.VendorId,
+		status.VendorErrorCode,
+		status.Timestamp,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update connector status: %w", err)
+	}
+
+	historyQuery := `
+		INSERT INTO connector_status_history (charger_id, connector_id, status, error_code, info, vendor_id, vendor_error_code, status_ts, received_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = tx.ExecContext(ctx, historyQuery,
+		chargerID,
+		status.ConnectorId,
+		status.Status,
+		status.ErrorCode,
+		status.Info,
+		status.VendorId,
+		status.VendorErrorCode,
+		status.Timestamp,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert connector status history: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// optionalString returns a pointer to a string field of a payload, or nil if it is missing or empty
+func optionalString(payloadMap map[string]interface{}, key string) *string {
+	value, ok := payloadMap[key].(string)
+	if !ok || value == "" {
+		return nil
+	}
+	return &value
+}
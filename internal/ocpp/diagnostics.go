@@ -0,0 +1,101 @@
+package ocpp
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// States of a diagnostics request besides the DiagnosticsStatus values the charger reports
+const (
+	DiagnosticsRequested = "requested" // The charger answered GetDiagnostics and has not reported progress yet
+	DiagnosticsFailed    = "failed"    // GetDiagnostics could not be delivered, or the charger had nothing to upload
+)
+
+// IsFinalDiagnosticsStatus reports whether a diagnostics request in this state has ended
+func IsFinalDiagnosticsStatus(status string) bool {
+	switch status {
+	case DiagnosticsFailed, string(DiagnosticsStatusUploaded), string(DiagnosticsStatusUploadFailed):
+		return true
+	}
+	return false
+}
+
+// GetDiagnostics asks the charging station to upload a diagnostics file to a location
+func (s *Server) GetDiagnostics(ctx context.Context, chargePointId string, request *GetDiagnosticsRequest) (*GetDiagnosticsConfirmation, error) {
+	response, err := s.callCommand(ctx, chargePointId, GetDiagnosticsFeatureName, request)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation := response.(*GetDiagnosticsConfirmation)
+	s.logger.Info("GetDiagnostics answered by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("location", request.Location),
+		zap.String("file_name", confirmation.FileName))
+
+	return confirmation, nil
+}
+
+// handleDiagnosticsStatusNotificationRequest records the progress of the charger's running diagnostics upload
+func (s *Server) handleDiagnosticsStatusNotificationRequest(chargePointId string, payload interface{}) interface{} {
+	payloadMap, _ := payload.(map[string]interface{})
+	status, _ := payloadMap["status"].(string)
+
+	s.logger.Info("Diagnostics status update received",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("status", status))
+
+	// Idle answers a TriggerMessage while no upload is running; there is nothing to record
+	if status == string(DiagnosticsStatusIdle) {
+		return map[string]interface{}{}
+	}
+
+	diagnosticsID, err := s.recordDiagnosticsStatus(context.Background(), chargePointId, status)
+	if err != nil {
+		s.logger.Error("Failed to record diagnostics status", zap.String("charge_point_id", chargePointId), zap.Error(err))
+	} else if diagnosticsID == 0 {
+		s.logger.Warn("Diagnostics status for an upload we did not request", zap.String("charge_point_id", chargePointId))
+	}
+
+	s.events.Publish(EventDiagnosticsStatus, chargePointId, map[string]interface{}{
+		"status":         status,
+		"diagnostics_id": diagnosticsID,
+	})
+
+	return map[string]interface{}{}
+}
+
+// recordDiagnosticsStatus moves the charger's open diagnostics request to a new status
+// It returns the request's ID, or 0 if the charger has no open request
+func (s *Server) recordDiagnosticsStatus(ctx context.Context, chargePointId, status string) (int64, error) {
+	// A charger runs one upload at a time, so the notification belongs to the newest open request
+	query := `
+		SELECT d.id FROM diagnostics d
+		JOIN chargers c ON c.id = d.charger_id
+		WHERE c.identity = ? AND d.completed_at IS NULL
+		ORDER BY d.id DESC
+		LIMIT 1
+	`
+	var diagnosticsID int64
+	err := s.db.QueryRowContext(ctx, query, chargePointId).Scan(&diagnosticsID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	var completedAt *time.Time
+	if IsFinalDiagnosticsStatus(status) {
+		completedAt = &now
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE diagnostics SET status = ?, updated_at = ?, completed_at = ? WHERE id = ?`,
+		status, now, completedAt, diagnosticsID)
+	return diagnosticsID, err
+}
@@ -0,0 +1,122 @@
+package ocpp
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType identifies what happened on a charger
+type EventType string
+
+const (
+	EventBoot              EventType = "boot"
+	EventStatusChange      EventType = "status_change"
+	EventMeterSample       EventType = "meter_sample"
+	EventTransactionStart  EventType = "transaction_start"
+	EventTransactionStop   EventType = "transaction_stop"
+	EventConnected         EventType = "connected"
+	EventDisconnected      EventType = "disconnected"
+	EventCommandResult     EventType = "command_result"
+	EventFirmwareStatus    EventType = "firmware_status"
+	EventDiagnosticsStatus EventType = "diagnostics_status"
+)
+
+// DefaultEventBufferSize is how many recent events are kept for Last-Event-ID replay
+const DefaultEventBufferSize = 1000
+
+// subscriberBufferSize is how many events a subscriber may fall behind before it is dropped
+const subscriberBufferSize = 64
+
+// Event is a single notification published on the event bus
+type Event struct {
+	ID            uint64      `json:"id"`
+	Type          EventType   `json:"type"`
+	ChargePointId string      `json:"charge_point_id"`
+	Timestamp     time.Time   `json:"timestamp"`
+	Data          interface{} `json:"data,omitempty"`
+}
+
+// EventBus fans out charger events to subscribers and keeps a bounded history for replay
+type EventBus struct {
+	mu          sync.Mutex
+	nextID      uint64
+	ring        []Event // Most recent events, oldest first
+	size        int
+	subscribers map[chan Event]struct{}
+}
+
+// NewEventBus creates an event bus that remembers the last size events
+func NewEventBus(size int) *EventBus {
+	return &EventBus{
+		nextID:      1,
+		size:        size,
+		ring:        make([]Event, 0, size),
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Publish sends an event to every subscriber
+// Subscribers that cannot keep up are disconnected; they can resume with Last-Event-ID
+func (b *EventBus) Publish(eventType EventType, chargePointId string, data interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event := Event{
+		ID:            b.nextID,
+		Type:          eventType,
+		ChargePointId: chargePointId,
+		Timestamp:     time.Now(),
+		Data:          data,
+	}
+	b.nextID++
+
+	if len(b.ring) == b.size {
+		copy(b.ring, b.ring[1:])
+		b.ring = b.ring[:b.size-1]
+	}
+	b.ring = append(b.ring, event)
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe registers a new subscriber
+// Events after lastEventID that are still buffered are returned for replay; pass 0 to skip replay
+// The returned channel is closed when the subscriber falls behind or cancel is called
+func (b *EventBus) Subscribe(lastEventID uint64) ([]Event, <-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var replay []Event
+	if lastEventID > 0 {
+		// An ID from the future means the server restarted, so everything buffered is new to the client
+		if lastEventID >= b.nextID {
+			lastEventID = 0
+		}
+		for _, event := range b.ring {
+			if event.ID > lastEventID {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	ch := make(chan Event, subscriberBufferSize)
+	b.subscribers[ch] = struct{}{}
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return replay, ch, cancel
+}
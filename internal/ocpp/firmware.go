@@ -0,0 +1,145 @@
+package ocpp
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// States of a firmware update besides the FirmwareStatus values the charger reports
+const (
+	FirmwareUpdateRequested = "requested" // The charger acknowledged UpdateFirmware and has not reported progress yet
+	FirmwareUpdateFailed    = "failed"    // UpdateFirmware could not be delivered or was not answered
+)
+
+// IsFinalFirmwareStatus reports whether a firmware update in this state has ended
+func IsFinalFirmwareStatus(status string) bool {
+	switch status {
+	case FirmwareUpdateFailed, string(FirmwareStatusInstalled), string(FirmwareStatusInstallationFailed), string(FirmwareStatusDownloadFailed):
+		return true
+	}
+	return false
+}
+
+// UpdateFirmware asks the charging station to download firmware from a location and install it
+func (s *Server) UpdateFirmware(ctx context.Context, chargePointId string, request *UpdateFirmwareRequest) (*UpdateFirmwareConfirmation, error) {
+	response, err := s.callCommand(ctx, chargePointId, UpdateFirmwareFeatureName, request)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("UpdateFirmware answered by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("location", request.Location))
+
+	return response.(*UpdateFirmwareConfirmation), nil
+}
+
+// handleFirmwareStatusNotificationRequest records the progress of the charger's running firmware update
+func (s *Server) handleFirmwareStatusNotificationRequest(chargePointId string, payload interface{}) interface{} {
+	payloadMap, _ := payload.(map[string]interface{})
+	status, _ := payloadMap["status"].(string)
+
+	s.logger.Info("Firmware status update received",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("status", status))
+
+	// Idle answers a TriggerMessage while no update is running; there is nothing to record
+	if status == string(FirmwareStatusIdle) {
+		return map[string]interface{}{}
+	}
+
+	updateID, err := s.recordFirmwareStatus(context.Background(), chargePointId, status)
+	if err != nil {
+		s.logger.Error("Failed to record firmware status", zap.String("charge_point_id", chargePointId), zap.Error(err))
+	} else if updateID == 0 {
+		s.logger.Warn("Firmware status for an update we did not request", zap.String("charge_point_id", chargePointId))
+	}
+
+	s.events.Publish(EventFirmwareStatus, chargePointId, map[string]interface{}{
+		"status":    status,
+		"update_id": updateID,
+	})
+
+	return map[string]interface{}{}
+}
+
+// recordFirmwareStatus moves the charger's open firmware update to a new status
+// It returns the update's ID, or 0 if the charger has no open update
+func (s *Server) recordFirmwareStatus(ctx context.Context, chargePointId, status string) (int64, error) {
+	// A charger runs one update at a time, so the notification belongs to the newest open one
+	query := `
+		SELECT u.id FROM firmware_updates u
+		JOIN chargers c ON c.id = u.charger_id
+		WHERE c.identity = ? AND u.completed_at IS NULL
+		ORDER BY u.id DESC
+		LIMIT 1
+	`
+	var updateID int64
+	err := s.db.QueryRowContext(ctx, query, chargePointId).Scan(&updateID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	var completedAt *time.Time
+	if IsFinalFirmwareStatus(status) {
+		completedAt = &now
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE firmware_updates SET status = ?, updated_at = ?, completed_at = ? WHERE id = ?`,
+		status, now, completedAt, updateID)
+	return updateID, err
+}
+
+// completeFirmwareUpdateOnBoot marks an open update installed when the charger boots with the new version
+// Some chargers reboot into the new firmware without sending Installed first
+func (s *Server) completeFirmwareUpdateOnBoot(ctx context.Context, chargePointId, firmwareVersion string) {
+	if firmwareVersion == "" {
+		return
+	}
+
+	query := `
+		SELECT u.id, u.status FROM firmware_updates u
+		JOIN chargers c ON c.id = u.charger_id
+		JOIN firmware_files f ON f.id = u.firmware_id
+		WHERE c.identity = ? AND u.completed_at IS NULL AND f.version = ?
+		ORDER BY u.id DESC
+		LIMIT 1
+	`
+	var updateID int64
+	var status string
+	err := s.db.QueryRowContext(ctx, query, chargePointId, firmwareVersion).Scan(&updateID, &status)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to look up firmware update", zap.String("charge_point_id", chargePointId), zap.Error(err))
+		return
+	}
+
+	now := time.Now().UTC()
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE firmware_updates SET status = ?, updated_at = ?, completed_at = ? WHERE id = ?`,
+		string(FirmwareStatusInstalled), now, now, updateID)
+	if err != nil {
+		s.logger.Error("Failed to complete firmware update", zap.String("charge_point_id", chargePointId), zap.Error(err))
+		return
+	}
+
+	s.logger.Info("Charger booted with the firmware it was updated to",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("firmware", firmwareVersion),
+		zap.String("previous_status", status))
+
+	s.events.Publish(EventFirmwareStatus, chargePointId, map[string]interface{}{
+		"status":    string(FirmwareStatusInstalled),
+		"update_id": updateID,
+	})
+}
@@ -0,0 +1,120 @@
+package ocpp
+
+import (
+	"reflect"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+)
+
+// -------------------- Update Firmware (CS -> CP) --------------------
+
+const UpdateFirmwareFeatureName = "UpdateFirmware"
+
+// UpdateFirmwareRequest is sent by the Central System to have the charger download and install new firmware
+// The charger reports its progress with FirmwareStatusNotification
+type UpdateFirmwareRequest struct {
+	Location      string          `json:"location"`                // URI the charger downloads the firmware from
+	Retries       *int            `json:"retries,omitempty"`       // How often to retry a failed download
+	RetrieveDate  *types.DateTime `json:"retrieveDate"`            // Not before this time
+	RetryInterval *int            `json:"retryInterval,omitempty"` // Seconds between retries
+}
+
+// UpdateFirmwareConfirmation is the charger's reply to an UpdateFirmwareRequest; it carries no fields
+type UpdateFirmwareConfirmation struct{}
+
+// UpdateFirmwareFeature describes the UpdateFirmware request/confirmation pair
+type UpdateFirmwareFeature struct{}
+
+func (f UpdateFirmwareFeature) GetFeatureName() string {
+	return UpdateFirmwareFeatureName
+}
+
+func (f UpdateFirmwareFeature) GetRequestType() reflect.Type {
+	return reflect.TypeOf(UpdateFirmwareRequest{})
+}
+
+func (f UpdateFirmwareFeature) GetResponseType() reflect.Type {
+	return reflect.TypeOf(UpdateFirmwareConfirmation{})
+}
+
+func (r UpdateFirmwareRequest) GetFeatureName() string {
+	return UpdateFirmwareFeatureName
+}
+
+func (c UpdateFirmwareConfirmation) GetFeatureName() string {
+	return UpdateFirmwareFeatureName
+}
+
+// -------------------- Firmware Status Notification (CP -> CS) --------------------
+
+// FirmwareStatus is the progress of a firmware update reported by the charger
+type FirmwareStatus string
+
+const (
+	FirmwareStatusDownloaded         FirmwareStatus = "Downloaded"
+	FirmwareStatusDownloadFailed     FirmwareStatus = "DownloadFailed"
+	FirmwareStatusDownloading        FirmwareStatus = "Downloading"
+	FirmwareStatusIdle               FirmwareStatus = "Idle" // Only sent when triggered while no update is running
+	FirmwareStatusInstallationFailed FirmwareStatus = "InstallationFailed"
+	FirmwareStatusInstalling         FirmwareStatus = "Installing"
+	FirmwareStatusInstalled          FirmwareStatus = "Installed"
+)
+
+// -------------------- Get Diagnostics (CS -> CP) --------------------
+
+const GetDiagnosticsFeatureName = "GetDiagnostics"
+
+// GetDiagnosticsRequest is sent by the Central System to have the charger upload a diagnostics file
+// The charger reports its progress with DiagnosticsStatusNotification
+type GetDiagnosticsRequest struct {
+	Location      string          `json:"location"`                // Directory URI the charger uploads the file to
+	Retries       *int            `json:"retries,omitempty"`       // How often to retry a failed upload
+	RetryInterval *int            `json:"retryInterval,omitempty"` // Seconds between retries
+	StartTime     *types.DateTime `json:"startTime,omitempty"`     // Oldest logging information to include
+	StopTime      *types.DateTime `json:"stopTime,omitempty"`      // Latest logging information to include
+}
+
+// GetDiagnosticsConfirmation is the charger's reply to a GetDiagnosticsRequest
+// Without a file name the charger has no diagnostics to upload
+type GetDiagnosticsConfirmation struct {
+	FileName string `json:"fileName,omitempty"`
+}
+
+// GetDiagnosticsFeature describes the GetDiagnostics request/confirmation pair
+type GetDiagnosticsFeature struct{}
+
+func (f GetDiagnosticsFeature) GetFeatureName() string {
+	return GetDiagnosticsFeatureName
+}
+
+func (f GetDiagnosticsFeature) GetRequestType() reflect.Type {
+	return reflect.TypeOf(GetDiagnosticsRequest{})
+}
+
+func (f GetDiagnosticsFeature) GetResponseType() reflect.Type {
+	return reflect.TypeOf(GetDiagnosticsConfirmation{})
+}
+
+func (r GetDiagnosticsRequest) GetFeatureName() string {
+	return GetDiagnosticsFeatureName
+}
+
+func (c GetDiagnosticsConfirmation) GetFeatureName() string {
+	return GetDiagnosticsFeatureName
+}
+
+// -------------------- Diagnostics Status Notification (CP -> CS) --------------------
+
+// DiagnosticsStatus is the progress of a diagnostics upload reported by the charger
+type DiagnosticsStatus string
+
+const (
+	DiagnosticsStatusIdle         DiagnosticsStatus = "Idle" // Only sent when triggered while no upload is running
+	DiagnosticsStatusUploaded     DiagnosticsStatus = "Uploaded"
+	DiagnosticsStatusUploadFailed DiagnosticsStatus = "UploadFailed"
+	DiagnosticsStatusUploading    DiagnosticsStatus = "Uploading"
+)
+
+// FirmwareManagementProfile groups the messages of the OCPP 1.6 FirmwareManagement profile we send
+var FirmwareManagementProfile = ocpp.NewProfile("FirmwareManagement", UpdateFirmwareFeature{}, GetDiagnosticsFeature{})
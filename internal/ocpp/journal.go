@@ -0,0 +1,307 @@
+package ocpp
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Directions of a journaled frame
+const (
+	JournalDirectionIn  = "in"  // Received from the charger
+	JournalDirectionOut = "out" // Sent to the charger
+)
+
+// Journal retention defaults, used until the app settings say otherwise
+const (
+	DefaultJournalRetentionDays = 30
+	DefaultJournalMaxMessages   = 1000000
+)
+
+// app_settings keys of the journal retention
+const (
+	journalRetentionDaysKey = "ocpp_log_retention_days"
+	journalMaxMessagesKey   = "ocpp_log_max_messages"
+)
+
+const (
+	// journalBufferSize is how many frames may wait to be written before new ones are dropped
+	journalBufferSize = 4096
+	// journalBatchSize is how many frames are written in one database transaction
+	journalBatchSize = 200
+	// journalPruneInterval is how often frames past the retention limits are deleted
+	journalPruneInterval = time.Hour
+	// journalCallTimeout is how long a CALL waits for its answer before it is no longer matched
+	journalCallTimeout = 10 * time.Minute
+)
+
+// JournalRetention limits how much of the OCPP traffic is kept
+type JournalRetention struct {
+	Days        int `json:"retention_days"` // Frames older than this are deleted
+	MaxMessages int `json:"max_messages"`   // The oldest frames beyond this count are deleted
+}
+
+// journalEntry is a frame waiting to be written
+type journalEntry struct {
+	identity    string
+	direction   string
+	messageType *int
+	messageId   *string
+	action      *string
+	errorCode   *string
+	latencyMs   *int64
+	payload     string
+	ts          time.Time
+}
+
+// journalCall is a CALL whose answer has not been journaled yet
+type journalCall struct {
+	direction string
+	action    string
+	ts        time.Time
+}
+
+// journal persists the raw OCPP traffic so misbehaving chargers can be diagnosed from the exact frames
+// Frames are written in the background; the connections never wait on the database
+type journal struct {
+	db      *sql.DB
+	logger  *zap.Logger
+	entries chan journalEntry
+	dropped int64 // Frames dropped because the buffer was full, reported with the next write
+
+	mu    sync.Mutex
+	calls map[string]journalCall // Unanswered CALLs keyed by identity and message ID
+}
+
+// newJournal creates the journal and starts writing and pruning in the background
+func newJournal(db *sql.DB, logger *zap.Logger) *journal {
+	j := &journal{
+		db:      db,
+		logger:  logger,
+		entries: make(chan journalEntry, journalBufferSize),
+		calls:   make(map[string]journalCall),
+	}
+	go j.run()
+	go j.runPrune()
+	return j
+}
+
+// record queues a frame for the journal
+// A CALLRESULT or CALLERROR gets the action of the CALL it answers and the time the answer took
+func (j *journal) record(identity, direction string, frame []byte) {
+	entry := journalEntry{
+		identity:  identity,
+		direction: direction,
+		payload:   string(frame),
+		ts:        time.Now().UTC(),
+	}
+
+	var message []json.RawMessage
+	var messageType int
+	var messageId string
+	if json.Unmarshal(frame, &message) == nil && len(message) >= 3 &&
+		json.Unmarshal(message[0], &messageType) == nil && json.Unmarshal(message[1], &messageId) == nil {
+		entry.messageType = &messageType
+		entry.messageId = &messageId
+		key := identity + "\x00" + messageId
+
+		switch messageType {
+		case 2:
+			var action string
+			if json.Unmarshal(message[2], &action) == nil {
+				entry.action = &action
+				j.mu.Lock()
+				j.calls[key] = journalCall{direction: direction, action: action, ts: entry.ts}
+				j.mu.Unlock()
+			}
+		case 3, 4:
+			if messageType == 4 {
+				var errorCode string
+				if json.Unmarshal(message[2], &errorCode) == nil {
+					entry.errorCode = &errorCode
+				}
+			}
+			j.mu.Lock()
+			call, ok := j.calls[key]
+			// Only the other side answers a CALL; a frame in the same direction is not its answer
+			if ok && call.direction != direction {
+				delete(j.calls, key)
+			}
+			j.mu.Unlock()
+			if ok && call.direction != direction {
+				latency := entry.ts.Sub(call.ts).Milliseconds()
+				entry.action = &call.action
+				entry.latencyMs = &latency
+			}
+		}
+	}
+
+	select {
+	case j.entries <- entry:
+	default:
+		atomic.AddInt64(&j.dropped, 1)
+	}
+}
+
+// run writes the queued frames in batches
+func (j *journal) run() {
+	batch := make([]journalEntry, 0, journalBatchSize)
+	for entry := range j.entries {
+		batch = append(batch[:0], entry)
+	fill:
+		for len(batch) < journalBatchSize {
+			select {
+			case entry := <-j.entries:
+				batch = append(batch, entry)
+			default:
+				break fill
+			}
+		}
+
+		if err := j.write(batch); err != nil {
+			j.logger.Error("Failed to write OCPP journal", zap.Int("frames", len(batch)), zap.Error(err))
+		}
+		if dropped := atomic.SwapInt64(&j.dropped, 0); dropped > 0 {
+			j.logger.Warn("OCPP journal buffer was full, frames were not journaled", zap.Int64("dropped", dropped))
+		}
+	}
+}
+
+// write stores a batch of frames with one statement, so it takes the database write lock only once
+func (j *journal) write(batch []journalEntry) error {
+	query := `
+		INSERT INTO ocpp_messages (identity, direction, message_type, message_id, action, error_code, latency_ms, payload, ts)
+		VALUES ` + strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?, ?, ?, ?), ", len(batch)), ", ")
+
+	args := make([]interface{}, 0, 9*len(batch))
+	for _, entry := range batch {
+		args = append(args,
+			entry.identity,
+			entry.direction,
+			entry.messageType,
+			entry.messageId,
+			entry.action,
+			entry.errorCode,
+			entry.latencyMs,
+			entry.payload,
+			entry.ts,
+		)
+	}
+
+	_, err := j.db.Exec(query, args...)
+	return err
+}
+
+// runPrune deletes frames past the retention limits and forgets CALLs that were never answered
+func (j *journal) runPrune() {
+	ticker := time.NewTicker(journalPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		j.prune(context.Background(), time.Now().UTC())
+
+		j.mu.Lock()
+		for key, call := range j.calls {
+			if time.Since(call.ts) > journalCallTimeout {
+				delete(j.calls, key)
+			}
+		}
+		j.mu.Unlock()
+
+		<-ticker.C
+	}
+}
+
+// prune applies the retention limits once
+func (j *journal) prune(ctx context.Context, now time.Time) {
+	retention, err := LoadJournalRetention(ctx, j.db)
+	if err != nil {
+		j.logger.Error("Failed to load OCPP journal retention", zap.Error(err))
+		return
+	}
+
+	var deleted int64
+	if retention.Days > 0 {
+		result, err := j.db.ExecContext(ctx, `DELETE FROM ocpp_messages WHERE ts < ?`, now.AddDate(0, 0, -retention.Days))
+		if err != nil {
+			j.logger.Error("Failed to prune OCPP journal by age", zap.Error(err))
+			return
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+	}
+
+	if retention.MaxMessages > 0 {
+		query := `
+			DELETE FROM ocpp_messages
+			WHERE id <= (SELECT id FROM ocpp_messages ORDER BY id DESC LIMIT 1 OFFSET ?)
+		`
+		result, err := j.db.ExecContext(ctx, query, retention.MaxMessages)
+		if err != nil {
+			j.logger.Error("Failed to prune OCPP journal by size", zap.Error(err))
+			return
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+	}
+
+	if deleted > 0 {
+		j.logger.Info("Pruned OCPP journal", zap.Int64("frames", deleted))
+	}
+}
+
+// LoadJournalRetention reads the journal retention from the app settings, with the defaults for unset keys
+// A limit of 0 turns that limit off
+func LoadJournalRetention(ctx context.Context, db *sql.DB) (*JournalRetention, error) {
+	retention := &JournalRetention{
+		Days:        DefaultJournalRetentionDays,
+		MaxMessages: DefaultJournalMaxMessages,
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT key, value FROM app_settings WHERE key IN (?, ?)`,
+		journalRetentionDaysKey, journalMaxMessagesKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			continue
+		}
+		switch key {
+		case journalRetentionDaysKey:
+			retention.Days = n
+		case journalMaxMessagesKey:
+			retention.MaxMessages = n
+		}
+	}
+
+	return retention, rows.Err()
+}
+
+// SaveJournalRetention stores the journal retention in the app settings; it applies from the next prune
+func SaveJournalRetention(ctx context.Context, db *sql.DB, retention *JournalRetention) error {
+	query := `
+		INSERT INTO app_settings (key, value)
+		VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`
+	if _, err := db.ExecContext(ctx, query, journalRetentionDaysKey, strconv.Itoa(retention.Days)); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, query, journalMaxMessagesKey, strconv.Itoa(retention.MaxMessages))
+	return err
+}
@@ -0,0 +1,619 @@
+package ocpp
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"go.uber.org/zap"
+)
+
+// Load balancing strategies of a site
+const (
+	LoadStrategyEqual     = "equal"      // Split capacity evenly across charging connectors
+	LoadStrategyFirstCome = "first_come" // Sessions that started first are served in full first
+	LoadStrategyPriority  = "priority"   // Chargers with a higher priority are served in full first
+)
+
+const (
+	// loadManagementProfileId is the chargingProfileId of the TxProfile the load manager installs
+	// Sending a profile with the same ID replaces the previous limit on the charger. It is kept
+	// well above the charging_profiles row IDs, which are the IDs of the operator's profiles
+	loadManagementProfileId = 1000000
+	// loadManagementStackLevel is high so the load limit wins over other TxProfiles
+	loadManagementStackLevel = 50
+	// loadChangeThresholdA is the smallest limit increase worth sending to a charger
+	// Decreases are always sent, and before any increase, so the limits never add up to more than the site has
+	loadChangeThresholdA = 0.5
+	// demandHeadroomA is how far above its measured current a throttled-down connector's limit is set
+	demandHeadroomA = 2.0
+	// demandShrinkMarginA is how far below its limit a connector must draw before its limit is lowered
+	demandShrinkMarginA = 4.0
+	// demandGrowMarginA is how close to its limit a connector must draw before it is offered more
+	demandGrowMarginA = 1.0
+	// meterSampleMaxAge is how old a current/power reading may be to count as the live draw
+	meterSampleMaxAge = 5 * time.Minute
+)
+
+// LoadAllocation is the current limit given to one charging connector
+type LoadAllocation struct {
+	ChargePointId string  `json:"charge_point_id"`
+	ConnectorId   int     `json:"connector_id"`
+	TransactionId int     `json:"transaction_id"`
+	LimitA        float64 `json:"limit_a"`
+	Status        string  `json:"status"` // Charger's answer to SetChargingProfile, "Unchanged" if nothing was sent, or "Skipped" if an increase was held back
+	Error         *string `json:"error,omitempty"`
+}
+
+// site is a grid connection shared by a group of chargers
+type site struct {
+	id          int64
+	gridLimit   float64
+	limitUnit   string // "A" per phase or "kW" in total
+	phases      int
+	voltage     float64
+	strategy    string
+	minCurrentA float64
+}
+
+// limitA returns the grid limit as a current per phase
+func (st site) limitA() float64 {
+	if st.limitUnit == "kW" {
+		return st.kwToA(st.gridLimit)
+	}
+	return st.gridLimit
+}
+
+// kwToA converts a power to the current per phase at the site's voltage and phase count
+func (st site) kwToA(kw float64) float64 {
+	return kw * 1000 / (st.voltage * float64(st.phases))
+}
+
+// loadSession is an open transaction competing for site capacity
+type loadSession struct {
+	chargePointId    string
+	chargerID        int64
+	connectorId      int
+	transactionRowID int64
+	txID             int
+	priority         int
+	startTs          time.Time
+	capA             float64  // Charger's rated output, or the whole site if unknown
+	measuredA        *float64 // Live draw from recent meter values
+	currentLimitA    *float64 // Limit we last sent for this transaction
+	allocationA      float64
+}
+
+// demandA is the most current a session can use right now
+// A car drawing well below its limit only needs its draw plus some headroom, and a car drawing
+// close to its limit may need more. In between it keeps its limit, so the limit a connector was
+// given does not feed back into its next demand and make the limits oscillate
+func (ls *loadSession) demandA() float64 {
+	if ls.measuredA == nil || ls.currentLimitA == nil {
+		return ls.capA
+	}
+
+	measured, limit := *ls.measuredA, *ls.currentLimitA
+	switch {
+	case measured < limit-demandShrinkMarginA:
+		return math.Min(ls.capA, measured+demandHeadroomA)
+	case measured >= limit-demandGrowMarginA:
+		return ls.capA
+	default:
+		return math.Min(ls.capA, limit)
+	}
+}
+
+// limitChanged reports whether a new allocation has to be sent to the charger
+// currentA is the limit the charger has, or nil if it has none from us yet
+func limitChanged(currentA *float64, allocationA float64) bool {
+	if currentA == nil {
+		return true
+	}
+	return allocationA < *currentA || allocationA-*currentA >= loadChangeThresholdA
+}
+
+// siteRebalancer runs the load balancing of one site, one run at a time
+// Triggers that arrive while a run is in progress are merged into a single follow-up run
+type siteRebalancer struct {
+	pending bool                   // Another run is needed after the current one
+	waiters []chan rebalanceResult // Callers waiting for the next run
+}
+
+// rebalanceResult is the outcome of a load balancing run handed to a waiting caller
+type rebalanceResult struct {
+	allocations []LoadAllocation
+	err         error
+}
+
+// rebalanceChargerSite schedules a rebalance of the site a charger belongs to, if any
+// It is called after sessions start or stop and when live meter values arrive
+func (s *Server) rebalanceChargerSite(chargePointId string) {
+	var siteID sql.NullInt64
+	err := s.db.QueryRowContext(context.Background(), `SELECT site_id FROM chargers WHERE identity = ?`, chargePointId).Scan(&siteID)
+	if err != nil {
+		s.logger.Error("Failed to look up charger site", zap.String("charge_point_id", chargePointId), zap.Error(err))
+		return
+	}
+	if !siteID.Valid {
+		return
+	}
+
+	s.scheduleRebalance(siteID.Int64, nil)
+}
+
+// RebalanceSite splits a site's grid capacity across its open transactions
+// and sends each connector a TxProfile with its new current limit
+// If the site is being rebalanced already, the result is that of the run that follows it
+func (s *Server) RebalanceSite(ctx context.Context, siteID int64) ([]LoadAllocation, error) {
+	wait := make(chan rebalanceResult, 1)
+	s.scheduleRebalance(siteID, wait)
+
+	select {
+	case result := <-wait:
+		return result.allocations, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// scheduleRebalance asks for a load balancing run of a site; wait, if set, receives its result
+// Only one run per site is in progress at a time, so two runs never hand out the same capacity twice
+func (s *Server) scheduleRebalance(siteID int64, wait chan rebalanceResult) {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	rebalancer, running := s.rebalancers[siteID]
+	if !running {
+		rebalancer = &siteRebalancer{}
+		s.rebalancers[siteID] = rebalancer
+		go s.runRebalances(siteID, rebalancer)
+	}
+
+	rebalancer.pending = true
+	if wait != nil {
+		rebalancer.waiters = append(rebalancer.waiters, wait)
+	}
+}
+
+// runRebalances rebalances a site until no more runs are pending
+// loadMu only guards the bookkeeping, it is never held while talking to chargers
+func (s *Server) runRebalances(siteID int64, rebalancer *siteRebalancer) {
+	for {
+		s.loadMu.Lock()
+		if !rebalancer.pending {
+			delete(s.rebalancers, siteID)
+			s.loadMu.Unlock()
+			return
+		}
+		rebalancer.pending = false
+		waiters := rebalancer.waiters
+		rebalancer.waiters = nil
+		s.loadMu.Unlock()
+
+		allocations, err := s.rebalanceSite(context.Background(), siteID)
+		if err != nil && len(waiters) == 0 {
+			s.logger.Error("Failed to rebalance site", zap.Int64("site_id", siteID), zap.Error(err))
+		}
+		for _, wait := range waiters {
+			wait <- rebalanceResult{allocations: allocations, err: err}
+		}
+	}
+}
+
+// rebalanceSite performs one load balancing run of a site
+// Decreases are sent first and increases only once every decrease was accepted, so the limits on the
+// chargers never add up to more than the site has. Within each step the limits are sent in parallel,
+// so a slow or unresponsive charger does not hold up the others
+func (s *Server) rebalanceSite(ctx context.Context, siteID int64) ([]LoadAllocation, error) {
+	st, err := s.loadSite(ctx, siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.loadSiteSessions(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+
+	allocateLoad(st, sessions)
+
+	allocations := make([]LoadAllocation, len(sessions))
+	var decreases, increases []int
+	for i, session := range sessions {
+		allocations[i] = LoadAllocation{
+			ChargePointId: session.chargePointId,
+			ConnectorId:   session.connectorId,
+			TransactionId: session.txID,
+			LimitA:        session.allocationA,
+			Status:        "Unchanged",
+		}
+
+		if !limitChanged(session.currentLimitA, session.allocationA) {
+			continue
+		}
+
+		// A session without a limit from us can draw up to its cap, so any limit lowers its draw
+		if session.currentLimitA == nil || session.allocationA < *session.currentLimitA {
+			decreases = append(decreases, i)
+		} else {
+			increases = append(increases, i)
+		}
+	}
+
+	if s.sendLoadLimits(ctx, st, sessions, allocations, decreases) {
+		s.sendLoadLimits(ctx, st, sessions, allocations, increases)
+	} else if len(increases) > 0 {
+		// The capacity a charger did not give up cannot be handed to the others yet
+		// The increases are not stored, so the next run sends them again
+		msg := "not sent: a limit decrease on the site was not accepted"
+		for _, i := range increases {
+			allocations[i].Status = "Skipped"
+			allocations[i].Error = &msg
+		}
+		s.logger.Warn("Load limit increases held back",
+			zap.Int64("site_id", siteID),
+			zap.Int("increases", len(increases)))
+	}
+
+	if err := s.pruneLoadAllocations(ctx); err != nil {
+		s.logger.Error("Failed to prune load allocations", zap.Int64("site_id", siteID), zap.Error(err))
+	}
+
+	s.logger.Info("Site load rebalanced",
+		zap.Int64("site_id", siteID),
+		zap.String("strategy", st.strategy),
+		zap.Float64("limit_a", st.limitA()),
+		zap.Int("sessions", len(sessions)))
+
+	return allocations, nil
+}
+
+// sendLoadLimits sends the allocations of the given sessions in parallel and waits for every answer
+// It reports whether the chargers accepted all of them
+func (s *Server) sendLoadLimits(ctx context.Context, st site, sessions []*loadSession, allocations []LoadAllocation, indices []int) bool {
+	var wg sync.WaitGroup
+	for _, i := range indices {
+		wg.Add(1)
+		go func(allocation *LoadAllocation, session *loadSession) {
+			defer wg.Done()
+			status, err := s.sendLoadLimit(ctx, st, session)
+			allocation.Status = status
+			if err != nil {
+				msg := err.Error()
+				allocation.Error = &msg
+			}
+			s.storeLoadAllocation(ctx, session, status, err)
+		}(&allocations[i], sessions[i])
+	}
+	wg.Wait()
+
+	for _, i := range indices {
+		if allocations[i].Status != string(ChargingProfileStatusAccepted) {
+			return false
+		}
+	}
+	return true
+}
+
+// allocateLoad sets allocationA on every session according to the site's strategy
+// Sessions that cannot get at least the site's minimum current are paused with a 0 A limit
+func allocateLoad(st site, sessions []*loadSession) {
+	available := st.limitA()
+
+	// Decide who is served first when there is not enough for everyone
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if st.strategy == LoadStrategyPriority && sessions[i].priority != sessions[j].priority {
+			return sessions[i].priority > sessions[j].priority
+		}
+		return sessions[i].startTs.Before(sessions[j].startTs)
+	})
+
+	if st.strategy != LoadStrategyEqual {
+		for _, session := range sessions {
+			session.allocationA = math.Min(session.demandA(), available)
+			if session.allocationA < st.minCurrentA {
+				session.allocationA = 0
+			}
+			session.allocationA = roundDownA(session.allocationA)
+			available -= session.allocationA
+		}
+		return
+	}
+
+	// Only as many sessions as can get the minimum current take part in the split
+	served := sessions
+	if st.minCurrentA > 0 {
+		maxServed := int(available / st.minCurrentA)
+		if maxServed < len(served) {
+			for _, session := range served[maxServed:] {
+				session.allocationA = 0
+			}
+			served = served[:maxServed]
+		}
+	}
+
+	// Water-filling: sessions that need less than an equal share keep what they need,
+	// and the rest is shared by the others
+	remaining := available
+	unsatisfied := append([]*loadSession(nil), served...)
+	for len(unsatisfied) > 0 {
+		share := remaining / float64(len(unsatisfied))
+		var next []*loadSession
+		for _, session := range unsatisfied {
+			demand := math.Max(session.demandA(), st.minCurrentA)
+			if demand <= share {
+				session.allocationA = demand
+				remaining -= demand
+			} else {
+				next = append(next, session)
+			}
+		}
+		if len(next) == len(unsatisfied) {
+			for _, session := range next {
+				session.allocationA = share
+			}
+			break
+		}
+		unsatisfied = next
+	}
+
+	for _, session := range served {
+		session.allocationA = roundDownA(session.allocationA)
+	}
+}
+
+// roundDownA rounds a current down to 0.1 A so rounding never exceeds the site limit
+// The small epsilon keeps values that already are a multiple of 0.1 A (e.g. 12.3) unchanged
+func roundDownA(a float64) float64 {
+	return math.Floor(a*10+1e-9) / 10
+}
+
+// sendLoadLimit installs the session's allocation on the charger as a TxProfile
+func (s *Server) sendLoadLimit(ctx context.Context, st site, session *loadSession) (string, error) {
+	phases := st.phases
+	request := &SetChargingProfileRequest{
+		ConnectorId: session.connectorId,
+		ChargingProfile: &types.ChargingProfile{
+			ChargingProfileId:      loadManagementProfileId,
+			TransactionId:          session.txID,
+			StackLevel:             loadManagementStackLevel,
+			ChargingProfilePurpose: types.ChargingProfilePurposeTxProfile,
+			ChargingProfileKind:    types.ChargingProfileKindRelative,
+			ChargingSchedule: &types.ChargingSchedule{
+				ChargingRateUnit: types.ChargingRateUnitAmperes,
+				ChargingSchedulePeriod: []types.ChargingSchedulePeriod{
+					{StartPeriod: 0, Limit: session.allocationA, NumberPhases: &phases},
+				},
+			},
+		},
+	}
+
+	response, err := s.callCommand(ctx, session.chargePointId, SetChargingProfileFeatureName, request)
+	if err != nil {
+		s.logger.Error("Failed to send load limit",
+			zap.String("charge_point_id", session.chargePointId),
+			zap.Int("connector_id", session.connectorId),
+			zap.Error(err))
+		return "Error", err
+	}
+
+	confirmation := response.(*SetChargingProfileConfirmation)
+	s.logger.Info("Load limit answered by charger",
+		zap.String("charge_point_id", session.chargePointId),
+		zap.Int("connector_id", session.connectorId),
+		zap.Int("transaction_id", session.txID),
+		zap.Float64("limit_a", session.allocationA),
+		zap.String("status", string(confirmation.Status)))
+
+	return string(confirmation.Status), nil
+}
+
+// ReleaseLoadLimit removes the load manager's TxProfile from a charger that left its site
+// Otherwise its last limit, possibly 0 A for a paused session, would stay in force until the session ends
+func (s *Server) ReleaseLoadLimit(ctx context.Context, chargePointId string) error {
+	chargerID, err := s.getChargerID(ctx, chargePointId)
+	if err != nil {
+		return err
+	}
+
+	var allocations int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM load_allocations WHERE charger_id = ?`, chargerID).Scan(&allocations); err != nil {
+		return fmt.Errorf("failed to query load allocations: %w", err)
+	}
+	if allocations == 0 {
+		return nil
+	}
+
+	profileId := loadManagementProfileId
+	response, err := s.callCommand(ctx, chargePointId, ClearChargingProfileFeatureName, &ClearChargingProfileRequest{Id: &profileId})
+	if err != nil {
+		return err
+	}
+
+	confirmation := response.(*ClearChargingProfileConfirmation)
+	s.logger.Info("Load limit cleared by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("status", string(confirmation.Status)))
+
+	// Unknown means the session the limit belonged to has ended already, so there is nothing left to clear
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM load_allocations WHERE charger_id = ?`, chargerID); err != nil {
+		return fmt.Errorf("failed to forget load allocations: %w", err)
+	}
+	return nil
+}
+
+// loadSite reads a site's grid connection settings
+func (s *Server) loadSite(ctx context.Context, siteID int64) (site, error) {
+	st := site{id: siteID}
+	query := `SELECT grid_limit, limit_unit, phases, voltage, strategy, min_current_a FROM sites WHERE id = ?`
+	err := s.db.QueryRowContext(ctx, query, siteID).Scan(
+		&st.gridLimit,
+		&st.limitUnit,
+		&st.phases,
+		&st.voltage,
+		&st.strategy,
+		&st.minCurrentA,
+	)
+	if err != nil {
+		return st, fmt.Errorf("failed to load site %d: %w", siteID, err)
+	}
+	return st, nil
+}
+
+// loadSiteSessions reads the open transactions on a site's chargers with their live draw and last limit
+func (s *Server) loadSiteSessions(ctx context.Context, st site) ([]*loadSession, error) {
+	// Only limits the charger accepted count as applied, so failed sends are retried on the next run
+	query := `
+		SELECT c.identity, c.id, COALESCE(t.connector_id, 1), t.id, t.tx_id, c.priority, t.start_ts, c.max_output_kw,
+			CASE WHEN la.status = 'Accepted' THEN la.limit_a END
+		FROM transactions t
+		JOIN chargers c ON c.id = t.charger_id
+		LEFT JOIN load_allocations la ON la.charger_id = t.charger_id AND la.transaction_id = t.id
+		WHERE c.site_id = ? AND t.stop_ts IS NULL
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, st.id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query site sessions: %w", err)
+	}
+
+	var sessions []*loadSession
+	for rows.Next() {
+		session := &loadSession{}
+		var txID string
+		var maxOutputKW sql.NullFloat64
+		if err := rows.Scan(
+			&session.chargePointId,
+			&session.chargerID,
+			&session.connectorId,
+			&session.transactionRowID,
+			&txID,
+			&session.priority,
+			&session.startTs,
+			&maxOutputKW,
+			&session.currentLimitA,
+		); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan site session: %w", err)
+		}
+
+		// Rows without a numeric OCPP transaction ID (e.g. dev test data) are not on a charger
+		if session.txID, err = strconv.Atoi(txID); err != nil {
+			continue
+		}
+
+		session.capA = st.limitA()
+		if maxOutputKW.Valid && maxOutputKW.Float64 > 0 {
+			session.capA = math.Min(session.capA, st.kwToA(maxOutputKW.Float64))
+		}
+		sessions = append(sessions, session)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The TxProfile replaces a time-of-use TxDefaultProfile during the session, so it has to honour its limit
+	now := time.Now()
+	for _, session := range sessions {
+		touLimitA, err := s.chargerTOULimitA(ctx, st, session.chargerID, now)
+		if err != nil {
+			s.logger.Warn("Failed to read time-of-use limit", zap.String("charge_point_id", session.chargePointId), zap.Error(err))
+		} else if touLimitA != nil {
+			session.capA = math.Min(session.capA, *touLimitA)
+		}
+	}
+
+	for _, session := range sessions {
+		measured, err := s.measuredCurrentA(ctx, st, session.transactionRowID)
+		if err != nil {
+			s.logger.Warn("Failed to read live current", zap.String("charge_point_id", session.chargePointId), zap.Error(err))
+			continue
+		}
+		session.measuredA = measured
+	}
+
+	return sessions, nil
+}
+
+// measuredCurrentA returns the highest recent per-phase current of a transaction, or nil without recent readings
+// Current.Import is used when the charger reports it, otherwise Power.Active.Import is converted
+func (s *Server) measuredCurrentA(ctx context.Context, st site, transactionRowID int64) (*float64, error) {
+	since := time.Now().UTC().Add(-meterSampleMaxAge)
+
+	var current sql.NullFloat64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT MAX(value) FROM meter_values WHERE transaction_id = ? AND measurand = 'Current.Import' AND ts >= ?`,
+		transactionRowID, since).Scan(&current)
+	if err != nil {
+		return nil, err
+	}
+	if current.Valid {
+		return &current.Float64, nil
+	}
+
+	var power sql.NullFloat64
+	err = s.db.QueryRowContext(ctx,
+		`SELECT MAX(value) FROM meter_values WHERE transaction_id = ? AND measurand = 'Power.Active.Import' AND phase IS NULL AND ts >= ?`,
+		transactionRowID, since).Scan(&power)
+	if err != nil {
+		return nil, err
+	}
+	if power.Valid {
+		a := st.kwToA(power.Float64 / 1000)
+		return &a, nil
+	}
+
+	return nil, nil
+}
+
+// storeLoadAllocation remembers the limit sent for a session so unchanged limits are not re-sent
+func (s *Server) storeLoadAllocation(ctx context.Context, session *loadSession, status string, callErr error) {
+	var errorText *string
+	if callErr != nil {
+		msg := callErr.Error()
+		errorText = &msg
+	}
+
+	query := `
+		INSERT INTO load_allocations (charger_id, connector_id, transaction_id, limit_a, status, error, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(charger_id, connector_id) DO UPDATE SET
+			transaction_id = excluded.transaction_id,
+			limit_a = excluded.limit_a,
+			status = excluded.status,
+			error = excluded.error,
+			updated_at = excluded.updated_at
+	`
+
+	_, err := s.db.ExecContext(context.Background(), query,
+		session.chargerID,
+		session.connectorId,
+		session.transactionRowID,
+		session.allocationA,
+		status,
+		errorText,
+		time.Now(),
+	)
+	if err != nil {
+		s.logger.Error("Failed to store load allocation", zap.String("charge_point_id", session.chargePointId), zap.Error(err))
+	}
+}
+
+// pruneLoadAllocations forgets allocations of finished transactions and of chargers that left the site
+func (s *Server) pruneLoadAllocations(ctx context.Context) error {
+	query := `
+		DELETE FROM load_allocations
+		WHERE transaction_id IN (SELECT id FROM transactions WHERE stop_ts IS NOT NULL)
+			OR charger_id NOT IN (SELECT id FROM chargers WHERE site_id IS NOT NULL)
+	`
+	_, err := s.db.ExecContext(ctx, query)
+	return err
+}
@@ -0,0 +1,233 @@
+package ocpp
+
+import (
+	"testing"
+	"time"
+)
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func TestAllocateLoad(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// session builds a charging connector; sessions are told apart by connectorId
+	session := func(connectorId int, startedMinutes int, priority int, capA float64) *loadSession {
+		return &loadSession{
+			connectorId: connectorId,
+			priority:    priority,
+			startTs:     start.Add(time.Duration(startedMinutes) * time.Minute),
+			capA:        capA,
+		}
+	}
+
+	// throttled is a session whose car draws measuredA under a limit of limitA
+	throttled := func(ls *loadSession, measuredA, limitA float64) *loadSession {
+		ls.measuredA = floatPtr(measuredA)
+		ls.currentLimitA = floatPtr(limitA)
+		return ls
+	}
+
+	tests := []struct {
+		name     string
+		strategy string
+		limitA   float64
+		minA     float64
+		sessions []*loadSession
+		want     map[int]float64 // connectorId -> allocation
+	}{
+		{
+			name:     "equal split",
+			strategy: LoadStrategyEqual,
+			limitA:   32,
+			minA:     6,
+			sessions: []*loadSession{session(1, 0, 0, 32), session(2, 1, 0, 32)},
+			want:     map[int]float64{1: 16, 2: 16},
+		},
+		{
+			name:     "equal split rounds down to 0.1 A",
+			strategy: LoadStrategyEqual,
+			limitA:   32,
+			minA:     6,
+			sessions: []*loadSession{session(1, 0, 0, 32), session(2, 1, 0, 32), session(3, 2, 0, 32)},
+			want:     map[int]float64{1: 10.6, 2: 10.6, 3: 10.6},
+		},
+		{
+			name:     "water-filling hands a small charger's share to the others",
+			strategy: LoadStrategyEqual,
+			limitA:   32,
+			minA:     6,
+			sessions: []*loadSession{session(1, 0, 0, 8), session(2, 1, 0, 32), session(3, 2, 0, 32)},
+			want:     map[int]float64{1: 8, 2: 12, 3: 12},
+		},
+		{
+			name:     "water-filling never gives less than the minimum",
+			strategy: LoadStrategyEqual,
+			limitA:   32,
+			minA:     6,
+			// Draws 1 A under a 10 A limit, so it only needs 3 A
+			sessions: []*loadSession{throttled(session(1, 0, 0, 32), 1, 10), session(2, 1, 0, 32)},
+			want:     map[int]float64{1: 6, 2: 26},
+		},
+		{
+			name:     "equal split pauses the latest sessions below the minimum",
+			strategy: LoadStrategyEqual,
+			limitA:   16,
+			minA:     6,
+			sessions: []*loadSession{session(3, 2, 0, 32), session(1, 0, 0, 32), session(2, 1, 0, 32)},
+			want:     map[int]float64{1: 8, 2: 8, 3: 0},
+		},
+		{
+			name:     "equal split without a minimum shares between everyone",
+			strategy: LoadStrategyEqual,
+			limitA:   16,
+			minA:     0,
+			sessions: []*loadSession{session(1, 0, 0, 32), session(2, 1, 0, 32), session(3, 2, 0, 32), session(4, 3, 0, 32)},
+			want:     map[int]float64{1: 4, 2: 4, 3: 4, 4: 4},
+		},
+		{
+			name:     "equal split pauses everyone when the site is below the minimum",
+			strategy: LoadStrategyEqual,
+			limitA:   5,
+			minA:     6,
+			sessions: []*loadSession{session(1, 0, 0, 32)},
+			want:     map[int]float64{1: 0},
+		},
+		{
+			name:     "first come is served in full first",
+			strategy: LoadStrategyFirstCome,
+			limitA:   32,
+			minA:     6,
+			sessions: []*loadSession{session(2, 1, 0, 16), session(1, 0, 0, 16), session(3, 2, 0, 16)},
+			want:     map[int]float64{1: 16, 2: 16, 3: 0},
+		},
+		{
+			name:     "first come gives the rest to the next session if it reaches the minimum",
+			strategy: LoadStrategyFirstCome,
+			limitA:   22,
+			minA:     6,
+			sessions: []*loadSession{session(1, 0, 0, 16), session(2, 1, 0, 16)},
+			want:     map[int]float64{1: 16, 2: 6},
+		},
+		{
+			name:     "first come pauses the next session below the minimum",
+			strategy: LoadStrategyFirstCome,
+			limitA:   21.9,
+			minA:     6,
+			sessions: []*loadSession{session(1, 0, 0, 16), session(2, 1, 0, 16)},
+			want:     map[int]float64{1: 16, 2: 0},
+		},
+		{
+			name:     "priority serves the higher priority first",
+			strategy: LoadStrategyPriority,
+			limitA:   20,
+			minA:     6,
+			sessions: []*loadSession{session(1, 0, 0, 16), session(2, 1, 5, 16)},
+			want:     map[int]float64{1: 0, 2: 16},
+		},
+		{
+			name:     "priority falls back to start time between equal priorities",
+			strategy: LoadStrategyPriority,
+			limitA:   32,
+			minA:     6,
+			sessions: []*loadSession{session(3, 2, 1, 16), session(2, 1, 1, 16), session(1, 0, 0, 16)},
+			want:     map[int]float64{1: 0, 2: 16, 3: 16},
+		},
+		{
+			name:     "priority leaves unused capacity to lower priorities",
+			strategy: LoadStrategyPriority,
+			limitA:   32,
+			minA:     6,
+			// Draws 5 A under a 16 A limit, so it only needs 7 A
+			sessions: []*loadSession{session(1, 0, 0, 32), throttled(session(2, 1, 5, 32), 5, 16)},
+			want:     map[int]float64{1: 25, 2: 7},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := site{gridLimit: tt.limitA, limitUnit: "A", phases: 3, voltage: 230, strategy: tt.strategy, minCurrentA: tt.minA}
+			allocateLoad(st, tt.sessions)
+
+			total := 0.0
+			for _, session := range tt.sessions {
+				if want := tt.want[session.connectorId]; session.allocationA != want {
+					t.Errorf("connector %d: got %.1f A, want %.1f A", session.connectorId, session.allocationA, want)
+				}
+				total += session.allocationA
+			}
+			if total > tt.limitA+1e-9 {
+				t.Errorf("allocated %.1f A in total, more than the site limit of %.1f A", total, tt.limitA)
+			}
+		})
+	}
+}
+
+func TestDemandA(t *testing.T) {
+	tests := []struct {
+		name      string
+		measuredA *float64
+		limitA    *float64
+		want      float64
+	}{
+		{name: "no reading", measuredA: nil, limitA: floatPtr(16), want: 32},
+		{name: "no limit sent yet", measuredA: floatPtr(5), limitA: nil, want: 32},
+		{name: "draws far below its limit", measuredA: floatPtr(5), limitA: floatPtr(16), want: 7},
+		{name: "draws close to its limit", measuredA: floatPtr(15.5), limitA: floatPtr(16), want: 32},
+		{name: "draws a little below its limit keeps it", measuredA: floatPtr(13), limitA: floatPtr(16), want: 16},
+		{name: "throttled limit is stable", measuredA: floatPtr(5), limitA: floatPtr(7), want: 7},
+		{name: "paused session asks for more", measuredA: floatPtr(0), limitA: floatPtr(0), want: 32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := &loadSession{capA: 32, measuredA: tt.measuredA, currentLimitA: tt.limitA}
+			if got := session.demandA(); got != tt.want {
+				t.Errorf("got %.1f A, want %.1f A", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitChanged(t *testing.T) {
+	tests := []struct {
+		name        string
+		currentA    *float64
+		allocationA float64
+		want        bool
+	}{
+		{name: "nothing sent yet", currentA: nil, allocationA: 16, want: true},
+		{name: "unchanged", currentA: floatPtr(16), allocationA: 16, want: false},
+		{name: "small increase", currentA: floatPtr(16), allocationA: 16.4, want: false},
+		{name: "increase", currentA: floatPtr(16), allocationA: 16.5, want: true},
+		{name: "small decrease", currentA: floatPtr(16), allocationA: 15.9, want: true},
+		{name: "pause", currentA: floatPtr(6), allocationA: 0, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limitChanged(tt.currentA, tt.allocationA); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundDownA(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want float64
+	}{
+		{in: 32.0 / 3, want: 10.6},
+		{in: 12.3, want: 12.3},
+		{in: 6.09, want: 6},
+		{in: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := roundDownA(tt.in); got != tt.want {
+			t.Errorf("roundDownA(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package ocpp
+
+import (
+	"reflect"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+)
+
+// AuthorizationData is one entry of a local authorization list
+// An entry without IdTagInfo removes the idTag from the list in a Differential update
+type AuthorizationData struct {
+	IdTag     string           `json:"idTag"`
+	IdTagInfo *types.IdTagInfo `json:"idTagInfo,omitempty"`
+}
+
+// -------------------- Get Local List Version (CS -> CP) --------------------
+
+const GetLocalListVersionFeatureName = "GetLocalListVersion"
+
+// GetLocalListVersionRequest asks the charger which local list version it has installed
+type GetLocalListVersionRequest struct{}
+
+// GetLocalListVersionConfirmation is the charger's reply to a GetLocalListVersionRequest
+// 0 means no list is installed, -1 means the charger does not support local lists
+type GetLocalListVersionConfirmation struct {
+	ListVersion int `json:"listVersion"`
+}
+
+// GetLocalListVersionFeature describes the GetLocalListVersion request/confirmation pair
+type GetLocalListVersionFeature struct{}
+
+func (f GetLocalListVersionFeature) GetFeatureName() string {
+	return GetLocalListVersionFeatureName
+}
+
+func (f GetLocalListVersionFeature) GetRequestType() reflect.Type {
+	return reflect.TypeOf(GetLocalListVersionRequest{})
+}
+
+func (f GetLocalListVersionFeature) GetResponseType() reflect.Type {
+	return reflect.TypeOf(GetLocalListVersionConfirmation{})
+}
+
+func (r GetLocalListVersionRequest) GetFeatureName() string {
+	return GetLocalListVersionFeatureName
+}
+
+func (c GetLocalListVersionConfirmation) GetFeatureName() string {
+	return GetLocalListVersionFeatureName
+}
+
+// -------------------- Send Local List (CS -> CP) --------------------
+
+const SendLocalListFeatureName = "SendLocalList"
+
+// UpdateType says whether a SendLocalList replaces the whole list or changes part of it
+type UpdateType string
+
+// UpdateStatus is the charger's answer to a SendLocalListRequest
+type UpdateStatus string
+
+const (
+	UpdateTypeDifferential      UpdateType   = "Differential"
+	UpdateTypeFull              UpdateType   = "Full"
+	UpdateStatusAccepted        UpdateStatus = "Accepted"
+	UpdateStatusFailed          UpdateStatus = "Failed"
+	UpdateStatusNotSupported    UpdateStatus = "NotSupported"
+	UpdateStatusVersionMismatch UpdateStatus = "VersionMismatch"
+)
+
+// SendLocalListRequest installs or updates the local authorization list on the charger
+type SendLocalListRequest struct {
+	ListVersion            int                 `json:"listVersion"`
+	LocalAuthorizationList []AuthorizationData `json:"localAuthorizationList,omitempty"`
+	UpdateType             UpdateType          `json:"updateType"`
+}
+
+// SendLocalListConfirmation is the charger's reply to a SendLocalListRequest
+type SendLocalListConfirmation struct {
+	Status UpdateStatus `json:"status"`
+}
+
+// SendLocalListFeature describes the SendLocalList request/confirmation pair
+type SendLocalListFeature struct{}
+
+func (f SendLocalListFeature) GetFeatureName() string {
+	return SendLocalListFeatureName
+}
+
+func (f SendLocalListFeature) GetRequestType() reflect.Type {
+	return reflect.TypeOf(SendLocalListRequest{})
+}
+
+func (f SendLocalListFeature) GetResponseType() reflect.Type {
+	return reflect.TypeOf(SendLocalListConfirmation{})
+}
+
+func (r SendLocalListRequest) GetFeatureName() string {
+	return SendLocalListFeatureName
+}
+
+func (c SendLocalListConfirmation) GetFeatureName() string {
+	return SendLocalListFeatureName
+}
+
+// LocalAuthListProfile groups the messages of the OCPP 1.6 LocalAuthListManagement profile
+var LocalAuthListProfile = ocpp.NewProfile("LocalAuthListManagement", GetLocalListVersionFeature{}, SendLocalListFeature{})
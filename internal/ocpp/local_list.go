@@ -0,0 +1,579 @@
+package ocpp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"go.uber.org/zap"
+)
+
+// LocalListSyncStatusUpToDate is reported when the charger already has the current list
+const LocalListSyncStatusUpToDate = "UpToDate"
+
+// sendLocalListMaxLengthKey is the configuration key limiting the entries of one SendLocalList
+const sendLocalListMaxLengthKey = "SendLocalListMaxLength"
+
+// LocalListSyncResult is the outcome of pushing the authorization list to a charger
+type LocalListSyncResult struct {
+	Status         string `json:"status"`                // Accepted, Failed, NotSupported, VersionMismatch or UpToDate
+	UpdateType     string `json:"update_type,omitempty"` // Full or Differential; empty when nothing was sent
+	ListVersion    int    `json:"list_version"`          // Version we installed (or already had)
+	ChargerVersion int    `json:"charger_version"`       // Version the charger reported afterwards
+	Entries        int    `json:"entries"`               // Number of entries sent
+}
+
+// LocalListState is the last known local list sync state of a charger
+type LocalListState struct {
+	ListVersion    int        `json:"list_version"`
+	ChargerVersion *int       `json:"charger_version"`
+	UpdateType     *string    `json:"update_type"`
+	LastStatus     *string    `json:"last_status"`
+	LastError      *string    `json:"last_error"`
+	SyncedAt       *time.Time `json:"synced_at"`
+	VerifiedAt     *time.Time `json:"verified_at"`
+	PendingChanges int        `json:"pending_changes"` // idTag changes not yet on the charger
+}
+
+// localListEntry is one idTag as it is (or should be) on a charger's local list
+type localListEntry struct {
+	tag         string
+	status      string
+	expiryDate  *time.Time
+	parentIdTag *string
+}
+
+// equal reports whether two entries would be sent to the charger identically
+func (e localListEntry) equal(other localListEntry) bool {
+	if e.status != other.status {
+		return false
+	}
+	if (e.expiryDate == nil) != (other.expiryDate == nil) || (e.expiryDate != nil && !e.expiryDate.Equal(*other.expiryDate)) {
+		return false
+	}
+	if (e.parentIdTag == nil) != (other.parentIdTag == nil) || (e.parentIdTag != nil && *e.parentIdTag != *other.parentIdTag) {
+		return false
+	}
+	return true
+}
+
+// authorizationData converts an entry into the SendLocalList format
+func (e localListEntry) authorizationData() AuthorizationData {
+	info := &types.IdTagInfo{Status: types.AuthorizationStatus(e.status)}
+	if e.expiryDate != nil {
+		info.ExpiryDate = types.NewDateTime(*e.expiryDate)
+	}
+	if e.parentIdTag != nil {
+		info.ParentIdTag = *e.parentIdTag
+	}
+	return AuthorizationData{IdTag: e.tag, IdTagInfo: info}
+}
+
+// GetLocalListVersion asks the charger which local list version it has installed
+func (s *Server) GetLocalListVersion(ctx context.Context, chargePointId string) (int, error) {
+	response, err := s.Call(ctx, chargePointId, GetLocalListVersionFeatureName, &GetLocalListVersionRequest{})
+	if err != nil {
+		return 0, err
+	}
+
+	confirmation := response.(*GetLocalListVersionConfirmation)
+	s.logger.Info("GetLocalListVersion answered by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.Int("list_version", confirmation.ListVersion))
+
+	return confirmation.ListVersion, nil
+}
+
+// SyncLocalList brings the charger's local authorization list in line with id_tags
+// A Differential update is sent when the charger still has the version we installed last,
+// otherwise (or when full is set) the whole list is replaced. The result is checked with GetLocalListVersion
+// Syncs of the same charger run one at a time, so two runs never send the same list version
+func (s *Server) SyncLocalList(ctx context.Context, chargePointId string, full bool) (*LocalListSyncResult, error) {
+	lock := s.localListLock(chargePointId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	chargerID, err := s.getChargerID(ctx, chargePointId)
+	if err != nil {
+		return nil, err
+	}
+
+	chargerVersion, err := s.GetLocalListVersion(ctx, chargePointId)
+	if err != nil {
+		// Chargers without the profile often answer with a CALLERROR instead of -1
+		var callErr *CallError
+		if errors.As(err, &callErr) && (callErr.ErrorCode == "NotImplemented" || callErr.ErrorCode == "NotSupported") {
+			chargerVersion = -1
+		} else {
+			return nil, err
+		}
+	}
+
+	if chargerVersion < 0 {
+		result := &LocalListSyncResult{Status: string(UpdateStatusNotSupported), ChargerVersion: chargerVersion}
+		s.saveLocalListResult(ctx, chargerID, result, nil)
+		return result, nil
+	}
+
+	state, err := s.loadLocalListState(ctx, chargerID)
+	if err != nil {
+		return nil, err
+	}
+
+	desired, err := s.loadAuthorizationList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	installed, err := s.loadInstalledLocalList(ctx, chargerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A differential update only makes sense if the charger still holds the list we installed
+	if !full && (state == nil || state.ListVersion != chargerVersion) {
+		full = true
+	}
+
+	maxLength := s.sendLocalListMaxLength(ctx, chargePointId, chargerID)
+
+	if !full {
+		changes := diffLocalList(installed, desired)
+		if len(changes) == 0 {
+			result := &LocalListSyncResult{
+				Status:         LocalListSyncStatusUpToDate,
+				ListVersion:    chargerVersion,
+				ChargerVersion: chargerVersion,
+			}
+			s.saveLocalListResult(ctx, chargerID, result, nil)
+			return result, nil
+		}
+
+		result, err := s.sendLocalListInParts(ctx, chargePointId, chargerID, chargerVersion, UpdateTypeDifferential, state.ListVersion+1, changes, installed, desired, maxLength)
+		if err != nil || result.Status != string(UpdateStatusVersionMismatch) {
+			return result, err
+		}
+
+		// The charger's list moved under us; start over with the whole list
+		s.logger.Warn("Differential local list update rejected, sending full list",
+			zap.String("charge_point_id", chargePointId))
+	}
+
+	version := chargerVersion
+	if state != nil && state.ListVersion > version {
+		version = state.ListVersion
+	}
+
+	entries := make([]AuthorizationData, 0, len(desired))
+	for _, entry := range desired {
+		entries = append(entries, entry.authorizationData())
+	}
+
+	return s.sendLocalListInParts(ctx, chargePointId, chargerID, chargerVersion, UpdateTypeFull, version+1, entries, installed, desired, maxLength)
+}
+
+// localListLock returns the mutex that serialises local list syncs of a charger
+func (s *Server) localListLock(chargePointId string) *sync.Mutex {
+	s.localListMu.Lock()
+	defer s.localListMu.Unlock()
+
+	lock, ok := s.localListLocks[chargePointId]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.localListLocks[chargePointId] = lock
+	}
+	return lock
+}
+
+// sendLocalListMaxLength returns how many entries the charger accepts in one SendLocalList, or 0 if unknown
+// The cached configuration is used when we have it, otherwise the key is read from the charger
+func (s *Server) sendLocalListMaxLength(ctx context.Context, chargePointId string, chargerID int64) int {
+	var value sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		`SELECT value FROM charger_configuration WHERE charger_id = ? AND key = ?`,
+		chargerID, sendLocalListMaxLengthKey).Scan(&value)
+	if err != nil && err != sql.ErrNoRows {
+		s.logger.Warn("Failed to read cached SendLocalListMaxLength", zap.String("charge_point_id", chargePointId), zap.Error(err))
+	}
+
+	if !value.Valid {
+		confirmation, err := s.GetConfiguration(ctx, chargePointId, []string{sendLocalListMaxLengthKey})
+		if err != nil {
+			s.logger.Warn("Failed to read SendLocalListMaxLength from charger", zap.String("charge_point_id", chargePointId), zap.Error(err))
+			return 0
+		}
+		for _, key := range confirmation.ConfigurationKey {
+			if key.Key == sendLocalListMaxLengthKey && key.Value != nil {
+				value = sql.NullString{String: *key.Value, Valid: true}
+			}
+		}
+	}
+
+	maxLength, err := strconv.Atoi(value.String)
+	if err != nil || maxLength < 0 {
+		return 0
+	}
+	return maxLength
+}
+
+// sendLocalListInParts sends entries in SendLocalList messages of at most maxLength entries (0 for no limit)
+// The first message carries updateType; the parts after it are Differential updates adding to the list,
+// each with the next version. It stops at the first part the charger does not accept
+func (s *Server) sendLocalListInParts(ctx context.Context, chargePointId string, chargerID int64, chargerVersion int, updateType UpdateType, version int, entries []AuthorizationData, installed, desired map[string]localListEntry, maxLength int) (*LocalListSyncResult, error) {
+	parts := splitAuthorizationData(entries, maxLength)
+	if updateType == UpdateTypeFull {
+		installed = nil
+	}
+
+	var result *LocalListSyncResult
+	sent := 0
+	for i, part := range parts {
+		partType := updateType
+		if i > 0 {
+			partType = UpdateTypeDifferential
+			chargerVersion = result.ChargerVersion
+		}
+
+		installed = applyLocalListChanges(installed, part, desired)
+
+		var err error
+		result, err = s.sendLocalList(ctx, chargePointId, chargerID, chargerVersion, partType, version+i, part, installed)
+		if err != nil || result.Status != string(UpdateStatusAccepted) {
+			return result, err
+		}
+		sent += len(part)
+	}
+
+	result.UpdateType = string(updateType)
+	result.Entries = sent
+	return result, nil
+}
+
+// splitAuthorizationData splits entries into parts of at most maxLength entries
+// There is always at least one part, so an empty Full update still clears the charger's list
+func splitAuthorizationData(entries []AuthorizationData, maxLength int) [][]AuthorizationData {
+	if maxLength <= 0 || len(entries) <= maxLength {
+		return [][]AuthorizationData{entries}
+	}
+
+	var parts [][]AuthorizationData
+	for start := 0; start < len(entries); start += maxLength {
+		end := start + maxLength
+		if end > len(entries) {
+			end = len(entries)
+		}
+		parts = append(parts, entries[start:end])
+	}
+	return parts
+}
+
+// applyLocalListChanges returns the list a charger holds after a SendLocalList part is installed
+// Entries without idTagInfo remove the tag, the others are taken from desired
+func applyLocalListChanges(installed map[string]localListEntry, changes []AuthorizationData, desired map[string]localListEntry) map[string]localListEntry {
+	list := make(map[string]localListEntry, len(installed)+len(changes))
+	for tag, entry := range installed {
+		list[tag] = entry
+	}
+	for _, change := range changes {
+		if change.IdTagInfo == nil {
+			delete(list, change.IdTag)
+			continue
+		}
+		list[change.IdTag] = desired[change.IdTag]
+	}
+	return list
+}
+
+// SyncAllLocalLists pushes the authorization list to every connected charger in the background
+// Called after the idTag list changes so blocked cards stop working offline as well
+func (s *Server) SyncAllLocalLists() {
+	s.mu.RLock()
+	chargePointIds := make([]string, 0, len(s.connections))
+	for chargePointId := range s.connections {
+		chargePointIds = append(chargePointIds, chargePointId)
+	}
+	s.mu.RUnlock()
+
+	for _, chargePointId := range chargePointIds {
+		go s.syncLocalListInBackground(chargePointId)
+	}
+}
+
+// syncLocalListInBackground runs SyncLocalList without a caller waiting on it
+func (s *Server) syncLocalListInBackground(chargePointId string) {
+	result, err := s.SyncLocalList(context.Background(), chargePointId, false)
+	if err != nil {
+		s.logger.Error("Failed to sync local authorization list",
+			zap.String("charge_point_id", chargePointId),
+			zap.Error(err))
+		return
+	}
+
+	s.logger.Info("Local authorization list synced",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("status", result.Status),
+		zap.Int("list_version", result.ListVersion))
+}
+
+// GetLocalListState returns the stored sync state of a charger
+// A charger that was never synced has version 0 and every idTag pending
+func (s *Server) GetLocalListState(ctx context.Context, chargePointId string) (*LocalListState, error) {
+	chargerID, err := s.getChargerID(ctx, chargePointId)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := s.loadLocalListState(ctx, chargerID)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		state = &LocalListState{}
+	}
+
+	desired, err := s.loadAuthorizationList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	installed, err := s.loadInstalledLocalList(ctx, chargerID)
+	if err != nil {
+		return nil, err
+	}
+
+	state.PendingChanges = len(diffLocalList(installed, desired))
+	return state, nil
+}
+
+// sendLocalList sends one SendLocalList and stores installed as the charger's list when it accepts it
+// chargerVersion is the version the charger reported before the update
+func (s *Server) sendLocalList(ctx context.Context, chargePointId string, chargerID int64, chargerVersion int, updateType UpdateType, version int, entries []AuthorizationData, installed map[string]localListEntry) (*LocalListSyncResult, error) {
+	request := &SendLocalListRequest{
+		ListVersion:            version,
+		LocalAuthorizationList: entries,
+		UpdateType:             updateType,
+	}
+
+	response, err := s.callCommand(ctx, chargePointId, SendLocalListFeatureName, request)
+	if err != nil {
+		s.saveLocalListError(ctx, chargerID, updateType, err)
+		return nil, err
+	}
+
+	confirmation := response.(*SendLocalListConfirmation)
+	s.logger.Info("SendLocalList answered by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("update_type", string(updateType)),
+		zap.Int("list_version", version),
+		zap.Int("entries", len(entries)),
+		zap.String("status", string(confirmation.Status)))
+
+	result := &LocalListSyncResult{
+		Status:         string(confirmation.Status),
+		UpdateType:     string(updateType),
+		ChargerVersion: chargerVersion,
+		Entries:        len(entries),
+	}
+
+	if confirmation.Status != UpdateStatusAccepted {
+		s.saveLocalListResult(ctx, chargerID, result, nil)
+		return result, nil
+	}
+
+	result.ListVersion = version
+
+	// Check the charger really installed the version we sent
+	result.ChargerVersion, err = s.GetLocalListVersion(ctx, chargePointId)
+	if err != nil {
+		s.logger.Warn("Failed to verify local list version",
+			zap.String("charge_point_id", chargePointId),
+			zap.Error(err))
+		result.ChargerVersion = version
+		s.saveLocalListResult(ctx, chargerID, result, installed)
+		return result, nil
+	}
+
+	if result.ChargerVersion != version {
+		s.logger.Warn("Charger reports a different local list version than we installed",
+			zap.String("charge_point_id", chargePointId),
+			zap.Int("expected", version),
+			zap.Int("reported", result.ChargerVersion))
+	}
+
+	s.saveLocalListResult(ctx, chargerID, result, installed)
+	return result, nil
+}
+
+// diffLocalList returns the entries a Differential update needs to turn installed into desired
+func diffLocalList(installed, desired map[string]localListEntry) []AuthorizationData {
+	changes := []AuthorizationData{}
+	for tag, entry := range desired {
+		if current, ok := installed[tag]; !ok || !current.equal(entry) {
+			changes = append(changes, entry.authorizationData())
+		}
+	}
+	for tag := range installed {
+		if _, ok := desired[tag]; !ok {
+			// No idTagInfo removes the idTag from the charger's list
+			changes = append(changes, AuthorizationData{IdTag: tag})
+		}
+	}
+	return changes
+}
+
+// loadAuthorizationList reads every idTag that belongs on the chargers' local lists
+func (s *Server) loadAuthorizationList(ctx context.Context) (map[string]localListEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT tag, status, expiry_date, parent_id_tag FROM id_tags`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query idTags: %w", err)
+	}
+	defer rows.Close()
+
+	return scanLocalListEntries(rows)
+}
+
+// loadInstalledLocalList reads the list we last installed on a charger
+func (s *Server) loadInstalledLocalList(ctx context.Context, chargerID int64) (map[string]localListEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT tag, status, expiry_date, parent_id_tag FROM local_list_entries WHERE charger_id = ?`, chargerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query installed local list: %w", err)
+	}
+	defer rows.Close()
+
+	return scanLocalListEntries(rows)
+}
+
+// scanLocalListEntries reads (tag, status, expiry_date, parent_id_tag) rows into a map keyed by tag
+func scanLocalListEntries(rows *sql.Rows) (map[string]localListEntry, error) {
+	entries := make(map[string]localListEntry)
+	for rows.Next() {
+		var entry localListEntry
+		if err := rows.Scan(&entry.tag, &entry.status, &entry.expiryDate, &entry.parentIdTag); err != nil {
+			return nil, fmt.Errorf("failed to scan local list entry: %w", err)
+		}
+		entries[entry.tag] = entry
+	}
+	return entries, rows.Err()
+}
+
+// loadLocalListState reads the sync state of a charger, or nil if it was never synced
+func (s *Server) loadLocalListState(ctx context.Context, chargerID int64) (*LocalListState, error) {
+	query := `
+		SELECT list_version, charger_version, update_type, last_status, last_error, synced_at, verified_at
+		FROM local_list_sync
+		WHERE charger_id = ?
+	`
+
+	var state LocalListState
+	err := s.db.QueryRowContext(ctx, query, chargerID).Scan(
+		&state.ListVersion,
+		&state.ChargerVersion,
+		&state.UpdateType,
+		&state.LastStatus,
+		&state.LastError,
+		&state.SyncedAt,
+		&state.VerifiedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query local list state: %w", err)
+	}
+	return &state, nil
+}
+
+// saveLocalListResult stores the outcome of a sync
+// installed is the list the charger now holds; nil leaves the stored list and version unchanged
+func (s *Server) saveLocalListResult(ctx context.Context, chargerID int64, result *LocalListSyncResult, installed map[string]localListEntry) {
+	if err := s.storeLocalListResult(ctx, chargerID, result, installed); err != nil {
+		s.logger.Error("Failed to store local list sync state", zap.Int64("charger_id", chargerID), zap.Error(err))
+	}
+}
+
+func (s *Server) storeLocalListResult(ctx context.Context, chargerID int64, result *LocalListSyncResult, installed map[string]localListEntry) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	var updateType *string
+	if result.UpdateType != "" {
+		updateType = &result.UpdateType
+	}
+
+	// An Accepted update moves the version forward; anything else only records what happened
+	if installed != nil {
+		query := `
+			INSERT INTO local_list_sync (charger_id, list_version, charger_version, update_type, last_status, last_error, synced_at, verified_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, NULL, ?, ?, ?)
+			ON CONFLICT(charger_id) DO UPDATE SET
+				list_version = excluded.list_version,
+				charger_version = excluded.charger_version,
+				update_type = excluded.update_type,
+				last_status = excluded.last_status,
+				last_error = NULL,
+				synced_at = excluded.synced_at,
+				verified_at = excluded.verified_at,
+				updated_at = excluded.updated_at
+		`
+		if _, err := tx.ExecContext(ctx, query, chargerID, result.ListVersion, result.ChargerVersion, updateType, result.Status, now, now, now); err != nil {
+			return fmt.Errorf("failed to update local list state: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM local_list_entries WHERE charger_id = ?`, chargerID); err != nil {
+			return fmt.Errorf("failed to clear installed local list: %w", err)
+		}
+		for _, entry := range installed {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO local_list_entries (charger_id, tag, status, expiry_date, parent_id_tag) VALUES (?, ?, ?, ?, ?)`,
+				chargerID, entry.tag, entry.status, entry.expiryDate, entry.parentIdTag)
+			if err != nil {
+				return fmt.Errorf("failed to store installed local list: %w", err)
+			}
+		}
+	} else {
+		query := `
+			INSERT INTO local_list_sync (charger_id, list_version, charger_version, update_type, last_status, last_error, verified_at, updated_at)
+			VALUES (?, 0, ?, ?, ?, NULL, ?, ?)
+			ON CONFLICT(charger_id) DO UPDATE SET
+				charger_version = excluded.charger_version,
+				update_type = excluded.update_type,
+				last_status = excluded.last_status,
+				last_error = NULL,
+				verified_at = excluded.verified_at,
+				updated_at = excluded.updated_at
+		`
+		if _, err := tx.ExecContext(ctx, query, chargerID, result.ChargerVersion, updateType, result.Status, now, now); err != nil {
+			return fmt.Errorf("failed to update local list state: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// saveLocalListError records a SendLocalList that got no answer (timeout, CALLERROR, disconnect)
+func (s *Server) saveLocalListError(ctx context.Context, chargerID int64, updateType UpdateType, callErr error) {
+	query := `
+		INSERT INTO local_list_sync (charger_id, list_version, update_type, last_status, last_error, updated_at)
+		VALUES (?, 0, ?, 'Error', ?, ?)
+		ON CONFLICT(charger_id) DO UPDATE SET
+			update_type = excluded.update_type,
+			last_status = excluded.last_status,
+			last_error = excluded.last_error,
+			updated_at = excluded.updated_at
+	`
+	// Use a fresh context so the failure is kept even if the HTTP caller went away
+	_, err := s.db.ExecContext(context.Background(), query, chargerID, string(updateType), callErr.Error(), time.Now())
+	if err != nil {
+		s.logger.Error("Failed to store local list sync error", zap.Int64("charger_id", chargerID), zap.Error(err))
+	}
+}
@@ -0,0 +1,249 @@
+package ocpp
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// MeasurandEnergyActiveImportRegister is the cumulative energy delivered by a meter
+// It is also the measurand a charger means when it leaves measurand out
+const MeasurandEnergyActiveImportRegister = "Energy.Active.Import.Register"
+
+// sampledValue is a single reading from a MeterValues request
+type sampledValue struct {
+	ConnectorId   int
+	TransactionId *int64 // transactions.id, not the OCPP transaction ID
+	Timestamp     time.Time
+	Measurand     string
+	Phase         *string
+	Unit          *string
+	Context       *string
+	Location      *string
+	Format        *string
+	Value         *float64 // Normalised to the base unit; nil for SignedData or unreadable values
+	RawValue      string   // The value exactly as the charger sent it
+}
+
+// unitScales converts prefixed units to their base unit
+var unitScales = map[string]struct {
+	unit  string
+	scale float64
+}{
+	"kWh":   {"Wh", 1000},
+	"kvarh": {"varh", 1000},
+	"kW":    {"W", 1000},
+	"kVA":   {"VA", 1000},
+	"kvar":  {"var", 1000},
+}
+
+// measurandUnits is the unit a measurand is reported in when the charger leaves unit out
+// OCPP 1.6 only defines the Wh default for energy; the others are the measurands' standard units
+var measurandUnits = []struct {
+	prefix string
+	unit   string
+}{
+	{"Energy.Active.", "Wh"},
+	{"Energy.Reactive.", "varh"},
+	{"Power.Active.", "W"},
+	{"Power.Offered", "W"},
+	{"Power.Reactive.", "var"},
+	{"Current.", "A"},
+	{"Voltage", "V"},
+	{"SoC", "Percent"},
+	{"Temperature", "Celsius"},
+}
+
+// parseSampledValue reads one sampledValue entry, applying the OCPP 1.6 defaults
+// (Energy.Active.Import.Register, Sample.Periodic, Outlet, Raw) for missing fields
+// A missing unit is the measurand's standard unit, or nil for measurands without one (e.g. Frequency)
+func parseSampledValue(sampledValueMap map[string]interface{}) sampledValue {
+	value := sampledValue{}
+
+	value.RawValue, _ = sampledValueMap["value"].(string)
+	value.Measurand, _ = sampledValueMap["measurand"].(string)
+	if value.Measurand == "" {
+		value.Measurand = MeasurandEnergyActiveImportRegister
+	}
+
+	value.Phase = optionalString(sampledValueMap, "phase")
+	value.Unit = optionalString(sampledValueMap, "unit")
+	if value.Unit == nil {
+		value.Unit = defaultUnit(value.Measurand)
+	}
+	value.Context = stringOrDefault(sampledValueMap, "context", "Sample.Periodic")
+	value.Location = stringOrDefault(sampledValueMap, "location", "Outlet")
+	value.Format = stringOrDefault(sampledValueMap, "format", "Raw")
+
+	// Signed values are opaque blobs, only raw values carry a number
+	if *value.Format != "Raw" {
+		return value
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(value.RawValue), 64)
+	if err != nil {
+		return value
+	}
+
+	if value.Unit != nil {
+		var unit string
+		number, unit = normalizeUnit(number, *value.Unit)
+		value.Unit = &unit
+	}
+	value.Value = &number
+
+	return value
+}
+
+// defaultUnit returns the standard unit of a measurand, or nil if it has none
+func defaultUnit(measurand string) *string {
+	for _, mu := range measurandUnits {
+		if strings.HasPrefix(measurand, mu.prefix) {
+			unit := mu.unit
+			return &unit
+		}
+	}
+	return nil
+}
+
+// normalizeUnit converts a reading to its base unit (kWh to Wh, kW to W, Fahrenheit and K to Celsius)
+func normalizeUnit(value float64, unit string) (float64, string) {
+	if scaled, ok := unitScales[unit]; ok {
+		return value * scaled.scale, scaled.unit
+	}
+
+	switch unit {
+	case "Fahrenheit":
+		return (value - 32) * 5 / 9, "Celsius"
+	case "K":
+		return value - 273.15, "Celsius"
+	}
+
+	return value, unit
+}
+
+// parseMeterValues collects every sampled value of every meterValue entry of a MeterValues or
+// StopTransaction request, stamped with the charger's timestamp rather than the time we received it
+func (s *Server) parseMeterValues(meterValues []interface{}, connectorId int, transactionRowID *int64) []sampledValue {
+	var values []sampledValue
+	for _, mv := range meterValues {
+		meterValue, ok := mv.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		timestampStr, _ := meterValue["timestamp"].(string)
+		timestamp, err := time.Parse(time.RFC3339, timestampStr)
+		if err != nil {
+			s.logger.Error("Invalid timestamp in meter values", zap.Error(err))
+			continue
+		}
+
+		// Get the sampled values (the actual readings)
+		sampledValues, ok := meterValue["sampledValue"].([]interface{})
+		if !ok {
+			continue
+		}
+
+		for _, sv := range sampledValues {
+			sampledValueMap, ok := sv.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			value := parseSampledValue(sampledValueMap)
+			value.ConnectorId = connectorId
+			value.TransactionId = transactionRowID
+			value.Timestamp = timestamp.UTC()
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// recordTransactionData stores the transactionData of a StopTransaction request, linked to the
+// session's transactions row and connector
+func (s *Server) recordTransactionData(chargePointId string, txID int, transactionData []interface{}) {
+	ctx := context.Background()
+
+	var transactionRowID int64
+	var chargerID int64
+	var connectorId sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT t.id, t.charger_id, t.connector_id
+		FROM transactions t
+		JOIN chargers c ON c.id = t.charger_id
+		WHERE c.identity = ? AND t.tx_id = ?
+	`, chargePointId, fmt.Sprint(txID)).Scan(&transactionRowID, &chargerID, &connectorId)
+	if err != nil {
+		s.logger.Warn("Transaction data for unknown transaction",
+			zap.String("charge_point_id", chargePointId),
+			zap.Int("transaction_id", txID),
+			zap.Error(err))
+		return
+	}
+
+	values := s.parseMeterValues(transactionData, int(connectorId.Int64), &transactionRowID)
+	if err := s.recordMeterValues(ctx, chargerID, values); err != nil {
+		s.logger.Error("Failed to store transaction data", zap.String("charge_point_id", chargePointId), zap.Error(err))
+	}
+}
+
+// recordMeterValues stores sampled values in meter_values
+func (s *Server) recordMeterValues(ctx context.Context, chargerID int64, values []sampledValue) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO meter_values (charger_id, connector_id, transaction_id, ts, measurand, phase, unit, context, location, format, value, raw_value)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	for _, value := range values {
+		_, err := tx.ExecContext(ctx, query,
+			chargerID,
+			value.ConnectorId,
+			value.TransactionId,
+			value.Timestamp,
+			value.Measurand,
+			value.Phase,
+			value.Unit,
+			value.Context,
+			value.Location,
+			value.Format,
+			value.Value,
+			value.RawValue,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert meter value: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// findTransactionRowID resolves an OCPP transaction ID to the transactions row of a charger
+func (s *Server) findTransactionRowID(ctx context.Context, chargerID int64, txID int) (*int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, `SELECT id FROM transactions WHERE charger_id = ? AND tx_id = ?`, chargerID, fmt.Sprint(txID)).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// stringOrDefault returns a pointer to a string field of a payload, or to def if it is missing or empty
+func stringOrDefault(payloadMap map[string]interface{}, key, def string) *string {
+	if value := optionalString(payloadMap, key); value != nil {
+		return value
+	}
+	return &def
+}
@@ -0,0 +1,193 @@
+package ocpp
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// OCPP versions, named by their WebSocket subprotocol
+const (
+	ProtocolOCPP16  = "ocpp1.6"
+	ProtocolOCPP201 = "ocpp2.0.1"
+)
+
+// CALLERROR codes of OCPP 2.0.1 that differ from 1.6 (FormationViolation and the misspelt
+// OccurenceConstraintViolation were renamed); the others keep their 1.6 names
+const (
+	ErrorCodeFormatViolation               = "FormatViolation"
+	ErrorCodeOccurrenceConstraintViolation = "OccurrenceConstraintViolation"
+)
+
+// ocpp201Requests are the actions an OCPP 2.0.1 charging station can send to the CSMS
+// Those without a handler are answered NotSupported, anything else NotImplemented
+var ocpp201Requests = map[string]bool{
+	"Authorize":                         true,
+	"BootNotification":                  true,
+	"ClearedChargingLimit":              true,
+	"DataTransfer":                      true,
+	"FirmwareStatusNotification":        true,
+	"Get15118EVCertificate":             true,
+	"GetCertificateStatus":              true,
+	"Heartbeat":                         true,
+	"LogStatusNotification":             true,
+	"MeterValues":                       true,
+	"NotifyChargingLimit":               true,
+	"NotifyCustomerInformation":         true,
+	"NotifyDisplayMessages":             true,
+	"NotifyEVChargingNeeds":             true,
+	"NotifyEVChargingSchedule":          true,
+	"NotifyEvent":                       true,
+	"NotifyMonitoringReport":            true,
+	"NotifyReport":                      true,
+	"PublishFirmwareStatusNotification": true,
+	"ReportChargingProfiles":            true,
+	"ReservationStatusUpdate":           true,
+	"SecurityEventNotification":         true,
+	"SignCertificate":                   true,
+	"StatusNotification":                true,
+	"TransactionEvent":                  true,
+}
+
+// ocpp201RequiredFields are the top-level fields the 2.0.1 schemas require for the requests we handle
+// There are no 2.0.1 schemas to validate against, so this is the check before a handler reads the payload
+var ocpp201RequiredFields = map[string][]string{
+	"Authorize":          {"idToken"},
+	"BootNotification":   {"chargingStation", "reason"},
+	"Heartbeat":          {},
+	"MeterValues":        {"evseId", "meterValue"},
+	"NotifyReport":       {"requestId", "generatedAt", "seqNo"},
+	"StatusNotification": {"timestamp", "connectorStatus", "evseId", "connectorId"},
+	"TransactionEvent":   {"eventType", "timestamp", "triggerReason", "seqNo", "transactionInfo"},
+}
+
+// preferredProtocols orders an endpoint's versions for subprotocol negotiation, newest first
+func preferredProtocols(protocols []string) []string {
+	ordered := make([]string, 0, len(protocols))
+	for _, protocol := range protocols {
+		if protocol == ProtocolOCPP201 {
+			ordered = append(ordered, protocol)
+		}
+	}
+	for _, protocol := range protocols {
+		if protocol != ProtocolOCPP201 {
+			ordered = append(ordered, protocol)
+		}
+	}
+	return ordered
+}
+
+// processOCPP201Message handles a frame from a charger connected with OCPP 2.0.1
+// The RPC framing is the same as in 1.6; only the error codes and the messages differ
+func (s *Server) processOCPP201Message(chargePointId string, message []byte) ([]byte, error) {
+	s.logger.Debug("Processing OCPP 2.0.1 message from charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("message", string(message)))
+
+	var ocppMessage []json.RawMessage
+	if err := json.Unmarshal(message, &ocppMessage); err != nil {
+		return nil, err
+	}
+	if len(ocppMessage) < 3 {
+		return nil, fmt.Errorf("invalid OCPP message format")
+	}
+
+	var messageType int
+	if err := json.Unmarshal(ocppMessage[0], &messageType); err != nil {
+		return nil, fmt.Errorf("invalid message type")
+	}
+
+	var messageId string
+	if err := json.Unmarshal(ocppMessage[1], &messageId); err != nil {
+		return nil, fmt.Errorf("invalid message ID")
+	}
+
+	switch messageType {
+	case 2: // CALL: [2, messageId, action, payload]
+		if len(ocppMessage) != 4 {
+			return callErrorFrame(messageId, ErrorCodeFormatViolation, "A CALL must have 4 elements", nil)
+		}
+		var action string
+		if err := json.Unmarshal(ocppMessage[2], &action); err != nil {
+			return callErrorFrame(messageId, ErrorCodeFormatViolation, "The action must be a string", nil)
+		}
+		var payload map[string]interface{}
+		if err := json.Unmarshal(ocppMessage[3], &payload); err != nil || payload == nil {
+			return callErrorFrame(messageId, ErrorCodeFormatViolation, "The payload must be an object", nil)
+		}
+		return s.handleOCPP201Request(chargePointId, messageId, action, payload)
+	case 3: // CALLRESULT: [3, messageId, payload]
+		s.handleCallResult(chargePointId, messageId, ocppMessage[2])
+		return nil, nil
+	case 4: // CALLERROR: [4, messageId, errorCode, errorDescription, errorDetails]
+		if len(ocppMessage) < 4 {
+			return nil, fmt.Errorf("invalid CALLERROR format")
+		}
+		var errorCode, errorDescription string
+		if err := json.Unmarshal(ocppMessage[2], &errorCode); err != nil {
+			return nil, fmt.Errorf("invalid error code")
+		}
+		_ = json.Unmarshal(ocppMessage[3], &errorDescription)
+		var errorDetails json.RawMessage
+		if len(ocppMessage) > 4 {
+			errorDetails = ocppMessage[4]
+		}
+		s.handleCallError(chargePointId, messageId, errorCode, errorDescription, errorDetails)
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown message type: %d", messageType)
+	}
+}
+
+// handleOCPP201Request routes a 2.0.1 request to its handler
+// The handlers store what the charger reports in the same tables as 1.6, so the rest of the
+// application does not need to know which version a charger speaks
+func (s *Server) handleOCPP201Request(chargePointId, messageId, action string, payload map[string]interface{}) ([]byte, error) {
+	s.logger.Info("Charger is requesting something",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("protocol", ProtocolOCPP201),
+		zap.String("action", action),
+		zap.String("message_id", messageId))
+
+	if !ocpp201Requests[action] {
+		s.logger.Info("Unknown request type from charger", zap.String("action", action))
+		return callErrorFrame(messageId, ErrorCodeNotImplemented, "Action not implemented", nil)
+	}
+
+	required, handled := ocpp201RequiredFields[action]
+	if !handled {
+		s.logger.Info("Unsupported request type from charger", zap.String("action", action))
+		return callErrorFrame(messageId, ErrorCodeNotSupported, "Action not supported", nil)
+	}
+	for _, field := range required {
+		if _, ok := payload[field]; !ok {
+			s.logger.Warn("Rejected OCPP 2.0.1 request with a missing field",
+				zap.String("charge_point_id", chargePointId),
+				zap.String("action", action),
+				zap.String("field", field))
+			return callErrorFrame(messageId, ErrorCodeOccurrenceConstraintViolation, "Missing required property "+field, nil)
+		}
+	}
+
+	var response interface{}
+	switch action {
+	case "BootNotification":
+		response = s.handleBootNotification201(chargePointId, payload)
+	case "StatusNotification":
+		response = s.handleStatusNotification201(chargePointId, payload)
+	case "TransactionEvent":
+		response = s.handleTransactionEvent201(chargePointId, payload)
+	case "MeterValues":
+		response = s.handleMeterValues201(chargePointId, payload)
+	case "Authorize":
+		response = s.handleAuthorize201(chargePointId, payload)
+	case "NotifyReport":
+		response = s.handleNotifyReport201(chargePointId, payload)
+	case "Heartbeat":
+		// Same request and response as in 1.6
+		response = s.handleHeartbeatRequest(chargePointId, payload)
+	}
+
+	return json.Marshal([]interface{}{3, messageId, response})
+}
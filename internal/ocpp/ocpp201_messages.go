@@ -0,0 +1,619 @@
+package ocpp
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"go.uber.org/zap"
+)
+
+// connectorStatuses201 maps the 2.0.1 connectorStatus onto the 1.6 statuses the dashboard shows
+// Occupied becomes Preparing until TransactionEvent reports what the EV is doing
+var connectorStatuses201 = map[string]string{
+	"Available":   "Available",
+	"Occupied":    "Preparing",
+	"Reserved":    "Reserved",
+	"Unavailable": "Unavailable",
+	"Faulted":     "Faulted",
+}
+
+// transaction201 is the transactions row an OCPP 2.0.1 transactionId belongs to
+type transaction201 struct {
+	rowID       int64
+	txID        int // Our transaction number (tx_id)
+	connectorID int
+	idTag       string
+	stopped     bool
+}
+
+// handleBootNotification201 registers a 2.0.1 charging station
+// The station details are nested in chargingStation, unlike the flat 1.6 fields
+func (s *Server) handleBootNotification201(chargePointId string, payload map[string]interface{}) interface{} {
+	station, _ := payload["chargingStation"].(map[string]interface{})
+	model, _ := station["model"].(string)
+	vendor, _ := station["vendorName"].(string)
+	firmwareVersion, _ := station["firmwareVersion"].(string)
+	reason, _ := payload["reason"].(string)
+
+	s.logger.Info("Charging station booted up",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("protocol", ProtocolOCPP201),
+		zap.String("reason", reason))
+
+	status := "Accepted"
+	if err := s.registerCharger(context.Background(), chargePointId, model, vendor, firmwareVersion, ProtocolOCPP201); err != nil {
+		s.logger.Error("Failed to register charger", zap.Error(err))
+		status = "Rejected"
+	} else {
+		s.events.Publish(EventBoot, chargePointId, map[string]interface{}{
+			"model":    model,
+			"vendor":   vendor,
+			"firmware": firmwareVersion,
+			"protocol": ProtocolOCPP201,
+		})
+	}
+
+	// All three fields are required in 2.0.1, even when the station is rejected
+	return map[string]interface{}{
+		"currentTime": time.Now().Format(time.RFC3339),
+		"interval":    300,
+		"status":      status,
+	}
+}
+
+// handleStatusNotification201 records the status of a connector
+// EVSEs are stored as connectors numbered by evseId, which matches the usual one connector per EVSE
+func (s *Server) handleStatusNotification201(chargePointId string, payload map[string]interface{}) interface{} {
+	s.touchCharger(chargePointId)
+
+	evseId, _ := payload["evseId"].(float64)
+	reported, _ := payload["connectorStatus"].(string)
+
+	status := connectorStatus{
+		ConnectorId: int(evseId),
+		Status:      reported,
+		ErrorCode:   "NoError",
+	}
+	if mapped, ok := connectorStatuses201[reported]; ok {
+		status.Status = mapped
+	}
+	if status.Status == "Faulted" {
+		// 2.0.1 reports the cause with NotifyEvent instead
+		status.ErrorCode = "OtherError"
+	}
+	timestamp := parseTransactionTimestamp(payload)
+	status.Timestamp = &timestamp
+
+	s.logger.Info("Status notification details",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("connector_status", reported),
+		zap.String("status", status.Status),
+		zap.Int("evse_id", status.ConnectorId))
+
+	if err := s.recordConnectorStatus(context.Background(), chargePointId, status); err != nil {
+		s.logger.Error("Failed to record connector status", zap.Error(err))
+	}
+	s.events.Publish(EventStatusChange, chargePointId, status)
+
+	return map[string]interface{}{}
+}
+
+// handleTransactionEvent201 records the start, progress and end of a transaction
+// The charger names the transaction; the row gets our own tx_id like a 1.6 transaction, so sessions,
+// pricing, receipts and exports treat it the same. The first event seen for a transactionId starts
+// the row even if it is not Started, so a lost Started does not lose the session
+func (s *Server) handleTransactionEvent201(chargePointId string, payload map[string]interface{}) interface{} {
+	ctx := context.Background()
+	s.touchCharger(chargePointId)
+
+	eventType, _ := payload["eventType"].(string)
+	info, _ := payload["transactionInfo"].(map[string]interface{})
+	ocppTransactionId, _ := info["transactionId"].(string)
+	chargingState, _ := info["chargingState"].(string)
+	timestamp := parseTransactionTimestamp(payload)
+	idTag := idTokenValue(payload["idToken"])
+
+	s.logger.Info("Transaction event received",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("event_type", eventType),
+		zap.String("transaction_id", ocppTransactionId),
+		zap.String("charging_state", chargingState))
+
+	chargerID, err := s.getChargerID(ctx, chargePointId)
+	if err != nil {
+		s.logger.Error("Charger not found in database", zap.Error(err))
+		return map[string]interface{}{}
+	}
+
+	meterValues, _ := payload["meterValue"].([]interface{})
+	values := parseMeterValues201(meterValues)
+
+	transaction, err := s.findTransaction201(ctx, chargerID, ocppTransactionId)
+	if err == sql.ErrNoRows {
+		transaction, err = s.startTransaction201(ctx, chargePointId, chargerID, ocppTransactionId, payload, values)
+	} else if err == nil && idTag != "" && transaction.idTag == "" {
+		// A transaction can start on plug-in and be authorized later
+		_, err = s.db.ExecContext(ctx, `UPDATE transactions SET id_tag = ? WHERE id = ?`, idTag, transaction.rowID)
+		transaction.idTag = idTag
+	}
+	if err != nil {
+		s.logger.Error("Failed to record transaction event",
+			zap.String("charge_point_id", chargePointId),
+			zap.String("transaction_id", ocppTransactionId),
+			zap.Error(err))
+		return map[string]interface{}{}
+	}
+
+	for i := range values {
+		values[i].ConnectorId = transaction.connectorID
+		values[i].TransactionId = &transaction.rowID
+	}
+	s.storeMeterValues201(ctx, chargePointId, chargerID, &transaction.txID, values)
+
+	if eventType == "Ended" && !transaction.stopped {
+		s.stopTransaction201(ctx, chargePointId, transaction, timestamp, values)
+	}
+
+	if status := chargingStateStatus(eventType, chargingState); status != "" {
+		connector := connectorStatus{
+			ConnectorId: transaction.connectorID,
+			Status:      status,
+			ErrorCode:   "NoError",
+			Timestamp:   &timestamp,
+		}
+		if err := s.recordConnectorStatus(ctx, chargePointId, connector); err != nil {
+			s.logger.Error("Failed to record connector status", zap.Error(err))
+		}
+		s.events.Publish(EventStatusChange, chargePointId, connector)
+	}
+
+	// idTokenInfo is only returned when the event carries an idToken
+	if idTag == "" {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"idTokenInfo": idTokenInfo201(s.authorizeIdTag(ctx, idTag, &tagLocation{
+			ChargePointId: chargePointId,
+			ConnectorId:   transaction.connectorID,
+		})),
+	}
+}
+
+// startTransaction201 records a new 2.0.1 transaction
+// The meter start is the Transaction.Begin reading, any energy reading in the event, or the
+// charger's last register reading when the event carries none
+func (s *Server) startTransaction201(ctx context.Context, chargePointId string, chargerID int64, ocppTransactionId string, payload map[string]interface{}, values []sampledValue) (*transaction201, error) {
+	start := transactionStart{
+		ConnectorId: 1, // The evse is only optional on later events
+		IdTag:       idTokenValue(payload["idToken"]),
+		Timestamp:   parseTransactionTimestamp(payload),
+	}
+	if evse, ok := payload["evse"].(map[string]interface{}); ok {
+		if id, ok := evse["id"].(float64); ok {
+			start.ConnectorId = int(id)
+		}
+	}
+
+	if reading := energyRegister(values, "Transaction.Begin"); reading != nil {
+		start.MeterStart = int64(*reading)
+	} else if reading := energyRegister(values, ""); reading != nil {
+		start.MeterStart = int64(*reading)
+	} else {
+		var total sql.NullInt64
+		if err := s.db.QueryRowContext(ctx, `SELECT total_energy_wh FROM chargers WHERE id = ?`, chargerID).Scan(&total); err != nil {
+			return nil, err
+		}
+		start.MeterStart = total.Int64
+	}
+
+	txID, err := s.insertTransaction(ctx, chargerID, start)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.db.ExecContext(ctx, `UPDATE transactions SET ocpp_transaction_id = ? WHERE tx_id = ?`, ocppTransactionId, fmt.Sprint(txID)); err != nil {
+		return nil, fmt.Errorf("failed to store the charger's transaction ID: %w", err)
+	}
+
+	s.logger.Info("Charging session recorded",
+		zap.String("charge_point_id", chargePointId),
+		zap.Int("transaction_id", txID),
+		zap.String("ocpp_transaction_id", ocppTransactionId),
+		zap.Int("connector_id", start.ConnectorId),
+		zap.String("id_tag", start.IdTag),
+		zap.Int64("start_meter_wh", start.MeterStart))
+
+	s.events.Publish(EventTransactionStart, chargePointId, map[string]interface{}{
+		"transaction_id":      txID,
+		"ocpp_transaction_id": ocppTransactionId,
+		"connector_id":        start.ConnectorId,
+		"id_tag":              start.IdTag,
+		"meter_start_wh":      start.MeterStart,
+	})
+
+	return s.findTransaction201(ctx, chargerID, ocppTransactionId)
+}
+
+// stopTransaction201 closes a 2.0.1 transaction
+// The meter stop is the Transaction.End reading, any energy reading in the event, or the last
+// reading stored for the transaction
+func (s *Server) stopTransaction201(ctx context.Context, chargePointId string, transaction *transaction201, stopTs time.Time, values []sampledValue) {
+	var meterStop *float64
+	if reading := energyRegister(values, "Transaction.End"); reading != nil {
+		meterStop = reading
+	} else if reading := energyRegister(values, ""); reading != nil {
+		meterStop = reading
+	} else {
+		var last float64
+		err := s.db.QueryRowContext(ctx, `
+			SELECT value FROM meter_values
+			WHERE transaction_id = ? AND measurand = ? AND phase IS NULL AND value IS NOT NULL
+			ORDER BY ts DESC
+			LIMIT 1
+		`, transaction.rowID, MeasurandEnergyActiveImportRegister).Scan(&last)
+		if err == nil {
+			meterStop = &last
+		} else if err != sql.ErrNoRows {
+			s.logger.Error("Failed to look up the last meter reading", zap.Error(err))
+		}
+	}
+
+	// Without any reading the session is closed with no energy
+	query := `
+		UPDATE transactions
+		SET stop_ts = ?, stop_meter_wh = COALESCE(?, start_meter_wh), energy_wh = MAX(0, COALESCE(?, start_meter_wh) - start_meter_wh)
+		WHERE id = ? AND stop_ts IS NULL
+	`
+	var stopWh *int64
+	if meterStop != nil {
+		wh := int64(*meterStop)
+		stopWh = &wh
+	}
+	if _, err := s.db.ExecContext(ctx, query, stopTs, stopWh, stopWh, transaction.rowID); err != nil {
+		s.logger.Error("Failed to update charging session", zap.Error(err))
+		return
+	}
+
+	s.logger.Info("Charging session completed",
+		zap.String("charge_point_id", chargePointId),
+		zap.Int("transaction_id", transaction.txID))
+
+	event := map[string]interface{}{"transaction_id": transaction.txID}
+	if stopWh != nil {
+		event["meter_stop_wh"] = *stopWh
+	}
+	s.events.Publish(EventTransactionStop, chargePointId, event)
+
+	// The session is complete, so its cost can be calculated
+	go s.priceStoppedTransaction(chargePointId, transaction.txID)
+}
+
+// findTransaction201 looks up the row of a charger's 2.0.1 transactionId
+func (s *Server) findTransaction201(ctx context.Context, chargerID int64, ocppTransactionId string) (*transaction201, error) {
+	var transaction transaction201
+	var txID string
+	var connectorID sql.NullInt64
+	var idTag sql.NullString
+	var stopTs sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, tx_id, connector_id, id_tag, stop_ts FROM transactions
+		WHERE charger_id = ? AND ocpp_transaction_id = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`, chargerID, ocppTransactionId).Scan(&transaction.rowID, &txID, &connectorID, &idTag, &stopTs)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction.txID, err = strconv.Atoi(txID)
+	if err != nil {
+		return nil, fmt.Errorf("transaction %d has a non-numeric tx_id %q", transaction.rowID, txID)
+	}
+	transaction.connectorID = int(connectorID.Int64)
+	transaction.idTag = idTag.String
+	transaction.stopped = stopTs.Valid
+	return &transaction, nil
+}
+
+// handleMeterValues201 stores readings sent outside a transaction
+func (s *Server) handleMeterValues201(chargePointId string, payload map[string]interface{}) interface{} {
+	ctx := context.Background()
+	s.touchCharger(chargePointId)
+
+	chargerID, err := s.getChargerID(ctx, chargePointId)
+	if err != nil {
+		s.logger.Error("Charger not found in database", zap.Error(err))
+		return map[string]interface{}{}
+	}
+
+	evseId, _ := payload["evseId"].(float64)
+	meterValues, _ := payload["meterValue"].([]interface{})
+	values := parseMeterValues201(meterValues)
+	for i := range values {
+		values[i].ConnectorId = int(evseId)
+	}
+	s.storeMeterValues201(ctx, chargePointId, chargerID, nil, values)
+
+	s.logger.Info("Meter values stored",
+		zap.String("charge_point_id", chargePointId),
+		zap.Int("evse_id", int(evseId)),
+		zap.Int("samples", len(values)))
+
+	return map[string]interface{}{}
+}
+
+// handleAuthorize201 checks an idToken against the id_tags table like a 1.6 idTag
+func (s *Server) handleAuthorize201(chargePointId string, payload map[string]interface{}) interface{} {
+	idTag := idTokenValue(payload["idToken"])
+	info := s.authorizeIdTag(context.Background(), idTag, &tagLocation{ChargePointId: chargePointId})
+
+	s.logger.Info("RFID card authorization result",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("id_tag", idTag),
+		zap.String("status", string(info.Status)))
+
+	return map[string]interface{}{
+		"idTokenInfo": idTokenInfo201(info),
+	}
+}
+
+// handleNotifyReport201 stores the variables of a device model report as configuration keys
+// A key is Component[instance]@evse.connector/Variable[instance], with :type for attributes other
+// than Actual, so the configuration page shows 2.0.1 variables next to 1.6 keys
+func (s *Server) handleNotifyReport201(chargePointId string, payload map[string]interface{}) interface{} {
+	ctx := context.Background()
+
+	reportData, _ := payload["reportData"].([]interface{})
+	requestId, _ := payload["requestId"].(float64)
+	seqNo, _ := payload["seqNo"].(float64)
+
+	chargerID, err := s.getChargerID(ctx, chargePointId)
+	if err != nil {
+		s.logger.Error("Charger not found in database", zap.Error(err))
+		return map[string]interface{}{}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.Error("Failed to begin transaction", zap.Error(err))
+		return map[string]interface{}{}
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO charger_configuration (charger_id, key, value, readonly, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(charger_id, key) DO UPDATE SET
+			value = excluded.value,
+			readonly = excluded.readonly,
+			updated_at = excluded.updated_at
+	`
+
+	now := time.Now()
+	stored := 0
+	for _, entry := range reportData {
+		data, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name := reportVariableName(data)
+		attributes, _ := data["variableAttribute"].([]interface{})
+		for _, a := range attributes {
+			attribute, ok := a.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			key := name
+			if attributeType, _ := attribute["type"].(string); attributeType != "" && attributeType != "Actual" {
+				key += ":" + attributeType
+			}
+			value := optionalString(attribute, "value")
+			mutability, _ := attribute["mutability"].(string)
+
+			if _, err := tx.ExecContext(ctx, query, chargerID, key, value, mutability == "ReadOnly", now); err != nil {
+				s.logger.Error("Failed to store reported variable", zap.String("key", key), zap.Error(err))
+				return map[string]interface{}{}
+			}
+			stored++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("Failed to commit reported variables", zap.Error(err))
+		return map[string]interface{}{}
+	}
+
+	s.logger.Info("Device model report stored",
+		zap.String("charge_point_id", chargePointId),
+		zap.Int("request_id", int(requestId)),
+		zap.Int("seq_no", int(seqNo)),
+		zap.Int("variables", stored))
+
+	return map[string]interface{}{}
+}
+
+// storeMeterValues201 stores readings and updates the charger's energy total like 1.6 MeterValues
+func (s *Server) storeMeterValues201(ctx context.Context, chargePointId string, chargerID int64, txID *int, values []sampledValue) {
+	if len(values) == 0 {
+		return
+	}
+
+	if err := s.recordMeterValues(ctx, chargerID, values); err != nil {
+		s.logger.Error("Failed to store meter values", zap.Error(err))
+	}
+
+	for _, value := range values {
+		event := map[string]interface{}{
+			"connector_id": value.ConnectorId,
+			"measurand":    value.Measurand,
+			"phase":        value.Phase,
+			"unit":         value.Unit,
+			"value":        value.Value,
+			"timestamp":    value.Timestamp,
+		}
+		if txID != nil {
+			event["transaction_id"] = *txID
+		}
+
+		// The charger-wide energy register (no phase) is the total energy delivered since installation
+		if value.Measurand == MeasurandEnergyActiveImportRegister && value.Phase == nil && value.Value != nil {
+			event["value_wh"] = *value.Value
+			if _, err := s.db.ExecContext(ctx, `UPDATE chargers SET total_energy_wh = ? WHERE id = ?`, int64(*value.Value), chargerID); err != nil {
+				s.logger.Error("Failed to update energy reading", zap.Error(err))
+			}
+		}
+
+		s.events.Publish(EventMeterSample, chargePointId, event)
+	}
+}
+
+// parseMeterValues201 reads 2.0.1 meterValue entries into the 1.6 sampled value form
+// 2.0.1 sends numbers with a unitOfMeasure and a power of ten multiplier instead of strings with a unit
+func parseMeterValues201(meterValues []interface{}) []sampledValue {
+	var values []sampledValue
+	for _, mv := range meterValues {
+		meterValue, ok := mv.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		timestampStr, _ := meterValue["timestamp"].(string)
+		timestamp, err := time.Parse(time.RFC3339, timestampStr)
+		if err != nil {
+			continue
+		}
+
+		sampledValues, _ := meterValue["sampledValue"].([]interface{})
+		for _, sv := range sampledValues {
+			sampled, ok := sv.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			number, ok := sampled["value"].(float64)
+			if !ok {
+				continue
+			}
+
+			converted := map[string]interface{}{}
+			for _, field := range []string{"measurand", "phase", "context", "location"} {
+				if v, ok := sampled[field].(string); ok {
+					converted[field] = v
+				}
+			}
+			if unitOfMeasure, ok := sampled["unitOfMeasure"].(map[string]interface{}); ok {
+				if unit, ok := unitOfMeasure["unit"].(string); ok {
+					converted["unit"] = unit
+				}
+				if multiplier, ok := unitOfMeasure["multiplier"].(float64); ok {
+					number *= math.Pow10(int(multiplier))
+				}
+			}
+			converted["value"] = strconv.FormatFloat(number, 'f', -1, 64)
+
+			value := parseSampledValue(converted)
+			value.RawValue = strconv.FormatFloat(sampled["value"].(float64), 'f', -1, 64)
+			value.Timestamp = timestamp.UTC()
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// energyRegister returns the last charger-wide energy register reading with the given context
+// An empty context matches any reading
+func energyRegister(values []sampledValue, readingContext string) *float64 {
+	var reading *float64
+	for _, value := range values {
+		if value.Measurand != MeasurandEnergyActiveImportRegister || value.Phase != nil || value.Value == nil {
+			continue
+		}
+		if readingContext != "" && (value.Context == nil || *value.Context != readingContext) {
+			continue
+		}
+		reading = value.Value
+	}
+	return reading
+}
+
+// chargingStateStatus maps a TransactionEvent chargingState onto a 1.6 connector status
+// It returns "" when the event does not change what the dashboard shows
+func chargingStateStatus(eventType, chargingState string) string {
+	switch chargingState {
+	case "Charging", "SuspendedEV", "SuspendedEVSE":
+		if eventType != "Ended" {
+			return chargingState
+		}
+	case "EVConnected":
+		if eventType == "Ended" {
+			return "Finishing"
+		}
+		return "Preparing"
+	}
+	return ""
+}
+
+// idTokenValue returns the token of a 2.0.1 IdTokenType, or "" if there is none
+func idTokenValue(idToken interface{}) string {
+	token, _ := idToken.(map[string]interface{})
+	value, _ := token["idToken"].(string)
+	return value
+}
+
+// idTokenInfo201 converts the 1.6 idTagInfo our authorization produces into a 2.0.1 IdTokenInfoType
+// The statuses are the same; a parent idTag becomes the group token
+func idTokenInfo201(info *types.IdTagInfo) map[string]interface{} {
+	result := map[string]interface{}{
+		"status": string(info.Status),
+	}
+	if info.ExpiryDate != nil {
+		result["cacheExpiryDateTime"] = info.ExpiryDate.Time.UTC().Format(time.RFC3339)
+	}
+	if info.ParentIdTag != "" {
+		result["groupIdToken"] = map[string]interface{}{
+			"idToken": info.ParentIdTag,
+			"type":    "Central",
+		}
+	}
+	return result
+}
+
+// reportVariableName builds the configuration key of a NotifyReport entry
+func reportVariableName(data map[string]interface{}) string {
+	component, _ := data["component"].(map[string]interface{})
+	variable, _ := data["variable"].(map[string]interface{})
+
+	var name strings.Builder
+	componentName, _ := component["name"].(string)
+	name.WriteString(componentName)
+	if instance, ok := component["instance"].(string); ok {
+		name.WriteString("[" + instance + "]")
+	}
+	if evse, ok := component["evse"].(map[string]interface{}); ok {
+		id, _ := evse["id"].(float64)
+		name.WriteString(fmt.Sprintf("@%d", int(id)))
+		if connectorId, ok := evse["connectorId"].(float64); ok {
+			name.WriteString(fmt.Sprintf(".%d", int(connectorId)))
+		}
+	}
+
+	variableName, _ := variable["name"].(string)
+	name.WriteString("/" + variableName)
+	if instance, ok := variable["instance"].(string); ok {
+		name.WriteString("[" + instance + "]")
+	}
+	return name.String()
+}
+
+// touchCharger updates when we last heard from a charger
+func (s *Server) touchCharger(chargePointId string) {
+	_, err := s.db.ExecContext(context.Background(), `UPDATE chargers SET last_seen = ? WHERE identity = ?`, time.Now(), chargePointId)
+	if err != nil {
+		s.logger.Error("Failed to update charger last seen time", zap.Error(err))
+	}
+}
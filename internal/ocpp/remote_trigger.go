@@ -0,0 +1,70 @@
+package ocpp
+
+import (
+	"reflect"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+)
+
+// The vendored ocpp-go only ships the Core profile, so the messages of the other
+// OCPP 1.6 profiles (RemoteTrigger here, LocalAuthListManagement, SmartCharging, ...)
+// are defined in this package following the same Feature layout
+
+// -------------------- Trigger Message (CS -> CP) --------------------
+
+const TriggerMessageFeatureName = "TriggerMessage"
+
+// MessageTrigger is the message the Central System asks the charger to send
+type MessageTrigger string
+
+// TriggerMessageStatus is the charger's answer to a TriggerMessageRequest
+type TriggerMessageStatus string
+
+const (
+	MessageTriggerBootNotification              MessageTrigger       = "BootNotification"
+	MessageTriggerDiagnosticsStatusNotification MessageTrigger       = "DiagnosticsStatusNotification"
+	MessageTriggerFirmwareStatusNotification    MessageTrigger       = "FirmwareStatusNotification"
+	MessageTriggerHeartbeat                     MessageTrigger       = "Heartbeat"
+	MessageTriggerMeterValues                   MessageTrigger       = "MeterValues"
+	MessageTriggerStatusNotification            MessageTrigger       = "StatusNotification"
+	TriggerMessageStatusAccepted                TriggerMessageStatus = "Accepted"
+	TriggerMessageStatusRejected                TriggerMessageStatus = "Rejected"
+	TriggerMessageStatusNotImplemented          TriggerMessageStatus = "NotImplemented"
+)
+
+// TriggerMessageRequest is sent by the Central System to request a message from the charger
+type TriggerMessageRequest struct {
+	RequestedMessage MessageTrigger `json:"requestedMessage"`
+	ConnectorId      *int           `json:"connectorId,omitempty"`
+}
+
+// TriggerMessageConfirmation is the charger's reply to a TriggerMessageRequest
+type TriggerMessageConfirmation struct {
+	Status TriggerMessageStatus `json:"status"`
+}
+
+// TriggerMessageFeature describes the TriggerMessage request/confirmation pair
+type TriggerMessageFeature struct{}
+
+func (f TriggerMessageFeature) GetFeatureName() string {
+	return TriggerMessageFeatureName
+}
+
+func (f TriggerMessageFeature) GetRequestType() reflect.Type {
+	return reflect.TypeOf(TriggerMessageRequest{})
+}
+
+func (f TriggerMessageFeature) GetResponseType() reflect.Type {
+	return reflect.TypeOf(TriggerMessageConfirmation{})
+}
+
+func (r TriggerMessageRequest) GetFeatureName() string {
+	return TriggerMessageFeatureName
+}
+
+func (c TriggerMessageConfirmation) GetFeatureName() string {
+	return TriggerMessageFeatureName
+}
+
+// RemoteTriggerProfile groups the messages of the OCPP 1.6 RemoteTrigger profile
+var RemoteTriggerProfile = ocpp.NewProfile("RemoteTrigger", TriggerMessageFeature{})
@@ -0,0 +1,109 @@
+package ocpp
+
+import (
+	"reflect"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+)
+
+// -------------------- Reserve Now (CS -> CP) --------------------
+
+const ReserveNowFeatureName = "ReserveNow"
+
+// ReservationStatus is the charger's answer to a ReserveNowRequest
+type ReservationStatus string
+
+const (
+	ReservationStatusAccepted    ReservationStatus = "Accepted"
+	ReservationStatusFaulted     ReservationStatus = "Faulted"
+	ReservationStatusOccupied    ReservationStatus = "Occupied"
+	ReservationStatusRejected    ReservationStatus = "Rejected"
+	ReservationStatusUnavailable ReservationStatus = "Unavailable"
+)
+
+// ReserveNowRequest is sent by the Central System to reserve a connector for an idTag
+// Connector 0 reserves the charger as a whole, if the charger supports it
+type ReserveNowRequest struct {
+	ConnectorId   int             `json:"connectorId"`
+	ExpiryDate    *types.DateTime `json:"expiryDate"`
+	IdTag         string          `json:"idTag"`
+	ParentIdTag   string          `json:"parentIdTag,omitempty"`
+	ReservationId int             `json:"reservationId"`
+}
+
+// ReserveNowConfirmation is the charger's reply to a ReserveNowRequest
+type ReserveNowConfirmation struct {
+	Status ReservationStatus `json:"status"`
+}
+
+// ReserveNowFeature describes the ReserveNow request/confirmation pair
+type ReserveNowFeature struct{}
+
+func (f ReserveNowFeature) GetFeatureName() string {
+	return ReserveNowFeatureName
+}
+
+func (f ReserveNowFeature) GetRequestType() reflect.Type {
+	return reflect.TypeOf(ReserveNowRequest{})
+}
+
+func (f ReserveNowFeature) GetResponseType() reflect.Type {
+	return reflect.TypeOf(ReserveNowConfirmation{})
+}
+
+func (r ReserveNowRequest) GetFeatureName() string {
+	return ReserveNowFeatureName
+}
+
+func (c ReserveNowConfirmation) GetFeatureName() string {
+	return ReserveNowFeatureName
+}
+
+// -------------------- Cancel Reservation (CS -> CP) --------------------
+
+const CancelReservationFeatureName = "CancelReservation"
+
+// CancelReservationStatus is the charger's answer to a CancelReservationRequest
+type CancelReservationStatus string
+
+const (
+	CancelReservationStatusAccepted CancelReservationStatus = "Accepted"
+	CancelReservationStatusRejected CancelReservationStatus = "Rejected" // No reservation with that ID on the charger
+)
+
+// CancelReservationRequest is sent by the Central System to cancel a reservation
+type CancelReservationRequest struct {
+	ReservationId int `json:"reservationId"`
+}
+
+// CancelReservationConfirmation is the charger's reply to a CancelReservationRequest
+type CancelReservationConfirmation struct {
+	Status CancelReservationStatus `json:"status"`
+}
+
+// CancelReservationFeature describes the CancelReservation request/confirmation pair
+type CancelReservationFeature struct{}
+
+func (f CancelReservationFeature) GetFeatureName() string {
+	return CancelReservationFeatureName
+}
+
+func (f CancelReservationFeature) GetRequestType() reflect.Type {
+	return reflect.TypeOf(CancelReservationRequest{})
+}
+
+func (f CancelReservationFeature) GetResponseType() reflect.Type {
+	return reflect.TypeOf(CancelReservationConfirmation{})
+}
+
+func (r CancelReservationRequest) GetFeatureName() string {
+	return CancelReservationFeatureName
+}
+
+func (c CancelReservationConfirmation) GetFeatureName() string {
+	return CancelReservationFeatureName
+}
+
+// ReservationProfile groups the messages of the OCPP 1.6 Reservation profile
+var ReservationProfile = ocpp.NewProfile("Reservation", ReserveNowFeature{}, CancelReservationFeature{})
@@ -0,0 +1,118 @@
+package ocpp
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// States of a row in the reservations table
+const (
+	ReservationPending   = "pending"   // ReserveNow sent, no answer yet
+	ReservationActive    = "active"    // The charger accepted the reservation
+	ReservationRejected  = "rejected"  // The charger answered Faulted, Occupied, Rejected or Unavailable
+	ReservationFailed    = "failed"    // ReserveNow could not be delivered or was not answered
+	ReservationCancelled = "cancelled" // Cancelled through the API
+	ReservationExpired   = "expired"   // Reached its expiry without being used
+	ReservationUsed      = "used"      // A transaction started with its reservationId
+)
+
+// reservationExpiryInterval is how often reservations past their expiry are marked expired
+const reservationExpiryInterval = 30 * time.Second
+
+// ReserveNow asks the charging station to hold a connector for an idTag until the expiry date
+// The reservation ID is the ID of the reservations row, so it is unique across all chargers
+func (s *Server) ReserveNow(ctx context.Context, chargePointId string, request *ReserveNowRequest) (*ReserveNowConfirmation, error) {
+	response, err := s.callCommand(ctx, chargePointId, ReserveNowFeatureName, request)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation := response.(*ReserveNowConfirmation)
+	s.logger.Info("ReserveNow answered by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.Int("reservation_id", request.ReservationId),
+		zap.Int("connector_id", request.ConnectorId),
+		zap.String("status", string(confirmation.Status)))
+
+	return confirmation, nil
+}
+
+// CancelReservation asks the charging station to drop a reservation
+func (s *Server) CancelReservation(ctx context.Context, chargePointId string, reservationId int) (*CancelReservationConfirmation, error) {
+	response, err := s.callCommand(ctx, chargePointId, CancelReservationFeatureName, &CancelReservationRequest{ReservationId: reservationId})
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation := response.(*CancelReservationConfirmation)
+	s.logger.Info("CancelReservation answered by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.Int("reservation_id", reservationId),
+		zap.String("status", string(confirmation.Status)))
+
+	return confirmation, nil
+}
+
+// useReservation marks the reservation a StartTransaction refers to as used by the new transaction
+// The charger ends the reservation itself when the reserved idTag starts charging
+func (s *Server) useReservation(ctx context.Context, chargerID int64, reservationId, transactionRowID int) {
+	query := `
+		UPDATE reservations
+		SET status = ?, transaction_id = ?, ended_at = ?
+		WHERE id = ? AND charger_id = ? AND status IN (?, ?)
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		ReservationUsed,
+		transactionRowID,
+		time.Now().UTC(),
+		reservationId,
+		chargerID,
+		ReservationPending,
+		ReservationActive,
+	)
+	if err != nil {
+		s.logger.Error("Failed to mark reservation used", zap.Int("reservation_id", reservationId), zap.Error(err))
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		// The transaction is recorded anyway; whether the reservation applied is up to the charger
+		s.logger.Warn("Transaction started with a reservation that is not active",
+			zap.Int64("charger_id", chargerID),
+			zap.Int("reservation_id", reservationId),
+			zap.Int("transaction_id", transactionRowID))
+	}
+}
+
+// runReservationExpiry marks reservations expired once their expiry date has passed
+// The charger releases the connector on its own; this keeps our view in step with it
+func (s *Server) runReservationExpiry() {
+	ticker := time.NewTicker(reservationExpiryInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.expireReservations(context.Background(), time.Now().UTC())
+	}
+}
+
+// expireReservations performs one run of the expiry check
+func (s *Server) expireReservations(ctx context.Context, now time.Time) {
+	query := `
+		UPDATE reservations
+		SET status = ?, ended_at = ?
+		WHERE status IN (?, ?) AND expires_at <= ?
+	`
+
+	result, err := s.db.ExecContext(ctx, query, ReservationExpired, now, ReservationPending, ReservationActive, now)
+	if err != nil {
+		s.logger.Error("Failed to expire reservations", zap.Error(err))
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n > 0 {
+		s.logger.Info("Reservations expired", zap.Int64("count", n))
+	}
+}
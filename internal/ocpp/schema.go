@@ -0,0 +1,339 @@
+package ocpp
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Validation modes of a charger
+const (
+	ValidationStrict  = "strict"  // Payloads that break the schema are rejected with a CALLERROR
+	ValidationLenient = "lenient" // Known vendor quirks are logged and let through
+)
+
+// DefaultValidationMode applies to chargers without a stored mode
+const DefaultValidationMode = ValidationStrict
+
+// OCPP 1.6 CALLERROR codes
+// The spec spells OccurenceConstraintViolation with one r, and chargers expect it that way
+const (
+	ErrorCodeNotImplemented               = "NotImplemented"
+	ErrorCodeNotSupported                 = "NotSupported"
+	ErrorCodeInternalError                = "InternalError"
+	ErrorCodeFormationViolation           = "FormationViolation"
+	ErrorCodePropertyConstraintViolation  = "PropertyConstraintViolation"
+	ErrorCodeOccurenceConstraintViolation = "OccurenceConstraintViolation"
+	ErrorCodeTypeConstraintViolation      = "TypeConstraintViolation"
+)
+
+//go:embed schemas/ocpp16/*.json
+var schemaFiles embed.FS
+
+// jsonSchema is the part of JSON Schema draft-04 the OCPP 1.6 schemas use
+type jsonSchema struct {
+	Type                 string                 `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Required             []string               `json:"required"`
+	Enum                 []string               `json:"enum"`
+	MaxLength            *int                   `json:"maxLength"`
+	Format               string                 `json:"format"`
+	Items                *jsonSchema            `json:"items"`
+	MultipleOf           *float64               `json:"multipleOf"`
+}
+
+// schemas holds the OCPP 1.6 schemas keyed by action for requests and by action + "Response" for answers
+var schemas = loadSchemas()
+
+// loadSchemas parses the embedded schemas; they ship with the binary, so a broken one is a build mistake
+func loadSchemas() map[string]*jsonSchema {
+	files, err := schemaFiles.ReadDir("schemas/ocpp16")
+	if err != nil {
+		panic(err)
+	}
+
+	loaded := make(map[string]*jsonSchema, len(files))
+	for _, file := range files {
+		data, err := schemaFiles.ReadFile(path.Join("schemas/ocpp16", file.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var schema jsonSchema
+		if err := json.Unmarshal(data, &schema); err != nil {
+			panic(fmt.Sprintf("invalid OCPP schema %s: %v", file.Name(), err))
+		}
+		loaded[strings.TrimSuffix(file.Name(), ".json")] = &schema
+	}
+	return loaded
+}
+
+// IsValidValidationMode reports whether mode is strict or lenient
+func IsValidValidationMode(mode string) bool {
+	return mode == ValidationStrict || mode == ValidationLenient
+}
+
+// SchemaViolation is one way a payload breaks its schema
+type SchemaViolation struct {
+	Code      string `json:"code"` // The CALLERROR code the violation maps to
+	Path      string `json:"path"` // Where in the payload, e.g. meterValue[0].sampledValue[1].unit
+	Message   string `json:"message"`
+	Tolerated bool   `json:"-"` // Let through in lenient mode
+}
+
+func (v SchemaViolation) String() string {
+	if v.Path == "" {
+		return v.Message
+	}
+	return v.Path + ": " + v.Message
+}
+
+// SchemaError is returned when a payload does not match its OCPP 1.6 schema
+type SchemaError struct {
+	Schema     string // Action, or action + "Response"
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%s does not match the OCPP 1.6 schema: %s", e.Schema, e.Violations[0])
+}
+
+// IsResponse reports whether the payload was a CALLRESULT rather than a CALL
+func (e *SchemaError) IsResponse() bool {
+	return strings.HasSuffix(e.Schema, "Response")
+}
+
+// Code is the CALLERROR code for the first violation
+func (e *SchemaError) Code() string {
+	return e.Violations[0].Code
+}
+
+// validatePayload checks a payload against the OCPP 1.6 schema with the given name
+// In lenient mode violations vendors are known for (extra properties, over-long strings, unknown enum values,
+// numbers sent as strings and the like) are tolerated and scalar types are coerced where that is unambiguous;
+// missing required fields and values that cannot be coerced are still errors
+// It returns the payload with coerced values, every violation found, and the error if any were not tolerated
+func validatePayload(name string, payload interface{}, mode string) (interface{}, []SchemaViolation, error) {
+	schema, ok := schemas[name]
+	if !ok {
+		return payload, nil, nil
+	}
+
+	v := &schemaValidator{lenient: mode == ValidationLenient}
+	payload = v.validate(schema, payload, "")
+
+	var blocking []SchemaViolation
+	for _, violation := range v.violations {
+		if !violation.Tolerated {
+			blocking = append(blocking, violation)
+		}
+	}
+	if len(blocking) > 0 {
+		return payload, v.violations, &SchemaError{Schema: name, Violations: blocking}
+	}
+	return payload, v.violations, nil
+}
+
+// schemaValidator collects the violations of one payload
+type schemaValidator struct {
+	lenient    bool
+	violations []SchemaViolation
+}
+
+// fail records a violation; tolerable ones are only let through in lenient mode
+func (v *schemaValidator) fail(code, path string, tolerable bool, format string, args ...interface{}) {
+	v.violations = append(v.violations, SchemaViolation{
+		Code:      code,
+		Path:      path,
+		Message:   fmt.Sprintf(format, args...),
+		Tolerated: tolerable && v.lenient,
+	})
+}
+
+// validate checks a value against a schema and returns it, coerced to the schema type where lenient mode allows
+func (v *schemaValidator) validate(schema *jsonSchema, value interface{}, path string) interface{} {
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			v.fail(ErrorCodeTypeConstraintViolation, path, false, "expected an object, got %s", jsonTypeName(value))
+			return value
+		}
+
+		for _, key := range schema.Required {
+			if _, ok := object[key]; !ok {
+				v.fail(ErrorCodeOccurenceConstraintViolation, joinPath(path, key), false, "required property is missing")
+			}
+		}
+
+		// Sorted so the first violation, which becomes the CALLERROR, is the same every time
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			property, ok := schema.Properties[key]
+			if !ok {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					v.fail(ErrorCodeFormationViolation, joinPath(path, key), true, "property is not allowed")
+				}
+				continue
+			}
+			object[key] = v.validate(property, object[key], joinPath(path, key))
+		}
+		return object
+
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			v.fail(ErrorCodeTypeConstraintViolation, path, false, "expected an array, got %s", jsonTypeName(value))
+			return value
+		}
+		if schema.Items != nil {
+			for i := range array {
+				array[i] = v.validate(schema.Items, array[i], fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+		return array
+
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			// Some chargers send sampled values and IDs as bare numbers
+			switch n := value.(type) {
+			case float64:
+				s = strconv.FormatFloat(n, 'f', -1, 64)
+			case bool:
+				s = strconv.FormatBool(n)
+			default:
+				v.fail(ErrorCodeTypeConstraintViolation, path, false, "expected a string, got %s", jsonTypeName(value))
+				return value
+			}
+			v.fail(ErrorCodeTypeConstraintViolation, path, true, "expected a string, got %s", jsonTypeName(value))
+			if !v.lenient {
+				return value
+			}
+		}
+
+		if schema.MaxLength != nil && utf8.RuneCountInString(s) > *schema.MaxLength {
+			v.fail(ErrorCodePropertyConstraintViolation, path, true, "longer than %d characters", *schema.MaxLength)
+		}
+		if len(schema.Enum) > 0 && !containsString(schema.Enum, s) {
+			v.fail(ErrorCodePropertyConstraintViolation, path, true, "%q is not one of %s", s, strings.Join(schema.Enum, ", "))
+		}
+		switch schema.Format {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				v.fail(ErrorCodePropertyConstraintViolation, path, true, "%q is not an RFC 3339 date-time", s)
+			}
+		case "uri":
+			if u, err := url.Parse(s); err != nil || u.Scheme == "" {
+				v.fail(ErrorCodePropertyConstraintViolation, path, true, "%q is not an absolute URI", s)
+			}
+		}
+		return s
+
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok {
+			// Some chargers quote their meter readings
+			s, isString := value.(string)
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if !isString || err != nil {
+				v.fail(ErrorCodeTypeConstraintViolation, path, false, "expected %s %s, got %s", article(schema.Type), schema.Type, jsonTypeName(value))
+				return value
+			}
+			v.fail(ErrorCodeTypeConstraintViolation, path, true, "expected %s %s, got a string", article(schema.Type), schema.Type)
+			if !v.lenient {
+				return value
+			}
+			n = parsed
+		}
+
+		// Draft-04 has no integer type in JSON itself; an integer is a number without a fraction
+		if schema.Type == "integer" && n != math.Trunc(n) {
+			v.fail(ErrorCodeTypeConstraintViolation, path, false, "expected an integer, got %v", n)
+			return n
+		}
+		if schema.MultipleOf != nil {
+			if q := n / *schema.MultipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+				v.fail(ErrorCodePropertyConstraintViolation, path, true, "%v is not a multiple of %v", n, *schema.MultipleOf)
+			}
+		}
+		return n
+
+	case "boolean":
+		if b, ok := value.(bool); ok {
+			return b
+		}
+		if s, ok := value.(string); ok {
+			if b, err := strconv.ParseBool(s); err == nil {
+				v.fail(ErrorCodeTypeConstraintViolation, path, true, "expected a boolean, got a string")
+				if v.lenient {
+					return b
+				}
+				return value
+			}
+		}
+		v.fail(ErrorCodeTypeConstraintViolation, path, false, "expected a boolean, got %s", jsonTypeName(value))
+		return value
+	}
+
+	return value
+}
+
+// joinPath appends a property name to a payload path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// jsonTypeName names the JSON type of a decoded value for violation messages
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case float64:
+		return "a number"
+	case bool:
+		return "a boolean"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// article returns the indefinite article for a schema type name
+func article(typeName string) string {
+	if strings.IndexAny(typeName[:1], "aeiou") == 0 {
+		return "an"
+	}
+	return "a"
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,379 @@
+package ocpp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// OCPP security profiles a station can be configured with
+const (
+	SecurityProfileNone              = 0 // Any connection with the station's identity is accepted
+	SecurityProfileBasicAuth         = 1 // HTTP Basic auth with the station's AuthorizationKey
+	SecurityProfileTLSBasicAuth      = 2 // Basic auth over TLS
+	SecurityProfileClientCertificate = 3 // TLS with a client certificate whose CN is the station's identity
+)
+
+// Length limits of an AuthorizationKey, the Basic auth password of profiles 1 and 2
+const (
+	MinAuthorizationKeyLength = 16
+	MaxAuthorizationKeyLength = 40
+)
+
+const (
+	// authKeyIterations is the PBKDF2 work factor of stored AuthorizationKeys
+	authKeyIterations = 100000
+	// authFailureRetention is how long failed connection attempts are kept
+	authFailureRetention = 30 * 24 * time.Hour
+	// authGuardCleanupInterval is how often expired lockouts are forgotten and old failures deleted
+	authGuardCleanupInterval = time.Hour
+)
+
+// app_settings keys of the connection security settings
+const (
+	securityAllowUnknownKey   = "security_allow_unknown_chargers"
+	securityMaxFailuresKey    = "security_max_failed_attempts"
+	securityLockoutMinutesKey = "security_lockout_minutes"
+)
+
+// Defaults of the connection security settings
+const (
+	DefaultSecurityMaxFailedAttempts = 5
+	DefaultSecurityLockoutMinutes    = 15
+)
+
+// SecuritySettings control who may open an OCPP connection
+type SecuritySettings struct {
+	AllowUnknownChargers bool `json:"allow_unknown_chargers"` // Opt-in: identities without a station are accepted and registered on boot
+	MaxFailedAttempts    int  `json:"max_failed_attempts"`    // Failed attempts from one address before it is locked out
+	LockoutMinutes       int  `json:"lockout_minutes"`        // How long a lockout lasts, and the window failures are counted in
+}
+
+// IsValidSecurityProfile reports whether a security profile is one we implement
+func IsValidSecurityProfile(profile int) bool {
+	return profile >= SecurityProfileNone && profile <= SecurityProfileClientCertificate
+}
+
+// SecurityProfileNeedsKey reports whether a security profile authenticates with an AuthorizationKey
+func SecurityProfileNeedsKey(profile int) bool {
+	return profile == SecurityProfileBasicAuth || profile == SecurityProfileTLSBasicAuth
+}
+
+// HashAuthorizationKey hashes an AuthorizationKey for storage
+// The result is pbkdf2-sha256$iterations$salt$hash with the salt and hash base64 encoded
+func HashAuthorizationKey(key string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	hash := pbkdf2.Key([]byte(key), salt, authKeyIterations, sha256.Size, sha256.New)
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", authKeyIterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// verifyAuthorizationKey checks a password against a hash from HashAuthorizationKey
+func verifyAuthorizationKey(stored, key string) bool {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	hash := pbkdf2.Key([]byte(key), salt, iterations, len(expected), sha256.New)
+	return subtle.ConstantTimeCompare(hash, expected) == 1
+}
+
+// authFailure is why a connection attempt was refused
+type authFailure struct {
+	status int
+	reason string
+}
+
+// authenticateChargePoint checks a connection attempt against the station's security profile
+// It returns nil if the charger may connect, and the profile it was checked against
+func (s *Server) authenticateChargePoint(r *http.Request, chargePointId string, settings *SecuritySettings) (*authFailure, int) {
+	var profile int
+	var keyHash sql.NullString
+	err := s.db.QueryRowContext(r.Context(),
+		`SELECT security_profile, auth_key_hash FROM chargers WHERE identity = ?`, chargePointId).Scan(&profile, &keyHash)
+	if err == sql.ErrNoRows {
+		if settings.AllowUnknownChargers {
+			return nil, SecurityProfileNone
+		}
+		return &authFailure{http.StatusNotFound, "unknown charge point"}, SecurityProfileNone
+	}
+	if err != nil {
+		s.logger.Error("Failed to load charger security profile", zap.String("charge_point_id", chargePointId), zap.Error(err))
+		return &authFailure{http.StatusInternalServerError, "security profile unavailable"}, SecurityProfileNone
+	}
+
+	switch profile {
+	case SecurityProfileNone:
+		return nil, profile
+	case SecurityProfileBasicAuth, SecurityProfileTLSBasicAuth:
+		if profile == SecurityProfileTLSBasicAuth && r.TLS == nil {
+			return &authFailure{http.StatusForbidden, "TLS required"}, profile
+		}
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			return &authFailure{http.StatusUnauthorized, "no basic auth credentials"}, profile
+		}
+		// The username is the identity, so one station's key does not open another station's URL
+		if username != chargePointId {
+			return &authFailure{http.StatusUnauthorized, "basic auth username does not match the identity"}, profile
+		}
+		if !keyHash.Valid || !verifyAuthorizationKey(keyHash.String, password) {
+			return &authFailure{http.StatusUnauthorized, "wrong authorization key"}, profile
+		}
+		return nil, profile
+	case SecurityProfileClientCertificate:
+		if r.TLS == nil {
+			return &authFailure{http.StatusForbidden, "TLS required"}, profile
+		}
+		if len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			return &authFailure{http.StatusUnauthorized, "no trusted client certificate"}, profile
+		}
+		if cn := r.TLS.VerifiedChains[0][0].Subject.CommonName; cn != chargePointId {
+			return &authFailure{http.StatusForbidden, fmt.Sprintf("client certificate CN %q does not match the identity", cn)}, profile
+		}
+		return nil, profile
+	}
+	return &authFailure{http.StatusForbidden, fmt.Sprintf("unknown security profile %d", profile)}, profile
+}
+
+// authAttempts counts the failed connection attempts of one address
+type authAttempts struct {
+	failures    int
+	first       time.Time // First failure of the current window
+	lockedUntil time.Time
+}
+
+// authGuard rate limits failed connection attempts per remote address
+// Attempts are keyed on the TCP peer, not forwarded headers a client can forge
+type authGuard struct {
+	mu       sync.Mutex
+	attempts map[string]*authAttempts
+}
+
+// newAuthGuard creates a guard with no failures counted
+func newAuthGuard() *authGuard {
+	return &authGuard{attempts: make(map[string]*authAttempts)}
+}
+
+// lockedOut returns when the address's lockout ends, or the zero time if it is not locked out
+func (g *authGuard) lockedOut(addr string, now time.Time) time.Time {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if a := g.attempts[addr]; a != nil && now.Before(a.lockedUntil) {
+		return a.lockedUntil
+	}
+	return time.Time{}
+}
+
+// fail counts a failed attempt and reports whether it locked the address out
+func (g *authGuard) fail(addr string, now time.Time, settings *SecuritySettings) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	window := time.Duration(settings.LockoutMinutes) * time.Minute
+	a := g.attempts[addr]
+	if a == nil || now.Sub(a.first) > window {
+		a = &authAttempts{first: now}
+		g.attempts[addr] = a
+	}
+	a.failures++
+	if settings.MaxFailedAttempts > 0 && a.failures >= settings.MaxFailedAttempts {
+		a.lockedUntil = now.Add(window)
+		a.failures = 0
+		a.first = a.lockedUntil
+		return true
+	}
+	return false
+}
+
+// succeed forgets the failures of an address once it authenticates
+func (g *authGuard) succeed(addr string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.attempts, addr)
+}
+
+// forgetExpired drops the counters of addresses that have not failed for longer than the window
+func (g *authGuard) forgetExpired(now time.Time, window time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for addr, a := range g.attempts {
+		if now.After(a.lockedUntil) && now.Sub(a.first) > window {
+			delete(g.attempts, addr)
+		}
+	}
+}
+
+// checkConnectionAllowed authenticates a connection attempt and writes the refusal if it fails
+// It reports whether the upgrade may go ahead
+func (s *Server) checkConnectionAllowed(w http.ResponseWriter, r *http.Request, chargePointId string) bool {
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+	now := time.Now().UTC()
+
+	if until := s.authGuard.lockedOut(addr, now); !until.IsZero() {
+		// Not journaled, so a locked-out client cannot fill the auth_failures table
+		s.logger.Warn("Connection attempt from a locked out address",
+			zap.String("charger_id", chargePointId),
+			zap.String("remote_addr", addr),
+			zap.Time("locked_until", until))
+		w.Header().Set("Retry-After", strconv.Itoa(int(until.Sub(now).Seconds())+1))
+		http.Error(w, "Too many failed attempts", http.StatusTooManyRequests)
+		return false
+	}
+
+	settings, err := LoadSecuritySettings(r.Context(), s.db)
+	if err != nil {
+		s.logger.Error("Failed to load security settings", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+
+	failure, profile := s.authenticateChargePoint(r, chargePointId, settings)
+	if failure == nil {
+		s.authGuard.succeed(addr)
+		return true
+	}
+	if failure.status == http.StatusInternalServerError {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+
+	locked := s.authGuard.fail(addr, now, settings)
+	s.logger.Warn("Charger failed to authenticate",
+		zap.String("charger_id", chargePointId),
+		zap.String("remote_addr", addr),
+		zap.Int("security_profile", profile),
+		zap.String("reason", failure.reason),
+		zap.Bool("locked_out", locked))
+	s.recordAuthFailure(r.Context(), chargePointId, addr, profile, failure.reason, locked, now)
+
+	if failure.status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="OCPP", charset="UTF-8"`)
+	}
+	http.Error(w, http.StatusText(failure.status), failure.status)
+	return false
+}
+
+// recordAuthFailure stores a refused connection attempt
+func (s *Server) recordAuthFailure(ctx context.Context, chargePointId, addr string, profile int, reason string, locked bool, now time.Time) {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO auth_failures (identity, remote_addr, security_profile, reason, locked_out, ts)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, chargePointId, addr, profile, reason, locked, now)
+	if err != nil {
+		s.logger.Error("Failed to record authentication failure", zap.Error(err))
+	}
+}
+
+// runAuthGuardCleanup forgets expired lockouts and deletes old failed attempts
+func (s *Server) runAuthGuardCleanup() {
+	ticker := time.NewTicker(authGuardCleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now().UTC()
+		window := DefaultSecurityLockoutMinutes * time.Minute
+		if settings, err := LoadSecuritySettings(context.Background(), s.db); err == nil {
+			window = time.Duration(settings.LockoutMinutes) * time.Minute
+		}
+		s.authGuard.forgetExpired(now, window)
+
+		if _, err := s.db.Exec(`DELETE FROM auth_failures WHERE ts < ?`, now.Add(-authFailureRetention)); err != nil {
+			s.logger.Error("Failed to prune authentication failures", zap.Error(err))
+		}
+	}
+}
+
+// LoadSecuritySettings reads the connection security settings from the app settings, with the defaults for unset keys
+// Unknown chargers are refused unless security_allow_unknown_chargers is explicitly set to true
+func LoadSecuritySettings(ctx context.Context, db *sql.DB) (*SecuritySettings, error) {
+	settings := &SecuritySettings{
+		AllowUnknownChargers: false,
+		MaxFailedAttempts:    DefaultSecurityMaxFailedAttempts,
+		LockoutMinutes:       DefaultSecurityLockoutMinutes,
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT key, value FROM app_settings WHERE key IN (?, ?, ?)`,
+		securityAllowUnknownKey, securityMaxFailuresKey, securityLockoutMinutesKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		switch key {
+		case securityAllowUnknownKey:
+			if allow, err := strconv.ParseBool(value); err == nil {
+				settings.AllowUnknownChargers = allow
+			}
+		case securityMaxFailuresKey:
+			if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+				settings.MaxFailedAttempts = n
+			}
+		case securityLockoutMinutesKey:
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				settings.LockoutMinutes = n
+			}
+		}
+	}
+
+	return settings, rows.Err()
+}
+
+// SaveSecuritySettings stores the connection security settings; they apply to the next connection attempt
+func SaveSecuritySettings(ctx context.Context, db *sql.DB, settings *SecuritySettings) error {
+	query := `
+		INSERT INTO app_settings (key, value)
+		VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`
+	values := map[string]string{
+		securityAllowUnknownKey:   strconv.FormatBool(settings.AllowUnknownChargers),
+		securityMaxFailuresKey:    strconv.Itoa(settings.MaxFailedAttempts),
+		securityLockoutMinutesKey: strconv.Itoa(settings.LockoutMinutes),
+	}
+	for key, value := range values {
+		if _, err := db.ExecContext(ctx, query, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
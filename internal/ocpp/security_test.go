@@ -0,0 +1,146 @@
+package ocpp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite"
+)
+
+// newSecurityTestServer creates a server on an in-memory database with the tables connection checks use
+func newSecurityTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	schema := []string{
+		`CREATE TABLE chargers (id INTEGER PRIMARY KEY, identity TEXT UNIQUE, security_profile INTEGER NOT NULL DEFAULT 0, auth_key_hash TEXT)`,
+		`CREATE TABLE app_settings (key TEXT PRIMARY KEY, value TEXT)`,
+		`CREATE TABLE auth_failures (id INTEGER PRIMARY KEY AUTOINCREMENT, identity TEXT, remote_addr TEXT, security_profile INTEGER, reason TEXT, locked_out BOOLEAN, ts DATETIME)`,
+	}
+	for _, statement := range schema {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return &Server{db: db, logger: zap.NewNop(), authGuard: newAuthGuard()}
+}
+
+// testCertificate issues a certificate for cn, signed by parent (self-signed if parent is nil)
+func testCertificate(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// The TLS listener only asks for a client certificate (VerifyClientCertIfGiven), so profile 3 is
+// enforced by the per-station check alone
+func TestClientCertificateProfile(t *testing.T) {
+	s := newSecurityTestServer(t)
+	if _, err := s.db.Exec(`INSERT INTO chargers (identity, security_profile) VALUES ('CP3', ?)`, SecurityProfileClientCertificate); err != nil {
+		t.Fatal(err)
+	}
+
+	ca, caKey := testCertificate(t, "Test CA", true, nil, nil)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.checkConnectionAllowed(w, r, r.URL.Path[1:]) {
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+	srv := httptest.NewUnstartedServer(handler)
+	srv.TLS = &tls.Config{ClientCAs: clientCAs, ClientAuth: tls.VerifyClientCertIfGiven}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// clientWith connects with a certificate for cn, or without one if cn is empty
+	clientWith := func(cn string) *http.Client {
+		client := srv.Client()
+		transport := client.Transport.(*http.Transport).Clone()
+		if cn != "" {
+			cert, key := testCertificate(t, cn, false, ca, caKey)
+			transport.TLSClientConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}}
+		}
+		client.Transport = transport
+		return client
+	}
+
+	tests := []struct {
+		name     string
+		identity string
+		certCN   string
+		want     int
+	}{
+		{name: "no client certificate", identity: "CP3", want: http.StatusUnauthorized},
+		{name: "certificate of another identity", identity: "CP3", certCN: "OTHER", want: http.StatusForbidden},
+		{name: "certificate of the identity", identity: "CP3", certCN: "CP3", want: http.StatusOK},
+		{name: "identity without a station", identity: "UNKNOWN", certCN: "UNKNOWN", want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := clientWith(tt.certCN).Get(srv.URL + "/" + tt.identity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if response.StatusCode != tt.want {
+				t.Errorf("got status %d, want %d", response.StatusCode, tt.want)
+			}
+		})
+	}
+
+	var failures int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM auth_failures WHERE identity = 'CP3'`).Scan(&failures); err != nil {
+		t.Fatal(err)
+	}
+	if failures != 2 {
+		t.Errorf("got %d recorded failures for CP3, want 2", failures)
+	}
+}
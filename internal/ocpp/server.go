@@ -1,6 +1,7 @@
 package ocpp
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -8,6 +9,7 @@ import (
 	"net"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -23,11 +25,22 @@ import (
 // Server manages communication with electric vehicle charging stations
 // It handles WebSocket connections and processes OCPP messages from chargers
 type Server struct {
-	db          *sql.DB                    // Database connection for storing charger data
-	logger      *zap.Logger                // Logger for recording events and errors
-	cs          *ocppj.Server              // OCPP library server (not currently used)
-	running     bool                       // Whether the server is active and accepting connections
-	connections map[string]*websocket.Conn // Map of charger ID to WebSocket connection
+	db          *sql.DB                     // Database connection for storing charger data
+	logger      *zap.Logger                 // Logger for recording events and errors
+	cs          *ocppj.Server               // OCPP library server (not currently used)
+	running     bool                        // Whether the server is active and accepting connections
+	mu          sync.RWMutex                // Guards connections
+	connections map[string]*chargePointConn // Map of charger ID to WebSocket connection
+	profiles    []*ocpp.Profile             // OCPP profiles we can send CALLs for
+	callTimeout time.Duration               // How long Call waits for a charger to reply
+	events      *EventBus                   // Live events for the dashboard
+	journal     *journal                    // Raw OCPP traffic kept for diagnostics
+	authGuard   *authGuard                  // Rate limits failed connection attempts
+	loadMu      sync.Mutex                  // Guards rebalancers
+	rebalancers map[int64]*siteRebalancer   // Sites with a load balancing run in progress
+
+	localListMu    sync.Mutex             // Guards localListLocks
+	localListLocks map[string]*sync.Mutex // One local list sync at a time per charger
 }
 
 // New creates a new server to handle charging station connections
@@ -44,9 +57,29 @@ func New(db *sql.DB, logger *zap.Logger) *Server {
 		logger:      logger,
 		cs:          cs,
 		running:     true, // Server is ready to accept connections
-		connections: make(map[string]*websocket.Conn),
+		connections: make(map[string]*chargePointConn),
+		profiles:    []*ocpp.Profile{core.Profile, RemoteTriggerProfile, LocalAuthListProfile, SmartChargingProfile, ReservationProfile, FirmwareManagementProfile},
+		callTimeout: DefaultCallTimeout,
+		events:      NewEventBus(DefaultEventBufferSize),
+		journal:     newJournal(db, logger),
+		authGuard:   newAuthGuard(),
+		rebalancers: make(map[int64]*siteRebalancer),
+
+		localListLocks: make(map[string]*sync.Mutex),
 	}
 
+	// Nobody is connected yet, so sessions still open in the database are left over from a previous run
+	s.closeStaleConnectionSessions()
+
+	// Follow time-of-use window edges and daylight saving changes
+	go s.runTOUSchedules()
+
+	// Mark reservations the chargers have released at their expiry
+	go s.runReservationExpiry()
+
+	// Forget expired lockouts and old failed connection attempts
+	go s.runAuthGuardCleanup()
+
 	// Register handlers (not used since we handle WebSocket manually)
 	cs.SetRequestHandler(s.handleRequest)
 	cs.SetNewClientHandler(s.handleNewClient)
@@ -54,12 +87,21 @@ func New(db *sql.DB, logger *zap.Logger) *Server {
 	return s
 }
 
-// Mount sets up the WebSocket endpoint where charging stations can connect
-// Chargers will connect to /ocpp16/{their_id} to start communicating
+// Mount sets up the WebSocket endpoints where charging stations can connect
+// Chargers connect to /ocpp16/{their_id} or /ocpp201/{their_id}, or to /ocpp/{their_id}
+// where the OCPP version is negotiated with the WebSocket subprotocol
 func (s *Server) Mount(r chi.Router) {
-	// Set up the WebSocket endpoint for charger connections
-	r.HandleFunc("/ocpp16/{id}", s.handleOCPPConnection)
+	// Set up the WebSocket endpoints for charger connections
+	r.HandleFunc("/ocpp16/{id}", s.handleOCPPConnection(ProtocolOCPP16))
+	r.HandleFunc("/ocpp201/{id}", s.handleOCPPConnection(ProtocolOCPP201))
+	r.HandleFunc("/ocpp/{id}", s.handleOCPPConnection(ProtocolOCPP16, ProtocolOCPP201))
 	s.logger.Info("🔌 OCPP 1.6J server mounted at /ocpp16 - Ready for EV charging stations")
+	s.logger.Info("🔌 OCPP 2.0.1 server mounted at /ocpp201, both versions negotiated at /ocpp")
+}
+
+// Events returns the bus on which charger events are published
+func (s *Server) Events() *EventBus {
+	return s.events
 }
 
 // Start starts the OCPP server
@@ -79,8 +121,16 @@ func (s *Server) IsRunning() bool {
 	return s.running
 }
 
-// handleOCPPConnection handles WebSocket connections from charging stations
-func (s *Server) handleOCPPConnection(w http.ResponseWriter, r *http.Request) {
+// handleOCPPConnection returns the handler for an endpoint speaking the given OCPP versions
+// The first version is used when the charger does not ask for a subprotocol we know
+func (s *Server) handleOCPPConnection(protocols ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.serveChargePoint(w, r, protocols)
+	}
+}
+
+// serveChargePoint handles the WebSocket connection of a charging station
+func (s *Server) serveChargePoint(w http.ResponseWriter, r *http.Request, protocols []string) {
 	// Get the charger ID from the URL parameter
 	chargerID := chi.URLParam(r, "id")
 	if chargerID == "" {
@@ -88,39 +138,91 @@ func (s *Server) handleOCPPConnection(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.logger.Info("New WebSocket connection attempt", zap.String("charger_id", chargerID))
+	s.logger.Info("New WebSocket connection attempt",
+		zap.String("charger_id", chargerID),
+		zap.Strings("subprotocols", websocket.Subprotocols(r)))
+
+	// Refuse chargers that do not meet their station's security profile before upgrading
+	if !s.checkConnectionAllowed(w, r, chargerID) {
+		return
+	}
 
 	// Upgrade HTTP connection to WebSocket
+	// Where both versions are served 2.0.1 wins if the charger offers it
 	upgrader := websocket.Upgrader{
+		Subprotocols: preferredProtocols(protocols),
 		CheckOrigin: func(r *http.Request) bool {
-			return true // Allow all origins for now
+			return true // Chargers are authenticated by their security profile, not their origin
 		},
 	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	wsConn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		s.logger.Error("Failed to upgrade connection to WebSocket", zap.Error(err))
 		return
 	}
-	defer conn.Close()
-
-	s.logger.Info("WebSocket connection established", zap.String("charger_id", chargerID))
+	defer wsConn.Close()
+
+	// Chargers that do not negotiate get the endpoint's first version, as before subprotocols were checked
+	protocol := wsConn.Subprotocol()
+	if protocol == "" {
+		protocol = protocols[0]
+		if offered := websocket.Subprotocols(r); len(offered) > 0 {
+			s.logger.Warn("Charger offered no OCPP version this endpoint speaks",
+				zap.String("charger_id", chargerID),
+				zap.Strings("offered", offered),
+				zap.String("using", protocol))
+		}
+	}
 
-	// Store the connection for this charger
+	s.logger.Info("WebSocket connection established",
+		zap.String("charger_id", chargerID),
+		zap.String("protocol", protocol))
+	s.recordProtocol(chargerID, protocol)
+
+	// Record the connection session so flapping chargers can be diagnosed
+	remoteIP := getClientIP(r)
+	sessionID := s.openConnectionSession(chargerID, remoteIP)
+	s.events.Publish(EventConnected, chargerID, map[string]interface{}{
+		"remote_ip": remoteIP,
+	})
+
+	// Store the connection for this charger, dropping any connection it left behind
+	conn := newChargePointConn(chargerID, wsConn, protocol)
+	conn.validation = s.loadValidationMode(chargerID)
+	s.mu.Lock()
+	previous := s.connections[chargerID]
+	if previous != nil {
+		previous.replaced = true
+	}
 	s.connections[chargerID] = conn
+	s.mu.Unlock()
+
+	if previous != nil {
+		s.logger.Info("Charger reconnected, closing previous connection", zap.String("charger_id", chargerID))
+		previous.ws.Close()
+	}
 
 	// Handle WebSocket messages
+	var readErr error
 	for {
-		_, message, err := conn.ReadMessage()
+		_, message, err := wsConn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				s.logger.Error("WebSocket error", zap.Error(err))
 			}
+			readErr = err
 			break
 		}
+		s.journal.record(chargerID, JournalDirectionIn, message)
 
 		// Process the OCPP message
-		response, err := s.processOCPPMessage(chargerID, message)
+		var response []byte
+		if protocol == ProtocolOCPP201 {
+			response, err = s.processOCPP201Message(chargerID, message)
+		} else {
+			response, err = s.processOCPPMessage(chargerID, message)
+		}
 		if err != nil {
 			s.logger.Error("Failed to process OCPP message", zap.Error(err))
 			continue
@@ -128,16 +230,69 @@ func (s *Server) handleOCPPConnection(w http.ResponseWriter, r *http.Request) {
 
 		// Send response back to charger
 		if response != nil {
-			if err := conn.WriteMessage(websocket.TextMessage, response); err != nil {
+			if err := s.writeFrame(conn, response); err != nil {
 				s.logger.Error("Failed to send response to charger", zap.Error(err))
+				readErr = err
 				break
 			}
 		}
+
+		// Follow-up CALLs may go out now that the charger has our answer
+		for _, fn := range conn.takeAfterResponse() {
+			go fn()
+		}
+	}
+
+	// Remove the connection when it's closed, unless the charger has already reconnected
+	s.mu.Lock()
+	if s.connections[chargerID] == conn {
+		delete(s.connections, chargerID)
+	}
+	replaced := conn.replaced
+	s.mu.Unlock()
+
+	// Fail any CALLs still waiting on this connection
+	close(conn.closed)
+
+	closeCode, closeReason := closeInfo(readErr)
+	if replaced {
+		closeReason = "Replaced by new connection"
+	}
+	s.closeConnectionSession(sessionID, closeCode, closeReason)
+	s.events.Publish(EventDisconnected, chargerID, map[string]interface{}{
+		"close_code":   closeCode,
+		"close_reason": closeReason,
+	})
+
+	s.logger.Info("WebSocket connection closed",
+		zap.String("charger_id", chargerID),
+		zap.Int("close_code", closeCode),
+		zap.String("close_reason", closeReason))
+}
+
+// afterResponse runs fn in the background once the response to the charger's current request is sent
+// Handlers use it for CALLs that depend on the charger having processed our answer first
+func (s *Server) afterResponse(chargePointId string, fn func()) {
+	conn := s.getConnection(chargePointId)
+	if conn == nil {
+		go fn()
+		return
 	}
+	conn.addAfterResponse(fn)
+}
 
-	// Remove the connection when it's closed
-	delete(s.connections, chargerID)
-	s.logger.Info("WebSocket connection closed", zap.String("charger_id", chargerID))
+// writeFrame journals a frame and sends it to the charger
+// The frame is journaled first so an answer arriving right away can be matched to it
+func (s *Server) writeFrame(conn *chargePointConn, message []byte) error {
+	s.journal.record(conn.id, JournalDirectionOut, message)
+	return conn.write(message)
+}
+
+// getConnection returns the open connection for a charger, or nil if it is not connected
+func (s *Server) getConnection(chargePointId string) *chargePointConn {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.connections[chargePointId]
 }
 
 // handleNewClient handles new client connections
@@ -292,22 +447,14 @@ func (s *Server) OnStartTransaction(chargePointId string, request *core.StartTra
 		}, nil
 	}
 
-	// Generate transaction ID
-	txID := int(time.Now().Unix())
-
-	// Insert transaction
-	query := `
-		INSERT INTO transactions (charger_id, tx_id, start_ts, start_meter_wh)
-		VALUES (?, ?, ?, ?)
-	`
-
-	_, err = s.db.ExecContext(context.Background(), query,
-		chargerID,
-		txID,
-		request.Timestamp.Time,
-		request.MeterStart,
-	)
-
+	// Insert transaction; the transaction ID is allocated by the database
+	txID, err := s.insertTransaction(context.Background(), chargerID, transactionStart{
+		ConnectorId:   request.ConnectorId,
+		IdTag:         request.IdTag,
+		MeterStart:    int64(request.MeterStart),
+		ReservationId: request.ReservationId,
+		Timestamp:     request.Timestamp.Time.UTC(),
+	})
 	if err != nil {
 		s.logger.Error("Failed to insert transaction", zap.Error(err))
 		return &core.StartTransactionConfirmation{
@@ -341,7 +488,7 @@ func (s *Server) OnStopTransaction(chargePointId string, request *core.StopTrans
 	`
 
 	_, err := s.db.ExecContext(context.Background(), query,
-		request.Timestamp.Time,
+		request.Timestamp.Time.UTC(),
 		request.MeterStop,
 		request.MeterStop,
 		request.TransactionId,
@@ -406,11 +553,13 @@ func (s *Server) OnMeterValues(chargePointId string, request *core.MeterValuesRe
 
 					// Insert meter value
 					insertQuery := `
-						INSERT INTO meter_values (transaction_id, ts, measurand, value)
-						VALUES (?, ?, ?, ?)
+						INSERT INTO meter_values (charger_id, connector_id, transaction_id, ts, measurand, unit, value)
+						VALUES (?, ?, ?, ?, ?, 'Wh', ?)
 					`
 
 					_, err = s.db.ExecContext(context.Background(), insertQuery,
+						chargerID,
+						request.ConnectorId,
 						transactionID,
 						mv.Timestamp.Time,
 						sample.Measurand,
@@ -484,30 +633,6 @@ func (s *Server) OnDataTransfer(chargePointId string, request *core.DataTransfer
 	}, nil
 }
 
-// OnChangeAvailability handles ChangeAvailability requests
-func (s *Server) OnChangeAvailability(chargePointId string, request *core.ChangeAvailabilityRequest) (*core.ChangeAvailabilityConfirmation, error) {
-	s.logger.Info("ChangeAvailability received",
-		zap.String("charge_point_id", chargePointId),
-		zap.String("type", string(request.Type)),
-	)
-
-	return &core.ChangeAvailabilityConfirmation{
-		Status: core.AvailabilityStatusAccepted,
-	}, nil
-}
-
-// OnChangeConfiguration handles ChangeConfiguration requests
-func (s *Server) OnChangeConfiguration(chargePointId string, request *core.ChangeConfigurationRequest) (*core.ChangeConfigurationConfirmation, error) {
-	s.logger.Info("ChangeConfiguration received",
-		zap.String("charge_point_id", chargePointId),
-		zap.String("key", request.Key),
-	)
-
-	return &core.ChangeConfigurationConfirmation{
-		Status: core.ConfigurationStatusAccepted,
-	}, nil
-}
-
 // OnClearCache handles ClearCache requests
 func (s *Server) OnClearCache(chargePointId string, request *core.ClearCacheRequest) (*core.ClearCacheConfirmation, error) {
 	s.logger.Info("ClearCache received", zap.String("charge_point_id", chargePointId))
@@ -517,110 +642,76 @@ func (s *Server) OnClearCache(chargePointId string, request *core.ClearCacheRequ
 	}, nil
 }
 
-// OnGetConfiguration handles GetConfiguration requests
-func (s *Server) OnGetConfiguration(chargePointId string, request *core.GetConfigurationRequest) (*core.GetConfigurationConfirmation, error) {
-	s.logger.Info("GetConfiguration received", zap.String("charge_point_id", chargePointId))
-
-	return &core.GetConfigurationConfirmation{
-		ConfigurationKey: []core.ConfigurationKey{},
-		UnknownKey:       request.Key,
-	}, nil
-}
-
-// OnRemoteStartTransaction handles RemoteStartTransaction requests
-func (s *Server) OnRemoteStartTransaction(chargePointId string, request *core.RemoteStartTransactionRequest) (*core.RemoteStartTransactionConfirmation, error) {
-	s.logger.Info("RemoteStartTransaction received",
-		zap.String("charge_point_id", chargePointId),
-		zap.String("id_tag", request.IdTag),
-	)
-
-	return &core.RemoteStartTransactionConfirmation{
-		Status: types.RemoteStartStopStatusAccepted,
-	}, nil
-}
-
-// OnRemoteStopTransaction handles RemoteStopTransaction requests
-func (s *Server) OnRemoteStopTransaction(chargePointId string, request *core.RemoteStopTransactionRequest) (*core.RemoteStopTransactionConfirmation, error) {
-	s.logger.Info("RemoteStopTransaction received",
-		zap.String("charge_point_id", chargePointId),
-		zap.Int("tx_id", request.TransactionId),
-	)
-
-	return &core.RemoteStopTransactionConfirmation{
-		Status: types.RemoteStartStopStatusAccepted,
-	}, nil
-}
-
-// OnReset handles Reset requests
-func (s *Server) OnReset(chargePointId string, request *core.ResetRequest) (*core.ResetConfirmation, error) {
-	s.logger.Info("Reset received",
-		zap.String("charge_point_id", chargePointId),
-		zap.String("type", string(request.Type)),
-	)
-
-	return &core.ResetConfirmation{
-		Status: core.ResetStatusAccepted,
-	}, nil
-}
-
-// OnUnlockConnector handles UnlockConnector requests
-func (s *Server) OnUnlockConnector(chargePointId string, request *core.UnlockConnectorRequest) (*core.UnlockConnectorConfirmation, error) {
-	s.logger.Info("UnlockConnector received",
-		zap.String("charge_point_id", chargePointId),
-		zap.Int("connector_id", request.ConnectorId),
-	)
-
-	return &core.UnlockConnectorConfirmation{
-		Status: core.UnlockStatusUnlocked,
-	}, nil
-}
-
 // processOCPPMessage takes a raw message from the charger and figures out what to do with it
 // OCPP messages are JSON arrays with specific formats for different types of communication
 func (s *Server) processOCPPMessage(chargePointId string, message []byte) ([]byte, error) {
-	s.logger.Info("Processing message from charger",
+	s.logger.Debug("Processing message from charger",
 		zap.String("charge_point_id", chargePointId),
 		zap.String("message", string(message)))
 
 	// Parse the JSON message from the charger
-	var ocppMessage []interface{}
+	var ocppMessage []json.RawMessage
 	if err := json.Unmarshal(message, &ocppMessage); err != nil {
+		// A CALL whose payload is broken can still be answered if its message ID is readable
+		if messageId, ok := callMessageId(message); ok {
+			return callErrorFrame(messageId, ErrorCodeFormationViolation, "The payload must be valid JSON", nil)
+		}
 		return nil, err
 	}
 
-	// OCPP messages must have at least 3 parts: [messageType, messageId, action]
+	// OCPP messages must have at least 3 parts: [messageType, messageId, ...]
 	if len(ocppMessage) < 3 {
 		return nil, fmt.Errorf("invalid OCPP message format")
 	}
 
 	// Get the message type (2 = request, 3 = response, 4 = error)
-	messageType, ok := ocppMessage[0].(float64)
-	if !ok {
+	var messageType int
+	if err := json.Unmarshal(ocppMessage[0], &messageType); err != nil {
 		return nil, fmt.Errorf("invalid message type")
 	}
 
 	// Get the unique message ID (used to match requests with responses)
-	messageId, ok := ocppMessage[1].(string)
-	if !ok {
+	var messageId string
+	if err := json.Unmarshal(ocppMessage[1], &messageId); err != nil {
 		return nil, fmt.Errorf("invalid message ID")
 	}
 
-	// Get the action (what the charger wants to do)
-	action, ok := ocppMessage[2].(string)
-	if !ok {
-		return nil, fmt.Errorf("invalid action")
-	}
-
 	// Handle different types of messages from the charger
-	switch int(messageType) {
-	case 2: // CALL - The charger is asking us to do something
-		return s.handleOCPPRequest(chargePointId, messageId, action, ocppMessage[3])
-	case 3: // CALLRESULT - The charger is responding to something we asked
-		return nil, nil // We don't send commands to chargers yet, so ignore responses
-	case 4: // CALLERROR - The charger is telling us there was an error
-		return nil, nil // We don't handle errors from chargers yet
+	switch messageType {
+	case 2: // CALL - The charger is asking us to do something: [2, messageId, action, payload]
+		// The message ID is known, so a malformed CALL can still be answered
+		if len(ocppMessage) != 4 {
+			return callErrorFrame(messageId, ErrorCodeFormationViolation, "A CALL must have 4 elements", nil)
+		}
+		var action string
+		if err := json.Unmarshal(ocppMessage[2], &action); err != nil {
+			return callErrorFrame(messageId, ErrorCodeFormationViolation, "The action must be a string", nil)
+		}
+		var payload interface{}
+		if err := json.Unmarshal(ocppMessage[3], &payload); err != nil {
+			return callErrorFrame(messageId, ErrorCodeFormationViolation, "The payload must be valid JSON", nil)
+		}
+		return s.handleOCPPRequest(chargePointId, messageId, action, payload)
+	case 3: // CALLRESULT - The charger is responding to something we asked: [3, messageId, payload]
+		s.handleCallResult(chargePointId, messageId, ocppMessage[2])
+		return nil, nil
+	case 4: // CALLERROR - The charger could not process our request: [4, messageId, errorCode, errorDescription, errorDetails]
+		if len(ocppMessage) < 4 {
+			return nil, fmt.Errorf("invalid CALLERROR format")
+		}
+		var errorCode, errorDescription string
+		if err := json.Unmarshal(ocppMessage[2], &errorCode); err != nil {
+			return nil, fmt.Errorf("invalid error code")
+		}
+		_ = json.Unmarshal(ocppMessage[3], &errorDescription)
+		var errorDetails json.RawMessage
+		if len(ocppMessage) > 4 {
+			errorDetails = ocppMessage[4]
+		}
+		s.handleCallError(chargePointId, messageId, errorCode, errorDescription, errorDetails)
+		return nil, nil
 	default:
-		return nil, fmt.Errorf("unknown message type: %d", int(messageType))
+		return nil, fmt.Errorf("unknown message type: %d", messageType)
 	}
 }
 
@@ -632,6 +723,30 @@ func (s *Server) handleOCPPRequest(chargePointId, messageId, action string, payl
 		zap.String("action", action),
 		zap.String("message_id", messageId))
 
+	// Actions that are not part of OCPP 1.6 at all are not implemented
+	if _, ok := schemas[action]; !ok {
+		s.logger.Info("Unknown request type from charger", zap.String("action", action))
+		return callErrorFrame(messageId, ErrorCodeNotImplemented, "Action not implemented", nil)
+	}
+
+	// Check the payload before any handler trusts its fields
+	payload, violations, err := validatePayload(action, payload, s.validationMode(chargePointId))
+	if err != nil {
+		schemaErr := err.(*SchemaError)
+		s.logger.Warn("Rejected request that does not match the OCPP 1.6 schema",
+			zap.String("charge_point_id", chargePointId),
+			zap.String("action", action),
+			zap.Strings("violations", violationStrings(schemaErr.Violations)))
+		return callErrorFrame(messageId, schemaErr.Code(), schemaErr.Violations[0].String(),
+			map[string]interface{}{"violations": schemaErr.Violations})
+	}
+	if len(violations) > 0 {
+		s.logger.Warn("Accepted request with schema violations (lenient mode)",
+			zap.String("charge_point_id", chargePointId),
+			zap.String("action", action),
+			zap.Strings("violations", violationStrings(violations)))
+	}
+
 	var response interface{}
 
 	// Route the request to the appropriate handler based on what the charger wants to do
@@ -657,18 +772,24 @@ func (s *Server) handleOCPPRequest(chargePointId, messageId, action string, payl
 	case "Heartbeat":
 		// Charger is checking if we're still alive and updating its last seen time
 		response = s.handleHeartbeatRequest(chargePointId, payload)
+	case "FirmwareStatusNotification":
+		// Charger is reporting the progress of a firmware update
+		response = s.handleFirmwareStatusNotificationRequest(chargePointId, payload)
+	case "DiagnosticsStatusNotification":
+		// Charger is reporting the progress of a diagnostics upload
+		response = s.handleDiagnosticsStatusNotificationRequest(chargePointId, payload)
 	default:
-		// We don't know how to handle this type of request
-		s.logger.Info("Unknown request type from charger", zap.String("action", action))
-		// Send back an error saying we don't support this
-		errorResponse := []interface{}{
-			4, // CALLERROR
-			messageId,
-			"NotImplemented",
-			"Action not implemented",
-			"{}",
-		}
-		return json.Marshal(errorResponse)
+		// A valid OCPP 1.6 action we have no handler for
+		s.logger.Info("Unsupported request type from charger", zap.String("action", action))
+		return callErrorFrame(messageId, ErrorCodeNotSupported, "Action not supported", nil)
+	}
+
+	// A response that breaks the schema is our bug; it is still sent so the charger is not left waiting
+	if err := checkOutgoingPayload(action+"Response", response); err != nil {
+		s.logger.Error("Response does not match the OCPP 1.6 schema",
+			zap.String("charge_point_id", chargePointId),
+			zap.String("action", action),
+			zap.Error(err))
 	}
 
 	// Send back a success response to the charger
@@ -701,25 +822,7 @@ func (s *Server) handleBootNotificationRequest(chargePointId string, payload int
 	firmwareVersion, _ := payloadMap["firmwareVersion"].(string)
 
 	// Add or update the charger in our database
-	query := `
-		INSERT INTO chargers (identity, name, model, vendor, firmware, last_seen)
-		VALUES (?, ?, ?, ?, ?, ?)
-		ON CONFLICT(identity) DO UPDATE SET
-			model = excluded.model,
-			vendor = excluded.vendor,
-			firmware = excluded.firmware,
-			last_seen = excluded.last_seen
-	`
-
-	_, err := s.db.ExecContext(context.Background(), query,
-		chargePointId,
-		chargePointId, // Use the ID as the name if no name provided
-		chargePointModel,
-		chargePointVendor,
-		firmwareVersion,
-		time.Now(),
-	)
-
+	err := s.registerCharger(context.Background(), chargePointId, chargePointModel, chargePointVendor, firmwareVersion, ProtocolOCPP16)
 	if err != nil {
 		s.logger.Error("Failed to register charger", zap.Error(err))
 		return map[string]interface{}{
@@ -732,6 +835,25 @@ func (s *Server) handleBootNotificationRequest(chargePointId string, payload int
 		zap.String("model", chargePointModel),
 		zap.String("vendor", chargePointVendor))
 
+	s.events.Publish(EventBoot, chargePointId, map[string]interface{}{
+		"model":    chargePointModel,
+		"vendor":   chargePointVendor,
+		"firmware": firmwareVersion,
+	})
+
+	// A charger that rebooted into new firmware has finished its update
+	s.completeFirmwareUpdateOnBoot(context.Background(), chargePointId, firmwareVersion)
+
+	// Bring the charger's offline authorization list up to date once it knows it has been accepted
+	s.afterResponse(chargePointId, func() {
+		s.syncLocalListInBackground(chargePointId)
+	})
+
+	// A rebooted charger may have lost its profiles, so its time-of-use schedule is sent again
+	s.afterResponse(chargePointId, func() {
+		s.pushChargerTOUSchedule(chargePointId)
+	})
+
 	// Tell the charger we accept it and how often to send status updates (every 5 minutes)
 	return map[string]interface{}{
 		"status":      "Accepted",
@@ -752,19 +874,24 @@ func (s *Server) handleStatusNotificationRequest(chargePointId string, payload i
 		s.logger.Error("Failed to update charger last seen time", zap.Error(err))
 	}
 
-	// Parse the status to check if charger just became available (connected)
+	// Parse the connector status and remember it
 	payloadMap, ok := payload.(map[string]interface{})
 	if ok {
-		status, _ := payloadMap["status"].(string)
-		connectorId, _ := payloadMap["connectorId"].(float64)
+		status := parseConnectorStatus(payloadMap)
 
 		s.logger.Info("Status notification details",
 			zap.String("charge_point_id", chargePointId),
-			zap.String("status", status),
-			zap.Float64("connector_id", connectorId))
+			zap.String("status", status.Status),
+			zap.String("error_code", status.ErrorCode),
+			zap.Int("connector_id", status.ConnectorId))
+
+		if err := s.recordConnectorStatus(context.Background(), chargePointId, status); err != nil {
+			s.logger.Error("Failed to record connector status", zap.Error(err))
+		}
+		s.events.Publish(EventStatusChange, chargePointId, status)
 
 		// When connector 1 reports Available, request meter values
-		if status == "Available" && connectorId == 1 {
+		if status.Status == "Available" && status.ConnectorId == 1 {
 			s.logger.Info("Charger connector 1 available, will trigger meter values request after response",
 				zap.String("charge_point_id", chargePointId))
 			// Trigger meter values after a short delay to avoid concurrent writes
@@ -804,84 +931,89 @@ func (s *Server) handleMeterValuesRequest(chargePointId string, payload interfac
 		return map[string]interface{}{}
 	}
 
-	// Process each meter reading
-	for _, mv := range meterValues {
-		meterValue, ok := mv.(map[string]interface{})
-		if !ok {
-			continue
-		}
+	// Find the charger in our database
+	var chargerID int64
+	err = s.db.QueryRowContext(context.Background(), "SELECT id FROM chargers WHERE identity = ?", chargePointId).Scan(&chargerID)
+	if err != nil {
+		s.logger.Error("Charger not found in database", zap.Error(err))
+		return map[string]interface{}{}
+	}
 
-		// Get the timestamp (for future use in storing meter readings)
-		timestampStr, _ := meterValue["timestamp"].(string)
-		_, err := time.Parse(time.RFC3339, timestampStr)
-		if err != nil {
-			s.logger.Error("Invalid timestamp in meter values", zap.Error(err))
-			continue
-		}
+	connectorId, _ := payloadMap["connectorId"].(float64)
 
-		// Get the sampled values (the actual readings)
-		sampledValues, ok := meterValue["sampledValue"].([]interface{})
-		if !ok {
-			continue
+	// Link the readings to the transaction they belong to, if the charger told us
+	var transactionRowID *int64
+	txID, hasTransaction := payloadMap["transactionId"].(float64)
+	if hasTransaction {
+		transactionRowID, err = s.findTransactionRowID(context.Background(), chargerID, int(txID))
+		if err != nil {
+			s.logger.Warn("Meter values for unknown transaction",
+				zap.String("charge_point_id", chargePointId),
+				zap.Int("transaction_id", int(txID)),
+				zap.Error(err))
 		}
+	}
 
-		for _, sv := range sampledValues {
-			sampledValue, ok := sv.(map[string]interface{})
-			if !ok {
-				continue
-			}
-
-			// Look for energy readings
-			measurand, _ := sampledValue["measurand"].(string)
-			if measurand == "Energy.Active.Import.Register" {
-				valueStr, _ := sampledValue["value"].(string)
-				value, err := strconv.ParseFloat(valueStr, 64)
-				if err != nil {
-					s.logger.Error("Invalid energy value", zap.Error(err))
-					continue
-				}
-
-				// Use the value as-is since it's already in Wh
-				valueWh := value
+	values := s.parseMeterValues(meterValues, int(connectorId), transactionRowID)
 
-				// Find the charger in our database
-				var chargerID int64
-				err = s.db.QueryRowContext(context.Background(), "SELECT id FROM chargers WHERE identity = ?", chargePointId).Scan(&chargerID)
-				if err != nil {
-					s.logger.Error("Charger not found in database", zap.Error(err))
-					continue
-				}
+	if err := s.recordMeterValues(context.Background(), chargerID, values); err != nil {
+		s.logger.Error("Failed to store meter values", zap.Error(err))
+	}
 
-				// Set total_energy_wh to the current cumulative meter reading
-				// Energy.Active.Import.Register is the total energy delivered by this charger since installation
-				updateQuery := `
-					UPDATE chargers 
-					SET total_energy_wh = ?
-					WHERE id = ?
-				`
+	for _, value := range values {
+		event := map[string]interface{}{
+			"connector_id": value.ConnectorId,
+			"measurand":    value.Measurand,
+			"phase":        value.Phase,
+			"unit":         value.Unit,
+			"value":        value.Value,
+			"timestamp":    value.Timestamp,
+		}
+		if hasTransaction {
+			event["transaction_id"] = int(txID)
+		}
 
-				result, err := s.db.ExecContext(context.Background(), updateQuery,
-					int64(valueWh),
-					chargerID,
+		// The charger-wide energy register (no phase) is the total energy delivered since installation
+		if value.Measurand == MeasurandEnergyActiveImportRegister && value.Phase == nil && value.Value != nil {
+			valueWh := *value.Value
+			event["value_wh"] = valueWh
+
+			// Set total_energy_wh to the current cumulative meter reading
+			updateQuery := `
+				UPDATE chargers 
+				SET total_energy_wh = ?
+				WHERE id = ?
+			`
+
+			if _, err := s.db.ExecContext(context.Background(), updateQuery, int64(valueWh), chargerID); err != nil {
+				s.logger.Error("Failed to update energy reading", zap.Error(err))
+			} else {
+				s.logger.Info("Updated total_energy_wh from charger's cumulative meter reading",
+					zap.String("charge_point_id", chargePointId),
+					zap.Float64("meter_reading_wh", valueWh),
+					zap.Float64("meter_reading_kwh", valueWh/1000.0),
 				)
+			}
+		}
 
-				if err != nil {
-					s.logger.Error("Failed to update energy reading", zap.Error(err))
-					continue
-				}
+		s.events.Publish(EventMeterSample, chargePointId, event)
+	}
 
-				rowsAffected, _ := result.RowsAffected()
-				if rowsAffected > 0 {
-					s.logger.Info("Updated total_energy_wh from charger's cumulative meter reading",
-						zap.String("charge_point_id", chargePointId),
-						zap.Float64("meter_reading_wh", valueWh),
-						zap.Float64("meter_reading_kwh", valueWh/1000.0),
-					)
-				}
+	// Live current and power readings let the load manager hand unused capacity to other sessions
+	if transactionRowID != nil {
+		for _, value := range values {
+			if value.Measurand == "Current.Import" || value.Measurand == "Power.Active.Import" {
+				go s.rebalanceChargerSite(chargePointId)
+				break
 			}
 		}
 	}
 
+	s.logger.Info("Meter values stored",
+		zap.String("charge_point_id", chargePointId),
+		zap.Int("connector_id", int(connectorId)),
+		zap.Int("samples", len(values)))
+
 	return map[string]interface{}{}
 }
 
@@ -901,10 +1033,8 @@ func (s *Server) handleStartTransactionRequest(chargePointId string, payload int
 		}
 	}
 
-	// Get the user's RFID card ID (not used for billing yet)
-	_, _ = payloadMap["idTag"].(string)
-	// Get the energy meter reading when charging started
-	meterStart, _ := payloadMap["meterStart"].(float64)
+	// Get the connector, RFID card ID, starting meter reading and start time
+	start := parseTransactionStart(payloadMap)
 
 	// Find the charger in our database
 	var chargerID int64
@@ -918,22 +1048,32 @@ func (s *Server) handleStartTransactionRequest(chargePointId string, payload int
 		}
 	}
 
-	// Create a unique transaction ID (using current timestamp)
-	txID := int(time.Now().Unix())
+	// A charger that lost our response sends the same StartTransaction again - give it the same ID
+	txID, duplicate, err := s.findDuplicateTransaction(context.Background(), chargerID, start)
+	if err != nil {
+		s.logger.Error("Failed to check for duplicate charging session", zap.Error(err))
+	}
+	if duplicate {
+		s.logger.Info("Duplicate charging session start, returning existing transaction",
+			zap.String("charge_point_id", chargePointId),
+			zap.Int("transaction_id", txID))
 
-	// Record the new charging session in our database
-	query := `
-		INSERT INTO transactions (charger_id, tx_id, start_ts, start_meter_wh)
-		VALUES (?, ?, ?, ?)
-	`
+		// The session already exists, so it must not count as its own concurrent transaction
+		return map[string]interface{}{
+			"transactionId": txID,
+			"idTagInfo":     s.authorizeIdTag(context.Background(), start.IdTag, nil),
+		}
+	}
 
-	_, err = s.db.ExecContext(context.Background(), query,
-		chargerID,
-		txID,
-		time.Now(),
-		int64(meterStart),
-	)
+	// Check the card before recording the session
+	// The session is recorded either way - the charger stops it if the card is not Accepted
+	idTagInfo := s.authorizeIdTag(context.Background(), start.IdTag, &tagLocation{
+		ChargePointId: chargePointId,
+		ConnectorId:   start.ConnectorId,
+	})
 
+	// Record the new charging session in our database
+	txID, err = s.insertTransaction(context.Background(), chargerID, start)
 	if err != nil {
 		s.logger.Error("Failed to record charging session", zap.Error(err))
 		return map[string]interface{}{
@@ -943,16 +1083,35 @@ func (s *Server) handleStartTransactionRequest(chargePointId string, payload int
 		}
 	}
 
+	// The reserved connector has been taken by the transaction it was held for
+	if start.ReservationId != nil {
+		s.useReservation(context.Background(), chargerID, *start.ReservationId, txID)
+	}
+
 	s.logger.Info("Charging session recorded",
 		zap.String("charge_point_id", chargePointId),
 		zap.Int("transaction_id", txID),
-		zap.Float64("start_meter_wh", meterStart))
+		zap.Int("connector_id", start.ConnectorId),
+		zap.String("id_tag", start.IdTag),
+		zap.String("id_tag_status", string(idTagInfo.Status)),
+		zap.Int64("start_meter_wh", start.MeterStart))
+
+	s.events.Publish(EventTransactionStart, chargePointId, map[string]interface{}{
+		"transaction_id": txID,
+		"connector_id":   start.ConnectorId,
+		"id_tag":         start.IdTag,
+		"meter_start_wh": start.MeterStart,
+	})
+
+	// A new session takes a share of the site capacity
+	// Its TxProfile can only be sent once the charger knows the transaction ID from our answer
+	s.afterResponse(chargePointId, func() {
+		s.rebalanceChargerSite(chargePointId)
+	})
 
 	return map[string]interface{}{
 		"transactionId": txID,
-		"idTagInfo": map[string]interface{}{
-			"status": "Accepted",
-		},
+		"idTagInfo":     idTagInfo,
 	}
 }
 
@@ -975,6 +1134,10 @@ func (s *Server) handleStopTransactionRequest(chargePointId string, payload inte
 	// Get the transaction ID and final energy meter reading
 	transactionId, _ := payloadMap["transactionId"].(float64)
 	meterStop, _ := payloadMap["meterStop"].(float64)
+	// The card used to stop charging is optional (e.g. the cable was pulled)
+	idTag, _ := payloadMap["idTag"].(string)
+	// Stored on the charger's clock, like the start time, so session durations use a single clock
+	stopTs := parseTransactionTimestamp(payloadMap)
 
 	// Update the charging session with end time and calculate energy used
 	query := `
@@ -984,7 +1147,7 @@ func (s *Server) handleStopTransactionRequest(chargePointId string, payload inte
 	`
 
 	_, err := s.db.ExecContext(context.Background(), query,
-		time.Now(),
+		stopTs,
 		int64(meterStop),
 		int64(meterStop),
 		int64(transactionId),
@@ -997,30 +1160,64 @@ func (s *Server) handleStopTransactionRequest(chargePointId string, payload inte
 			zap.String("charge_point_id", chargePointId),
 			zap.Int64("transaction_id", int64(transactionId)),
 			zap.Float64("final_meter_wh", meterStop))
+
+		s.events.Publish(EventTransactionStop, chargePointId, map[string]interface{}{
+			"transaction_id": int64(transactionId),
+			"meter_stop_wh":  int64(meterStop),
+		})
+
+		// The session is complete, so its cost can be calculated
+		go s.priceStoppedTransaction(chargePointId, int(transactionId))
+	}
+
+	// Readings the charger took during the session are stored like any other meter values
+	if transactionData, ok := payloadMap["transactionData"].([]interface{}); ok && len(transactionData) > 0 {
+		s.recordTransactionData(chargePointId, int(transactionId), transactionData)
+	}
+
+	// Availability changes the charger scheduled during the session can be applied once it has our answer
+	s.afterResponse(chargePointId, func() {
+		s.reapplyScheduledAvailability(chargePointId)
+	})
+
+	// The capacity this session used can go to the others on the site
+	go s.rebalanceChargerSite(chargePointId)
+
+	// idTagInfo is only returned when the charger told us which card stopped the session
+	if idTag == "" {
+		return map[string]interface{}{}
 	}
 
 	return map[string]interface{}{
-		"idTagInfo": map[string]interface{}{
-			"status": "Accepted",
-		},
+		"idTagInfo": s.authorizeIdTag(context.Background(), idTag, nil),
 	}
 }
 
 // handleAuthorizeRequest handles when someone tries to use their RFID card to start charging
-// For now, we accept all cards - in a real system you'd check if the card is valid and has credit
+// The card is checked against the id_tags table - unknown, blocked and expired cards are refused
 func (s *Server) handleAuthorizeRequest(chargePointId string, payload interface{}) interface{} {
 	s.logger.Info("RFID card authorization request", zap.String("charge_point_id", chargePointId))
 
-	// In a real system, you would:
-	// 1. Check if the RFID card exists in your user database
-	// 2. Verify the user has sufficient credit
-	// 3. Check if the card is not blocked
-	// For now, we just accept everyone
+	payloadMap, ok := payload.(map[string]interface{})
+	if !ok {
+		s.logger.Error("Invalid authorization data")
+		return map[string]interface{}{
+			"idTagInfo": map[string]interface{}{
+				"status": "Invalid",
+			},
+		}
+	}
+
+	idTag, _ := payloadMap["idTag"].(string)
+	idTagInfo := s.authorizeIdTag(context.Background(), idTag, &tagLocation{ChargePointId: chargePointId})
+
+	s.logger.Info("RFID card authorization result",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("id_tag", idTag),
+		zap.String("status", string(idTagInfo.Status)))
 
 	return map[string]interface{}{
-		"idTagInfo": map[string]interface{}{
-			"status": "Accepted",
-		},
+		"idTagInfo": idTagInfo,
 	}
 }
 
@@ -1042,6 +1239,57 @@ func (s *Server) handleHeartbeatRequest(chargePointId string, payload interface{
 	}
 }
 
+// registerCharger adds a booted charger to the database or updates what it told us about itself
+func (s *Server) registerCharger(ctx context.Context, chargePointId, model, vendor, firmware, protocol string) error {
+	query := `
+		INSERT INTO chargers (identity, name, model, vendor, firmware, last_seen, ocpp_version)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(identity) DO UPDATE SET
+			model = excluded.model,
+			vendor = excluded.vendor,
+			firmware = excluded.firmware,
+			last_seen = excluded.last_seen,
+			ocpp_version = excluded.ocpp_version
+	`
+
+	_, err := s.db.ExecContext(ctx, query,
+		chargePointId,
+		chargePointId, // Use the ID as the name if no name provided
+		model,
+		vendor,
+		firmware,
+		time.Now(),
+		protocol,
+	)
+	return err
+}
+
+// recordProtocol remembers which OCPP version a known charger connected with
+// Chargers that have not booted yet get it with their BootNotification
+func (s *Server) recordProtocol(chargePointId, protocol string) {
+	_, err := s.db.ExecContext(context.Background(), `UPDATE chargers SET ocpp_version = ? WHERE identity = ?`, protocol, chargePointId)
+	if err != nil {
+		s.logger.Error("Failed to record charger OCPP version", zap.String("charge_point_id", chargePointId), zap.Error(err))
+	}
+}
+
+// callMessageId reads the message ID of a CALL from the start of a frame that is not valid JSON as a whole
+func callMessageId(message []byte) (string, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return "", false
+	}
+	if token, err := decoder.Token(); err != nil || token != float64(2) {
+		return "", false
+	}
+	token, err := decoder.Token()
+	if err != nil {
+		return "", false
+	}
+	messageId, ok := token.(string)
+	return messageId, ok
+}
+
 // getClientIP extracts the client IP address from the HTTP request
 func getClientIP(r *http.Request) string {
 	// Check for X-Forwarded-For header (for proxies/load balancers)
@@ -1076,99 +1324,26 @@ func getClientIP(r *http.Request) string {
 	return ip
 }
 
-// sendTriggerMessage sends a TriggerMessage request to the charging station
+// sendTriggerMessage asks the charging station to send the given message and logs its answer
 func (s *Server) sendTriggerMessage(chargePointId string, requestedMessage string) {
-	// Check if we have a connection for this charger
-	conn, exists := s.connections[chargePointId]
-	if !exists {
-		s.logger.Error("No WebSocket connection found for charger", zap.String("charge_point_id", chargePointId))
-		return
+	connectorId := 0 // 0 means the whole charge point
+	request := &TriggerMessageRequest{
+		RequestedMessage: MessageTrigger(requestedMessage),
+		ConnectorId:      &connectorId,
 	}
 
-	// Create TriggerMessage request (OCPP 1.6)
-	request := map[string]interface{}{
-		"requestedMessage": requestedMessage,
-		"connectorId":      0, // 0 means the whole charge point
-	}
-
-	// Convert to OCPP message format: [2, messageId, "TriggerMessage", payload]
-	messageId := fmt.Sprintf("trigger_%s_%d", requestedMessage, time.Now().Unix())
-	ocppMessage := []interface{}{
-		2,                // CALL (request)
-		messageId,        // unique message ID
-		"TriggerMessage", // action
-		request,          // payload
-	}
-
-	// Marshal to JSON
-	messageBytes, err := json.Marshal(ocppMessage)
+	response, err := s.Call(context.Background(), chargePointId, TriggerMessageFeatureName, request)
 	if err != nil {
-		s.logger.Error("Failed to marshal TriggerMessage request", zap.Error(err))
-		return
-	}
-
-	s.logger.Info("Sending TriggerMessage request to charger",
-		zap.String("charge_point_id", chargePointId),
-		zap.String("requested_message", requestedMessage),
-		zap.String("message_id", messageId))
-
-	// Send the message to the charger via WebSocket
-	if err := conn.WriteMessage(websocket.TextMessage, messageBytes); err != nil {
-		s.logger.Error("Failed to send TriggerMessage request to charger",
+		s.logger.Error("TriggerMessage request failed",
 			zap.String("charge_point_id", chargePointId),
+			zap.String("requested_message", requestedMessage),
 			zap.Error(err))
 		return
 	}
 
-	s.logger.Info("TriggerMessage request sent successfully",
+	confirmation := response.(*TriggerMessageConfirmation)
+	s.logger.Info("TriggerMessage answered by charger",
 		zap.String("charge_point_id", chargePointId),
 		zap.String("requested_message", requestedMessage),
-		zap.String("message_id", messageId))
-}
-
-// requestMeterValues sends a GetMeterValues request to the charging station
-func (s *Server) requestMeterValues(chargePointId string) {
-	// Create GetMeterValues request
-	request := map[string]interface{}{
-		"connectorId": 0, // 0 means main meter for the entire charge point
-	}
-
-	// Convert to OCPP message format: [2, messageId, "GetMeterValues", payload]
-	messageId := fmt.Sprintf("get_meter_%d", time.Now().Unix())
-	ocppMessage := []interface{}{
-		2,                // CALL (request)
-		messageId,        // unique message ID
-		"GetMeterValues", // action
-		request,          // payload
-	}
-
-	// Marshal to JSON
-	messageBytes, err := json.Marshal(ocppMessage)
-	if err != nil {
-		s.logger.Error("Failed to marshal GetMeterValues request", zap.Error(err))
-		return
-	}
-
-	s.logger.Info("Sending GetMeterValues request to charger",
-		zap.String("charge_point_id", chargePointId),
-		zap.String("message_id", messageId))
-
-	// Check if we have a connection for this charger
-	conn, exists := s.connections[chargePointId]
-	if !exists {
-		s.logger.Error("No WebSocket connection found for charger", zap.String("charge_point_id", chargePointId))
-		return
-	}
-
-	// Send the message to the charger via WebSocket
-	if err := conn.WriteMessage(websocket.TextMessage, messageBytes); err != nil {
-		s.logger.Error("Failed to send GetMeterValues request to charger",
-			zap.String("charge_point_id", chargePointId),
-			zap.Error(err))
-		return
-	}
-
-	s.logger.Info("GetMeterValues request sent successfully",
-		zap.String("charge_point_id", chargePointId),
-		zap.String("message_id", messageId))
+		zap.String("status", string(confirmation.Status)))
 }
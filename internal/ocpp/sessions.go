@@ -0,0 +1,88 @@
+package ocpp
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// IsConnected reports whether the charger currently has an open WebSocket
+func (s *Server) IsConnected(chargePointId string) bool {
+	return s.getConnection(chargePointId) != nil
+}
+
+// openConnectionSession records a new WebSocket connection in charger_connections
+// It returns the session ID, or 0 if the session could not be recorded
+func (s *Server) openConnectionSession(chargePointId, remoteIP string) int64 {
+	query := `
+		INSERT INTO charger_connections (identity, remote_ip, connected_at)
+		VALUES (?, ?, ?)
+	`
+
+	result, err := s.db.ExecContext(context.Background(), query, chargePointId, remoteIP, time.Now())
+	if err != nil {
+		s.logger.Error("Failed to record connection session", zap.String("charge_point_id", chargePointId), zap.Error(err))
+		return 0
+	}
+
+	sessionID, err := result.LastInsertId()
+	if err != nil {
+		s.logger.Error("Failed to get connection session ID", zap.String("charge_point_id", chargePointId), zap.Error(err))
+		return 0
+	}
+
+	return sessionID
+}
+
+// closeConnectionSession records when and why a WebSocket connection ended
+func (s *Server) closeConnectionSession(sessionID int64, closeCode int, closeReason string) {
+	if sessionID == 0 {
+		return
+	}
+
+	query := `
+		UPDATE charger_connections
+		SET disconnected_at = ?, close_code = ?, close_reason = ?
+		WHERE id = ?
+	`
+
+	_, err := s.db.ExecContext(context.Background(), query, time.Now(), closeCode, closeReason, sessionID)
+	if err != nil {
+		s.logger.Error("Failed to close connection session", zap.Int64("session_id", sessionID), zap.Error(err))
+	}
+}
+
+// closeStaleConnectionSessions ends sessions left open by a previous run of the server
+func (s *Server) closeStaleConnectionSessions() {
+	query := `
+		UPDATE charger_connections
+		SET disconnected_at = ?, close_reason = ?
+		WHERE disconnected_at IS NULL
+	`
+
+	result, err := s.db.ExecContext(context.Background(), query, time.Now(), "Server restarted")
+	if err != nil {
+		s.logger.Error("Failed to close stale connection sessions", zap.Error(err))
+		return
+	}
+
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+		s.logger.Info("Closed stale connection sessions", zap.Int64("sessions", rowsAffected))
+	}
+}
+
+// closeInfo extracts the WebSocket close code and reason from the error that ended the read loop
+func closeInfo(err error) (int, string) {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return closeErr.Code, closeErr.Text
+	}
+	if err != nil {
+		// No close frame was received, e.g. the network dropped
+		return websocket.CloseAbnormalClosure, err.Error()
+	}
+	return websocket.CloseNormalClosure, ""
+}
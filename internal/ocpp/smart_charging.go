@@ -0,0 +1,164 @@
+package ocpp
+
+import (
+	"reflect"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+)
+
+// The charging profile types used by the SmartCharging messages come from ocpp1.6/types
+
+// -------------------- Set Charging Profile (CS -> CP) --------------------
+
+const SetChargingProfileFeatureName = "SetChargingProfile"
+
+// ChargingProfileStatus is the charger's answer to a SetChargingProfileRequest
+type ChargingProfileStatus string
+
+const (
+	ChargingProfileStatusAccepted     ChargingProfileStatus = "Accepted"
+	ChargingProfileStatusRejected     ChargingProfileStatus = "Rejected"
+	ChargingProfileStatusNotSupported ChargingProfileStatus = "NotSupported"
+)
+
+// SetChargingProfileRequest installs a charging profile on a connector (0 for the whole charger)
+type SetChargingProfileRequest struct {
+	ConnectorId     int                    `json:"connectorId"`
+	ChargingProfile *types.ChargingProfile `json:"csChargingProfiles"`
+}
+
+// SetChargingProfileConfirmation is the charger's reply to a SetChargingProfileRequest
+type SetChargingProfileConfirmation struct {
+	Status ChargingProfileStatus `json:"status"`
+}
+
+// SetChargingProfileFeature describes the SetChargingProfile request/confirmation pair
+type SetChargingProfileFeature struct{}
+
+func (f SetChargingProfileFeature) GetFeatureName() string {
+	return SetChargingProfileFeatureName
+}
+
+func (f SetChargingProfileFeature) GetRequestType() reflect.Type {
+	return reflect.TypeOf(SetChargingProfileRequest{})
+}
+
+func (f SetChargingProfileFeature) GetResponseType() reflect.Type {
+	return reflect.TypeOf(SetChargingProfileConfirmation{})
+}
+
+func (r SetChargingProfileRequest) GetFeatureName() string {
+	return SetChargingProfileFeatureName
+}
+
+func (c SetChargingProfileConfirmation) GetFeatureName() string {
+	return SetChargingProfileFeatureName
+}
+
+// -------------------- Clear Charging Profile (CS -> CP) --------------------
+
+const ClearChargingProfileFeatureName = "ClearChargingProfile"
+
+// ClearChargingProfileStatus is the charger's answer to a ClearChargingProfileRequest
+type ClearChargingProfileStatus string
+
+const (
+	ClearChargingProfileStatusAccepted ClearChargingProfileStatus = "Accepted"
+	ClearChargingProfileStatusUnknown  ClearChargingProfileStatus = "Unknown"
+)
+
+// ClearChargingProfileRequest removes the charging profiles matching every given criterion
+// A request with an Id removes that profile and ignores the other criteria
+type ClearChargingProfileRequest struct {
+	Id                     *int                             `json:"id,omitempty"`
+	ConnectorId            *int                             `json:"connectorId,omitempty"`
+	ChargingProfilePurpose types.ChargingProfilePurposeType `json:"chargingProfilePurpose,omitempty"`
+	StackLevel             *int                             `json:"stackLevel,omitempty"`
+}
+
+// ClearChargingProfileConfirmation is the charger's reply to a ClearChargingProfileRequest
+type ClearChargingProfileConfirmation struct {
+	Status ClearChargingProfileStatus `json:"status"`
+}
+
+// ClearChargingProfileFeature describes the ClearChargingProfile request/confirmation pair
+type ClearChargingProfileFeature struct{}
+
+func (f ClearChargingProfileFeature) GetFeatureName() string {
+	return ClearChargingProfileFeatureName
+}
+
+func (f ClearChargingProfileFeature) GetRequestType() reflect.Type {
+	return reflect.TypeOf(ClearChargingProfileRequest{})
+}
+
+func (f ClearChargingProfileFeature) GetResponseType() reflect.Type {
+	return reflect.TypeOf(ClearChargingProfileConfirmation{})
+}
+
+func (r ClearChargingProfileRequest) GetFeatureName() string {
+	return ClearChargingProfileFeatureName
+}
+
+func (c ClearChargingProfileConfirmation) GetFeatureName() string {
+	return ClearChargingProfileFeatureName
+}
+
+// -------------------- Get Composite Schedule (CS -> CP) --------------------
+
+const GetCompositeScheduleFeatureName = "GetCompositeSchedule"
+
+// GetCompositeScheduleStatus is the charger's answer to a GetCompositeScheduleRequest
+type GetCompositeScheduleStatus string
+
+const (
+	GetCompositeScheduleStatusAccepted GetCompositeScheduleStatus = "Accepted"
+	GetCompositeScheduleStatusRejected GetCompositeScheduleStatus = "Rejected"
+)
+
+// GetCompositeScheduleRequest asks the charger for the limits it will apply over the next Duration seconds
+// Connector 0 asks for the expected consumption of the whole charger
+type GetCompositeScheduleRequest struct {
+	ConnectorId      int                        `json:"connectorId"`
+	Duration         int                        `json:"duration"`
+	ChargingRateUnit types.ChargingRateUnitType `json:"chargingRateUnit,omitempty"`
+}
+
+// GetCompositeScheduleConfirmation is the charger's reply to a GetCompositeScheduleRequest
+type GetCompositeScheduleConfirmation struct {
+	Status           GetCompositeScheduleStatus `json:"status"`
+	ConnectorId      *int                       `json:"connectorId,omitempty"`
+	ScheduleStart    *types.DateTime            `json:"scheduleStart,omitempty"`
+	ChargingSchedule *types.ChargingSchedule    `json:"chargingSchedule,omitempty"`
+}
+
+// GetCompositeScheduleFeature describes the GetCompositeSchedule request/confirmation pair
+type GetCompositeScheduleFeature struct{}
+
+func (f GetCompositeScheduleFeature) GetFeatureName() string {
+	return GetCompositeScheduleFeatureName
+}
+
+func (f GetCompositeScheduleFeature) GetRequestType() reflect.Type {
+	return reflect.TypeOf(GetCompositeScheduleRequest{})
+}
+
+func (f GetCompositeScheduleFeature) GetResponseType() reflect.Type {
+	return reflect.TypeOf(GetCompositeScheduleConfirmation{})
+}
+
+func (r GetCompositeScheduleRequest) GetFeatureName() string {
+	return GetCompositeScheduleFeatureName
+}
+
+func (c GetCompositeScheduleConfirmation) GetFeatureName() string {
+	return GetCompositeScheduleFeatureName
+}
+
+// SmartChargingProfile groups the messages of the OCPP 1.6 SmartCharging profile
+var SmartChargingProfile = ocpp.NewProfile("SmartCharging",
+	SetChargingProfileFeature{},
+	ClearChargingProfileFeature{},
+	GetCompositeScheduleFeature{},
+)
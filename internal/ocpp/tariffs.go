@@ -0,0 +1,471 @@
+package ocpp
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Units of a tariff's time price
+const (
+	TariffTimeUnitMinute = "minute"
+	TariffTimeUnitHour   = "hour"
+)
+
+var (
+	// ErrNoTariff is returned when no tariff applies to a transaction and there is no default tariff
+	ErrNoTariff = errors.New("no tariff applies to the transaction")
+	// ErrTransactionOpen is returned when pricing a transaction that has not stopped yet
+	ErrTransactionOpen = errors.New("transaction has not stopped yet")
+)
+
+// Tariff prices charging sessions; every price excludes VAT
+type Tariff struct {
+	ID               int64
+	Name             string
+	Currency         string
+	Location         *time.Location // Timezone of the time-of-day periods
+	EnergyPrice      float64        // Per kWh
+	TimePrice        float64        // Per TimeUnit of charging
+	TimeUnit         string
+	SessionFee       float64
+	IdlePrice        float64 // Per minute the car stays connected after charging completed
+	IdleGraceMinutes int
+	VATPercent       float64
+	Periods          []TariffPeriod
+}
+
+// TariffPeriod overrides the tariff's prices during a time-of-day window
+// A nil price keeps the tariff's base price; where periods overlap the first one wins
+type TariffPeriod struct {
+	Window      TOUWindow // Limit is unused
+	EnergyPrice *float64
+	TimePrice   *float64
+}
+
+// TransactionCost is the price of a charging session and how it was calculated
+type TransactionCost struct {
+	TariffID        int64      `json:"tariff_id"`
+	TariffName      string     `json:"tariff_name"`
+	Currency        string     `json:"currency"`
+	Timezone        string     `json:"timezone"` // Of the tariff's periods, for showing the lines in local time
+	EnergyKwh       float64    `json:"energy_kwh"`
+	EnergyCost      float64    `json:"energy_cost"`
+	ChargingMinutes float64    `json:"charging_minutes"`
+	TimeUnit        string     `json:"time_unit"` // Of the lines' time price
+	TimeCost        float64    `json:"time_cost"`
+	ChargingEnd     time.Time  `json:"charging_end"` // When the car stopped drawing energy
+	IdleMinutes     float64    `json:"idle_minutes"` // Billed minutes after ChargingEnd and the grace period
+	IdlePrice       float64    `json:"idle_price"`   // Per minute
+	IdleCost        float64    `json:"idle_cost"`
+	SessionFee      float64    `json:"session_fee"`
+	Subtotal        float64    `json:"subtotal"`
+	VATPercent      float64    `json:"vat_percent"`
+	VATAmount       float64    `json:"vat_amount"`
+	Total           float64    `json:"total"`
+	Lines           []CostLine `json:"lines"` // Charging time split by time-of-day price
+	ComputedAt      time.Time  `json:"computed_at"`
+}
+
+// CostLine is a stretch of charging at one energy and time price
+type CostLine struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	EnergyKwh   float64   `json:"energy_kwh"`
+	EnergyPrice float64   `json:"energy_price"`
+	EnergyCost  float64   `json:"energy_cost"`
+	Minutes     float64   `json:"minutes"`
+	TimePrice   float64   `json:"time_price"` // Per the tariff's time unit
+	TimeCost    float64   `json:"time_cost"`
+}
+
+// energyReading is the meter register of a transaction at an instant
+type energyReading struct {
+	ts time.Time
+	wh float64
+}
+
+// pricesAt returns the energy and time price in force at an instant
+func (t *Tariff) pricesAt(at time.Time) (float64, float64) {
+	energyPrice, timePrice := t.EnergyPrice, t.TimePrice
+
+	local := at.In(t.Location)
+	weekday, minute := local.Weekday(), local.Hour()*60+local.Minute()
+	for _, period := range t.Periods {
+		if !period.Window.covers(weekday, minute) {
+			continue
+		}
+		if period.EnergyPrice != nil {
+			energyPrice = *period.EnergyPrice
+		}
+		if period.TimePrice != nil {
+			timePrice = *period.TimePrice
+		}
+		break
+	}
+	return energyPrice, timePrice
+}
+
+// minutesPerTimeUnit converts the tariff's time price to a price per minute
+func (t *Tariff) minutesPerTimeUnit() float64 {
+	if t.TimeUnit == TariffTimeUnitMinute {
+		return 1
+	}
+	return 60
+}
+
+// priceEdges returns the instants between from and to at which a time-of-day price may change
+func (t *Tariff) priceEdges(from, to time.Time) []time.Time {
+	var edges []time.Time
+	if len(t.Periods) == 0 {
+		return edges
+	}
+
+	localFrom := from.In(t.Location)
+	day := time.Date(localFrom.Year(), localFrom.Month(), localFrom.Day(), 0, 0, 0, 0, t.Location)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		minutes := []int{0}
+		for _, period := range t.Periods {
+			minutes = append(minutes, period.Window.Start, period.Window.End)
+		}
+		for _, minute := range minutes {
+			edge := time.Date(day.Year(), day.Month(), day.Day(), 0, minute, 0, 0, t.Location)
+			if edge.After(from) && edge.Before(to) {
+				edges = append(edges, edge.In(from.Location()))
+			}
+		}
+	}
+	return edges
+}
+
+// price calculates the cost of a session from its start and stop and the register readings in between
+// Energy between two readings is spread evenly over the time between them. Charging ends at the first
+// reading of the final register value; without readings during the session the whole session is charging
+func (t *Tariff) price(start, stop time.Time, meterStartWh, meterStopWh float64, readings []energyReading) *TransactionCost {
+	if meterStopWh < meterStartWh {
+		meterStopWh = meterStartWh
+	}
+
+	// The timeline runs from the start to the stop reading, never going backwards or past the final value
+	points := []energyReading{{start, meterStartWh}}
+	for _, reading := range readings {
+		if !reading.ts.After(start) || !reading.ts.Before(stop) {
+			continue
+		}
+		wh := math.Min(math.Max(reading.wh, points[len(points)-1].wh), meterStopWh)
+		points = append(points, energyReading{reading.ts, wh})
+	}
+	points = append(points, energyReading{stop, meterStopWh})
+
+	chargingEnd := stop
+	if len(points) > 2 && meterStopWh > meterStartWh {
+		for _, point := range points {
+			if point.wh >= meterStopWh {
+				chargingEnd = point.ts
+				break
+			}
+		}
+	}
+
+	// Cut the charging time at every reading and every possible price change
+	cuts := []time.Time{start, chargingEnd}
+	for _, point := range points {
+		if point.ts.After(start) && point.ts.Before(chargingEnd) {
+			cuts = append(cuts, point.ts)
+		}
+	}
+	cuts = append(cuts, t.priceEdges(start, chargingEnd)...)
+	sort.Slice(cuts, func(i, j int) bool { return cuts[i].Before(cuts[j]) })
+
+	cost := &TransactionCost{
+		TariffID:    t.ID,
+		TariffName:  t.Name,
+		Currency:    t.Currency,
+		Timezone:    t.Location.String(),
+		TimeUnit:    t.TimeUnit,
+		IdlePrice:   t.IdlePrice,
+		ChargingEnd: chargingEnd,
+		SessionFee:  roundCents(t.SessionFee),
+		VATPercent:  t.VATPercent,
+		Lines:       []CostLine{},
+	}
+
+	var line *CostLine
+	for i := 1; i < len(cuts); i++ {
+		from, to := cuts[i-1], cuts[i]
+		if !to.After(from) {
+			continue
+		}
+
+		energyPrice, timePrice := t.pricesAt(from)
+		kwh := (energyAt(points, to) - energyAt(points, from)) / 1000
+		minutes := to.Sub(from).Minutes()
+
+		if line != nil && line.EnergyPrice == energyPrice && line.TimePrice == timePrice {
+			line.To = to
+			line.EnergyKwh += kwh
+			line.Minutes += minutes
+			continue
+		}
+		cost.Lines = append(cost.Lines, CostLine{From: from, To: to, EnergyKwh: kwh, EnergyPrice: energyPrice, Minutes: minutes, TimePrice: timePrice})
+		line = &cost.Lines[len(cost.Lines)-1]
+	}
+
+	// Totals are the sums of the rounded lines, so an invoice listing the lines adds up
+	for i := range cost.Lines {
+		line := &cost.Lines[i]
+		line.EnergyKwh = math.Round(line.EnergyKwh*1000) / 1000
+		line.EnergyCost = roundCents(line.EnergyKwh * line.EnergyPrice)
+		line.TimeCost = roundCents(line.Minutes / t.minutesPerTimeUnit() * line.TimePrice)
+
+		cost.EnergyKwh += line.EnergyKwh
+		cost.EnergyCost += line.EnergyCost
+		cost.ChargingMinutes += line.Minutes
+		cost.TimeCost += line.TimeCost
+	}
+
+	cost.IdleMinutes = math.Max(0, stop.Sub(chargingEnd).Minutes()-float64(t.IdleGraceMinutes))
+	cost.IdleCost = roundCents(cost.IdleMinutes * t.IdlePrice)
+
+	cost.EnergyKwh = math.Round(cost.EnergyKwh*1000) / 1000
+	cost.EnergyCost = roundCents(cost.EnergyCost)
+	cost.TimeCost = roundCents(cost.TimeCost)
+	cost.Subtotal = roundCents(cost.EnergyCost + cost.TimeCost + cost.IdleCost + cost.SessionFee)
+	cost.VATAmount = roundCents(cost.Subtotal * t.VATPercent / 100)
+	cost.Total = roundCents(cost.Subtotal + cost.VATAmount)
+
+	return cost
+}
+
+// energyAt interpolates the register value at an instant of the timeline
+func energyAt(points []energyReading, at time.Time) float64 {
+	for i := 1; i < len(points); i++ {
+		before, after := points[i-1], points[i]
+		if at.After(after.ts) {
+			continue
+		}
+		span := after.ts.Sub(before.ts)
+		if span <= 0 {
+			return after.wh
+		}
+		return before.wh + (after.wh-before.wh)*float64(at.Sub(before.ts))/float64(span)
+	}
+	return points[len(points)-1].wh
+}
+
+// roundCents rounds an amount to two decimals
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// priceStoppedTransaction prices a transaction the charger just stopped
+func (s *Server) priceStoppedTransaction(chargePointId string, txID int) {
+	ctx := context.Background()
+
+	chargerID, err := s.getChargerID(ctx, chargePointId)
+	if err != nil {
+		s.logger.Error("Failed to look up charger for pricing", zap.String("charge_point_id", chargePointId), zap.Error(err))
+		return
+	}
+
+	transactionRowID, err := s.findTransactionRowID(ctx, chargerID, txID)
+	if err != nil {
+		s.logger.Error("Failed to look up transaction for pricing", zap.Int("transaction_id", txID), zap.Error(err))
+		return
+	}
+
+	cost, err := s.PriceTransaction(ctx, *transactionRowID)
+	if err == ErrNoTariff {
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to price transaction", zap.Int("transaction_id", txID), zap.Error(err))
+		return
+	}
+
+	s.logger.Info("Transaction priced",
+		zap.String("charge_point_id", chargePointId),
+		zap.Int("transaction_id", txID),
+		zap.String("tariff", cost.TariffName),
+		zap.Float64("total", cost.Total),
+		zap.String("currency", cost.Currency))
+}
+
+// PriceTransaction calculates and stores the cost of a stopped transaction with the tariff that applies to it
+// Running it again replaces the stored cost, e.g. after a tariff was corrected
+func (s *Server) PriceTransaction(ctx context.Context, transactionRowID int64) (*TransactionCost, error) {
+	var chargerID int64
+	var idTag sql.NullString
+	var start time.Time
+	var stop sql.NullTime
+	var meterStartWh int64
+	var meterStopWh sql.NullInt64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT charger_id, id_tag, start_ts, stop_ts, start_meter_wh, stop_meter_wh FROM transactions WHERE id = ?`,
+		transactionRowID).Scan(&chargerID, &idTag, &start, &stop, &meterStartWh, &meterStopWh)
+	if err != nil {
+		return nil, err
+	}
+	if !stop.Valid || !meterStopWh.Valid {
+		return nil, ErrTransactionOpen
+	}
+
+	tariff, err := s.resolveTariff(ctx, chargerID, idTag.String)
+	if err != nil {
+		return nil, err
+	}
+
+	readings, err := s.loadEnergyReadings(ctx, transactionRowID)
+	if err != nil {
+		return nil, err
+	}
+
+	cost := tariff.price(start, stop.Time, float64(meterStartWh), float64(meterStopWh.Int64), readings)
+	cost.ComputedAt = time.Now().UTC()
+
+	breakdown, err := json.Marshal(cost)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO transaction_costs (transaction_id, tariff_id, currency, subtotal, vat_amount, total, breakdown, computed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(transaction_id) DO UPDATE SET
+			tariff_id = excluded.tariff_id,
+			currency = excluded.currency,
+			subtotal = excluded.subtotal,
+			vat_amount = excluded.vat_amount,
+			total = excluded.total,
+			breakdown = excluded.breakdown,
+			computed_at = excluded.computed_at
+	`
+	_, err = s.db.ExecContext(ctx, query,
+		transactionRowID,
+		tariff.ID,
+		cost.Currency,
+		cost.Subtotal,
+		cost.VATAmount,
+		cost.Total,
+		string(breakdown),
+		cost.ComputedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store transaction cost: %w", err)
+	}
+
+	return cost, nil
+}
+
+// resolveTariff picks the tariff of a session: the idTag's own or group (parent idTag) assignment first,
+// then the station's assignment, then the default tariff
+func (s *Server) resolveTariff(ctx context.Context, chargerID int64, idTag string) (*Tariff, error) {
+	query := `
+		SELECT ta.tariff_id
+		FROM tariff_assignments ta
+		LEFT JOIN id_tags it ON it.tag = ?
+		WHERE (ta.id_tag_group = ? AND ? <> '')
+			OR ta.id_tag_group = it.parent_id_tag
+			OR ta.charger_id = ?
+		ORDER BY CASE WHEN ta.id_tag_group = ? THEN 0 WHEN ta.id_tag_group IS NOT NULL THEN 1 ELSE 2 END
+		LIMIT 1
+	`
+
+	var tariffID int64
+	err := s.db.QueryRowContext(ctx, query, idTag, idTag, idTag, chargerID, idTag).Scan(&tariffID)
+	if err == sql.ErrNoRows {
+		err = s.db.QueryRowContext(ctx, `SELECT id FROM tariffs WHERE is_default = 1 ORDER BY id ASC LIMIT 1`).Scan(&tariffID)
+		if err == sql.ErrNoRows {
+			return nil, ErrNoTariff
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve tariff: %w", err)
+	}
+
+	return s.loadTariff(ctx, tariffID)
+}
+
+// loadTariff reads a tariff with its time-of-day periods
+func (s *Server) loadTariff(ctx context.Context, tariffID int64) (*Tariff, error) {
+	tariff := &Tariff{ID: tariffID}
+	var timezone string
+	query := `
+		SELECT name, currency, timezone, energy_price, time_price, time_unit, session_fee, idle_price, idle_grace_minutes, vat_percent
+		FROM tariffs WHERE id = ?
+	`
+	err := s.db.QueryRowContext(ctx, query, tariffID).Scan(
+		&tariff.Name,
+		&tariff.Currency,
+		&timezone,
+		&tariff.EnergyPrice,
+		&tariff.TimePrice,
+		&tariff.TimeUnit,
+		&tariff.SessionFee,
+		&tariff.IdlePrice,
+		&tariff.IdleGraceMinutes,
+		&tariff.VATPercent,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tariff %d: %w", tariffID, err)
+	}
+
+	if tariff.Location, err = time.LoadLocation(timezone); err != nil {
+		return nil, fmt.Errorf("invalid timezone of tariff %d: %w", tariffID, err)
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT days_mask, start_time, end_time, energy_price, time_price FROM tariff_periods WHERE tariff_id = ? ORDER BY id ASC`, tariffID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tariff periods: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var period TariffPeriod
+		var start, end string
+		if err := rows.Scan(&period.Window.Days, &start, &end, &period.EnergyPrice, &period.TimePrice); err != nil {
+			return nil, fmt.Errorf("failed to scan tariff period: %w", err)
+		}
+		if period.Window.Start, err = parseClock(start); err != nil {
+			return nil, fmt.Errorf("invalid period start %q: %w", start, err)
+		}
+		if period.Window.End, err = parseClock(end); err != nil {
+			return nil, fmt.Errorf("invalid period end %q: %w", end, err)
+		}
+		tariff.Periods = append(tariff.Periods, period)
+	}
+
+	return tariff, rows.Err()
+}
+
+// loadEnergyReadings reads the charger-wide energy register readings of a transaction, oldest first
+func (s *Server) loadEnergyReadings(ctx context.Context, transactionRowID int64) ([]energyReading, error) {
+	query := `
+		SELECT ts, value FROM meter_values
+		WHERE transaction_id = ? AND measurand = ? AND phase IS NULL AND value IS NOT NULL
+		ORDER BY ts ASC, id ASC
+	`
+	rows, err := s.db.QueryContext(ctx, query, transactionRowID, MeasurandEnergyActiveImportRegister)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query energy readings: %w", err)
+	}
+	defer rows.Close()
+
+	var readings []energyReading
+	for rows.Next() {
+		var reading energyReading
+		if err := rows.Scan(&reading.ts, &reading.wh); err != nil {
+			return nil, fmt.Errorf("failed to scan energy reading: %w", err)
+		}
+		readings = append(readings, reading)
+	}
+	return readings, rows.Err()
+}
@@ -0,0 +1,601 @@
+package ocpp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// touScheduleProfileId is the chargingProfileId of the TxDefaultProfile a time-of-use schedule installs
+	touScheduleProfileId = 1000001
+	// touScheduleStackLevel keeps the schedule apart from operator TxDefaultProfiles at the usual low levels
+	touScheduleStackLevel = 40
+	// touScheduleCheckInterval is how often schedules are checked for window edges and UTC offset changes
+	touScheduleCheckInterval = time.Minute
+
+	minutesPerDay = 24 * 60
+	allDays       = 1<<7 - 1
+)
+
+// touDayNames are the day names accepted in schedule windows, indexed by time.Weekday
+var touDayNames = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// TOUSchedule is a recurring set of time windows with charging limits in a local timezone
+type TOUSchedule struct {
+	ID           int64
+	Location     *time.Location
+	LimitUnit    string  // "kW" or "A"
+	DefaultLimit float64 // Limit outside every window
+	Windows      []TOUWindow
+}
+
+// TOUWindow limits charging between two local clock times on some days of the week
+// A window whose end is not after its start runs past midnight into the next day
+type TOUWindow struct {
+	Days  uint8 // Bit 0 is Sunday, bit 6 is Saturday
+	Start int   // Minutes after local midnight
+	End   int   // Minutes after local midnight, 0 meaning midnight
+	Limit float64
+}
+
+// TOUPeriod is a stretch of local time with a single limit
+type TOUPeriod struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Limit float64   `json:"limit"`
+}
+
+// TOUPushResult is the outcome of sending a schedule to one charger
+type TOUPushResult struct {
+	ChargePointId string  `json:"charge_point_id"`
+	Status        string  `json:"status"` // Charger's answer to SetChargingProfile, or "Offline" if it is pushed on boot
+	Error         *string `json:"error,omitempty"`
+}
+
+// ParseTOUWindow builds a window from day names (empty for every day), HH:MM clock times and a limit
+func ParseTOUWindow(days []string, start, end string, limit float64) (TOUWindow, error) {
+	window := TOUWindow{Limit: limit}
+
+	if len(days) == 0 {
+		window.Days = allDays
+	}
+	for _, day := range days {
+		index := -1
+		for i, name := range touDayNames {
+			if strings.EqualFold(day, name) {
+				index = i
+			}
+		}
+		if index < 0 {
+			return window, fmt.Errorf("unknown day %q, use Mon, Tue, Wed, Thu, Fri, Sat or Sun", day)
+		}
+		window.Days |= 1 << index
+	}
+
+	var err error
+	if window.Start, err = parseClock(start); err != nil {
+		return window, fmt.Errorf("invalid start %q: %w", start, err)
+	}
+	if window.End, err = parseClock(end); err != nil {
+		return window, fmt.Errorf("invalid end %q: %w", end, err)
+	}
+	if window.Start == window.End {
+		return window, fmt.Errorf("start and end must differ")
+	}
+	if limit < 0 {
+		return window, fmt.Errorf("limit must be >= 0")
+	}
+
+	return window, nil
+}
+
+// TOUDayNames returns the day names of a days mask, or nil for every day
+func TOUDayNames(days uint8) []string {
+	if days == allDays {
+		return nil
+	}
+	var names []string
+	for i, name := range touDayNames {
+		if days&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseClock parses an HH:MM clock time into minutes after midnight; 24:00 is midnight
+func parseClock(clock string) (int, error) {
+	parts := strings.Split(clock, ":")
+	if len(parts) != 2 || len(parts[0]) != 2 || len(parts[1]) != 2 {
+		return 0, fmt.Errorf("expected HH:MM")
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM")
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes > 59 || hours < 0 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("expected a time between 00:00 and 24:00")
+	}
+	return (hours*60 + minutes) % minutesPerDay, nil
+}
+
+// covers reports whether the window applies at a local clock time
+func (w TOUWindow) covers(weekday time.Weekday, minute int) bool {
+	today := w.Days&(1<<weekday) != 0
+	if w.Start < w.End {
+		return today && minute >= w.Start && minute < w.End
+	}
+
+	// The window runs past midnight, so it may have started yesterday
+	yesterday := w.Days&(1<<((weekday+6)%7)) != 0
+	return (today && minute >= w.Start) || (yesterday && minute < w.End)
+}
+
+// limitAtClock returns the limit at a local clock time
+// Where windows overlap the lowest limit wins; outside every window the default applies
+func (sch *TOUSchedule) limitAtClock(weekday time.Weekday, minute int) float64 {
+	limit, covered := sch.DefaultLimit, false
+	for _, window := range sch.Windows {
+		if !window.covers(weekday, minute) {
+			continue
+		}
+		if !covered || window.Limit < limit {
+			limit = window.Limit
+		}
+		covered = true
+	}
+	return limit
+}
+
+// LimitAt returns the limit in force at an instant
+func (sch *TOUSchedule) LimitAt(t time.Time) float64 {
+	local := t.In(sch.Location)
+	return sch.limitAtClock(local.Weekday(), local.Hour()*60+local.Minute())
+}
+
+// weekly reports whether the windows differ between days, so the schedule repeats weekly instead of daily
+func (sch *TOUSchedule) weekly() bool {
+	for _, window := range sch.Windows {
+		if window.Days != allDays {
+			return true
+		}
+	}
+	return false
+}
+
+// edges returns the minutes after the start of a span of days at which a window starts or ends, in order
+func (sch *TOUSchedule) edges(days int) []int {
+	seen := map[int]bool{0: true}
+	for day := 0; day < days; day++ {
+		for _, window := range sch.Windows {
+			seen[day*minutesPerDay+window.Start] = true
+			seen[day*minutesPerDay+window.End] = true
+		}
+	}
+
+	edges := make([]int, 0, len(seen))
+	for minute := range seen {
+		edges = append(edges, minute)
+	}
+	sort.Ints(edges)
+	return edges
+}
+
+// ChargingProfile compiles the schedule into a recurring TxDefaultProfile starting at the current day or week
+// The recurrence repeats in fixed 24 h or 7 day steps, so the profile is anchored on the local midnight of
+// the current UTC offset; the returned offset lets the caller re-send the profile once daylight saving changes it
+func (sch *TOUSchedule) ChargingProfile(now time.Time) (*types.ChargingProfile, int) {
+	local := now.In(sch.Location)
+	_, offset := local.Zone()
+
+	days, recurrency, firstWeekday := 1, types.RecurrencyKindDaily, local.Weekday()
+	minutesSinceStart := local.Hour()*60 + local.Minute()
+	if sch.weekly() {
+		// Weeks start on Monday
+		days, recurrency, firstWeekday = 7, types.RecurrencyKindWeekly, time.Monday
+		minutesSinceStart += ((int(local.Weekday()) + 6) % 7) * minutesPerDay
+	}
+	start := local.Truncate(time.Minute).Add(-time.Duration(minutesSinceStart) * time.Minute)
+
+	rateUnit, scale := types.ChargingRateUnitAmperes, 1.0
+	if sch.LimitUnit == "kW" {
+		rateUnit, scale = types.ChargingRateUnitWatts, 1000
+	}
+
+	var periods []types.ChargingSchedulePeriod
+	for _, edge := range sch.edges(days) {
+		if edge >= days*minutesPerDay {
+			break
+		}
+		weekday := (firstWeekday + time.Weekday(edge/minutesPerDay)) % 7
+		limit := sch.limitAtClock(weekday, edge%minutesPerDay) * scale
+		if len(periods) > 0 && periods[len(periods)-1].Limit == limit {
+			continue
+		}
+		periods = append(periods, types.ChargingSchedulePeriod{StartPeriod: edge * 60, Limit: limit})
+	}
+
+	duration := days * minutesPerDay * 60
+	return &types.ChargingProfile{
+		ChargingProfileId:      touScheduleProfileId,
+		StackLevel:             touScheduleStackLevel,
+		ChargingProfilePurpose: types.ChargingProfilePurposeTxDefaultProfile,
+		ChargingProfileKind:    types.ChargingProfileKindRecurring,
+		RecurrencyKind:         recurrency,
+		ChargingSchedule: &types.ChargingSchedule{
+			Duration:               &duration,
+			StartSchedule:          types.NewDateTime(start.UTC()),
+			ChargingRateUnit:       rateUnit,
+			ChargingSchedulePeriod: periods,
+		},
+	}, offset
+}
+
+// Curve returns the limits over one local calendar day
+// Days with a daylight saving change are 23 or 25 hours long
+func (sch *TOUSchedule) Curve(day time.Time) []TOUPeriod {
+	year, month, date := day.Date()
+	midnight := time.Date(year, month, date, 0, 0, 0, 0, sch.Location)
+	nextMidnight := time.Date(year, month, date+1, 0, 0, 0, 0, sch.Location)
+
+	// Clock times skipped by daylight saving move to the next valid instant, so sort again
+	var starts []time.Time
+	for _, edge := range sch.edges(1) {
+		start := time.Date(year, month, date, 0, edge, 0, 0, sch.Location)
+		if start.Before(midnight) || !start.Before(nextMidnight) {
+			continue
+		}
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+	var periods []TOUPeriod
+	for _, start := range starts {
+		limit := sch.LimitAt(start)
+		if len(periods) > 0 {
+			last := &periods[len(periods)-1]
+			if last.Limit == limit || last.Start.Equal(start) {
+				continue
+			}
+			last.End = start
+		}
+		periods = append(periods, TOUPeriod{Start: start, Limit: limit})
+	}
+	if len(periods) > 0 {
+		periods[len(periods)-1].End = nextMidnight
+	}
+	return periods
+}
+
+// runTOUSchedules checks the schedules every minute
+// Profiles are re-sent when daylight saving changes the zone's UTC offset, and load-managed
+// sites are rebalanced at window edges, because the load manager's TxProfile overrides the
+// TxDefaultProfile during a transaction and has to apply the schedule's limit itself
+func (s *Server) runTOUSchedules() {
+	limits := make(map[int64]float64) // Limit of each schedule at the previous check
+	ticker := time.NewTicker(touScheduleCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.checkTOUSchedules(context.Background(), limits, time.Now())
+	}
+}
+
+// checkTOUSchedules performs one run of the schedule checker
+func (s *Server) checkTOUSchedules(ctx context.Context, limits map[int64]float64, now time.Time) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM tou_schedules`)
+	if err != nil {
+		s.logger.Error("Failed to query time-of-use schedules", zap.Error(err))
+		return
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			s.logger.Error("Failed to scan time-of-use schedule", zap.Error(err))
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		sch, err := s.loadTOUSchedule(ctx, id)
+		if err != nil {
+			s.logger.Error("Failed to load time-of-use schedule", zap.Int64("schedule_id", id), zap.Error(err))
+			continue
+		}
+
+		limit := sch.LimitAt(now)
+		if previous, known := limits[id]; known && previous != limit {
+			s.rebalanceTOUScheduleSites(ctx, id)
+		}
+		limits[id] = limit
+
+		_, offset := now.In(sch.Location).Zone()
+		s.resendShiftedTOUProfiles(ctx, sch, offset)
+	}
+}
+
+// resendShiftedTOUProfiles re-sends the schedule to connected chargers whose profile was built with another UTC offset
+func (s *Server) resendShiftedTOUProfiles(ctx context.Context, sch *TOUSchedule, offset int) {
+	query := `
+		SELECT c.identity
+		FROM tou_schedule_chargers tsc
+		JOIN chargers c ON c.id = tsc.charger_id
+		WHERE tsc.schedule_id = ? AND tsc.status = 'Accepted' AND tsc.utc_offset <> ?
+	`
+	rows, err := s.db.QueryContext(ctx, query, sch.ID, offset)
+	if err != nil {
+		s.logger.Error("Failed to query time-of-use schedule chargers", zap.Int64("schedule_id", sch.ID), zap.Error(err))
+		return
+	}
+	var chargePointIds []string
+	for rows.Next() {
+		var chargePointId string
+		if err := rows.Scan(&chargePointId); err != nil {
+			rows.Close()
+			s.logger.Error("Failed to scan time-of-use schedule charger", zap.Error(err))
+			return
+		}
+		chargePointIds = append(chargePointIds, chargePointId)
+	}
+	rows.Close()
+
+	for _, chargePointId := range chargePointIds {
+		if !s.IsConnected(chargePointId) {
+			continue
+		}
+		s.logger.Info("UTC offset changed, re-sending time-of-use schedule",
+			zap.String("charge_point_id", chargePointId),
+			zap.Int64("schedule_id", sch.ID))
+		go s.pushTOUProfile(context.Background(), chargePointId, sch)
+	}
+}
+
+// rebalanceTOUScheduleSites rebalances the load-managed sites of a schedule's chargers
+func (s *Server) rebalanceTOUScheduleSites(ctx context.Context, scheduleID int64) {
+	query := `
+		SELECT DISTINCT c.site_id
+		FROM tou_schedule_chargers tsc
+		JOIN chargers c ON c.id = tsc.charger_id
+		WHERE tsc.schedule_id = ? AND c.site_id IS NOT NULL
+	`
+	rows, err := s.db.QueryContext(ctx, query, scheduleID)
+	if err != nil {
+		s.logger.Error("Failed to query time-of-use schedule sites", zap.Int64("schedule_id", scheduleID), zap.Error(err))
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var siteID int64
+		if err := rows.Scan(&siteID); err != nil {
+			s.logger.Error("Failed to scan time-of-use schedule site", zap.Error(err))
+			return
+		}
+		s.scheduleRebalance(siteID, nil)
+	}
+}
+
+// PushTOUSchedule sends a schedule to every charger that follows it
+// Offline chargers get the schedule when they boot
+func (s *Server) PushTOUSchedule(ctx context.Context, scheduleID int64) ([]TOUPushResult, error) {
+	sch, err := s.loadTOUSchedule(ctx, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT c.identity
+		FROM tou_schedule_chargers tsc
+		JOIN chargers c ON c.id = tsc.charger_id
+		WHERE tsc.schedule_id = ?
+		ORDER BY c.id ASC
+	`
+	rows, err := s.db.QueryContext(ctx, query, scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schedule chargers: %w", err)
+	}
+	var chargePointIds []string
+	for rows.Next() {
+		var chargePointId string
+		if err := rows.Scan(&chargePointId); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan schedule charger: %w", err)
+		}
+		chargePointIds = append(chargePointIds, chargePointId)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	results := make([]TOUPushResult, len(chargePointIds))
+	var wg sync.WaitGroup
+	for i, chargePointId := range chargePointIds {
+		results[i] = TOUPushResult{ChargePointId: chargePointId, Status: "Offline"}
+		if !s.IsConnected(chargePointId) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(result *TOUPushResult) {
+			defer wg.Done()
+			status, err := s.pushTOUProfile(ctx, result.ChargePointId, sch)
+			result.Status = status
+			if err != nil {
+				msg := err.Error()
+				result.Error = &msg
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+
+	// Load-managed sessions only see the new limits through the site's TxProfiles
+	s.rebalanceTOUScheduleSites(ctx, scheduleID)
+
+	return results, nil
+}
+
+// pushChargerTOUSchedule sends a booting charger the schedule it follows, if any
+func (s *Server) pushChargerTOUSchedule(chargePointId string) {
+	var scheduleID int64
+	query := `
+		SELECT tsc.schedule_id
+		FROM tou_schedule_chargers tsc
+		JOIN chargers c ON c.id = tsc.charger_id
+		WHERE c.identity = ?
+	`
+	err := s.db.QueryRowContext(context.Background(), query, chargePointId).Scan(&scheduleID)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to look up time-of-use schedule", zap.String("charge_point_id", chargePointId), zap.Error(err))
+		return
+	}
+
+	sch, err := s.loadTOUSchedule(context.Background(), scheduleID)
+	if err != nil {
+		s.logger.Error("Failed to load time-of-use schedule", zap.Int64("schedule_id", scheduleID), zap.Error(err))
+		return
+	}
+	s.pushTOUProfile(context.Background(), chargePointId, sch)
+}
+
+// pushTOUProfile installs a schedule on a charger as a TxDefaultProfile for all connectors and records the outcome
+func (s *Server) pushTOUProfile(ctx context.Context, chargePointId string, sch *TOUSchedule) (string, error) {
+	profile, offset := sch.ChargingProfile(time.Now())
+	request := &SetChargingProfileRequest{
+		ConnectorId:     0,
+		ChargingProfile: profile,
+	}
+
+	status := "Error"
+	var errorText *string
+	response, err := s.callCommand(ctx, chargePointId, SetChargingProfileFeatureName, request)
+	if err != nil {
+		msg := err.Error()
+		errorText = &msg
+		s.logger.Error("Failed to send time-of-use schedule",
+			zap.String("charge_point_id", chargePointId),
+			zap.Int64("schedule_id", sch.ID),
+			zap.Error(err))
+	} else {
+		status = string(response.(*SetChargingProfileConfirmation).Status)
+		s.logger.Info("Time-of-use schedule answered by charger",
+			zap.String("charge_point_id", chargePointId),
+			zap.Int64("schedule_id", sch.ID),
+			zap.String("recurrency", string(profile.RecurrencyKind)),
+			zap.Int("periods", len(profile.ChargingSchedule.ChargingSchedulePeriod)),
+			zap.String("status", status))
+	}
+
+	query := `
+		UPDATE tou_schedule_chargers SET status = ?, error = ?, utc_offset = ?, pushed_at = ?
+		WHERE schedule_id = ? AND charger_id = (SELECT id FROM chargers WHERE identity = ?)
+	`
+	if _, dbErr := s.db.ExecContext(context.Background(), query, status, errorText, offset, time.Now(), sch.ID, chargePointId); dbErr != nil {
+		s.logger.Error("Failed to store time-of-use schedule result", zap.String("charge_point_id", chargePointId), zap.Error(dbErr))
+	}
+
+	return status, err
+}
+
+// ReleaseTOUSchedule removes the schedule's TxDefaultProfile from a charger that no longer follows it
+func (s *Server) ReleaseTOUSchedule(ctx context.Context, chargePointId string) error {
+	profileId := touScheduleProfileId
+	response, err := s.callCommand(ctx, chargePointId, ClearChargingProfileFeatureName, &ClearChargingProfileRequest{Id: &profileId})
+	if err != nil {
+		if errors.Is(err, ErrNotConnected) {
+			s.logger.Warn("Charger offline, time-of-use schedule stays installed until it is cleared",
+				zap.String("charge_point_id", chargePointId))
+		}
+		return err
+	}
+
+	confirmation := response.(*ClearChargingProfileConfirmation)
+	s.logger.Info("Time-of-use schedule cleared by charger",
+		zap.String("charge_point_id", chargePointId),
+		zap.String("status", string(confirmation.Status)))
+
+	// Load-managed sessions were capped by the schedule as well
+	s.rebalanceChargerSite(chargePointId)
+	return nil
+}
+
+// chargerTOULimitA returns the schedule limit in force for a charger as a current per phase, or nil without a schedule
+func (s *Server) chargerTOULimitA(ctx context.Context, st site, chargerID int64, now time.Time) (*float64, error) {
+	var scheduleID int64
+	err := s.db.QueryRowContext(ctx, `SELECT schedule_id FROM tou_schedule_chargers WHERE charger_id = ?`, chargerID).Scan(&scheduleID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sch, err := s.loadTOUSchedule(ctx, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := sch.LimitAt(now)
+	if sch.LimitUnit == "kW" {
+		limit = st.kwToA(limit)
+	}
+	return &limit, nil
+}
+
+// loadTOUSchedule reads a schedule with its windows
+func (s *Server) loadTOUSchedule(ctx context.Context, scheduleID int64) (*TOUSchedule, error) {
+	sch := &TOUSchedule{ID: scheduleID}
+	var timezone string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT timezone, limit_unit, default_limit FROM tou_schedules WHERE id = ?`, scheduleID).
+		Scan(&timezone, &sch.LimitUnit, &sch.DefaultLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load time-of-use schedule %d: %w", scheduleID, err)
+	}
+
+	if sch.Location, err = time.LoadLocation(timezone); err != nil {
+		return nil, fmt.Errorf("invalid timezone of time-of-use schedule %d: %w", scheduleID, err)
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT days_mask, start_time, end_time, limit_value FROM tou_schedule_windows WHERE schedule_id = ? ORDER BY id ASC`, scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schedule windows: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var window TOUWindow
+		var start, end string
+		if err := rows.Scan(&window.Days, &start, &end, &window.Limit); err != nil {
+			return nil, fmt.Errorf("failed to scan schedule window: %w", err)
+		}
+		if window.Start, err = parseClock(start); err != nil {
+			return nil, fmt.Errorf("invalid window start %q: %w", start, err)
+		}
+		if window.End, err = parseClock(end); err != nil {
+			return nil, fmt.Errorf("invalid window end %q: %w", end, err)
+		}
+		sch.Windows = append(sch.Windows, window)
+	}
+
+	return sch, rows.Err()
+}
@@ -0,0 +1,125 @@
+package ocpp
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// transactionStart is the content of a StartTransaction request
+type transactionStart struct {
+	ConnectorId   int
+	IdTag         string
+	MeterStart    int64
+	ReservationId *int
+	Timestamp     time.Time // When the charger says the transaction started
+}
+
+// parseTransactionStart reads a StartTransaction payload
+// A missing or unreadable timestamp falls back to the time we received the request
+func parseTransactionStart(payloadMap map[string]interface{}) transactionStart {
+	start := transactionStart{}
+
+	connectorId, _ := payloadMap["connectorId"].(float64)
+	start.ConnectorId = int(connectorId)
+	start.IdTag, _ = payloadMap["idTag"].(string)
+	meterStart, _ := payloadMap["meterStart"].(float64)
+	start.MeterStart = int64(meterStart)
+
+	if reservationId, ok := payloadMap["reservationId"].(float64); ok {
+		id := int(reservationId)
+		start.ReservationId = &id
+	}
+
+	start.Timestamp = parseTransactionTimestamp(payloadMap)
+
+	return start
+}
+
+// parseTransactionTimestamp reads the timestamp of a StartTransaction or StopTransaction payload in UTC
+// A missing or unreadable timestamp falls back to the time we received the request
+func parseTransactionTimestamp(payloadMap map[string]interface{}) time.Time {
+	if timestampStr, ok := payloadMap["timestamp"].(string); ok {
+		if timestamp, err := time.Parse(time.RFC3339, timestampStr); err == nil {
+			return timestamp.UTC()
+		}
+	}
+	return time.Now().UTC()
+}
+
+// findDuplicateTransaction returns the ID already assigned to a StartTransaction the charger retried
+// A retry is a start with the same connector, idTag, meter reading and timestamp
+func (s *Server) findDuplicateTransaction(ctx context.Context, chargerID int64, start transactionStart) (int, bool, error) {
+	query := `
+		SELECT tx_id FROM transactions
+		WHERE charger_id = ? AND connector_id = ? AND id_tag = ? AND start_meter_wh = ? AND start_ts = ?
+		ORDER BY id ASC
+		LIMIT 1
+	`
+
+	var txID int
+	err := s.db.QueryRowContext(ctx, query,
+		chargerID,
+		start.ConnectorId,
+		start.IdTag,
+		start.MeterStart,
+		start.Timestamp,
+	).Scan(&txID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to look up duplicate transaction: %w", err)
+	}
+	return txID, true, nil
+}
+
+// insertTransaction records a new transaction and returns its transaction ID
+// The ID comes from the row's AUTOINCREMENT id, so it is unique across all chargers
+func (s *Server) insertTransaction(ctx context.Context, chargerID int64, start transactionStart) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// tx_id is unique, so insert under a random placeholder until the row ID is known
+	placeholder, err := newMessageId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate placeholder transaction ID: %w", err)
+	}
+
+	query := `
+		INSERT INTO transactions (charger_id, tx_id, start_ts, start_meter_wh, id_tag, connector_id, reservation_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := tx.ExecContext(ctx, query,
+		chargerID,
+		placeholder,
+		start.Timestamp,
+		start.MeterStart,
+		start.IdTag,
+		start.ConnectorId,
+		start.ReservationId,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert transaction: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get transaction row ID: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE transactions SET tx_id = ? WHERE id = ?`, fmt.Sprint(id), id); err != nil {
+		return 0, fmt.Errorf("failed to assign transaction ID: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return int(id), nil
+}
@@ -0,0 +1,75 @@
+package ocpp
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"go.uber.org/zap"
+)
+
+// loadValidationMode reads the stored validation mode of a charger
+// Chargers that are not registered yet are validated strictly
+func (s *Server) loadValidationMode(chargePointId string) string {
+	var mode string
+	err := s.db.QueryRowContext(context.Background(),
+		`SELECT validation_mode FROM chargers WHERE identity = ?`, chargePointId).Scan(&mode)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			s.logger.Error("Failed to load validation mode", zap.String("charge_point_id", chargePointId), zap.Error(err))
+		}
+		return DefaultValidationMode
+	}
+	if !IsValidValidationMode(mode) {
+		return DefaultValidationMode
+	}
+	return mode
+}
+
+// validationMode returns the validation mode of a connected charger, or the default if it is not connected
+func (s *Server) validationMode(chargePointId string) string {
+	conn := s.getConnection(chargePointId)
+	if conn == nil {
+		return DefaultValidationMode
+	}
+	return conn.validationMode()
+}
+
+// SetValidationMode applies a changed validation mode to the charger's open connection, if any
+// The stored mode is read again whenever the charger connects
+func (s *Server) SetValidationMode(chargePointId, mode string) {
+	if conn := s.getConnection(chargePointId); conn != nil {
+		conn.setValidationMode(mode)
+	}
+}
+
+// checkOutgoingPayload validates a payload we are about to send; our own payloads get no leniency
+func checkOutgoingPayload(name string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	_, _, err = validatePayload(name, decoded, ValidationStrict)
+	return err
+}
+
+// callErrorFrame builds a CALLERROR: [4, messageId, errorCode, errorDescription, errorDetails]
+func callErrorFrame(messageId, errorCode, errorDescription string, errorDetails interface{}) ([]byte, error) {
+	if errorDetails == nil {
+		errorDetails = struct{}{}
+	}
+	return json.Marshal([]interface{}{4, messageId, errorCode, errorDescription, errorDetails})
+}
+
+// violationStrings formats violations for the log
+func violationStrings(violations []SchemaViolation) []string {
+	strs := make([]string, len(violations))
+	for i, violation := range violations {
+		strs[i] = violation.String()
+	}
+	return strs
+}
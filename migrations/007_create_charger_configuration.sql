@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE charger_configuration (
+    charger_id INTEGER NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT,
+    readonly BOOLEAN NOT NULL DEFAULT 0,
+    last_change_status TEXT,
+    last_change_at DATETIME,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (charger_id, key),
+    FOREIGN KEY (charger_id) REFERENCES chargers(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE charger_configuration;
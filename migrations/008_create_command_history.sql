@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE command_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    charger_id INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    request TEXT NOT NULL,
+    status TEXT,
+    error TEXT,
+    created_at DATETIME NOT NULL,
+    completed_at DATETIME,
+    FOREIGN KEY (charger_id) REFERENCES chargers(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS cmd_ch_ts ON command_history(charger_id, created_at);
+
+CREATE TABLE scheduled_availability (
+    charger_id INTEGER NOT NULL,
+    connector_id INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (charger_id, connector_id),
+    FOREIGN KEY (charger_id) REFERENCES chargers(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE scheduled_availability;
+DROP TABLE command_history;
@@ -0,0 +1,34 @@
+-- +goose Up
+CREATE TABLE connectors (
+    charger_id INTEGER NOT NULL,
+    connector_id INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    error_code TEXT NOT NULL DEFAULT 'NoError',
+    info TEXT,
+    vendor_id TEXT,
+    vendor_error_code TEXT,
+    status_ts DATETIME,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (charger_id, connector_id),
+    FOREIGN KEY (charger_id) REFERENCES chargers(id) ON DELETE CASCADE
+);
+
+CREATE TABLE connector_status_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    charger_id INTEGER NOT NULL,
+    connector_id INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    error_code TEXT NOT NULL DEFAULT 'NoError',
+    info TEXT,
+    vendor_id TEXT,
+    vendor_error_code TEXT,
+    status_ts DATETIME,
+    received_at DATETIME NOT NULL,
+    FOREIGN KEY (charger_id) REFERENCES chargers(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS csh_ch_conn_ts ON connector_status_history(charger_id, connector_id, received_at);
+
+-- +goose Down
+DROP TABLE connector_status_history;
+DROP TABLE connectors;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE charger_connections (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    identity TEXT NOT NULL,
+    remote_ip TEXT,
+    connected_at DATETIME NOT NULL,
+    disconnected_at DATETIME,
+    close_code INTEGER,
+    close_reason TEXT
+);
+
+CREATE INDEX IF NOT EXISTS cc_identity_ts ON charger_connections(identity, connected_at);
+
+-- +goose Down
+DROP TABLE charger_connections;
@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE id_tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tag TEXT UNIQUE NOT NULL,
+    status TEXT NOT NULL DEFAULT 'Accepted',
+    expiry_date DATETIME,
+    parent_id_tag TEXT,
+    owner_name TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE transactions ADD COLUMN id_tag TEXT;
+
+CREATE INDEX IF NOT EXISTS tx_id_tag ON transactions(id_tag);
+
+-- +goose Down
+DROP INDEX IF EXISTS tx_id_tag;
+ALTER TABLE transactions DROP COLUMN id_tag;
+DROP TABLE id_tags;
@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE local_list_sync (
+    charger_id INTEGER PRIMARY KEY,
+    list_version INTEGER NOT NULL DEFAULT 0,
+    charger_version INTEGER,
+    update_type TEXT,
+    last_status TEXT,
+    last_error TEXT,
+    synced_at DATETIME,
+    verified_at DATETIME,
+    updated_at DATETIME NOT NULL,
+    FOREIGN KEY (charger_id) REFERENCES chargers(id) ON DELETE CASCADE
+);
+
+CREATE TABLE local_list_entries (
+    charger_id INTEGER NOT NULL,
+    tag TEXT NOT NULL,
+    status TEXT NOT NULL,
+    expiry_date DATETIME,
+    parent_id_tag TEXT,
+    PRIMARY KEY (charger_id, tag),
+    FOREIGN KEY (charger_id) REFERENCES chargers(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE local_list_entries;
+DROP TABLE local_list_sync;
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE transactions ADD COLUMN connector_id INTEGER;
+ALTER TABLE transactions ADD COLUMN reservation_id INTEGER;
+
+-- tx_id used to be the Unix time, so chargers starting in the same second shared one
+-- Keep the first row of each clash and make the others unique before adding the constraint
+UPDATE transactions SET tx_id = tx_id || '-' || id
+WHERE id NOT IN (SELECT MIN(id) FROM transactions GROUP BY tx_id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS tx_tx_id ON transactions(tx_id);
+CREATE INDEX IF NOT EXISTS tx_ch_conn_ts ON transactions(charger_id, connector_id, start_ts);
+
+-- +goose Down
+DROP INDEX IF EXISTS tx_ch_conn_ts;
+DROP INDEX IF EXISTS tx_tx_id;
+ALTER TABLE transactions DROP COLUMN reservation_id;
+ALTER TABLE transactions DROP COLUMN connector_id;
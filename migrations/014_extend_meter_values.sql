@@ -0,0 +1,51 @@
+-- +goose Up
+-- Meter values are no longer tied to a transaction (idle and connector 0 samples have none),
+-- so the table is rebuilt with a nullable transaction_id and the full sampled value details
+CREATE TABLE meter_values_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    charger_id INTEGER NOT NULL,
+    connector_id INTEGER NOT NULL DEFAULT 0,
+    transaction_id INTEGER,
+    ts DATETIME NOT NULL,
+    measurand TEXT NOT NULL,
+    phase TEXT,
+    unit TEXT,
+    context TEXT,
+    location TEXT,
+    format TEXT,
+    value REAL,
+    raw_value TEXT,
+    FOREIGN KEY (charger_id) REFERENCES chargers(id) ON DELETE CASCADE,
+    FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE SET NULL
+);
+
+INSERT INTO meter_values_new (id, charger_id, connector_id, transaction_id, ts, measurand, unit, value)
+SELECT mv.id, t.charger_id, COALESCE(t.connector_id, 0), mv.transaction_id, mv.ts, mv.measurand, 'Wh', mv.value
+FROM meter_values mv
+JOIN transactions t ON t.id = mv.transaction_id;
+
+DROP TABLE meter_values;
+ALTER TABLE meter_values_new RENAME TO meter_values;
+
+CREATE INDEX IF NOT EXISTS mv_tx_ts ON meter_values(transaction_id, ts);
+CREATE INDEX IF NOT EXISTS mv_ch_ts ON meter_values(charger_id, ts);
+
+-- +goose Down
+CREATE TABLE meter_values_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    transaction_id INTEGER NOT NULL,
+    ts DATETIME NOT NULL,
+    measurand TEXT NOT NULL,
+    value REAL NOT NULL,
+    FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE CASCADE
+);
+
+INSERT INTO meter_values_old (id, transaction_id, ts, measurand, value)
+SELECT id, transaction_id, ts, measurand, value
+FROM meter_values
+WHERE transaction_id IS NOT NULL AND value IS NOT NULL;
+
+DROP TABLE meter_values;
+ALTER TABLE meter_values_old RENAME TO meter_values;
+
+CREATE INDEX IF NOT EXISTS mv_tx_ts ON meter_values(transaction_id, ts);
@@ -0,0 +1,38 @@
+-- +goose Up
+CREATE TABLE sites (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    grid_limit REAL NOT NULL,
+    limit_unit TEXT NOT NULL DEFAULT 'A',
+    phases INTEGER NOT NULL DEFAULT 3,
+    voltage REAL NOT NULL DEFAULT 230,
+    strategy TEXT NOT NULL DEFAULT 'equal',
+    min_current_a REAL NOT NULL DEFAULT 6,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE chargers ADD COLUMN site_id INTEGER REFERENCES sites(id) ON DELETE SET NULL;
+ALTER TABLE chargers ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS ch_site ON chargers(site_id);
+
+CREATE TABLE load_allocations (
+    charger_id INTEGER NOT NULL,
+    connector_id INTEGER NOT NULL,
+    transaction_id INTEGER NOT NULL,
+    limit_a REAL NOT NULL,
+    status TEXT,
+    error TEXT,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (charger_id, connector_id),
+    FOREIGN KEY (charger_id) REFERENCES chargers(id) ON DELETE CASCADE,
+    FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE load_allocations;
+DROP INDEX IF EXISTS ch_site;
+ALTER TABLE chargers DROP COLUMN priority;
+ALTER TABLE chargers DROP COLUMN site_id;
+DROP TABLE sites;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- Samples without a unit used to be stored as Wh whatever their measurand;
+-- give them the measurand's standard unit instead (none for e.g. Frequency)
+UPDATE meter_values
+SET unit = CASE
+    WHEN measurand LIKE 'Energy.Reactive.%' THEN 'varh'
+    WHEN measurand LIKE 'Power.Active.%' OR measurand = 'Power.Offered' THEN 'W'
+    WHEN measurand LIKE 'Power.Reactive.%' THEN 'var'
+    WHEN measurand LIKE 'Current.%' THEN 'A'
+    WHEN measurand = 'Voltage' THEN 'V'
+    WHEN measurand = 'SoC' THEN 'Percent'
+    WHEN measurand = 'Temperature' THEN 'Celsius'
+    ELSE NULL
+END
+WHERE unit = 'Wh' AND measurand NOT LIKE 'Energy.Active.%';
+
+-- +goose Down
+UPDATE meter_values SET unit = 'Wh' WHERE unit IS NULL;
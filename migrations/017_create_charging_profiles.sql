@@ -0,0 +1,28 @@
+-- +goose Up
+-- Charging profiles defined by the operator; the row ID is the chargingProfileId sent to the charger
+CREATE TABLE charging_profiles (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    charger_id INTEGER NOT NULL,
+    connector_id INTEGER NOT NULL DEFAULT 0,
+    purpose TEXT NOT NULL,
+    stack_level INTEGER NOT NULL DEFAULT 0,
+    kind TEXT NOT NULL,
+    recurrency_kind TEXT,
+    transaction_id INTEGER,
+    valid_from DATETIME,
+    valid_to DATETIME,
+    schedule TEXT NOT NULL,
+    installed BOOLEAN NOT NULL DEFAULT 0,
+    status TEXT,
+    error TEXT,
+    installed_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (charger_id) REFERENCES chargers(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS cp_ch_conn ON charging_profiles(charger_id, connector_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS cp_ch_conn;
+DROP TABLE charging_profiles;
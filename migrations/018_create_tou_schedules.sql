@@ -0,0 +1,45 @@
+-- +goose Up
+-- Time-of-use schedules that throttle chargers during peak tariff hours
+CREATE TABLE tou_schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    limit_unit TEXT NOT NULL DEFAULT 'kW',
+    default_limit REAL NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Windows are in the schedule's local time; days_mask has bit 0 for Sunday up to bit 6 for Saturday
+CREATE TABLE tou_schedule_windows (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    schedule_id INTEGER NOT NULL,
+    days_mask INTEGER NOT NULL DEFAULT 127,
+    start_time TEXT NOT NULL,
+    end_time TEXT NOT NULL,
+    limit_value REAL NOT NULL,
+    FOREIGN KEY (schedule_id) REFERENCES tou_schedules(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS tsw_schedule ON tou_schedule_windows(schedule_id);
+
+-- A charger follows at most one schedule; utc_offset is the zone offset the pushed profile was built with
+CREATE TABLE tou_schedule_chargers (
+    charger_id INTEGER PRIMARY KEY,
+    schedule_id INTEGER NOT NULL,
+    status TEXT,
+    error TEXT,
+    utc_offset INTEGER,
+    pushed_at DATETIME,
+    FOREIGN KEY (charger_id) REFERENCES chargers(id) ON DELETE CASCADE,
+    FOREIGN KEY (schedule_id) REFERENCES tou_schedules(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS tsc_schedule ON tou_schedule_chargers(schedule_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS tsc_schedule;
+DROP TABLE tou_schedule_chargers;
+DROP INDEX IF EXISTS tsw_schedule;
+DROP TABLE tou_schedule_windows;
+DROP TABLE tou_schedules;
@@ -0,0 +1,67 @@
+-- +goose Up
+-- Prices are excluding VAT; time_price is per time_unit of charging, idle_price per minute after charging completes
+CREATE TABLE tariffs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    currency TEXT NOT NULL DEFAULT 'EUR',
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    energy_price REAL NOT NULL DEFAULT 0,
+    time_price REAL NOT NULL DEFAULT 0,
+    time_unit TEXT NOT NULL DEFAULT 'hour',
+    session_fee REAL NOT NULL DEFAULT 0,
+    idle_price REAL NOT NULL DEFAULT 0,
+    idle_grace_minutes INTEGER NOT NULL DEFAULT 0,
+    vat_percent REAL NOT NULL DEFAULT 0,
+    is_default BOOLEAN NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Time-of-day prices in the tariff's timezone; NULL keeps the tariff's base price
+CREATE TABLE tariff_periods (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tariff_id INTEGER NOT NULL,
+    days_mask INTEGER NOT NULL DEFAULT 127,
+    start_time TEXT NOT NULL,
+    end_time TEXT NOT NULL,
+    energy_price REAL,
+    time_price REAL,
+    FOREIGN KEY (tariff_id) REFERENCES tariffs(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS tp_tariff ON tariff_periods(tariff_id);
+
+-- A tariff applies to a station or to an idTag group (the parent idTag); a group wins over a station
+CREATE TABLE tariff_assignments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tariff_id INTEGER NOT NULL,
+    charger_id INTEGER UNIQUE,
+    id_tag_group TEXT UNIQUE,
+    FOREIGN KEY (tariff_id) REFERENCES tariffs(id) ON DELETE CASCADE,
+    FOREIGN KEY (charger_id) REFERENCES chargers(id) ON DELETE CASCADE,
+    CHECK ((charger_id IS NULL) <> (id_tag_group IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS ta_tariff ON tariff_assignments(tariff_id);
+
+-- The price of a completed transaction; breakdown is the full calculation as JSON
+CREATE TABLE transaction_costs (
+    transaction_id INTEGER PRIMARY KEY,
+    tariff_id INTEGER,
+    currency TEXT NOT NULL,
+    subtotal REAL NOT NULL,
+    vat_amount REAL NOT NULL,
+    total REAL NOT NULL,
+    breakdown TEXT NOT NULL,
+    computed_at DATETIME NOT NULL,
+    FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE CASCADE,
+    FOREIGN KEY (tariff_id) REFERENCES tariffs(id) ON DELETE SET NULL
+);
+
+-- +goose Down
+DROP TABLE transaction_costs;
+DROP INDEX IF EXISTS ta_tariff;
+DROP TABLE tariff_assignments;
+DROP INDEX IF EXISTS tp_tariff;
+DROP TABLE tariff_periods;
+DROP TABLE tariffs;
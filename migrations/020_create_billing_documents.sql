@@ -0,0 +1,16 @@
+-- +goose Up
+-- Numbers of issued receipts and statements; a document keeps its number when it is downloaded again.
+-- reference identifies what the document is for, e.g. the transaction of a receipt
+CREATE TABLE billing_documents (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,
+    reference TEXT NOT NULL,
+    year INTEGER NOT NULL,
+    seq INTEGER NOT NULL,
+    issued_at DATETIME NOT NULL,
+    UNIQUE (kind, reference),
+    UNIQUE (kind, year, seq)
+);
+
+-- +goose Down
+DROP TABLE billing_documents;
@@ -0,0 +1,69 @@
+-- +goose Up
+-- Scheduled exports of a dataset to files; window 'since_last_run' exports the rows added since the
+-- previous successful run, 'full' the whole dataset every time. keep_files/keep_days of 0 keep every file
+CREATE TABLE export_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    dataset TEXT NOT NULL,
+    format TEXT NOT NULL DEFAULT 'csv',
+    directory TEXT NOT NULL,
+    frequency TEXT NOT NULL DEFAULT 'hours',
+    frequency_value INTEGER NOT NULL DEFAULT 1,
+    window_mode TEXT NOT NULL DEFAULT 'since_last_run',
+    keep_files INTEGER NOT NULL DEFAULT 0,
+    keep_days INTEGER NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    last_run_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per run; file_deleted_at is set when retention removed the file
+CREATE TABLE export_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_id INTEGER NOT NULL,
+    triggered_by TEXT NOT NULL,
+    status TEXT NOT NULL,
+    window_start DATETIME,
+    window_end DATETIME NOT NULL,
+    row_count INTEGER,
+    file_path TEXT,
+    bytes INTEGER,
+    error TEXT,
+    started_at DATETIME NOT NULL,
+    finished_at DATETIME,
+    file_deleted_at DATETIME,
+    FOREIGN KEY (job_id) REFERENCES export_jobs(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS er_job_started ON export_runs(job_id, started_at);
+
+-- The single CSV dump of the stations becomes a job; it had no minimum, so seconds round up to minutes
+INSERT INTO export_jobs (name, dataset, format, directory, frequency, frequency_value, window_mode, enabled, last_run_at)
+SELECT 'Stations', 'stations', 'csv', directory,
+    CASE frequency WHEN 'seconds' THEN 'minutes' ELSE frequency END,
+    CASE frequency WHEN 'seconds' THEN MAX(1, (frequency_value + 59) / 60) ELSE frequency_value END,
+    'full', enabled, last_export
+FROM logs_config
+WHERE directory <> '';
+
+DROP TABLE logs_config;
+
+-- +goose Down
+CREATE TABLE logs_config (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    enabled BOOLEAN NOT NULL DEFAULT 0,
+    directory TEXT NOT NULL DEFAULT '',
+    frequency TEXT NOT NULL DEFAULT 'hours',
+    frequency_value INTEGER NOT NULL DEFAULT 1,
+    last_export DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO logs_config (enabled, directory, frequency, frequency_value, last_export)
+VALUES (0, '', 'hours', 1, NULL);
+
+DROP INDEX IF EXISTS er_job_started;
+DROP TABLE export_runs;
+DROP TABLE export_jobs;
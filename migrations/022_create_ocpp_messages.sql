@@ -0,0 +1,26 @@
+-- +goose Up
+-- Journal of every OCPP frame exchanged with the chargers. identity is the ID the charger connected with,
+-- so frames sent before its BootNotification are kept too. action and latency_ms are filled in on a
+-- CALLRESULT/CALLERROR from the CALL it answers; message_type is null for frames that could not be parsed
+CREATE TABLE ocpp_messages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    identity TEXT NOT NULL,
+    direction TEXT NOT NULL,
+    message_type INTEGER,
+    message_id TEXT,
+    action TEXT,
+    error_code TEXT,
+    latency_ms INTEGER,
+    payload TEXT NOT NULL,
+    ts DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS om_ts ON ocpp_messages(ts);
+CREATE INDEX IF NOT EXISTS om_identity_ts ON ocpp_messages(identity, ts);
+CREATE INDEX IF NOT EXISTS om_message_id ON ocpp_messages(identity, message_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS om_message_id;
+DROP INDEX IF EXISTS om_identity_ts;
+DROP INDEX IF EXISTS om_ts;
+DROP TABLE ocpp_messages;
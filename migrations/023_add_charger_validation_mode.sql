@@ -0,0 +1,7 @@
+-- +goose Up
+-- How strictly the charger's OCPP payloads are checked against the 1.6 JSON schemas:
+-- strict rejects violations with a CALLERROR, lenient logs known vendor quirks and lets them through
+ALTER TABLE chargers ADD COLUMN validation_mode TEXT NOT NULL DEFAULT 'strict';
+
+-- +goose Down
+ALTER TABLE chargers DROP COLUMN validation_mode;
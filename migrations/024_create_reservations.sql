@@ -0,0 +1,28 @@
+-- +goose Up
+-- Connector reservations; id is the reservationId sent to the charger with ReserveNow.
+-- status: pending (ReserveNow sent), active (Accepted), rejected, failed (no answer), cancelled, expired or used;
+-- charger_status keeps the charger's answer and transaction_id the transaction that used the reservation
+CREATE TABLE reservations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    charger_id INTEGER NOT NULL,
+    connector_id INTEGER NOT NULL,
+    id_tag TEXT NOT NULL,
+    parent_id_tag TEXT,
+    expires_at DATETIME NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    charger_status TEXT,
+    error TEXT,
+    transaction_id INTEGER,
+    created_at DATETIME NOT NULL,
+    ended_at DATETIME,
+    FOREIGN KEY (charger_id) REFERENCES chargers(id) ON DELETE CASCADE,
+    FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS res_charger_status ON reservations(charger_id, status);
+CREATE INDEX IF NOT EXISTS res_status_expires ON reservations(status, expires_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS res_status_expires;
+DROP INDEX IF EXISTS res_charger_status;
+DROP TABLE reservations;
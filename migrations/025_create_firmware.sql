@@ -0,0 +1,47 @@
+-- +goose Up
+-- Firmware images uploaded for chargers; the file is kept on disk under stored_name
+CREATE TABLE firmware_files (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    filename TEXT NOT NULL,
+    stored_name TEXT UNIQUE NOT NULL,
+    version TEXT NOT NULL,
+    vendor TEXT,
+    model TEXT,
+    notes TEXT,
+    size INTEGER NOT NULL,
+    sha256 TEXT NOT NULL,
+    md5 TEXT NOT NULL,
+    uploaded_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS fw_sha256 ON firmware_files(sha256);
+
+-- One UpdateFirmware per charger; status is requested (UpdateFirmware answered), failed (not delivered)
+-- or the last FirmwareStatusNotification: Downloading, Downloaded, DownloadFailed, Installing, Installed, InstallationFailed
+CREATE TABLE firmware_updates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    firmware_id INTEGER NOT NULL,
+    charger_id INTEGER NOT NULL,
+    location TEXT NOT NULL,
+    retrieve_date DATETIME NOT NULL,
+    retries INTEGER,
+    retry_interval INTEGER,
+    status TEXT NOT NULL,
+    error TEXT,
+    previous_firmware TEXT,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    completed_at DATETIME,
+    FOREIGN KEY (firmware_id) REFERENCES firmware_files(id) ON DELETE CASCADE,
+    FOREIGN KEY (charger_id) REFERENCES chargers(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS fwu_charger ON firmware_updates(charger_id, id);
+CREATE INDEX IF NOT EXISTS fwu_firmware ON firmware_updates(firmware_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS fwu_firmware;
+DROP INDEX IF EXISTS fwu_charger;
+DROP TABLE firmware_updates;
+DROP INDEX IF EXISTS fw_sha256;
+DROP TABLE firmware_files;
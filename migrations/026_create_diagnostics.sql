@@ -0,0 +1,31 @@
+-- +goose Up
+-- One GetDiagnostics per row; status is requested (GetDiagnostics answered), failed (not delivered, or nothing to upload)
+-- or the last DiagnosticsStatusNotification: Uploading, Uploaded, UploadFailed
+-- The charger uploads to a URL carrying upload_token; the received file is kept on disk under stored_name
+CREATE TABLE diagnostics (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    charger_id INTEGER NOT NULL,
+    upload_token TEXT UNIQUE NOT NULL,
+    location TEXT NOT NULL,
+    start_time DATETIME,
+    stop_time DATETIME,
+    retries INTEGER,
+    retry_interval INTEGER,
+    status TEXT NOT NULL,
+    error TEXT,
+    file_name TEXT,
+    stored_name TEXT,
+    size INTEGER,
+    sha256 TEXT,
+    uploaded_at DATETIME,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    completed_at DATETIME,
+    FOREIGN KEY (charger_id) REFERENCES chargers(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS diag_charger ON diagnostics(charger_id, id);
+
+-- +goose Down
+DROP INDEX IF EXISTS diag_charger;
+DROP TABLE diagnostics;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- The OCPP version the charger last connected with: ocpp1.6 or ocpp2.0.1
+ALTER TABLE chargers ADD COLUMN ocpp_version TEXT;
+
+-- OCPP 2.0.1 chargers name their transactions themselves; tx_id stays our own number
+ALTER TABLE transactions ADD COLUMN ocpp_transaction_id TEXT;
+
+CREATE INDEX IF NOT EXISTS tx_ch_ocpp_tx ON transactions(charger_id, ocpp_transaction_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS tx_ch_ocpp_tx;
+ALTER TABLE transactions DROP COLUMN ocpp_transaction_id;
+ALTER TABLE chargers DROP COLUMN ocpp_version;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- OCPP security profile of the station: 0 none, 1 basic auth, 2 basic auth over TLS, 3 client certificate
+ALTER TABLE chargers ADD COLUMN security_profile INTEGER NOT NULL DEFAULT 0;
+
+-- PBKDF2 hash of the AuthorizationKey the station authenticates with in profiles 1 and 2
+ALTER TABLE chargers ADD COLUMN auth_key_hash TEXT;
+
+-- Refused connection attempts; attempts during a lockout are not recorded
+CREATE TABLE auth_failures (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    identity TEXT NOT NULL,
+    remote_addr TEXT NOT NULL,
+    security_profile INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    locked_out BOOLEAN NOT NULL DEFAULT 0,
+    ts DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS af_ts ON auth_failures(ts);
+CREATE INDEX IF NOT EXISTS af_identity_ts ON auth_failures(identity, ts);
+
+-- +goose Down
+DROP INDEX IF EXISTS af_identity_ts;
+DROP INDEX IF EXISTS af_ts;
+DROP TABLE auth_failures;
+ALTER TABLE chargers DROP COLUMN auth_key_hash;
+ALTER TABLE chargers DROP COLUMN security_profile;
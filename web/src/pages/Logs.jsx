@@ -2,79 +2,189 @@ import React, { useState, useEffect } from 'react';
 import Sidebar from '../partials/Sidebar';
 import Header from '../partials/Header';
 
+const DATASETS = [
+  { value: 'stations', label: 'Stations' },
+  { value: 'sessions', label: 'Sessions' },
+  { value: 'meter_values', label: 'Meter values' },
+  { value: 'status_history', label: 'Status history' },
+  { value: 'ocpp_messages', label: 'OCPP messages' },
+];
+
+const FORMATS = [
+  { value: 'csv', label: 'CSV' },
+  { value: 'jsonl', label: 'JSON Lines' },
+  { value: 'xlsx', label: 'Excel (XLSX)' },
+];
+
+const emptyJob = {
+  name: '',
+  dataset: 'sessions',
+  format: 'csv',
+  directory: '',
+  frequency: 'hours',
+  frequency_value: 1,
+  window: 'since_last_run',
+  keep_files: 0,
+  keep_days: 0,
+  enabled: true,
+};
+
+const formatTime = (value) => (value ? new Date(value).toLocaleString() : '-');
+
+const statusClass = (status) => {
+  switch (status) {
+    case 'success':
+      return 'text-green-600 dark:text-green-400';
+    case 'failed':
+      return 'text-red-600 dark:text-red-400';
+    default:
+      return 'text-yellow-600 dark:text-yellow-400';
+  }
+};
+
 function Logs() {
   const [sidebarOpen, setSidebarOpen] = useState(false);
-  const [logsConfig, setLogsConfig] = useState({
-    enabled: false,
-    directory: '',
-    frequency: 'hours',
-    frequency_value: 1,
-    lastExport: null
-  });
-
-  // Fetch logs configuration on component mount
-  useEffect(() => {
-    const fetchConfig = async () => {
-      try {
-        const response = await fetch('/api/logs/config');
-        if (response.ok) {
-          const config = await response.json();
-          setLogsConfig(config);
-        }
-      } catch (error) {
-        console.error('Failed to fetch logs config:', error);
+  const [jobs, setJobs] = useState([]);
+  const [runs, setRuns] = useState([]);
+  const [form, setForm] = useState(emptyJob);
+  const [editingId, setEditingId] = useState(null);
+  const [download, setDownload] = useState({ dataset: 'stations', format: 'csv' });
+
+  const fetchJobs = async () => {
+    try {
+      const [jobsResponse, runsResponse] = await Promise.all([
+        fetch('/api/logs/exports'),
+        fetch('/api/logs/runs?limit=20'),
+      ]);
+      if (jobsResponse.ok) {
+        setJobs(await jobsResponse.json());
+      }
+      if (runsResponse.ok) {
+        setRuns(await runsResponse.json());
       }
-    };
+    } catch (error) {
+      console.error('Failed to fetch export jobs:', error);
+    }
+  };
 
-    fetchConfig();
+  // Fetch the jobs on mount and refresh the run history every 30 seconds
+  useEffect(() => {
+    fetchJobs();
+    const interval = setInterval(fetchJobs, 30000);
+    return () => clearInterval(interval);
   }, []);
 
   const handleInputChange = (e) => {
     const { name, value, type, checked } = e.target;
-    setLogsConfig(prev => ({
-      ...prev,
-      [name]: type === 'checkbox' ? checked : (name === 'frequency_value' ? parseInt(value) || 1 : value)
-    }));
+    setForm(prev => {
+      const next = {
+        ...prev,
+        [name]: type === 'checkbox' ? checked : (type === 'number' ? parseInt(value) || 0 : value)
+      };
+      // Stations are a snapshot of the current state, so every export holds all of them
+      if (name === 'dataset' && value === 'stations') {
+        next.window = 'full';
+      }
+      return next;
+    });
+  };
+
+  const handleEdit = (job) => {
+    setEditingId(job.id);
+    setForm({
+      name: job.name,
+      dataset: job.dataset,
+      format: job.format,
+      directory: job.directory,
+      frequency: job.frequency,
+      frequency_value: job.frequency_value,
+      window: job.window,
+      keep_files: job.keep_files,
+      keep_days: job.keep_days,
+      enabled: job.enabled,
+    });
   };
 
-  const handleSaveConfig = async (e) => {
+  const handleCancel = () => {
+    setEditingId(null);
+    setForm(emptyJob);
+  };
+
+  const handleSaveJob = async (e) => {
     e.preventDefault();
     try {
-      const response = await fetch('/api/logs/config', {
-        method: 'PUT',
+      const response = await fetch(editingId ? `/api/logs/exports/${editingId}` : '/api/logs/exports', {
+        method: editingId ? 'PUT' : 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
-        body: JSON.stringify(logsConfig),
+        body: JSON.stringify(form),
       });
 
       if (response.ok) {
-        alert('Configuration saved successfully!');
+        handleCancel();
+        fetchJobs();
       } else {
-        alert('Failed to save configuration');
+        alert(`Failed to save export job: ${await response.text()}`);
       }
     } catch (error) {
-      console.error('Error saving config:', error);
-      alert('Error saving configuration');
+      console.error('Error saving export job:', error);
+      alert('Error saving export job');
     }
   };
 
-  const handleDownloadCSV = async () => {
+  const handleDelete = async (job) => {
+    if (!window.confirm(`Delete export job "${job.name}"? Files it wrote are kept.`)) {
+      return;
+    }
     try {
-      const response = await fetch('/api/logs/download', { method: 'POST' });
+      const response = await fetch(`/api/logs/exports/${job.id}`, { method: 'DELETE' });
+      if (response.ok) {
+        if (editingId === job.id) {
+          handleCancel();
+        }
+        fetchJobs();
+      } else {
+        alert('Failed to delete export job');
+      }
+    } catch (error) {
+      console.error('Error deleting export job:', error);
+    }
+  };
+
+  const handleRunNow = async (job) => {
+    try {
+      const response = await fetch(`/api/logs/exports/${job.id}/run`, { method: 'POST' });
+      if (response.ok) {
+        const run = await response.json();
+        if (run.status === 'failed') {
+          alert(`Export failed: ${run.error}`);
+        }
+      } else {
+        alert(`Failed to run export job: ${await response.text()}`);
+      }
+      fetchJobs();
+    } catch (error) {
+      console.error('Error running export job:', error);
+    }
+  };
+
+  const handleDownload = async () => {
+    try {
+      const params = new URLSearchParams(download);
+      const response = await fetch(`/api/logs/download?${params}`);
       if (response.ok) {
         const blob = await response.blob();
         const url = window.URL.createObjectURL(blob);
         const a = document.createElement('a');
         a.href = url;
-        a.download = 'stations_log.csv';
+        a.download = `${download.dataset}.${download.format}`;
         document.body.appendChild(a);
         a.click();
         window.URL.revokeObjectURL(url);
         document.body.removeChild(a);
-        alert('CSV downloaded successfully!');
       } else {
-        alert('Failed to download CSV');
+        alert(`Download failed: ${await response.text()}`);
       }
     } catch (error) {
       console.error('Download failed:', error);
@@ -82,6 +192,8 @@ function Logs() {
     }
   };
 
+  const datasetLabel = (value) => (DATASETS.find(d => d.value === value) || { label: value }).label;
+
   return (
     <div className="flex h-screen overflow-hidden">
       {/* Sidebar */}
@@ -93,113 +205,252 @@ function Logs() {
         <Header sidebarOpen={sidebarOpen} setSidebarOpen={setSidebarOpen} />
 
         <main className="grow">
-          <div className="px-4 sm:px-6 lg:px-8 py-8 w-full max-w-4xl mx-auto">
+          <div className="px-4 sm:px-6 lg:px-8 py-8 w-full max-w-6xl mx-auto">
             {/* Page header */}
             <div className="mb-8">
               <h1 className="text-2xl md:text-3xl text-gray-800 dark:text-gray-100 font-bold">Logs</h1>
-              <p className="text-gray-600 dark:text-gray-400 mt-2">Configure CSV log exports and download station data</p>
+              <p className="text-gray-600 dark:text-gray-400 mt-2">Schedule exports of station data and follow their runs</p>
             </div>
 
-            {/* Configuration Form */}
+            {/* Export jobs */}
             <div className="bg-white dark:bg-gray-800 shadow-lg rounded-lg">
               <div className="px-6 py-4 border-b border-gray-200 dark:border-gray-700">
-                <h2 className="text-lg font-semibold text-gray-800 dark:text-gray-100">Logs Configuration</h2>
+                <h2 className="text-lg font-semibold text-gray-800 dark:text-gray-100">Export Jobs</h2>
               </div>
-              
-              <form onSubmit={handleSaveConfig} className="p-6 space-y-6">
-                {/* Enable Logs */}
-                <div className="flex items-center">
-                  <input
-                    type="checkbox"
-                    id="enabled"
-                    name="enabled"
-                    checked={logsConfig.enabled}
-                    onChange={handleInputChange}
-                    className="h-4 w-4 text-blue-600 focus:ring-blue-500 border-gray-300 rounded"
-                  />
-                  <label htmlFor="enabled" className="ml-2 block text-sm font-medium text-gray-700 dark:text-gray-300">
-                    Enable automatic CSV log exports
-                  </label>
+              <div className="overflow-x-auto">
+                <table className="table-auto w-full text-sm">
+                  <thead className="text-xs uppercase text-gray-500 dark:text-gray-400 bg-gray-50 dark:bg-gray-700/50">
+                    <tr>
+                      <th className="px-4 py-3 text-left">Name</th>
+                      <th className="px-4 py-3 text-left">Dataset</th>
+                      <th className="px-4 py-3 text-left">Every</th>
+                      <th className="px-4 py-3 text-left">Last run</th>
+                      <th className="px-4 py-3 text-left">Next run</th>
+                      <th className="px-4 py-3 text-right">Actions</th>
+                    </tr>
+                  </thead>
+                  <tbody className="divide-y divide-gray-100 dark:divide-gray-700/60 text-gray-700 dark:text-gray-300">
+                    {jobs.length === 0 && (
+                      <tr>
+                        <td colSpan="6" className="px-4 py-6 text-center text-gray-500">No export jobs yet</td>
+                      </tr>
+                    )}
+                    {jobs.map(job => (
+                      <tr key={job.id}>
+                        <td className="px-4 py-3">
+                          <div className="font-medium">{job.name}</div>
+                          <div className="text-xs text-gray-500">{job.directory}</div>
+                        </td>
+                        <td className="px-4 py-3">{datasetLabel(job.dataset)} ({job.format})</td>
+                        <td className="px-4 py-3">{job.frequency_value} {job.frequency}</td>
+                        <td className="px-4 py-3">
+                          {job.last_run ? (
+                            <span className={statusClass(job.last_run.status)} title={job.last_run.error || ''}>
+                              {job.last_run.status} · {formatTime(job.last_run.started_at)}
+                            </span>
+                          ) : '-'}
+                        </td>
+                        <td className="px-4 py-3">{job.enabled ? formatTime(job.next_run_at) : 'Disabled'}</td>
+                        <td className="px-4 py-3 text-right whitespace-nowrap">
+                          <button onClick={() => handleRunNow(job)} className="text-blue-600 hover:text-blue-700 mr-3">Run now</button>
+                          <button onClick={() => handleEdit(job)} className="text-gray-600 hover:text-gray-800 dark:text-gray-300 mr-3">Edit</button>
+                          <button onClick={() => handleDelete(job)} className="text-red-600 hover:text-red-700">Delete</button>
+                        </td>
+                      </tr>
+                    ))}
+                  </tbody>
+                </table>
+              </div>
+            </div>
+
+            {/* Job form */}
+            <div className="mt-8 bg-white dark:bg-gray-800 shadow-lg rounded-lg">
+              <div className="px-6 py-4 border-b border-gray-200 dark:border-gray-700">
+                <h2 className="text-lg font-semibold text-gray-800 dark:text-gray-100">
+                  {editingId ? 'Edit Export Job' : 'New Export Job'}
+                </h2>
+              </div>
+
+              <form onSubmit={handleSaveJob} className="p-6 grid grid-cols-1 md:grid-cols-2 gap-6">
+                <div>
+                  <label className="block text-gray-700 dark:text-gray-300 text-sm font-bold mb-2" htmlFor="name">Name</label>
+                  <input type="text" id="name" name="name" value={form.name} onChange={handleInputChange} className="form-input w-full" required />
                 </div>
 
-                {/* Directory */}
                 <div>
-                  <label className="block text-gray-700 dark:text-gray-300 text-sm font-bold mb-2" htmlFor="directory">
-                    Save Directory
-                  </label>
+                  <label className="block text-gray-700 dark:text-gray-300 text-sm font-bold mb-2" htmlFor="directory">Save Directory</label>
                   <input
                     type="text"
                     id="directory"
                     name="directory"
-                    value={logsConfig.directory}
+                    value={form.directory}
                     onChange={handleInputChange}
                     className="form-input w-full"
                     placeholder="C:\logs"
-                    disabled={!logsConfig.enabled}
+                    required
                   />
-                  <div className="mt-1">
-                    <p className="text-xs text-gray-500 dark:text-gray-400">
-                      <strong>Type the full directory path (e.g., C:\logs).</strong> The directory will be created automatically if it doesn't exist.
-                    </p>
-                  </div>
+                  <p className="mt-1 text-xs text-gray-500 dark:text-gray-400">
+                    Full directory path on the server; it is created if it doesn't exist.
+                  </p>
                 </div>
 
-                {/* Frequency */}
                 <div>
-                  <label className="block text-gray-700 dark:text-gray-300 text-sm font-bold mb-2" htmlFor="frequency">
-                    Export Frequency
-                  </label>
+                  <label className="block text-gray-700 dark:text-gray-300 text-sm font-bold mb-2" htmlFor="dataset">Dataset</label>
+                  <select id="dataset" name="dataset" value={form.dataset} onChange={handleInputChange} className="form-select w-full">
+                    {DATASETS.map(d => <option key={d.value} value={d.value}>{d.label}</option>)}
+                  </select>
+                </div>
+
+                <div>
+                  <label className="block text-gray-700 dark:text-gray-300 text-sm font-bold mb-2" htmlFor="format">Format</label>
+                  <select id="format" name="format" value={form.format} onChange={handleInputChange} className="form-select w-full">
+                    {FORMATS.map(f => <option key={f.value} value={f.value}>{f.label}</option>)}
+                  </select>
+                </div>
+
+                <div>
+                  <label className="block text-gray-700 dark:text-gray-300 text-sm font-bold mb-2" htmlFor="frequency">Export Every</label>
                   <div className="flex gap-2">
-                    <select
-                      id="frequency"
-                      name="frequency"
-                      value={logsConfig.frequency}
-                      onChange={handleInputChange}
-                      className="form-select flex-1"
-                    >
-                      <option value="seconds">Seconds</option>
-                      <option value="minutes">Minutes</option>
-                      <option value="hours">Hours</option>
-                    </select>
                     <input
                       type="number"
                       id="frequency_value"
                       name="frequency_value"
-                      value={logsConfig.frequency_value}
+                      value={form.frequency_value}
                       onChange={handleInputChange}
                       className="form-input w-20"
                       min="1"
-                      max="999"
                     />
+                    <select id="frequency" name="frequency" value={form.frequency} onChange={handleInputChange} className="form-select flex-1">
+                      <option value="minutes">Minutes</option>
+                      <option value="hours">Hours</option>
+                      <option value="days">Days</option>
+                    </select>
                   </div>
                 </div>
 
-                {/* Save Button */}
-                <div className="flex justify-end">
-                  <button
-                    type="submit"
-                    className="btn bg-blue-500 hover:bg-blue-600 text-white px-6 py-2 rounded-lg"
+                <div>
+                  <label className="block text-gray-700 dark:text-gray-300 text-sm font-bold mb-2" htmlFor="window">Rows</label>
+                  <select
+                    id="window"
+                    name="window"
+                    value={form.window}
+                    onChange={handleInputChange}
+                    className="form-select w-full"
+                    disabled={form.dataset === 'stations'}
                   >
-                    Save Configuration
+                    <option value="since_last_run">Since the last successful run</option>
+                    <option value="full">Everything, every run</option>
+                  </select>
+                </div>
+
+                <div>
+                  <label className="block text-gray-700 dark:text-gray-300 text-sm font-bold mb-2">Keep Files</label>
+                  <div className="flex gap-2 items-center text-sm text-gray-600 dark:text-gray-400">
+                    <input type="number" name="keep_files" value={form.keep_files} onChange={handleInputChange} className="form-input w-20" min="0" />
+                    <span>newest files</span>
+                    <input type="number" name="keep_days" value={form.keep_days} onChange={handleInputChange} className="form-input w-20" min="0" />
+                    <span>days</span>
+                  </div>
+                  <p className="mt-1 text-xs text-gray-500 dark:text-gray-400">0 keeps every file.</p>
+                </div>
+
+                <div className="flex items-center">
+                  <input
+                    type="checkbox"
+                    id="enabled"
+                    name="enabled"
+                    checked={form.enabled}
+                    onChange={handleInputChange}
+                    className="h-4 w-4 text-blue-600 focus:ring-blue-500 border-gray-300 rounded"
+                  />
+                  <label htmlFor="enabled" className="ml-2 block text-sm font-medium text-gray-700 dark:text-gray-300">
+                    Run on schedule
+                  </label>
+                </div>
+
+                <div className="md:col-span-2 flex justify-end gap-2">
+                  {editingId && (
+                    <button type="button" onClick={handleCancel} className="btn border-gray-300 text-gray-700 dark:text-gray-300 px-6 py-2 rounded-lg">
+                      Cancel
+                    </button>
+                  )}
+                  <button type="submit" className="btn bg-blue-500 hover:bg-blue-600 text-white px-6 py-2 rounded-lg">
+                    {editingId ? 'Save Job' : 'Create Job'}
                   </button>
                 </div>
               </form>
             </div>
 
+            {/* Run history */}
+            <div className="mt-8 bg-white dark:bg-gray-800 shadow-lg rounded-lg">
+              <div className="px-6 py-4 border-b border-gray-200 dark:border-gray-700">
+                <h2 className="text-lg font-semibold text-gray-800 dark:text-gray-100">Recent Runs</h2>
+              </div>
+              <div className="overflow-x-auto">
+                <table className="table-auto w-full text-sm">
+                  <thead className="text-xs uppercase text-gray-500 dark:text-gray-400 bg-gray-50 dark:bg-gray-700/50">
+                    <tr>
+                      <th className="px-4 py-3 text-left">Started</th>
+                      <th className="px-4 py-3 text-left">Job</th>
+                      <th className="px-4 py-3 text-left">Trigger</th>
+                      <th className="px-4 py-3 text-left">Status</th>
+                      <th className="px-4 py-3 text-right">Rows</th>
+                      <th className="px-4 py-3 text-left">File</th>
+                    </tr>
+                  </thead>
+                  <tbody className="divide-y divide-gray-100 dark:divide-gray-700/60 text-gray-700 dark:text-gray-300">
+                    {runs.length === 0 && (
+                      <tr>
+                        <td colSpan="6" className="px-4 py-6 text-center text-gray-500">No runs yet</td>
+                      </tr>
+                    )}
+                    {runs.map(run => (
+                      <tr key={run.id}>
+                        <td className="px-4 py-3 whitespace-nowrap">{formatTime(run.started_at)}</td>
+                        <td className="px-4 py-3">{run.job_name}</td>
+                        <td className="px-4 py-3">{run.triggered_by}</td>
+                        <td className={`px-4 py-3 ${statusClass(run.status)}`}>
+                          {run.status}
+                          {run.error && <div className="text-xs">{run.error}</div>}
+                        </td>
+                        <td className="px-4 py-3 text-right">{run.rows ?? '-'}</td>
+                        <td className="px-4 py-3">
+                          {run.file && !run.file_deleted_at ? (
+                            <a href={`/api/logs/runs/${run.id}/file`} className="text-blue-600 hover:text-blue-700">Download</a>
+                          ) : (run.file_deleted_at ? 'Deleted by retention' : '-')}
+                        </td>
+                      </tr>
+                    ))}
+                  </tbody>
+                </table>
+              </div>
+            </div>
+
             {/* Download Section */}
             <div className="mt-8 bg-white dark:bg-gray-800 shadow-lg rounded-lg">
               <div className="px-6 py-4 border-b border-gray-200 dark:border-gray-700">
-                <h2 className="text-lg font-semibold text-gray-800 dark:text-gray-100">Download CSV</h2>
+                <h2 className="text-lg font-semibold text-gray-800 dark:text-gray-100">Download Now</h2>
               </div>
-              <div className="p-6">
-                <p className="text-gray-600 dark:text-gray-400 mb-4">
-                  Download a CSV file with current station data.
-                </p>
+              <div className="p-6 flex flex-wrap gap-2 items-center">
+                <select
+                  value={download.dataset}
+                  onChange={(e) => setDownload(prev => ({ ...prev, dataset: e.target.value }))}
+                  className="form-select"
+                >
+                  {DATASETS.map(d => <option key={d.value} value={d.value}>{d.label}</option>)}
+                </select>
+                <select
+                  value={download.format}
+                  onChange={(e) => setDownload(prev => ({ ...prev, format: e.target.value }))}
+                  className="form-select"
+                >
+                  {FORMATS.map(f => <option key={f.value} value={f.value}>{f.label}</option>)}
+                </select>
                 <button
-                  onClick={handleDownloadCSV}
+                  onClick={handleDownload}
                   className="btn bg-green-500 hover:bg-green-600 text-white px-6 py-2 rounded-lg"
                 >
-                  Download CSV Now
+                  Download
                 </button>
               </div>
             </div>
@@ -210,4 +461,4 @@ function Logs() {
   );
 }
 
-export default Logs;
\ No newline at end of file
+export default Logs;
@@ -20,6 +20,7 @@ function Stations() {
   const modelRef = useRef(null);
   const vendorRef = useRef(null);
   const maxOutputRef = useRef(null);
+  const validationModeRef = useRef(null);
 
   const fetchStations = useCallback(async () => {
     try {
@@ -107,7 +108,8 @@ function Stations() {
         name: nameRef.current.value || null,
         model: modelRef.current.value || null,
         vendor: vendorRef.current.value || null,
-        max_output_kw: maxOutputRef.current.value ? parseFloat(maxOutputRef.current.value) : null
+        max_output_kw: maxOutputRef.current.value ? parseFloat(maxOutputRef.current.value) : null,
+        validation_mode: validationModeRef.current.value
       };
 
       const response = await fetch(`/api/stations/${editingStation.id}`, {
@@ -160,6 +162,7 @@ function Stations() {
     if (modelRef.current) modelRef.current.value = station.model || '';
     if (vendorRef.current) vendorRef.current.value = station.vendor || '';
     if (maxOutputRef.current) maxOutputRef.current.value = station.max_output_kw ? station.max_output_kw.toString() : '';
+    if (validationModeRef.current) validationModeRef.current.value = station.validation_mode || 'strict';
     setShowEditModal(true);
   };
 
@@ -533,6 +536,21 @@ function Stations() {
                   step="0.1"
                 />
               </div>
+              <div className="mb-4">
+                <label className="block text-gray-700 dark:text-gray-300 text-sm font-bold mb-2" htmlFor="edit-validation_mode">
+                  OCPP Validation
+                </label>
+                <select
+                  ref={validationModeRef}
+                  id="edit-validation_mode"
+                  name="validation_mode"
+                  className="form-select w-full"
+                  defaultValue={editingStation?.validation_mode || 'strict'}
+                >
+                  <option value="strict">Strict - reject payloads that break the schema</option>
+                  <option value="lenient">Lenient - log known vendor quirks and accept them</option>
+                </select>
+              </div>
               <div className="flex justify-end">
                 <button
                   type="button"